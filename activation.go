@@ -0,0 +1,98 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+)
+
+// https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/HTMLDocuments/WS-Management_Class_Reference/IPS_HostBasedSetupService.htm
+const netAdminPassEncryptionTypeHTTPDigestMD5A1 = "2"
+
+func getDigestRealm(ctx context.Context, client *Client) (string, error) {
+	resource := client.resourceURI(ResourceAMTGeneralSettings)
+	response, err := client.send(ctx, client.wsManClient.Get(resource))
+	if err != nil {
+		return "", err
+	}
+	realm := client.namespaces.firstTag("DigestRealm", resource, response.AllBodyElements())
+	if realm == nil {
+		return "", fmt.Errorf("response was missing the AMT_GeneralSettings DigestRealm")
+	}
+	return string(realm.Content), nil
+}
+
+func activateClientControlMode(ctx context.Context, client *Client, adminPassword string) error {
+	return activate(ctx, client, adminPassword, nil)
+}
+
+// applyClientControlMode activates client control mode unless the firmware
+// already is in it, returning the conditions of the steps.
+func applyClientControlMode(ctx context.Context, client *Client, adminPassword string) (ApplyResult, error) {
+	result := ApplyResult{}
+	var conditions []Condition
+	done := func(err error) (ApplyResult, error) {
+		result.Conditions = SetCondition(conditions, readyCondition(result, err, client.clock.Now()))
+		return result, err
+	}
+	setup, err := getInstance(ctx, client, client.resourceURI(ResourceIPSHostBasedSetupService), "CurrentControlMode")
+	if err != nil {
+		return done(err)
+	}
+	current := propertyContent(setup, "CurrentControlMode")
+	switch mode := controlModes[current]; mode {
+	case ControlModeClient:
+		return done(nil)
+	case ControlModeNone:
+	case ControlModeUnknown:
+		return done(fmt.Errorf("unknown control mode %q", current))
+	default:
+		return done(fmt.Errorf("the firmware already is in %s", mode))
+	}
+
+	err = activate(ctx, client, adminPassword, func(step string, err error) {
+		reason := ReasonApplied
+		if err != nil {
+			reason = ReasonFailed
+		}
+		conditions = SetCondition(conditions, stepCondition(step, reason, err, client.clock.Now()))
+	})
+	if err == nil {
+		result.add("client control mode")
+	}
+	return done(err)
+}
+
+// activate activates client control mode, calling record, when set, with
+// the outcome of each step.
+func activate(ctx context.Context, client *Client, adminPassword string, record func(step string, err error)) error {
+	if err := ValidateAMTPassword(adminPassword); err != nil {
+		return err
+	}
+	step := func(name string, fn func() error) error {
+		err := client.step(OperationActivate, name, fn)
+		if record != nil {
+			record(name, err)
+		}
+		return err
+	}
+	var realm string
+	err := step("digest realm", func() (err error) {
+		realm, err = getDigestRealm(ctx, client)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// the firmware only accepts the password as the digest A1 hash of the admin user.
+	hash := md5Hex("admin:" + realm + ":" + adminPassword)
+
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceIPSHostBasedSetupService), "Setup")
+	message.Parameters(
+		"NetAdminPassEncryptionType", netAdminPassEncryptionTypeHTTPDigestMD5A1,
+		"NetworkAdminPassword", hash,
+	)
+	return step("setup", func() error {
+		_, err := sendMessageForReturnValueInt(ctx, client, message)
+		return client.redact(err, adminPassword, hash)
+	})
+}
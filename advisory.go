@@ -0,0 +1,142 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// advisory is a known AMT vulnerability and the firmware it affects.
+type advisory struct {
+	id   string
+	cves []string
+	// minVersion is inclusive, maxVersion is exclusive, as in knownQuirks.
+	minVersion string
+	maxVersion string
+	// fixed are the first fixed versions, with their build number, of the
+	// branches that got a fix. Branches without one stay affected.
+	fixed []string
+	// remote is set when the attack needs a provisioned firmware reachable
+	// over the network.
+	remote bool
+}
+
+// knownAdvisories are checked by CheckAdvisories.
+var knownAdvisories = []advisory{
+	{
+		// authentication bypass of the web server, the digest response was
+		// compared on the length sent by the client.
+		id:         "INTEL-SA-00075",
+		cves:       []string{"CVE-2017-5689"},
+		minVersion: "6.0",
+		maxVersion: "11.7",
+		fixed:      []string{"6.2.61.3535", "7.1.91.3272", "8.1.71.3608", "9.1.41.3024", "9.5.61.3012", "10.0.55.3000", "11.0.25.3001", "11.6.27.3264"},
+		remote:     true,
+	},
+}
+
+// AdvisoryExposure tells whether a machine is exposed to a known AMT
+// vulnerability.
+type AdvisoryExposure struct {
+	// Advisory is the Intel security advisory, e.g. "INTEL-SA-00075".
+	Advisory string
+	CVEs     []string
+	// Vulnerable is true when the firmware version is affected.
+	Vulnerable bool
+	// Exposed is true when the firmware is vulnerable and the preconditions
+	// of the attack are met, e.g. it is provisioned and its network
+	// interface enabled. Update the firmware of these machines first.
+	Exposed bool
+	// Reasons explain the verdict.
+	Reasons []string
+}
+
+// firmwareState is what the advisories depend on.
+type firmwareState struct {
+	// version is the version of the firmware with its build number, e.g.
+	// "11.8.50.3425".
+	version     string
+	provisioned bool
+	// network is true when the network interface of the firmware is enabled.
+	network bool
+}
+
+func checkAdvisories(ctx context.Context, client *Client) ([]AdvisoryExposure, error) {
+	identities, err := getSoftwareIdentities(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	state := firmwareState{}
+	var build string
+	for _, identity := range identities {
+		switch identity.InstanceID {
+		case amtSoftwareIdentity:
+			state.version = identity.Version
+		case "Build Number":
+			build = identity.Version
+		}
+	}
+	if state.version == "" {
+		return nil, fmt.Errorf("could not find the %s software identity", amtSoftwareIdentity)
+	}
+	if build != "" {
+		state.version += "." + build
+	}
+
+	setup, err := getInstance(ctx, client, client.resourceURI(ResourceAMTSetupAndConfigurationService), "ProvisioningState")
+	if err != nil {
+		return nil, err
+	}
+	state.provisioned = propertyContent(setup, "ProvisioningState") == provisioningStatePost
+	general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings))
+	if err != nil {
+		return nil, err
+	}
+	// firmware without the property has its network interface always on.
+	state.network = propertyContent(general, "NetworkInterfaceEnabled") != "false"
+
+	exposures := make([]AdvisoryExposure, 0, len(knownAdvisories))
+	for _, a := range knownAdvisories {
+		exposures = append(exposures, a.check(state))
+	}
+	return exposures, nil
+}
+
+func (a advisory) check(state firmwareState) AdvisoryExposure {
+	exposure := AdvisoryExposure{Advisory: a.id, CVEs: a.cves}
+	exposure.Vulnerable = a.affects(state.version)
+	if !exposure.Vulnerable {
+		exposure.Reasons = append(exposure.Reasons, "version "+state.version+" is not affected")
+		return exposure
+	}
+	exposure.Reasons = append(exposure.Reasons, "version "+state.version+" is affected")
+	exposure.Exposed = true
+	if a.remote && !state.provisioned {
+		exposure.Exposed = false
+		exposure.Reasons = append(exposure.Reasons, "the firmware is not provisioned")
+	}
+	if a.remote && !state.network {
+		exposure.Exposed = false
+		exposure.Reasons = append(exposure.Reasons, "the network interface of the firmware is disabled")
+	}
+	return exposure
+}
+
+// affects reports whether version, with its build number, is affected.
+func (a advisory) affects(version string) bool {
+	if compareVersions(version, a.minVersion) < 0 || compareVersions(version, a.maxVersion) >= 0 {
+		return false
+	}
+	for _, fixed := range a.fixed {
+		if sameBranch(version, fixed) {
+			return compareVersions(version, fixed) < 0
+		}
+	}
+	return true
+}
+
+// sameBranch reports whether the major and minor versions of a and b match.
+func sameBranch(a, b string) bool {
+	as, bs := strings.SplitN(a, ".", 3), strings.SplitN(b, ".", 3)
+	return len(as) >= 2 && len(bs) >= 2 && as[0] == bs[0] && as[1] == bs[1]
+}
@@ -0,0 +1,28 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdvisoryAffects_When_SA00075Versions_Expect_FixedBuildsExcluded(t *testing.T) {
+	sa00075 := knownAdvisories[0]
+	assert.True(t, sa00075.affects("9.1.41.3023"))
+	assert.False(t, sa00075.affects("9.1.41.3024"))
+	// 9.0 never got a fix.
+	assert.True(t, sa00075.affects("9.0.30.1482"))
+	assert.False(t, sa00075.affects("5.2.70.1000"))
+	assert.False(t, sa00075.affects("11.8.50.3425"))
+}
+
+func TestAdvisoryCheck_When_NotProvisioned_Expect_VulnerableButNotExposed(t *testing.T) {
+	sa00075 := knownAdvisories[0]
+	exposure := sa00075.check(firmwareState{version: "8.1.40.1416", network: true})
+	assert.True(t, exposure.Vulnerable)
+	assert.False(t, exposure.Exposed)
+	assert.Contains(t, exposure.Reasons, "the firmware is not provisioned")
+
+	exposure = sa00075.check(firmwareState{version: "8.1.40.1416", provisioned: true, network: true})
+	assert.True(t, exposure.Exposed)
+}
@@ -0,0 +1,137 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+)
+
+// Alarm is an IPS_AlarmClockOccurrence, a scheduled power on of the machine.
+type Alarm struct {
+	InstanceID  string
+	ElementName string
+	// StartTime is the first time the alarm goes off.
+	StartTime time.Time
+	// Interval repeats the alarm, 0 for a single occurrence.
+	Interval           time.Duration
+	DeleteOnCompletion bool
+}
+
+func getAlarms(ctx context.Context, client *Client) ([]Alarm, error) {
+	items, err := enumerate(ctx, client, client.resourceURI(ResourceIPSAlarmClockOccurrence))
+	if err != nil {
+		return nil, err
+	}
+	alarms := make([]Alarm, 0, len(items))
+	for _, item := range items {
+		a, err := parseAlarm(item.Children())
+		if err != nil {
+			return nil, err
+		}
+		alarms = append(alarms, *a)
+	}
+	return alarms, nil
+}
+
+func parseAlarm(properties []*dom.Element) (*Alarm, error) {
+	a := &Alarm{
+		InstanceID:         propertyContent(properties, "InstanceID"),
+		ElementName:        propertyContent(properties, "ElementName"),
+		DeleteOnCompletion: propertyContent(properties, "DeleteOnCompletion") == "true",
+	}
+	// StartTime and Interval wrap a cim:Datetime and a cim:Interval.
+	if start := search.FirstTag("StartTime", "*", properties); start != nil {
+		if datetime := search.FirstTag("Datetime", "*", start.Children()); datetime != nil {
+			t, err := time.Parse(time.RFC3339, string(datetime.Content))
+			if err != nil {
+				return nil, fmt.Errorf("alarm %s: %v", a.InstanceID, err)
+			}
+			a.StartTime = t
+		}
+	}
+	if interval := search.FirstTag("Interval", "*", properties); interval != nil {
+		if duration := search.FirstTag("Interval", "*", interval.Children()); duration != nil {
+			d, err := parseXSDuration(string(duration.Content))
+			if err != nil {
+				return nil, fmt.Errorf("alarm %s: %v", a.InstanceID, err)
+			}
+			a.Interval = d
+		}
+	}
+	return a, nil
+}
+
+var xsDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseXSDuration parses the days and time of an xs:duration, e.g. "P1DT12H".
+// The firmware does not use years or months.
+func parseXSDuration(s string) (time.Duration, error) {
+	m := xsDuration.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported duration %q", s)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+func deleteAlarm(ctx context.Context, client *Client, instanceID string) error {
+	message := client.wsManClient.Delete(client.resourceURI(ResourceIPSAlarmClockOccurrence))
+	message.Selectors("InstanceID", instanceID)
+	_, err := client.send(ctx, message)
+	return err
+}
+
+// StaleAlarms returns the alarms that will not go off anymore after now and
+// the duplicates of others with the same StartTime and Interval. Of a set of
+// duplicates the alarm with the smallest InstanceID is kept.
+func StaleAlarms(alarms []Alarm, now time.Time) []Alarm {
+	sorted := append([]Alarm{}, alarms...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].InstanceID < sorted[j].InstanceID })
+
+	type schedule struct {
+		start    time.Time
+		interval time.Duration
+	}
+	seen := map[schedule]bool{}
+	stale := []Alarm{}
+	for _, a := range sorted {
+		key := schedule{a.StartTime.UTC(), a.Interval}
+		if (a.Interval == 0 && a.StartTime.Before(now)) || seen[key] {
+			stale = append(stale, a)
+			continue
+		}
+		seen[key] = true
+	}
+	return stale
+}
+
+func pruneAlarms(ctx context.Context, client *Client) ([]Alarm, error) {
+	alarms, err := getAlarms(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Alarm{}
+	for _, a := range StaleAlarms(alarms, client.clock.Now()) {
+		if err := deleteAlarm(ctx, client, a.InstanceID); err != nil {
+			return deleted, fmt.Errorf("deleting alarm %s: %v", a.InstanceID, err)
+		}
+		deleted = append(deleted, a)
+	}
+	return deleted, nil
+}
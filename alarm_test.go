@@ -0,0 +1,46 @@
+package amt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAlarm_When_Recurring_Expect_StartTimeAndInterval(t *testing.T) {
+	properties := []*dom.Element{
+		dom.ElemC("InstanceID", ResourceIPSAlarmClockOccurrence, "nightly"),
+		dom.Elem("StartTime", ResourceIPSAlarmClockOccurrence).AddChildren(
+			dom.ElemC("Datetime", "http://schemas.dmtf.org/wbem/wscim/1/common", "2022-06-01T02:00:00Z"),
+		),
+		dom.Elem("Interval", ResourceIPSAlarmClockOccurrence).AddChildren(
+			dom.ElemC("Interval", "http://schemas.dmtf.org/wbem/wscim/1/common", "P1DT0H0M0S"),
+		),
+		dom.ElemC("DeleteOnCompletion", ResourceIPSAlarmClockOccurrence, "false"),
+	}
+	alarm, err := parseAlarm(properties)
+	assert.NoError(t, err)
+	assert.Equal(t, &Alarm{
+		InstanceID: "nightly",
+		StartTime:  time.Date(2022, 6, 1, 2, 0, 0, 0, time.UTC),
+		Interval:   24 * time.Hour,
+	}, alarm)
+}
+
+func TestStaleAlarms_When_ExpiredAndDuplicates_Expect_OnlyThem(t *testing.T) {
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	alarms := []Alarm{
+		{InstanceID: "b", StartTime: future},
+		{InstanceID: "a", StartTime: future},
+		{InstanceID: "expired", StartTime: past},
+		{InstanceID: "recurring", StartTime: past, Interval: time.Hour},
+	}
+	stale := StaleAlarms(alarms, now)
+	ids := []string{}
+	for _, a := range stale {
+		ids = append(ids, a.InstanceID)
+	}
+	assert.Equal(t, []string{"b", "expired"}, ids)
+}
@@ -1,5 +1,31 @@
 package amt
 
+// Resource URIs of the Intel AMT classes used by the client.
 const (
-	resourceAMTBootSettingData = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData"
+	ResourceAMTAgentPresenceWatchdog          = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AgentPresenceWatchdog"
+	ResourceAMTAuthorizationService           = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuthorizationService"
+	ResourceAMTBootCapabilities               = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootCapabilities"
+	ResourceAMTBootSettingData                = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData"
+	ResourceAMT8021xCredentialContext         = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_8021xCredentialContext"
+	ResourceAMTEthernetPortSettings           = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings"
+	ResourceAMTProvisioningCertificateHash    = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_ProvisioningCertificateHash"
+	ResourceAMTPublicKeyCertificate           = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyCertificate"
+	ResourceAMTPublicKeyManagementService     = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicKeyManagementService"
+	ResourceAMTPublicPrivateKeyPair           = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_PublicPrivateKeyPair"
+	ResourceAMTTLSCredentialContext           = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_TLSCredentialContext"
+	ResourceAMTTLSProtocolEndpointCollection  = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_TLSProtocolEndpointCollection"
+	ResourceAMTGeneralSettings                = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings"
+	ResourceAMTManagementPresenceRemoteSAP    = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_ManagementPresenceRemoteSAP"
+	ResourceAMTRemoteAccessPolicyAppliesToMPS = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RemoteAccessPolicyAppliesToMPS"
+	ResourceAMTSetupAndConfigurationService   = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_SetupAndConfigurationService"
+	ResourceAMTUserInitiatedConnectionService = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_UserInitiatedConnectionService"
+	ResourceAMTRedirectionService             = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RedirectionService"
+	ResourceAMTWebUIService                   = "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_WebUIService"
+)
+
+// Resource URIs of the Intel IPS classes used by the client.
+const (
+	ResourceIPSAlarmClockOccurrence  = "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_AlarmClockOccurrence"
+	ResourceIPSHostBasedSetupService = "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_HostBasedSetupService"
+	ResourceIPSOptInService          = "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_OptInService"
 )
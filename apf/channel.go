@@ -0,0 +1,229 @@
+package apf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Channel is a single forwarded connection inside a Session. It implements net.Conn.
+type Channel struct {
+	session    *Session
+	id         uint32
+	address    string
+	port       uint32
+	openResult chan error
+
+	mu            sync.Mutex
+	cond          *sync.Cond
+	peer          uint32
+	peerWindow    uint32
+	buf           bytes.Buffer
+	err           error
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+var _ net.Conn = (*Channel)(nil)
+
+func newChannel(s *Session, id uint32, address string, port uint32) *Channel {
+	c := &Channel{
+		session:    s,
+		id:         id,
+		address:    address,
+		port:       port,
+		openResult: make(chan error, 1),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *Channel) opened(peer uint32, window uint32, err error) {
+	c.mu.Lock()
+	c.peer = peer
+	c.peerWindow = window
+	c.mu.Unlock()
+	c.openResult <- err
+}
+
+func (c *Channel) adjustWindow(n uint32) {
+	c.mu.Lock()
+	c.peerWindow += n
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *Channel) receive(data []byte) {
+	c.mu.Lock()
+	c.buf.Write(data)
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *Channel) peerClosed(err error) {
+	c.mu.Lock()
+	alreadyClosed := c.closed
+	c.closed = true
+	if c.err == nil {
+		c.err = err
+	}
+	peer := c.peer
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	if !alreadyClosed && err == io.EOF {
+		c.session.Send(&ChannelClose{RecipientChannel: peer})
+	}
+}
+
+// wait blocks until woken up or deadline passes. It must be called with c.mu held.
+func (c *Channel) wait(deadline time.Time) error {
+	if deadline.IsZero() {
+		c.cond.Wait()
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+	t := time.AfterFunc(d, c.cond.Broadcast)
+	c.cond.Wait()
+	t.Stop()
+	return nil
+}
+
+// Read reads channel data sent by the peer.
+func (c *Channel) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	for c.buf.Len() == 0 && !c.closed {
+		if err := c.wait(c.readDeadline); err != nil {
+			c.mu.Unlock()
+			return 0, err
+		}
+	}
+	if c.buf.Len() == 0 {
+		err := c.err
+		c.mu.Unlock()
+		return 0, err
+	}
+	n, _ := c.buf.Read(p)
+	peer := c.peer
+	c.mu.Unlock()
+	if err := c.session.Send(&ChannelWindowAdjust{RecipientChannel: peer, BytesToAdd: uint32(n)}); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// Write sends p to the peer, honoring the window it granted.
+func (c *Channel) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		c.mu.Lock()
+		for c.peerWindow == 0 && !c.closed {
+			if err := c.wait(c.writeDeadline); err != nil {
+				c.mu.Unlock()
+				return written, err
+			}
+		}
+		if c.closed {
+			c.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		n := len(p) - written
+		if n > c.session.config.MaxPacket {
+			n = c.session.config.MaxPacket
+		}
+		if uint32(n) > c.peerWindow {
+			n = int(c.peerWindow)
+		}
+		c.peerWindow -= uint32(n)
+		peer := c.peer
+		c.mu.Unlock()
+
+		if err := c.session.Send(&ChannelData{RecipientChannel: peer, Data: p[written : written+n]}); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close the channel.
+func (c *Channel) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.err = errors.New("apf: use of closed channel")
+	peer := c.peer
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	c.session.removeChannel(c.id)
+	return c.session.Send(&ChannelClose{RecipientChannel: peer})
+}
+
+// LocalAddr returns a placeholder address for the local end of the channel.
+func (c *Channel) LocalAddr() net.Addr {
+	return Addr{Host: "127.0.0.1", Port: 0}
+}
+
+// RemoteAddr returns the forwarded address the channel is connected to.
+func (c *Channel) RemoteAddr() net.Addr {
+	return Addr{Host: c.address, Port: c.port}
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Channel) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *Channel) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c *Channel) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	return nil
+}
+
+// Addr is the address of an APF channel endpoint.
+type Addr struct {
+	Host string
+	Port uint32
+}
+
+// Network returns "apf".
+func (a Addr) Network() string {
+	return "apf"
+}
+
+func (a Addr) String() string {
+	return net.JoinHostPort(a.Host, strconv.FormatUint(uint64(a.Port), 10))
+}
+
+func (a Addr) GoString() string {
+	return fmt.Sprintf("apf.Addr{%s}", a.String())
+}
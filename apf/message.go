@@ -0,0 +1,487 @@
+// Package apf implements the Intel AMT Port Forwarding protocol (APF). APF is
+// the SSH-like multiplexing protocol the firmware speaks to LMS over the MEI
+// and to an MPS over a CIRA connection.
+package apf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Message types.
+const (
+	TypeDisconnect              byte = 1
+	TypeServiceRequest          byte = 5
+	TypeServiceAccept           byte = 6
+	TypeUserAuthRequest         byte = 50
+	TypeUserAuthFailure         byte = 51
+	TypeUserAuthSuccess         byte = 52
+	TypeGlobalRequest           byte = 80
+	TypeRequestSuccess          byte = 81
+	TypeRequestFailure          byte = 82
+	TypeChannelOpen             byte = 90
+	TypeChannelOpenConfirmation byte = 91
+	TypeChannelOpenFailure      byte = 92
+	TypeChannelWindowAdjust     byte = 93
+	TypeChannelData             byte = 94
+	TypeChannelClose            byte = 97
+	TypeProtocolVersion         byte = 192
+	TypeKeepAliveRequest        byte = 208
+	TypeKeepAliveReply          byte = 209
+	TypeKeepAliveOptionsRequest byte = 210
+	TypeKeepAliveOptionsReply   byte = 211
+)
+
+// Well known service, request and channel names.
+const (
+	ServiceAuth               = "auth@amt.intel.com"
+	ServicePortForward        = "pfwd@amt.intel.com"
+	RequestTCPIPForward       = "tcpip-forward"
+	RequestCancelTCPIPForward = "cancel-tcpip-forward"
+	RequestUDPSendTo          = "udp-send-to@amt.intel.com"
+	ChannelForwardedTCPIP     = "forwarded-tcpip"
+	ChannelDirectTCPIP        = "direct-tcpip"
+	AuthMethodPassword        = "password"
+)
+
+// Disconnect reason codes.
+const (
+	DisconnectProtocolError       uint32 = 2
+	DisconnectServiceNotAvailable uint32 = 7
+	DisconnectByApplication       uint32 = 11
+)
+
+// Channel open failure codes.
+const (
+	OpenFailureAdministrativelyProhibited uint32 = 1
+	OpenFailureConnectFailed              uint32 = 2
+)
+
+// maxStringLength bounds strings read off the wire so a hostile peer can't
+// make us allocate arbitrary amounts of memory.
+const maxStringLength = 1 << 16
+
+// Message is an APF protocol message.
+type Message interface {
+	// Type returns the message type byte.
+	Type() byte
+	appendPayload(b []byte) []byte
+}
+
+// Marshal encodes m for the wire.
+func Marshal(m Message) []byte {
+	return m.appendPayload([]byte{m.Type()})
+}
+
+// ProtocolVersion is the first message exchanged on a connection.
+type ProtocolVersion struct {
+	Major         uint32
+	Minor         uint32
+	TriggerReason uint32
+	UUID          [16]byte
+}
+
+// Disconnect terminates the connection.
+type Disconnect struct {
+	ReasonCode uint32
+}
+
+// ServiceRequest asks the peer to start a service.
+type ServiceRequest struct {
+	Service string
+}
+
+// ServiceAccept accepts a ServiceRequest.
+type ServiceAccept struct {
+	Service string
+}
+
+// UserAuthRequest authenticates the device to an MPS.
+type UserAuthRequest struct {
+	Username string
+	Service  string
+	Method   string
+	Password string
+}
+
+// UserAuthFailure rejects a UserAuthRequest.
+type UserAuthFailure struct{}
+
+// UserAuthSuccess accepts a UserAuthRequest.
+type UserAuthSuccess struct{}
+
+// GlobalRequest is a connection wide request, most commonly tcpip-forward.
+type GlobalRequest struct {
+	Name      string
+	WantReply bool
+	Address   string
+	Port      uint32
+	// The remaining fields are only used by udp-send-to requests.
+	OriginatorAddress string
+	OriginatorPort    uint32
+	Data              []byte
+}
+
+// RequestSuccess answers a GlobalRequest. Port is only sent in answers to tcpip-forward.
+type RequestSuccess struct {
+	Port    uint32
+	HasPort bool
+}
+
+// RequestFailure rejects a GlobalRequest.
+type RequestFailure struct{}
+
+// ChannelOpen asks the peer to open a channel.
+type ChannelOpen struct {
+	ChannelType       string
+	SenderChannel     uint32
+	InitialWindow     uint32
+	ConnectedAddress  string
+	ConnectedPort     uint32
+	OriginatorAddress string
+	OriginatorPort    uint32
+}
+
+// ChannelOpenConfirmation accepts a ChannelOpen.
+type ChannelOpenConfirmation struct {
+	RecipientChannel uint32
+	SenderChannel    uint32
+	InitialWindow    uint32
+}
+
+// ChannelOpenFailure rejects a ChannelOpen.
+type ChannelOpenFailure struct {
+	RecipientChannel uint32
+	ReasonCode       uint32
+}
+
+// ChannelWindowAdjust grants the peer more room to send.
+type ChannelWindowAdjust struct {
+	RecipientChannel uint32
+	BytesToAdd       uint32
+}
+
+// ChannelData carries channel payload.
+type ChannelData struct {
+	RecipientChannel uint32
+	Data             []byte
+}
+
+// ChannelClose closes a channel.
+type ChannelClose struct {
+	RecipientChannel uint32
+}
+
+// KeepAliveRequest is answered with a KeepAliveReply carrying the same cookie.
+type KeepAliveRequest struct {
+	Cookie uint32
+}
+
+// KeepAliveReply answers a KeepAliveRequest.
+type KeepAliveReply struct {
+	Cookie uint32
+}
+
+// KeepAliveOptionsRequest sets the keep alive interval and timeout in seconds.
+type KeepAliveOptionsRequest struct {
+	Interval uint32
+	Timeout  uint32
+}
+
+// KeepAliveOptionsReply answers a KeepAliveOptionsRequest.
+type KeepAliveOptionsReply struct {
+	Interval uint32
+	Timeout  uint32
+}
+
+func (*ProtocolVersion) Type() byte         { return TypeProtocolVersion }
+func (*Disconnect) Type() byte              { return TypeDisconnect }
+func (*ServiceRequest) Type() byte          { return TypeServiceRequest }
+func (*ServiceAccept) Type() byte           { return TypeServiceAccept }
+func (*UserAuthRequest) Type() byte         { return TypeUserAuthRequest }
+func (*UserAuthFailure) Type() byte         { return TypeUserAuthFailure }
+func (*UserAuthSuccess) Type() byte         { return TypeUserAuthSuccess }
+func (*GlobalRequest) Type() byte           { return TypeGlobalRequest }
+func (*RequestSuccess) Type() byte          { return TypeRequestSuccess }
+func (*RequestFailure) Type() byte          { return TypeRequestFailure }
+func (*ChannelOpen) Type() byte             { return TypeChannelOpen }
+func (*ChannelOpenConfirmation) Type() byte { return TypeChannelOpenConfirmation }
+func (*ChannelOpenFailure) Type() byte      { return TypeChannelOpenFailure }
+func (*ChannelWindowAdjust) Type() byte     { return TypeChannelWindowAdjust }
+func (*ChannelData) Type() byte             { return TypeChannelData }
+func (*ChannelClose) Type() byte            { return TypeChannelClose }
+func (*KeepAliveRequest) Type() byte        { return TypeKeepAliveRequest }
+func (*KeepAliveReply) Type() byte          { return TypeKeepAliveReply }
+func (*KeepAliveOptionsRequest) Type() byte { return TypeKeepAliveOptionsRequest }
+func (*KeepAliveOptionsReply) Type() byte   { return TypeKeepAliveOptionsReply }
+
+func (m *ProtocolVersion) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.Major)
+	b = appendUint32(b, m.Minor)
+	b = appendUint32(b, m.TriggerReason)
+	b = append(b, m.UUID[:]...)
+	return append(b, make([]byte, 64)...)
+}
+
+func (m *Disconnect) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.ReasonCode)
+	return append(b, 0, 0)
+}
+
+func (m *ServiceRequest) appendPayload(b []byte) []byte {
+	return appendString(b, m.Service)
+}
+
+func (m *ServiceAccept) appendPayload(b []byte) []byte {
+	return appendString(b, m.Service)
+}
+
+func (m *UserAuthRequest) appendPayload(b []byte) []byte {
+	b = appendString(b, m.Username)
+	b = appendString(b, m.Service)
+	b = appendString(b, m.Method)
+	if m.Method == AuthMethodPassword {
+		b = append(b, 0)
+		b = appendString(b, m.Password)
+	}
+	return b
+}
+
+func (m *UserAuthFailure) appendPayload(b []byte) []byte {
+	// the methods that can continue and partial success false.
+	b = appendString(b, AuthMethodPassword)
+	return append(b, 0)
+}
+
+func (m *UserAuthSuccess) appendPayload(b []byte) []byte { return b }
+
+func (m *GlobalRequest) appendPayload(b []byte) []byte {
+	b = appendString(b, m.Name)
+	b = appendBool(b, m.WantReply)
+	b = appendString(b, m.Address)
+	b = appendUint32(b, m.Port)
+	if m.Name == RequestUDPSendTo {
+		b = appendString(b, m.OriginatorAddress)
+		b = appendUint32(b, m.OriginatorPort)
+		b = appendString(b, string(m.Data))
+	}
+	return b
+}
+
+func (m *RequestSuccess) appendPayload(b []byte) []byte {
+	if m.HasPort {
+		b = appendUint32(b, m.Port)
+	}
+	return b
+}
+
+func (m *RequestFailure) appendPayload(b []byte) []byte { return b }
+
+func (m *ChannelOpen) appendPayload(b []byte) []byte {
+	b = appendString(b, m.ChannelType)
+	b = appendUint32(b, m.SenderChannel)
+	b = appendUint32(b, m.InitialWindow)
+	b = appendUint32(b, 0xFFFFFFFF)
+	b = appendString(b, m.ConnectedAddress)
+	b = appendUint32(b, m.ConnectedPort)
+	b = appendString(b, m.OriginatorAddress)
+	return appendUint32(b, m.OriginatorPort)
+}
+
+func (m *ChannelOpenConfirmation) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.RecipientChannel)
+	b = appendUint32(b, m.SenderChannel)
+	b = appendUint32(b, m.InitialWindow)
+	return appendUint32(b, 0xFFFFFFFF)
+}
+
+func (m *ChannelOpenFailure) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.RecipientChannel)
+	b = appendUint32(b, m.ReasonCode)
+	b = appendUint32(b, 0)
+	return appendUint32(b, 0)
+}
+
+func (m *ChannelWindowAdjust) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.RecipientChannel)
+	return appendUint32(b, m.BytesToAdd)
+}
+
+func (m *ChannelData) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.RecipientChannel)
+	b = appendUint32(b, uint32(len(m.Data)))
+	return append(b, m.Data...)
+}
+
+func (m *ChannelClose) appendPayload(b []byte) []byte {
+	return appendUint32(b, m.RecipientChannel)
+}
+
+func (m *KeepAliveRequest) appendPayload(b []byte) []byte {
+	return appendUint32(b, m.Cookie)
+}
+
+func (m *KeepAliveReply) appendPayload(b []byte) []byte {
+	return appendUint32(b, m.Cookie)
+}
+
+func (m *KeepAliveOptionsRequest) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.Interval)
+	return appendUint32(b, m.Timeout)
+}
+
+func (m *KeepAliveOptionsReply) appendPayload(b []byte) []byte {
+	b = appendUint32(b, m.Interval)
+	return appendUint32(b, m.Timeout)
+}
+
+// ReadMessage reads a single message from r. RequestSuccess messages are
+// always decoded without a port, as their length depends on the request
+// they answer.
+func ReadMessage(r *bufio.Reader) (Message, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{r: r}
+	var m Message
+	switch t {
+	case TypeProtocolVersion:
+		v := &ProtocolVersion{Major: d.uint32(), Minor: d.uint32(), TriggerReason: d.uint32()}
+		d.read(v.UUID[:])
+		d.skip(64)
+		m = v
+	case TypeDisconnect:
+		v := &Disconnect{ReasonCode: d.uint32()}
+		d.skip(2)
+		m = v
+	case TypeServiceRequest:
+		m = &ServiceRequest{Service: d.string()}
+	case TypeServiceAccept:
+		m = &ServiceAccept{Service: d.string()}
+	case TypeUserAuthRequest:
+		v := &UserAuthRequest{Username: d.string(), Service: d.string(), Method: d.string()}
+		if v.Method == AuthMethodPassword {
+			d.skip(1)
+			v.Password = d.string()
+		}
+		m = v
+	case TypeUserAuthFailure:
+		d.string()
+		d.skip(1)
+		m = &UserAuthFailure{}
+	case TypeUserAuthSuccess:
+		m = &UserAuthSuccess{}
+	case TypeGlobalRequest:
+		v := &GlobalRequest{Name: d.string(), WantReply: d.bool(), Address: d.string(), Port: d.uint32()}
+		if v.Name == RequestUDPSendTo {
+			v.OriginatorAddress = d.string()
+			v.OriginatorPort = d.uint32()
+			v.Data = []byte(d.string())
+		}
+		m = v
+	case TypeRequestSuccess:
+		m = &RequestSuccess{}
+	case TypeRequestFailure:
+		m = &RequestFailure{}
+	case TypeChannelOpen:
+		v := &ChannelOpen{ChannelType: d.string(), SenderChannel: d.uint32(), InitialWindow: d.uint32()}
+		d.skip(4)
+		v.ConnectedAddress = d.string()
+		v.ConnectedPort = d.uint32()
+		v.OriginatorAddress = d.string()
+		v.OriginatorPort = d.uint32()
+		m = v
+	case TypeChannelOpenConfirmation:
+		v := &ChannelOpenConfirmation{RecipientChannel: d.uint32(), SenderChannel: d.uint32(), InitialWindow: d.uint32()}
+		d.skip(4)
+		m = v
+	case TypeChannelOpenFailure:
+		v := &ChannelOpenFailure{RecipientChannel: d.uint32(), ReasonCode: d.uint32()}
+		d.skip(8)
+		m = v
+	case TypeChannelWindowAdjust:
+		m = &ChannelWindowAdjust{RecipientChannel: d.uint32(), BytesToAdd: d.uint32()}
+	case TypeChannelData:
+		m = &ChannelData{RecipientChannel: d.uint32(), Data: []byte(d.string())}
+	case TypeChannelClose:
+		m = &ChannelClose{RecipientChannel: d.uint32()}
+	case TypeKeepAliveRequest:
+		m = &KeepAliveRequest{Cookie: d.uint32()}
+	case TypeKeepAliveReply:
+		m = &KeepAliveReply{Cookie: d.uint32()}
+	case TypeKeepAliveOptionsRequest:
+		m = &KeepAliveOptionsRequest{Interval: d.uint32(), Timeout: d.uint32()}
+	case TypeKeepAliveOptionsReply:
+		m = &KeepAliveOptionsReply{Interval: d.uint32(), Timeout: d.uint32()}
+	default:
+		return nil, fmt.Errorf("unknown apf message type %d", t)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("could not decode apf message type %d: %v", t, d.err)
+	}
+	return m, nil
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = io.ReadFull(d.r, p)
+}
+
+func (d *decoder) skip(n int) {
+	if d.err != nil {
+		return
+	}
+	_, d.err = d.r.Discard(n)
+}
+
+func (d *decoder) uint32() uint32 {
+	var b [4]byte
+	d.read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func (d *decoder) bool() bool {
+	var b [1]byte
+	d.read(b[:])
+	return b[0] != 0
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if d.err != nil {
+		return ""
+	}
+	if n > maxStringLength {
+		d.err = fmt.Errorf("string length %d exceeds limit", n)
+		return ""
+	}
+	b := make([]byte, n)
+	d.read(b)
+	return string(b)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,294 @@
+package apf
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	defaultWindowSize = 4096
+	defaultMaxPacket  = 4096 - 9
+	// TriggerReasonLocal is used by LMS when it connects to the firmware over the MEI.
+	TriggerReasonLocal = 9
+)
+
+// ErrSessionClosed is returned when using a session that has shut down.
+var ErrSessionClosed = errors.New("apf: session closed")
+
+// Config controls how a Session answers requests from the peer.
+type Config struct {
+	// Authenticate validates the credentials of a USERAUTH_REQUEST. When nil
+	// every USERAUTH_REQUEST is rejected.
+	Authenticate func(username, password string) bool
+	// OnProtocolVersion is called when the peer announces its protocol version.
+	OnProtocolVersion func(*ProtocolVersion)
+	// WindowSize is the receive window granted to the peer for each channel.
+	WindowSize uint32
+	// MaxPacket bounds the payload of a single CHANNEL_DATA message.
+	MaxPacket int
+}
+
+// Session multiplexes channels over a single APF connection.
+type Session struct {
+	config  Config
+	conn    io.ReadWriteCloser
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+
+	mu          sync.Mutex
+	channels    map[uint32]*Channel
+	nextChannel uint32
+	forwards    map[uint32]string
+	version     *ProtocolVersion
+	err         error
+	done        chan struct{}
+}
+
+// NewSession wraps conn. Call Serve to start processing incoming messages.
+func NewSession(conn io.ReadWriteCloser, config Config) *Session {
+	if config.WindowSize == 0 {
+		config.WindowSize = defaultWindowSize
+	}
+	if config.MaxPacket <= 0 {
+		config.MaxPacket = defaultMaxPacket
+	}
+	return &Session{
+		config:   config,
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		channels: map[uint32]*Channel{},
+		forwards: map[uint32]string{},
+		done:     make(chan struct{}),
+	}
+}
+
+// Send writes a single message to the peer.
+func (s *Session) Send(m Message) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	select {
+	case <-s.done:
+		return ErrSessionClosed
+	default:
+	}
+	_, err := s.conn.Write(Marshal(m))
+	return err
+}
+
+// Done is closed once the session has shut down.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session shut down.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// ProtocolVersion returns the version announced by the peer, or nil.
+func (s *Session) ProtocolVersion() *ProtocolVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// ForwardedPorts returns the ports the peer asked to be forwarded with tcpip-forward.
+func (s *Session) ForwardedPorts() []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ports := make([]uint32, 0, len(s.forwards))
+	for p := range s.forwards {
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+// ForwardedAddress returns the address the peer sent with its tcpip-forward of port.
+func (s *Session) ForwardedAddress(port uint32) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	address, ok := s.forwards[port]
+	return address, ok
+}
+
+// Close the session and all of its channels.
+func (s *Session) Close() error {
+	s.shutdown(ErrSessionClosed)
+	return s.conn.Close()
+}
+
+func (s *Session) shutdown(err error) {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return
+	default:
+	}
+	s.err = err
+	close(s.done)
+	channels := s.channels
+	s.channels = map[uint32]*Channel{}
+	s.mu.Unlock()
+	for _, c := range channels {
+		c.peerClosed(err)
+	}
+}
+
+// Serve processes incoming messages until the connection fails or is closed.
+func (s *Session) Serve() error {
+	for {
+		m, err := ReadMessage(s.reader)
+		if err != nil {
+			s.shutdown(err)
+			s.conn.Close()
+			return err
+		}
+		if err := s.handle(m); err != nil {
+			s.shutdown(err)
+			s.conn.Close()
+			return err
+		}
+	}
+}
+
+func (s *Session) handle(m Message) error {
+	switch m := m.(type) {
+	case *ProtocolVersion:
+		s.mu.Lock()
+		s.version = m
+		s.mu.Unlock()
+		if s.config.OnProtocolVersion != nil {
+			s.config.OnProtocolVersion(m)
+		}
+	case *ServiceRequest:
+		if m.Service != ServiceAuth && m.Service != ServicePortForward {
+			s.Send(&Disconnect{ReasonCode: DisconnectServiceNotAvailable})
+			return fmt.Errorf("peer requested unknown service %q", m.Service)
+		}
+		return s.Send(&ServiceAccept{Service: m.Service})
+	case *UserAuthRequest:
+		if s.config.Authenticate != nil && m.Method == AuthMethodPassword && s.config.Authenticate(m.Username, m.Password) {
+			return s.Send(&UserAuthSuccess{})
+		}
+		return s.Send(&UserAuthFailure{})
+	case *GlobalRequest:
+		return s.handleGlobalRequest(m)
+	case *ChannelOpen:
+		// channels are only ever opened by us.
+		return s.Send(&ChannelOpenFailure{RecipientChannel: m.SenderChannel, ReasonCode: OpenFailureAdministrativelyProhibited})
+	case *ChannelOpenConfirmation:
+		if c := s.channel(m.RecipientChannel); c != nil {
+			c.opened(m.SenderChannel, m.InitialWindow, nil)
+		}
+	case *ChannelOpenFailure:
+		if c := s.channel(m.RecipientChannel); c != nil {
+			s.removeChannel(c.id)
+			c.opened(0, 0, fmt.Errorf("peer refused channel with reason %d", m.ReasonCode))
+		}
+	case *ChannelWindowAdjust:
+		if c := s.channel(m.RecipientChannel); c != nil {
+			c.adjustWindow(m.BytesToAdd)
+		}
+	case *ChannelData:
+		if c := s.channel(m.RecipientChannel); c != nil {
+			c.receive(m.Data)
+		}
+	case *ChannelClose:
+		if c := s.channel(m.RecipientChannel); c != nil {
+			s.removeChannel(c.id)
+			c.peerClosed(io.EOF)
+		}
+	case *KeepAliveRequest:
+		return s.Send(&KeepAliveReply{Cookie: m.Cookie})
+	case *KeepAliveOptionsRequest:
+		return s.Send(&KeepAliveOptionsReply{Interval: m.Interval, Timeout: m.Timeout})
+	case *Disconnect:
+		return fmt.Errorf("peer disconnected with reason %d", m.ReasonCode)
+	}
+	return nil
+}
+
+func (s *Session) handleGlobalRequest(m *GlobalRequest) error {
+	switch m.Name {
+	case RequestTCPIPForward:
+		s.mu.Lock()
+		s.forwards[m.Port] = m.Address
+		s.mu.Unlock()
+		if m.WantReply {
+			return s.Send(&RequestSuccess{Port: m.Port, HasPort: true})
+		}
+	case RequestCancelTCPIPForward:
+		s.mu.Lock()
+		delete(s.forwards, m.Port)
+		s.mu.Unlock()
+		if m.WantReply {
+			return s.Send(&RequestSuccess{})
+		}
+	default:
+		if m.WantReply {
+			return s.Send(&RequestFailure{})
+		}
+	}
+	return nil
+}
+
+func (s *Session) channel(id uint32) *Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[id]
+}
+
+func (s *Session) removeChannel(id uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, id)
+}
+
+// OpenChannel opens a forwarded-tcpip channel to port on the peer.
+func (s *Session) OpenChannel(ctx context.Context, address string, port uint32) (*Channel, error) {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	default:
+	}
+	id := s.nextChannel
+	s.nextChannel++
+	c := newChannel(s, id, address, port)
+	s.channels[id] = c
+	s.mu.Unlock()
+
+	err := s.Send(&ChannelOpen{
+		ChannelType:       ChannelForwardedTCPIP,
+		SenderChannel:     id,
+		InitialWindow:     s.config.WindowSize,
+		ConnectedAddress:  address,
+		ConnectedPort:     port,
+		OriginatorAddress: "127.0.0.1",
+		OriginatorPort:    0,
+	})
+	if err != nil {
+		s.removeChannel(id)
+		return nil, err
+	}
+	select {
+	case err := <-c.openResult:
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	case <-s.done:
+		return nil, ErrSessionClosed
+	case <-ctx.Done():
+		s.removeChannel(id)
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,72 @@
+package apf
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFirmware answers a channel open and echoes size bytes of channel data back before closing it.
+func fakeFirmware(t *testing.T, conn net.Conn, size int) {
+	r := bufio.NewReader(conn)
+	echoed := 0
+	for {
+		m, err := ReadMessage(r)
+		if err != nil {
+			return
+		}
+		switch m := m.(type) {
+		case *ChannelOpen:
+			conn.Write(Marshal(&ChannelOpenConfirmation{RecipientChannel: m.SenderChannel, SenderChannel: 42, InitialWindow: 4}))
+		case *ChannelData:
+			assert.Equal(t, uint32(42), m.RecipientChannel)
+			conn.Write(Marshal(&ChannelWindowAdjust{RecipientChannel: 0, BytesToAdd: uint32(len(m.Data))}))
+			conn.Write(Marshal(&ChannelData{RecipientChannel: 0, Data: m.Data}))
+			echoed += len(m.Data)
+			if echoed == size {
+				conn.Write(Marshal(&ChannelClose{RecipientChannel: 0}))
+			}
+		}
+	}
+}
+
+func TestMarshal_When_ReadBack_Expect_SameMessage(t *testing.T) {
+	in := &ChannelOpen{ChannelType: ChannelForwardedTCPIP, SenderChannel: 1, InitialWindow: 2, ConnectedAddress: "127.0.0.1", ConnectedPort: 16992, OriginatorAddress: "1.2.3.4", OriginatorPort: 5}
+	out, err := ReadMessage(bufio.NewReader(bytesReader(Marshal(in))))
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+}
+
+func TestOpenChannel_When_PeerWindowIsSmall_Expect_DataSplitAndEchoed(t *testing.T) {
+	local, remote := net.Pipe()
+	go fakeFirmware(t, remote, len("hello world"))
+	s := NewSession(local, Config{})
+	go s.Serve()
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := s.OpenChannel(ctx, "127.0.0.1", 16992)
+	assert.NoError(t, err)
+
+	n, err := c.Write([]byte("hello world"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, n)
+	echoed, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(echoed))
+}
+
+func bytesReader(b []byte) *bufio.Reader {
+	r, w := net.Pipe()
+	go func() {
+		w.Write(b)
+		w.Close()
+	}()
+	return bufio.NewReader(r)
+}
@@ -0,0 +1,270 @@
+package amt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ApplyResult tells what a configuration call changed. Settings already in
+// the desired state are not written, so applying the same configuration
+// twice reports no change the second time.
+type ApplyResult struct {
+	// Changed is true when at least one setting was written.
+	Changed bool
+	// Changes names the settings that were written, e.g. "KVM state".
+	Changes []string
+	// Conditions are the outcome of each step of the multi-step calls, e.g.
+	// ApplyFeatures and ApplyClientControlMode, and their Ready summary.
+	// They are also set when the call fails.
+	Conditions []Condition
+}
+
+func (r *ApplyResult) add(change string) {
+	r.Changed = true
+	r.Changes = append(r.Changes, change)
+}
+
+// ApplyError is returned by the configuration calls changing several settings
+// when one of them fails. It tells which settings were rolled back and which
+// ones are left changed, so the caller knows the state of the device.
+type ApplyError struct {
+	// Step is the setting that failed and Err why.
+	Step string
+	Err  error
+	// RolledBack names the settings restored to their prior value, in the
+	// order they were restored.
+	RolledBack []string
+	// RollbackStep and RollbackErr are the setting that could not be
+	// restored and why, when the rollback failed.
+	RollbackStep string
+	RollbackErr  error
+	// Applied names the settings left changed: all those changed before the
+	// failure when the rollback is off, those not restored when it failed.
+	Applied []string
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("setting the %s: %v", e.Step, e.Err)
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(". rolling back the %s also failed: %v", e.RollbackStep, e.RollbackErr)
+	}
+	return msg
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+// applyNextBootOrder sets the boot order of the next boot. The firmware only
+// applies the boot configuration in the next single use role, like
+// setNextBoot.
+func applyNextBootOrder(ctx context.Context, client *Client, sources []string) (ApplyResult, error) {
+	current, err := getBootOrder(ctx, client)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	if equalStrings(current, sources) {
+		// the firmware keeps the order once it was used, only the role tells.
+		pending := len(sources) == 0
+		if !pending {
+			if pending, err = bootConfigIsNextSingleUse(ctx, client); err != nil {
+				client.logger.V(1).Info("could not read the boot configuration role", "error", err.Error())
+			}
+		}
+		if pending {
+			return ApplyResult{}, nil
+		}
+	}
+	if len(sources) > 0 {
+		if err := setBootConfigRole(ctx, client, bootConfigRoleIsNextSingleUse); err != nil {
+			return ApplyResult{}, err
+		}
+	}
+	if err := changeBootOrder(ctx, client, sources); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("boot order")
+	return result, nil
+}
+
+// nextBootPending reports whether the next boot is already from source with
+// the next boot options cleared.
+func nextBootPending(ctx context.Context, client *Client, source string) (bool, error) {
+	order, err := getBootOrder(ctx, client)
+	if err != nil || !equalStrings(order, []string{source}) {
+		return false, err
+	}
+	pending, err := bootConfigIsNextSingleUse(ctx, client)
+	if err != nil {
+		// without the role the boot is set again.
+		client.logger.V(1).Info("could not read the boot configuration role", "error", err.Error())
+		return false, nil
+	}
+	if !pending {
+		return false, nil
+	}
+	settings, err := getBootSettings(ctx, client)
+	if err != nil {
+		return false, err
+	}
+	return !settings.BIOSPause && !settings.BIOSSetup && settings.BootMediaIndex == 0, nil
+}
+
+func applyLinkProtection(ctx context.Context, client *Client, port EthernetPort, protection LinkProtection) (ApplyResult, error) {
+	policy, err := getLinkPolicy(ctx, client, port)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	if policy.Protection == protection {
+		return ApplyResult{}, nil
+	}
+	if err := setLinkProtection(ctx, client, port, protection); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("link protection")
+	return result, nil
+}
+
+// applyCertificateHash makes sure the hash is trusted: an existing disabled
+// hash is enabled instead of adding a duplicate.
+func applyCertificateHash(ctx context.Context, client *Client, name string, hash []byte) (ApplyResult, error) {
+	if _, ok := hashTypes[len(hash)]; !ok {
+		return ApplyResult{}, addCertificateHash(ctx, client, name, hash)
+	}
+	hashes, err := getCertificateHashes(ctx, client)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	for _, h := range hashes {
+		if !bytes.Equal(h.Hash, hash) {
+			continue
+		}
+		if h.Enabled {
+			return result, nil
+		}
+		if _, err := updateInstanceByID(ctx, client, client.resourceURI(ResourceAMTProvisioningCertificateHash), h.InstanceID, "Enabled", strconv.FormatBool(true)); err != nil {
+			return result, fmt.Errorf("enabling certificate hash %s: %v", h.InstanceID, err)
+		}
+		result.add("certificate hash enabled")
+		return result, nil
+	}
+	if err := addCertificateHash(ctx, client, name, hash); err != nil {
+		return result, err
+	}
+	result.add("certificate hash")
+	return result, nil
+}
+
+// applyNextBoot makes the machine boot once from source unless it already
+// will: the boot order is source alone, the boot configuration is still set
+// for the next boot and the next boot options are cleared. The firmware
+// clears the role once the machine booted, the order is kept.
+func applyNextBoot(ctx context.Context, client *Client, source string) (ApplyResult, error) {
+	pending, err := nextBootPending(ctx, client, source)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	if pending {
+		return ApplyResult{}, nil
+	}
+	if err := setNextBoot(ctx, client, source); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("next boot")
+	return result, nil
+}
+
+// applyKVMState enables or disables KVM redirection unless it already is.
+func applyKVMState(ctx context.Context, client *Client, enabled bool) (ApplyResult, error) {
+	kvm, err := getInstance(ctx, client, client.resourceURI(ResourceCIMKVMRedirectionSAP), "EnabledState")
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	states := parseFeatureStates(nil, kvm, nil)
+	if states.KVM == enabled {
+		return ApplyResult{}, nil
+	}
+	if err := requestStateChange(ctx, client, client.resourceURI(ResourceCIMKVMRedirectionSAP), kvmState(enabled)); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add(featureKVMState)
+	return result, nil
+}
+
+// applyRedirectionState enables or disables SOL and IDE-R unless they
+// already are.
+func applyRedirectionState(ctx context.Context, client *Client, sol, ider bool) (ApplyResult, error) {
+	redirection, err := getInstance(ctx, client, client.resourceURI(ResourceAMTRedirectionService), "EnabledState")
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	states := parseFeatureStates(redirection, nil, nil)
+	if states.SOL == sol && states.IDER == ider {
+		return ApplyResult{}, nil
+	}
+	if err := requestStateChange(ctx, client, client.resourceURI(ResourceAMTRedirectionService), redirectionState(sol, ider)); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add(featureRedirectionState)
+	return result, nil
+}
+
+// applyLinkPreference sets the preferred owner of the link of port unless it
+// already is owner. A preference for LinkOwnerME is always written, it
+// restarts the timeout.
+func applyLinkPreference(ctx context.Context, client *Client, port EthernetPort, owner LinkOwner, timeout time.Duration) (ApplyResult, error) {
+	if owner != LinkOwnerME {
+		policy, err := getLinkPolicy(ctx, client, port)
+		if err != nil {
+			return ApplyResult{}, err
+		}
+		if policy.Preference == owner {
+			return ApplyResult{}, nil
+		}
+	}
+	if err := setLinkPreference(ctx, client, port, owner, timeout); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("link preference")
+	return result, nil
+}
+
+// applyUserInitiatedConnections allows or forbids the user initiated
+// connections unless they already are.
+func applyUserInitiatedConnections(ctx context.Context, client *Client, enabled bool) (ApplyResult, error) {
+	service, err := getInstance(ctx, client, client.resourceURI(ResourceAMTUserInitiatedConnectionService), "EnabledState")
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	if state, _ := strconv.Atoi(propertyContent(service, "EnabledState")); userInitiatedConnections(state) == enabled {
+		return ApplyResult{}, nil
+	}
+	if err := setUserInitiatedConnections(ctx, client, enabled); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("user initiated connections")
+	return result, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
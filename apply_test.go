@@ -0,0 +1,151 @@
+package amt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply_When_AlreadyInDesiredState_Expect_NoWrite(t *testing.T) {
+	tests := map[string]struct {
+		responses map[string]string
+		apply     func(ctx context.Context, client *Client) (ApplyResult, error)
+	}{
+		"KVM state": {
+			responses: map[string]string{
+				"CIM_KVMRedirectionSAP Get": instanceBody(ResourceCIMKVMRedirectionSAP, `<h:EnabledState>2</h:EnabledState>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyKVMState(ctx, true)
+			},
+		},
+		"redirection state": {
+			responses: map[string]string{
+				"AMT_RedirectionService Get": instanceBody(ResourceAMTRedirectionService, `<h:EnabledState>32770</h:EnabledState>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyRedirectionState(ctx, true, false)
+			},
+		},
+		"next boot": {
+			responses: map[string]string{
+				"CIM_OrderedComponent Enumerate":   enumerationBody(orderedComponent(bootConfigSetting, BootSourcePXE, "1")),
+				"CIM_ElementSettingData Enumerate": enumerationBody(elementSettingData(bootConfigSetting, "3")),
+				"AMT_BootSettingData Get":          instanceBody(ResourceAMTBootSettingData, `<h:BIOSPause>false</h:BIOSPause><h:BIOSSetup>false</h:BIOSSetup><h:BootMediaIndex>0</h:BootMediaIndex>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyNextBoot(ctx, BootSourcePXE)
+			},
+		},
+		"link preference": {
+			responses: map[string]string{
+				"AMT_EthernetPortSettings Get": instanceBody(ResourceAMTEthernetPortSettings, `<h:LinkPreference>2</h:LinkPreference><h:LinkControl>2</h:LinkControl>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyLinkPreference(ctx, WirelessPort, LinkOwnerHost, 0)
+			},
+		},
+		"user initiated connections": {
+			responses: map[string]string{
+				"AMT_UserInitiatedConnectionService Get": instanceBody(ResourceAMTUserInitiatedConnectionService, `<h:EnabledState>32768</h:EnabledState>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyUserInitiatedConnections(ctx, false)
+			},
+		},
+		"idle wake timeout": {
+			responses: map[string]string{
+				"AMT_GeneralSettings Get": instanceBody(ResourceAMTGeneralSettings, `<h:IdleWakeTimeout>65</h:IdleWakeTimeout>`),
+			},
+			apply: func(ctx context.Context, client *Client) (ApplyResult, error) {
+				return client.ApplyIdleWakeTimeout(ctx, 65*time.Minute)
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// only the reads are answered, a write fails.
+			f := &fakeFirmware{responses: tt.responses}
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			result, err := tt.apply(context.Background(), client)
+			assert.NoError(t, err)
+			assert.False(t, result.Changed)
+			assert.Empty(t, result.Changes)
+		})
+	}
+}
+
+func TestApplyKVMState_When_Disabled_Expect_Enabled(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_KVMRedirectionSAP Get", instanceBody(ResourceCIMKVMRedirectionSAP, `<h:EnabledState>3</h:EnabledState>`))
+	f.set("CIM_KVMRedirectionSAP RequestStateChange", outputBody(ResourceCIMKVMRedirectionSAP, "RequestStateChange", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	result, err := client.ApplyKVMState(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{featureKVMState}, result.Changes)
+	assert.Contains(t, f.body("CIM_KVMRedirectionSAP RequestStateChange"), "RequestedState>2<")
+}
+
+func TestApplyLinkPreference_When_PreferenceIsME_Expect_TimeoutRestarted(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_EthernetPortSettings SetLinkPreference", outputBody(ResourceAMTEthernetPortSettings, "SetLinkPreference", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	result, err := client.ApplyLinkPreference(context.Background(), WirelessPort, LinkOwnerME, time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+	// the preference isn't read, it is written whatever it is.
+	assert.Equal(t, []string{"AMT_EthernetPortSettings SetLinkPreference"}, f.received())
+	assert.Contains(t, f.body("AMT_EthernetPortSettings SetLinkPreference"), "Timeout>60<")
+}
+
+// elementSettingData is the association of the boot configuration config with
+// the IsNext of its role.
+func elementSettingData(config, isNext string) string {
+	return `<h:CIM_ElementSettingData xmlns:h="` + ResourceCIMElementSettingData + `" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd">` +
+		`<h:IsNext>` + isNext + `</h:IsNext>` +
+		`<h:SettingData><w:SelectorSet><w:Selector Name="InstanceID">` + config + `</w:Selector></w:SelectorSet></h:SettingData>` +
+		`</h:CIM_ElementSettingData>`
+}
+
+func TestApplyNextBoot_When_OrderMatchesButRoleIsNotSet_Expect_NextBootSet(t *testing.T) {
+	tests := map[string]struct {
+		elementSettingData string
+	}{
+		// the machine booted from PXE already, the role is "Not Next".
+		"role used": {elementSettingData: enumerationBody(elementSettingData(bootConfigSetting, "2"))},
+		// without the role the boot is set again.
+		"role unknown": {},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeFirmware{}
+			f.set("CIM_OrderedComponent Enumerate", enumerationBody(orderedComponent(bootConfigSetting, BootSourcePXE, "1")))
+			if tt.elementSettingData != "" {
+				f.set("CIM_ElementSettingData Enumerate", tt.elementSettingData)
+			}
+			settings := instanceBody(ResourceAMTBootSettingData, `<h:BIOSPause>false</h:BIOSPause><h:BIOSSetup>false</h:BIOSSetup><h:BootMediaIndex>0</h:BootMediaIndex>`)
+			f.set("AMT_BootSettingData Get", settings)
+			f.set("AMT_BootSettingData Put", settings)
+			f.set("CIM_BootConfigSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootConfigSetting, "InstanceID", bootConfigSetting)))
+			f.set("CIM_BootService SetBootConfigRole", outputBody(ResourceCIMBootService, "SetBootConfigRole", 0))
+			f.set("CIM_BootSourceSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootSourceSetting, "InstanceID", BootSourcePXE)))
+			f.set("CIM_BootConfigSetting ChangeBootOrder", outputBody(ResourceCIMBootConfigSetting, "ChangeBootOrder", 0))
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			result, err := client.ApplyNextBoot(context.Background(), BootSourcePXE)
+			assert.NoError(t, err)
+			assert.True(t, result.Changed)
+			assert.Contains(t, f.body("CIM_BootService SetBootConfigRole"), "Role>1<")
+			assert.Contains(t, f.body("CIM_BootConfigSetting ChangeBootOrder"), BootSourcePXE)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package amt
+
+import (
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
+)
+
+// redacted replaces the values of parameters holding secrets in an OperationRecord.
+const redacted = "REDACTED"
+
+// OperationRecord describes a request that changed, or tried to change, the machine.
+type OperationRecord struct {
+	Time        time.Time
+	Host        string
+	ResourceURI string
+	// Method is the invoked method, or Put, Create or Delete.
+	Method string
+	// Parameters are the input parameters of an invoke or the properties of a
+	// put or create. Passwords are redacted.
+	Parameters map[string]string
+	// ReturnValue of an invoke, -1 when there is none.
+	ReturnValue int
+	// Err is the error of the request, if any.
+	Err error
+}
+
+// OperationSink receives an OperationRecord for every mutating request, e.g.
+// to keep a per host change history.
+type OperationSink interface {
+	Record(OperationRecord)
+}
+
+func newOperationRecord(at time.Time, host string, request *Request, response *wsman.Message, err error) OperationRecord {
+	record := OperationRecord{
+		Time:        at,
+		Host:        host,
+		ResourceURI: request.ResourceURI,
+		Method:      path.Base(request.Action),
+		Parameters:  map[string]string{},
+		ReturnValue: -1,
+		Err:         err,
+	}
+	if body := request.Message.Body(); len(body) > 0 {
+		for _, p := range body[0].Children() {
+			value := string(p.Content)
+			if id := instanceIDSelector(p); id != "" {
+				value = id
+			}
+			// the UEFI boot parameters may hold the password of the recovery image server.
+			if strings.Contains(strings.ToLower(p.Name.Local), "password") || p.Name.Local == "UefiBootParametersArray" {
+				value = redacted
+			}
+			record.Parameters[p.Name.Local] = value
+		}
+	}
+	if response != nil {
+		if returnValue := search.FirstTag("ReturnValue", "*", response.AllBodyElements()); returnValue != nil {
+			if n, err := strconv.Atoi(string(returnValue.Content)); err == nil {
+				record.ReturnValue = n
+			}
+		}
+	}
+	return record
+}
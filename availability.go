@@ -0,0 +1,89 @@
+package amt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+var (
+	// ErrAMTDisabled is returned when the machine refuses the connections to
+	// the AMT port: nothing listens on it.
+	ErrAMTDisabled = errors.New("AMT is not listening, it is likely disabled in the BIOS")
+	// ErrAMTUnprovisioned is returned when a web server answers on the AMT
+	// port but has no WS-Management endpoint.
+	ErrAMTUnprovisioned = errors.New("AMT has no WS-Management endpoint, it is likely unprovisioned")
+	// ErrAMTFirewalled is returned when the connections to the AMT port get
+	// no answer at all.
+	ErrAMTFirewalled = errors.New("the AMT port is unreachable, it is likely firewalled")
+)
+
+// AvailabilityError is returned when AMT can't be reached, with a likely
+// reason and how to fix it. Err is ErrAMTDisabled, ErrAMTUnprovisioned or
+// ErrAMTFirewalled, Cause the error of the connection or the HTTP status.
+type AvailabilityError struct {
+	Err   error
+	Cause error
+	// Hint tells how to make AMT reachable.
+	Hint string
+}
+
+func (e *AvailabilityError) Error() string {
+	return fmt.Sprintf("%v: %v. %s", e.Err, e.Cause, e.Hint)
+}
+
+func (e *AvailabilityError) Unwrap() error {
+	return e.Err
+}
+
+// availabilityTransport turns the failures telling that AMT is off, not set
+// up or out of reach into an *AvailabilityError.
+type availabilityTransport struct {
+	next http.RoundTripper
+}
+
+func (t *availabilityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, classifyDialError(err, req.URL.Port())
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil, &AvailabilityError{
+		Err:   ErrAMTUnprovisioned,
+		Cause: fmt.Errorf("%s returned %s", req.URL.Path, resp.Status),
+		Hint:  "Provision AMT from the host, e.g. with ActivateClientControlMode through LMS, or check that Connection.Path is the WS-Management path of the firmware",
+	}
+}
+
+// classifyDialError returns an *AvailabilityError for the errors of
+// connecting to port, err otherwise. Errors past the connection, e.g. a
+// reset in the middle of a response, say nothing about the setup of AMT.
+func classifyDialError(err error, port string) error {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		return err
+	}
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return &AvailabilityError{
+			Err:   ErrAMTDisabled,
+			Cause: err,
+			Hint:  fmt.Sprintf("The machine is up but nothing listens on port %s: enable AMT in the BIOS and the MEBx. Unprovisioned firmware doesn't listen either, check the provisioning state from the host with the mei package", port),
+		}
+	case opErr.Timeout(), errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return &AvailabilityError{
+			Err:   ErrAMTFirewalled,
+			Cause: err,
+			Hint:  fmt.Sprintf("Check that the firewalls between the client and the machine allow port %s and that the machine is connected to the network", port),
+		}
+	}
+	return err
+}
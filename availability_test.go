@@ -0,0 +1,50 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilityTransport_When_ConnectionRefused_Expect_ErrAMTDisabled(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	client := &http.Client{Transport: &availabilityTransport{next: http.DefaultTransport}}
+	_, err = client.Post("http://"+address+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	assert.ErrorIs(t, err, ErrAMTDisabled)
+	var availabilityErr *AvailabilityError
+	if assert.True(t, errors.As(err, &availabilityErr)) {
+		assert.Contains(t, availabilityErr.Hint, "BIOS")
+	}
+}
+
+func TestAvailabilityTransport_When_NotFound_Expect_ErrAMTUnprovisioned(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := &http.Client{Transport: &availabilityTransport{next: http.DefaultTransport}}
+	_, err := client.Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	assert.ErrorIs(t, err, ErrAMTUnprovisioned)
+}
+
+func TestClassifyDialError_When_DialTimesOut_Expect_ErrAMTFirewalled(t *testing.T) {
+	err := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	assert.ErrorIs(t, classifyDialError(err, "16992"), ErrAMTFirewalled)
+
+	// a failed read says nothing about the setup of AMT.
+	err = &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	assert.Equal(t, err, classifyDialError(err, "16992"))
+	assert.Equal(t, context.Canceled, classifyDialError(context.Canceled, "16992"))
+}
@@ -5,14 +5,28 @@ package amt
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/VictorLowther/simplexml/dom"
 	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
 )
 
 type bootConfigRole int
 
+// Boot sources that can be used with SetNextBoot and SetNextBootOrder.
+const (
+	BootSourceHardDrive = "Intel(r) AMT: Force Hard-drive Boot"
+	BootSourcePXE       = "Intel(r) AMT: Force PXE Boot"
+	BootSourceCDDVD     = "Intel(r) AMT: Force CD/DVD Boot"
+	// BootSourceOCRHTTPS is the One-Click Recovery UEFI HTTPS boot, see Recover.
+	BootSourceOCRHTTPS = "Intel(r) AMT: Force OCR UEFI HTTPS Boot"
+)
+
+const bootConfigSetting = "Intel(r) AMT: Boot Configuration 0"
+
 const (
 	bootConfigRoleIsNext          bootConfigRole = 0
 	bootConfigRoleIsNextSingleUse bootConfigRole = 1
@@ -21,40 +35,62 @@ const (
 	bootConfigRoleVendorSpecified bootConfigRole = 32768 // 32768..65535
 )
 
+// elementSettingIsNextSingleUse is the CIM_ElementSettingData IsNext of a
+// setting applied to the next boot only.
+const elementSettingIsNextSingleUse = "3"
+
+// bootConfigIsNextSingleUse reports whether the boot configuration still
+// applies to the next boot: the firmware clears the role once it was used.
+func bootConfigIsNextSingleUse(ctx context.Context, client *Client) (bool, error) {
+	items, err := enumerate(ctx, client, client.resourceURI(ResourceCIMElementSettingData))
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		setting := search.First(search.Tag("SettingData", "*"), item.Children())
+		if setting == nil {
+			continue
+		}
+		selector := search.First(search.Attr("Name", "*", "InstanceID"), setting.Descendants())
+		if selector == nil || string(selector.Content) != bootConfigSetting {
+			continue
+		}
+		return propertyContent(item.Children(), "IsNext") == elementSettingIsNextSingleUse, nil
+	}
+	return false, nil
+}
+
 func setBootConfigRole(ctx context.Context, client *Client, role bootConfigRole) error {
-	bootConfigRef, err := getBootConfigSettingRef(ctx, client, "Intel(r) AMT: Boot Configuration 0")
+	bootConfigRef, err := getBootConfigSettingRef(ctx, client, bootConfigSetting)
 	if err != nil {
 		return err
 	}
 
-	message := client.wsManClient.Invoke(resourceCIMBootService, "SetBootConfigRole")
-	bootConfigSetting := message.MakeParameter("BootConfigSetting")
-	bootConfigSetting.AddChildren(bootConfigRef.Children()...)
-	message.AddParameter(bootConfigSetting)
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceCIMBootService), "SetBootConfigRole")
+	AddReferenceParameter(message, "BootConfigSetting", bootConfigRef)
 	message.Parameters("Role", strconv.Itoa(int(role)))
 
-	_, err = sendMessageForReturnValueInt(ctx, message)
+	_, err = sendMessageForReturnValueInt(ctx, client, message)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// changeBootOrder sets the boot order of the boot configuration to the boot
+// sources items, in order. An empty items clears the boot order.
 func changeBootOrder(ctx context.Context, client *Client, items []string) error {
-	message := client.wsManClient.Invoke(resourceCIMBootConfigSetting, "ChangeBootOrder")
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceCIMBootConfigSetting), "ChangeBootOrder")
 
-	if len(items) > 0 {
-		// TODO: multiple?
-		pxeEndpointRef, err := getBootSourceRef(ctx, client, "Intel(r) AMT: Force PXE Boot")
+	for _, item := range items {
+		sourceRef, err := getBootSourceRef(ctx, client, item)
 		if err != nil {
 			return err
 		}
-		sourceParam := message.MakeParameter("Source")
-		sourceParam.AddChildren(pxeEndpointRef.Children()...)
-		message.AddParameter(sourceParam)
+		AddReferenceParameter(message, "Source", sourceRef)
 	}
 
-	_, err := sendMessageForReturnValueInt(ctx, message)
+	_, err := sendMessageForReturnValueInt(ctx, client, message)
 	if err != nil {
 		return err
 	}
@@ -62,19 +98,140 @@ func changeBootOrder(ctx context.Context, client *Client, items []string) error
 }
 
 func getBootSettingData(ctx context.Context, client *Client) ([]*dom.Element, error) {
-	msg := client.wsManClient.Get(resourceAMTBootSettingData)
-	response, err := msg.Send(ctx)
+	resource := client.resourceURI(ResourceAMTBootSettingData)
+	msg := client.wsManClient.Get(resource)
+	response, err := client.send(ctx, msg)
 	if err != nil {
 		return nil, err
 	}
-	data := search.FirstTag("AMT_BootSettingData", resourceAMTBootSettingData, response.Body())
+	data := client.namespaces.firstTag("AMT_BootSettingData", resource, response.Body())
 	if data == nil {
 		return nil, fmt.Errorf("response was missing the AMT_BootSettingData")
 	}
+	if client.strict {
+		if err := validateElements(client.namespaces, resource, data.Children(), response, "BIOSPause", "BIOSSetup", "BootMediaIndex"); err != nil {
+			return nil, err
+		}
+	}
 	return data.Children(), nil
 }
 
-func setBootSettingData(ctx context.Context, client *Client) error {
+// BootSettings are the options of the next boot, from AMT_BootSettingData.
+type BootSettings struct {
+	BIOSPause         bool
+	BIOSSetup         bool
+	BootMediaIndex    int
+	LockKeyboard      bool
+	LockPowerButton   bool
+	LockResetButton   bool
+	LockSleepButton   bool
+	ReflashBIOS       bool
+	UseIDER           bool
+	UseSOL            bool
+	UseSafeMode       bool
+	FirmwareVerbosity int
+}
+
+func getBootSettings(ctx context.Context, client *Client) (*BootSettings, error) {
+	data, err := getBootSettingData(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return parseBootSettings(data), nil
+}
+
+func parseBootSettings(data []*dom.Element) *BootSettings {
+	flag := func(name string) bool { return propertyContent(data, name) == "true" }
+	number := func(name string) int {
+		n, _ := strconv.Atoi(propertyContent(data, name))
+		return n
+	}
+	return &BootSettings{
+		BIOSPause:         flag("BIOSPause"),
+		BIOSSetup:         flag("BIOSSetup"),
+		BootMediaIndex:    number("BootMediaIndex"),
+		LockKeyboard:      flag("LockKeyboard"),
+		LockPowerButton:   flag("LockPowerButton"),
+		LockResetButton:   flag("LockResetButton"),
+		LockSleepButton:   flag("LockSleepButton"),
+		ReflashBIOS:       flag("ReflashBIOS"),
+		UseIDER:           flag("UseIDER"),
+		UseSOL:            flag("UseSOL"),
+		UseSafeMode:       flag("UseSafeMode"),
+		FirmwareVerbosity: number("FirmwareVerbosity"),
+	}
+}
+
+// Verify compares the settings read back from the firmware with the expected
+// ones. Some firmware silently ignores the settings it doesn't support.
+func (s *BootSettings) Verify(expected BootSettings) error {
+	fields := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"BIOSPause", s.BIOSPause, expected.BIOSPause},
+		{"BIOSSetup", s.BIOSSetup, expected.BIOSSetup},
+		{"BootMediaIndex", s.BootMediaIndex, expected.BootMediaIndex},
+		{"LockKeyboard", s.LockKeyboard, expected.LockKeyboard},
+		{"LockPowerButton", s.LockPowerButton, expected.LockPowerButton},
+		{"LockResetButton", s.LockResetButton, expected.LockResetButton},
+		{"LockSleepButton", s.LockSleepButton, expected.LockSleepButton},
+		{"ReflashBIOS", s.ReflashBIOS, expected.ReflashBIOS},
+		{"UseIDER", s.UseIDER, expected.UseIDER},
+		{"UseSOL", s.UseSOL, expected.UseSOL},
+		{"UseSafeMode", s.UseSafeMode, expected.UseSafeMode},
+		{"FirmwareVerbosity", s.FirmwareVerbosity, expected.FirmwareVerbosity},
+	}
+	mismatches := []string{}
+	for _, f := range fields {
+		if f.got != f.want {
+			mismatches = append(mismatches, fmt.Sprintf("%s is %v, expected %v", f.name, f.got, f.want))
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	return fmt.Errorf("boot settings were not applied: %s", strings.Join(mismatches, ", "))
+}
+
+// nextBootSettings are the AMT_BootSettingData properties cleared before
+// every boot change.
+var nextBootSettings = map[string]string{
+	"BIOSPause":      "false",
+	"BIOSSetup":      "false",
+	"BootMediaIndex": "0",
+}
+
+// defaultBootSettings are the writable AMT_BootSettingData properties with
+// their default values.
+var defaultBootSettings = map[string]string{
+	"BIOSPause":              "false",
+	"BIOSSetup":              "false",
+	"BootMediaIndex":         "0",
+	"ConfigurationDataReset": "false",
+	"FirmwareVerbosity":      "0",
+	"ForcedProgressEvents":   "false",
+	"IDERBootDevice":         "0",
+	"LockKeyboard":           "false",
+	"LockPowerButton":        "false",
+	"LockResetButton":        "false",
+	"LockSleepButton":        "false",
+	"ReflashBIOS":            "false",
+	"UseIDER":                "false",
+	"UseSOL":                 "false",
+	"UseSafeMode":            "false",
+	"UserPasswordBypass":     "false",
+}
+
+// setBootSettingData clears the options of the next boot and sets the UEFI
+// boot parameters to params.
+func setBootSettingData(ctx context.Context, client *Client, params ...uefiBootParameter) error {
+	return putBootSettingData(ctx, client, nextBootSettings, params...)
+}
+
+// putBootSettingData writes back the boot settings with the values of
+// settings and the UEFI boot parameters params.
+func putBootSettingData(ctx context.Context, client *Client, settings map[string]string, params ...uefiBootParameter) error {
 	bootSettings, err := getBootSettingData(ctx, client)
 	if err != nil {
 		return err
@@ -91,31 +248,44 @@ func setBootSettingData(ctx context.Context, client *Client) error {
 			"BootguardStatus",
 			"OptionsCleared",
 			"BIOSLastStatus",
-			"UefiBootParametersArray":
+			"UefiBootParametersArray",
+			"UefiBootNumberOfParams":
 			continue
-		// gonna make sure these are set to "false"
-		case "BIOSPause", "BIOSSetup":
-			setting.Content = []byte("false")
-			settingsToKeep = append(settingsToKeep, setting)
-		// gonna make sure these are set to "0"
-		case "BootMediaIndex":
-			setting.Content = []byte("0")
-			settingsToKeep = append(settingsToKeep, setting)
-		default:
-			settingsToKeep = append(settingsToKeep, setting)
 		}
+		if value, ok := settings[setting.Name.Local]; ok {
+			setting.Content = []byte(value)
+		}
+		settingsToKeep = append(settingsToKeep, setting)
 	}
 
-	msg := client.wsManClient.Put(resourceAMTBootSettingData)
-	data := dom.Elem("AMT_BootSettingData", resourceAMTBootSettingData)
-	data.AddChildren(settingsToKeep...)
-	msg.SetBody(data)
-	_, err = msg.Send(ctx)
-
+	envelope := client.NewEnvelope(wsman.PUT, ResourceAMTBootSettingData)
+	if len(params) > 0 {
+		settingsToKeep = append(settingsToKeep,
+			envelope.Property("UefiBootNumberOfParams", strconv.Itoa(len(params))),
+			envelope.Property("UefiBootParametersArray", encodeUEFIBootParameters(params)),
+		)
+	}
+	_, err = envelope.Instance(settingsToKeep...).Send(ctx)
 	return err
 }
 
-func setPXE(ctx context.Context, client *Client) error {
+// resetBootSettings restores the default boot configuration: it clears the
+// boot order, so the machine boots from its BIOS order, and the options and
+// UEFI boot parameters of AMT_BootSettingData left by failed boot changes.
+func resetBootSettings(ctx context.Context, client *Client) error {
+	err := client.step(OperationResetBootSettings, "boot order", func() error {
+		return changeBootOrder(ctx, client, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return client.step(OperationResetBootSettings, "boot settings", func() error {
+		return putBootSettingData(ctx, client, defaultBootSettings)
+	})
+}
+
+// setNextBoot makes the machine boot once from the boot source with InstanceID source.
+func setNextBoot(ctx context.Context, client *Client, source string) error {
 	// clear existing boot order per meshcommander's implementation...
 	// "Set the boot order to null, this is needed for some AMT versions that don't clear this automatically."
 	// err := changeBootOrder(client, []string{})
@@ -123,28 +293,111 @@ func setPXE(ctx context.Context, client *Client) error {
 	// 	return err
 	// }
 
-	err := setBootSettingData(ctx, client)
+	err := client.step(OperationSetNextBoot, "boot settings", func() error {
+		return setBootSettingData(ctx, client)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = setBootConfigRole(ctx, client, bootConfigRoleIsNextSingleUse)
+	err = client.step(OperationSetNextBoot, "boot config role", func() error {
+		return setBootConfigRole(ctx, client, bootConfigRoleIsNextSingleUse)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = changeBootOrder(ctx, client, []string{"Intel(r) AMT: Force PXE Boot"})
+	return client.step(OperationSetNextBoot, "boot order", func() error {
+		return changeBootOrder(ctx, client, []string{source})
+	})
+}
+
+// BootSource is a device the machine can boot from.
+type BootSource struct {
+	// InstanceID identifies the source, e.g. BootSourcePXE.
+	InstanceID string
+	// StructuredBootString is the vendor neutral description, e.g. "CIM:Network:1".
+	StructuredBootString string
+	// BIOSBootString is the description used by the BIOS.
+	BIOSBootString string
+	ElementName    string
+}
+
+func getBootSources(ctx context.Context, client *Client) ([]BootSource, error) {
+	items, err := enumerate(ctx, client, client.resourceURI(ResourceCIMBootSourceSetting))
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	return nil
+	sources := make([]BootSource, 0, len(items))
+	for _, item := range items {
+		properties := item.Children()
+		sources = append(sources, BootSource{
+			InstanceID:           propertyContent(properties, "InstanceID"),
+			StructuredBootString: propertyContent(properties, "StructuredBootString"),
+			BIOSBootString:       propertyContent(properties, "BIOSBootString"),
+			ElementName:          propertyContent(properties, "ElementName"),
+		})
+	}
+	return sources, nil
 }
 
 func getBootConfigSettingRef(ctx context.Context, client *Client, name string) (*dom.Element, error) {
-	return getEndpointReferenceByInstanceID(ctx, client, resourceCIMBootConfigSetting, name)
+	return getEndpointReferenceByInstanceID(ctx, client, client.resourceURI(ResourceCIMBootConfigSetting), name)
 }
 
 func getBootSourceRef(ctx context.Context, client *Client, name string) (*dom.Element, error) {
-	return getEndpointReferenceByInstanceID(ctx, client, resourceCIMBootSourceSetting, name)
+	return getEndpointReferenceByInstanceID(ctx, client, client.resourceURI(ResourceCIMBootSourceSetting), name)
+}
+
+func getBootOrder(ctx context.Context, client *Client) ([]string, error) {
+	response, err := client.send(ctx, client.wsManClient.Enumerate(client.resourceURI(ResourceCIMOrderedComponent)))
+	if err != nil {
+		return nil, err
+	}
+	items, err := response.EnumItems()
+	if err != nil {
+		return nil, err
+	}
+	return parseBootOrder(items, bootConfigSetting), nil
+}
+
+// parseBootOrder returns the InstanceIDs of the boot sources ordered under the
+// boot configuration configInstanceID, first to last. Sources with an
+// AssignedSequence of 0 are not part of the boot order.
+func parseBootOrder(items []*dom.Element, configInstanceID string) []string {
+	type source struct {
+		id       string
+		sequence int
+	}
+	sources := []source{}
+	for _, item := range items {
+		group := search.FirstTag("GroupComponent", "*", item.Children())
+		part := search.FirstTag("PartComponent", "*", item.Children())
+		sequence := search.FirstTag("AssignedSequence", "*", item.Children())
+		if group == nil || part == nil || sequence == nil {
+			continue
+		}
+		if instanceIDSelector(group) != configInstanceID {
+			continue
+		}
+		n, err := strconv.Atoi(string(sequence.Content))
+		if err != nil || n == 0 {
+			continue
+		}
+		sources = append(sources, source{id: instanceIDSelector(part), sequence: n})
+	}
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].sequence < sources[j].sequence })
+	order := make([]string, len(sources))
+	for i, s := range sources {
+		order[i] = s.id
+	}
+	return order
+}
+
+func instanceIDSelector(epr *dom.Element) string {
+	selector := search.First(search.Attr("Name", "*", "InstanceID"), epr.Descendants())
+	if selector == nil {
+		return ""
+	}
+	return string(selector.Content)
 }
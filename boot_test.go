@@ -0,0 +1,160 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func orderedComponent(config, source, sequence string) string {
+	return `<h:CIM_OrderedComponent xmlns:h="` + ResourceCIMOrderedComponent + `" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd">` +
+		`<h:AssignedSequence>` + sequence + `</h:AssignedSequence>` +
+		`<h:GroupComponent><w:SelectorSet><w:Selector Name="InstanceID">` + config + `</w:Selector></w:SelectorSet></h:GroupComponent>` +
+		`<h:PartComponent><w:SelectorSet><w:Selector Name="InstanceID">` + source + `</w:Selector></w:SelectorSet></h:PartComponent>` +
+		`</h:CIM_OrderedComponent>`
+}
+
+func TestParseBootOrder_When_SourcesAreOrdered_Expect_SortedBySequence(t *testing.T) {
+	items, err := dom.ParseElements(strings.NewReader(
+		orderedComponent(bootConfigSetting, BootSourcePXE, "2") +
+			orderedComponent(bootConfigSetting, BootSourceCDDVD, "0") +
+			orderedComponent("Intel(r) AMT: Boot Configuration 1", BootSourceCDDVD, "1") +
+			orderedComponent(bootConfigSetting, BootSourceHardDrive, "1"),
+	))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{BootSourceHardDrive, BootSourcePXE}, parseBootOrder(items, bootConfigSetting))
+}
+
+func TestBootSettingsVerify_When_FlagIsIgnored_Expect_Mismatch(t *testing.T) {
+	settings := parseBootSettings([]*dom.Element{
+		dom.ElemC("BIOSPause", ResourceAMTBootSettingData, "false"),
+		dom.ElemC("BIOSSetup", ResourceAMTBootSettingData, "false"),
+		dom.ElemC("BootMediaIndex", ResourceAMTBootSettingData, "0"),
+		dom.ElemC("UseSOL", ResourceAMTBootSettingData, "false"),
+	})
+	assert.NoError(t, settings.Verify(BootSettings{}))
+	err := settings.Verify(BootSettings{UseSOL: true})
+	if assert.Error(t, err) {
+		assert.Equal(t, "boot settings were not applied: UseSOL is false, expected true", err.Error())
+	}
+}
+
+func TestResetBootSettings_When_Called_Expect_BootOrderClearedFirst(t *testing.T) {
+	injected := errors.New("injected")
+	var requests []*Request
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Hooks: Hooks{OnRequest: func(ctx context.Context, request *Request) error {
+			requests = append(requests, request)
+			return injected
+		}},
+	})
+	assert.NoError(t, err)
+
+	err = client.ResetBootSettings(context.Background())
+	assert.ErrorIs(t, err, injected)
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, ResourceCIMBootConfigSetting, requests[0].ResourceURI)
+		assert.True(t, strings.HasSuffix(requests[0].Action, "ChangeBootOrder"))
+	}
+}
+
+func TestSetNextBootOrder_When_OrderChanges_Expect_NextSingleUseRoleSet(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_OrderedComponent Enumerate", enumerationBody(orderedComponent(bootConfigSetting, BootSourcePXE, "1")))
+	f.set("CIM_BootConfigSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootConfigSetting, "InstanceID", bootConfigSetting)))
+	f.set("CIM_BootSourceSetting Enumerate", enumerationBody(
+		referenceItem(ResourceCIMBootSourceSetting, "InstanceID", BootSourceHardDrive),
+		referenceItem(ResourceCIMBootSourceSetting, "InstanceID", BootSourcePXE),
+	))
+	f.set("CIM_BootService SetBootConfigRole", outputBody(ResourceCIMBootService, "SetBootConfigRole", 0))
+	f.set("CIM_BootConfigSetting ChangeBootOrder", outputBody(ResourceCIMBootConfigSetting, "ChangeBootOrder", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	result, err := client.ApplyNextBootOrder(context.Background(), []string{BootSourceHardDrive, BootSourcePXE})
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+	assert.Equal(t, []string{
+		"CIM_OrderedComponent Enumerate",
+		"CIM_BootConfigSetting Enumerate",
+		"CIM_BootService SetBootConfigRole",
+		"CIM_BootSourceSetting Enumerate",
+		"CIM_BootSourceSetting Enumerate",
+		"CIM_BootConfigSetting ChangeBootOrder",
+	}, f.received())
+	assert.Contains(t, f.body("CIM_BootService SetBootConfigRole"), "Role>1<")
+
+	// the order is already the one of the next boot.
+	f.set("CIM_ElementSettingData Enumerate", enumerationBody(elementSettingData(bootConfigSetting, "3")))
+	result, err = client.ApplyNextBootOrder(context.Background(), []string{BootSourcePXE})
+	assert.NoError(t, err)
+	assert.False(t, result.Changed)
+
+	// the machine booted with it, the order is set again.
+	f.set("CIM_ElementSettingData Enumerate", enumerationBody(elementSettingData(bootConfigSetting, "2")))
+	result, err = client.ApplyNextBootOrder(context.Background(), []string{BootSourcePXE})
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+}
+
+func TestBootSources_When_Enumerated_Expect_Descriptions(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_BootSourceSetting Enumerate", enumerationBody(
+		instanceBody(ResourceCIMBootSourceSetting, `<h:InstanceID>`+BootSourcePXE+`</h:InstanceID><h:StructuredBootString>CIM:Network:1</h:StructuredBootString><h:BIOSBootString>Intel Boot Agent</h:BIOSBootString><h:ElementName>Intel(r) AMT: Boot Source</h:ElementName>`),
+		instanceBody(ResourceCIMBootSourceSetting, `<h:InstanceID>Intel(r) AMT: Force Hard-drive Boot 2</h:InstanceID><h:StructuredBootString>CIM:Hard-Disk:2</h:StructuredBootString>`),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	sources, err := client.BootSources(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []BootSource{
+		{InstanceID: BootSourcePXE, StructuredBootString: "CIM:Network:1", BIOSBootString: "Intel Boot Agent", ElementName: "Intel(r) AMT: Boot Source"},
+		{InstanceID: "Intel(r) AMT: Force Hard-drive Boot 2", StructuredBootString: "CIM:Hard-Disk:2"},
+	}, sources)
+}
+
+func TestSetNextBoot_When_SourceIsListed_Expect_BootOrderOfSource(t *testing.T) {
+	const source = "Intel(r) AMT: Force Hard-drive Boot 2"
+	f := &fakeFirmware{}
+	f.set("CIM_OrderedComponent Enumerate", enumerationBody())
+	settings := instanceBody(ResourceAMTBootSettingData, `<h:BIOSPause>false</h:BIOSPause><h:BIOSSetup>false</h:BIOSSetup><h:BootMediaIndex>0</h:BootMediaIndex>`)
+	f.set("AMT_BootSettingData Get", settings)
+	f.set("AMT_BootSettingData Put", settings)
+	f.set("CIM_BootConfigSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootConfigSetting, "InstanceID", bootConfigSetting)))
+	f.set("CIM_BootService SetBootConfigRole", outputBody(ResourceCIMBootService, "SetBootConfigRole", 0))
+	f.set("CIM_BootSourceSetting Enumerate", enumerationBody(
+		referenceItem(ResourceCIMBootSourceSetting, "InstanceID", BootSourcePXE),
+		referenceItem(ResourceCIMBootSourceSetting, "InstanceID", source),
+	))
+	f.set("CIM_BootConfigSetting ChangeBootOrder", outputBody(ResourceCIMBootConfigSetting, "ChangeBootOrder", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.NoError(t, client.SetNextBoot(context.Background(), source))
+	body := f.body("CIM_BootConfigSetting ChangeBootOrder")
+	assert.Contains(t, body, `Name="InstanceID">`+source+`<`)
+	assert.NotContains(t, body, BootSourcePXE)
+	assert.Contains(t, f.body("CIM_BootService SetBootConfigRole"), "Role>1<")
+}
+
+func TestSetNextBoot_When_SourceIsUnknown_Expect_ErrorBeforeBootOrder(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_OrderedComponent Enumerate", enumerationBody())
+	settings := instanceBody(ResourceAMTBootSettingData, `<h:BIOSPause>false</h:BIOSPause>`)
+	f.set("AMT_BootSettingData Get", settings)
+	f.set("AMT_BootSettingData Put", settings)
+	f.set("CIM_BootConfigSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootConfigSetting, "InstanceID", bootConfigSetting)))
+	f.set("CIM_BootService SetBootConfigRole", outputBody(ResourceCIMBootService, "SetBootConfigRole", 0))
+	f.set("CIM_BootSourceSetting Enumerate", enumerationBody(referenceItem(ResourceCIMBootSourceSetting, "InstanceID", BootSourcePXE)))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.Error(t, client.SetNextBoot(context.Background(), "Intel(r) AMT: Force USB Boot 9"))
+	assert.NotContains(t, f.received(), "CIM_BootConfigSetting ChangeBootOrder")
+}
@@ -0,0 +1,165 @@
+package amt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+)
+
+// CanonicalOptions control Canonicalize.
+type CanonicalOptions struct {
+	// OmitMessageID leaves out the WS-Addressing MessageID, unique to every
+	// request, so the same request canonicalizes the same way each time it
+	// is sent, e.g. to diff requests or match them on replay.
+	OmitMessageID bool
+}
+
+// Canonicalize serializes message deterministically, so requests can be
+// hashed, signed and compared whatever the version of Go or of the encoder:
+//
+//   - namespaces get the prefixes n0, n1... in the order they are first used
+//     and are all declared on the envelope
+//   - attributes are sorted by namespace and name, namespace declarations of
+//     parsed messages are dropped
+//   - every element has an end tag and text is escaped as in Canonical XML
+//   - there is no XML declaration and no whitespace between elements
+//
+// The result is well formed XML equivalent to the message but it isn't W3C
+// Canonical XML.
+func Canonicalize(message *wsman.Message, options CanonicalOptions) []byte {
+	return canonicalize(message.Root(), options)
+}
+
+func canonicalize(root *dom.Element, options CanonicalOptions) []byte {
+	if root == nil {
+		return nil
+	}
+	c := &canonicalizer{prefixes: map[string]string{}}
+	if options.OmitMessageID {
+		c.omit = xml.Name{Space: wsman.NS_WSA, Local: "MessageID"}
+	}
+	c.collect(root)
+
+	var b bytes.Buffer
+	c.write(&b, root, true)
+	return b.Bytes()
+}
+
+type canonicalizer struct {
+	// prefixes maps the namespaces to their prefix, spaces are in order.
+	prefixes map[string]string
+	spaces   []string
+	omit     xml.Name
+}
+
+func (c *canonicalizer) skip(e *dom.Element) bool {
+	return c.omit.Local != "" && e.Name == c.omit
+}
+
+// collect assigns the prefixes in document order.
+func (c *canonicalizer) collect(e *dom.Element) {
+	if c.skip(e) {
+		return
+	}
+	c.prefix(e.Name.Space)
+	for _, a := range canonicalAttributes(e.Attributes) {
+		c.prefix(a.Name.Space)
+	}
+	for _, child := range e.Children() {
+		c.collect(child)
+	}
+}
+
+func (c *canonicalizer) prefix(space string) string {
+	if space == "" {
+		return ""
+	}
+	p, ok := c.prefixes[space]
+	if !ok {
+		p = "n" + strconv.Itoa(len(c.spaces))
+		c.prefixes[space] = p
+		c.spaces = append(c.spaces, space)
+	}
+	return p
+}
+
+func (c *canonicalizer) name(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return c.prefixes[n.Space] + ":" + n.Local
+}
+
+func (c *canonicalizer) write(b *bytes.Buffer, e *dom.Element, root bool) {
+	if c.skip(e) {
+		return
+	}
+	name := c.name(e.Name)
+	b.WriteString("<" + name)
+	if root {
+		for _, space := range c.spaces {
+			b.WriteString(" xmlns:" + c.prefixes[space] + `="`)
+			escapeCanonical(b, []byte(space), true)
+			b.WriteString(`"`)
+		}
+	}
+	for _, a := range canonicalAttributes(e.Attributes) {
+		b.WriteString(" " + c.name(a.Name) + `="`)
+		escapeCanonical(b, []byte(a.Value), true)
+		b.WriteString(`"`)
+	}
+	b.WriteString(">")
+	escapeCanonical(b, e.Content, false)
+	for _, child := range e.Children() {
+		c.write(b, child, false)
+	}
+	b.WriteString("</" + name + ">")
+}
+
+// canonicalAttributes returns attributes without the namespace declarations,
+// sorted by namespace and name.
+func canonicalAttributes(attributes []xml.Attr) []xml.Attr {
+	sorted := make([]xml.Attr, 0, len(attributes))
+	for _, a := range attributes {
+		if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+			continue
+		}
+		sorted = append(sorted, a)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name.Space != sorted[j].Name.Space {
+			return sorted[i].Name.Space < sorted[j].Name.Space
+		}
+		return sorted[i].Name.Local < sorted[j].Name.Local
+	})
+	return sorted
+}
+
+// escapeCanonical escapes text or, when attribute is set, an attribute value
+// the way Canonical XML does.
+func escapeCanonical(b *bytes.Buffer, s []byte, attribute bool) {
+	for _, r := range string(s) {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>' && !attribute:
+			b.WriteString("&gt;")
+		case r == '"' && attribute:
+			b.WriteString("&quot;")
+		case r == '\t' && attribute:
+			b.WriteString("&#x9;")
+		case r == '\n' && attribute:
+			b.WriteString("&#xA;")
+		case r == '\r':
+			b.WriteString("&#xD;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
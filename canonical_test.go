@@ -0,0 +1,43 @@
+package amt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalize_When_MessageIDOmitted_Expect_SameRequestsEqual(t *testing.T) {
+	client, err := NewClient(Connection{Host: "192.0.2.1"})
+	assert.NoError(t, err)
+	request := func() *wsman.Message {
+		message := client.wsManClient.Invoke(ResourceCIMBootService, "SetBootConfigRole")
+		message.Parameters("Role", "1")
+		return message
+	}
+	a, b := request(), request()
+
+	assert.NotEqual(t, Canonicalize(a, CanonicalOptions{}), Canonicalize(b, CanonicalOptions{}))
+	canonical := Canonicalize(a, CanonicalOptions{OmitMessageID: true})
+	assert.Equal(t, canonical, Canonicalize(b, CanonicalOptions{OmitMessageID: true}))
+	assert.NotContains(t, string(canonical), "MessageID")
+}
+
+func TestCanonicalize_When_Reparsed_Expect_SameBytes(t *testing.T) {
+	root := dom.Elem("Envelope", "urn:envelope").AddChild(
+		dom.Elem("Item", "urn:item").
+			Attr("b", "", "2").
+			Attr("a", "", "1").
+			AddChild(dom.ElemC("Value", "urn:item", "a < b & c")),
+	)
+	canonical := canonicalize(root, CanonicalOptions{})
+	assert.Equal(t, `<n0:Envelope xmlns:n0="urn:envelope" xmlns:n1="urn:item"><n1:Item a="1" b="2"><n1:Value>a &lt; b &amp; c</n1:Value></n1:Item></n0:Envelope>`, string(canonical))
+
+	// the encoder of dom declares the namespaces its own way.
+	doc, err := dom.Parse(bytes.NewReader(root.Bytes()))
+	if assert.NoError(t, err) {
+		assert.Equal(t, canonical, canonicalize(doc.Root(), CanonicalOptions{}))
+	}
+}
@@ -0,0 +1,126 @@
+package amt
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// CIM_PowerManagementCapabilities PowerChangeCapabilities values.
+const (
+	powerChangeStateSettable       = 3
+	powerChangeCycling             = 4
+	powerChangeTimedPowerOn        = 5
+	powerChangeOffHardPowerCycling = 6
+	powerChangeHardwareReset       = 7
+	powerChangeGracefulShutdown    = 8
+)
+
+// PowerActions are the power actions, in the order of PowerCapabilities.Actions.
+var PowerActions = []PowerAction{
+	PowerActionOn,
+	PowerActionOff,
+	PowerActionCycle,
+	PowerActionSleep,
+	PowerActionReset,
+	PowerActionDiag,
+	PowerActionSoft,
+	PowerActionHardOff,
+	PowerActionHardCycle,
+	PowerActionSoftCycle,
+}
+
+// PowerCapabilities is the power transition matrix of a machine, e.g. for a
+// UI to grey out the actions a model doesn't support.
+type PowerCapabilities struct {
+	// Supported are the PowerStatesSupported of
+	// CIM_PowerManagementCapabilities, the states the model can be
+	// requested to go to at all.
+	Supported []PowerState
+	// The PowerChangeCapabilities of CIM_PowerManagementCapabilities.
+	StateSettable       bool
+	Cycling             bool
+	TimedPowerOn        bool
+	OffHardPowerCycling bool
+	HardwareReset       bool
+	GracefulShutdown    bool
+	// Current is the power state of the machine and Available the states it
+	// can transition to from it.
+	Current   PowerState
+	Available []PowerState
+	// Actions are the plans of every power action from Current, see
+	// PlanPowerTransition.
+	Actions []TransitionPlan
+}
+
+// Possible reports whether action does something from the current state,
+// either because it's already done or because a state can be requested.
+func (c *PowerCapabilities) Possible(action PowerAction) bool {
+	for _, plan := range c.Actions {
+		if plan.Action == action {
+			return plan.Done || plan.Request != PowerStateUnknown
+		}
+	}
+	return false
+}
+
+func getPowerCapabilities(ctx context.Context, client *Client) (*PowerCapabilities, error) {
+	properties, err := getInstance(ctx, client, client.resourceURI(ResourceCIMPowerManagementCapabilities))
+	if err != nil {
+		return nil, err
+	}
+	capabilities := parsePowerCapabilities(properties)
+
+	status, err := getPowerStatus(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	capabilities.Current = status.currentState
+	capabilities.Available = status.AvailableRequestedpowerStates
+	q := getQuirks(ctx, client)
+	for _, action := range PowerActions {
+		plan, err := planTransition(q, status, action)
+		if err != nil {
+			return nil, err
+		}
+		capabilities.Actions = append(capabilities.Actions, *plan)
+	}
+	return capabilities, nil
+}
+
+// parsePowerCapabilities reads the array properties of
+// CIM_PowerManagementCapabilities, one element per value.
+func parsePowerCapabilities(properties []*dom.Element) *PowerCapabilities {
+	capabilities := &PowerCapabilities{}
+	for _, p := range properties {
+		value, err := strconv.Atoi(string(p.Content))
+		if err != nil {
+			continue
+		}
+		switch p.Name.Local {
+		case "PowerStatesSupported":
+			capabilities.Supported = append(capabilities.Supported, PowerState(value))
+		case "PowerChangeCapabilities":
+			capabilities.setChangeCapability(value)
+		}
+	}
+	return capabilities
+}
+
+func (c *PowerCapabilities) setChangeCapability(value int) {
+	switch value {
+	case powerChangeStateSettable:
+		c.StateSettable = true
+	case powerChangeCycling:
+		c.Cycling = true
+	case powerChangeTimedPowerOn:
+		c.TimedPowerOn = true
+	case powerChangeOffHardPowerCycling:
+		c.OffHardPowerCycling = true
+	case powerChangeHardwareReset:
+		c.HardwareReset = true
+	case powerChangeGracefulShutdown:
+		c.GracefulShutdown = true
+	}
+}
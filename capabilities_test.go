@@ -0,0 +1,43 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePowerCapabilities_When_ArrayProperties_Expect_Matrix(t *testing.T) {
+	property := func(name, value string) *dom.Element {
+		return dom.ElemC(name, ResourceCIMPowerManagementCapabilities, value)
+	}
+	capabilities := parsePowerCapabilities([]*dom.Element{
+		property("ElementName", "Power Management Capabilities"),
+		property("PowerChangeCapabilities", "3"),
+		property("PowerChangeCapabilities", "4"),
+		property("PowerChangeCapabilities", "7"),
+		property("PowerStatesSupported", "2"),
+		property("PowerStatesSupported", "8"),
+		property("PowerStatesSupported", "10"),
+	})
+
+	assert.Equal(t, []PowerState{PowerStateOn, PowerStateOffSoft, PowerStateMasterBusReset}, capabilities.Supported)
+	assert.True(t, capabilities.StateSettable)
+	assert.True(t, capabilities.Cycling)
+	assert.True(t, capabilities.HardwareReset)
+	assert.False(t, capabilities.GracefulShutdown)
+}
+
+func TestPowerCapabilitiesPossible_When_Planned_Expect_RequestOrDone(t *testing.T) {
+	status := &powerStatus{currentState: PowerStateOffSoft, AvailableRequestedpowerStates: []PowerState{PowerStateOn}}
+	capabilities := &PowerCapabilities{}
+	for _, action := range PowerActions {
+		plan, err := planTransition(quirks{}, status, action)
+		assert.NoError(t, err)
+		capabilities.Actions = append(capabilities.Actions, *plan)
+	}
+
+	assert.True(t, capabilities.Possible(PowerActionOn))
+	assert.True(t, capabilities.Possible(PowerActionOff))
+	assert.False(t, capabilities.Possible(PowerActionReset))
+}
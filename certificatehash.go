@@ -0,0 +1,91 @@
+package amt
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+)
+
+// AMT_ProvisioningCertificateHash HashType values.
+const (
+	hashTypeSHA1   = 1
+	hashTypeSHA256 = 2
+	hashTypeSHA384 = 3
+)
+
+var hashTypes = map[int]int{
+	20: hashTypeSHA1,
+	32: hashTypeSHA256,
+	48: hashTypeSHA384,
+}
+
+// CertificateHash is a trusted root certificate hash used to verify the
+// provisioning certificate during admin control mode activation.
+type CertificateHash struct {
+	InstanceID string
+	Name       string
+	// Hash of the root certificate, SHA-1, SHA-256 or SHA-384 by its length.
+	Hash []byte
+	// Default is true for the hashes that ship with the firmware.
+	Default bool
+	Enabled bool
+}
+
+func getCertificateHashes(ctx context.Context, client *Client) ([]CertificateHash, error) {
+	items, err := enumerate(ctx, client, client.resourceURI(ResourceAMTProvisioningCertificateHash))
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]CertificateHash, 0, len(items))
+	for _, item := range items {
+		h, err := parseCertificateHash(item.Children())
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, *h)
+	}
+	return hashes, nil
+}
+
+func parseCertificateHash(properties []*dom.Element) (*CertificateHash, error) {
+	h := &CertificateHash{
+		InstanceID: propertyContent(properties, "InstanceID"),
+		Name:       propertyContent(properties, "ElementName"),
+		Default:    propertyContent(properties, "IsDefault") == "true",
+		Enabled:    propertyContent(properties, "Enabled") == "true",
+	}
+	hash, err := base64.StdEncoding.DecodeString(propertyContent(properties, "HashData"))
+	if err != nil {
+		return nil, fmt.Errorf("certificate hash %s: %v", h.InstanceID, err)
+	}
+	h.Hash = hash
+	return h, nil
+}
+
+func addCertificateHash(ctx context.Context, client *Client, name string, hash []byte) error {
+	hashType, ok := hashTypes[len(hash)]
+	if !ok {
+		return fmt.Errorf("a certificate hash of %d bytes is not SHA-1, SHA-256 or SHA-384", len(hash))
+	}
+	envelope := client.NewEnvelope(wsman.CREATE, ResourceAMTProvisioningCertificateHash)
+	envelope.Instance(
+		envelope.Property("ElementName", name),
+		envelope.Property("Enabled", "true"),
+		envelope.Property("HashData", base64.StdEncoding.EncodeToString(hash)),
+		envelope.Property("HashType", strconv.Itoa(hashType)),
+		envelope.Property("IsDefault", "false"),
+	)
+	_, err := envelope.Send(ctx)
+	return err
+}
+
+func deleteCertificateHash(ctx context.Context, client *Client, instanceID string) error {
+	message := client.wsManClient.Delete(client.resourceURI(ResourceAMTProvisioningCertificateHash))
+	message.Selectors("InstanceID", instanceID)
+	_, err := client.send(ctx, message)
+	return err
+}
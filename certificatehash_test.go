@@ -0,0 +1,96 @@
+package amt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func certificateHashItem(instanceID, name string, hash []byte, isDefault, enabled string) string {
+	return instanceBody(ResourceAMTProvisioningCertificateHash,
+		`<h:InstanceID>`+instanceID+`</h:InstanceID><h:ElementName>`+name+`</h:ElementName>`+
+			`<h:HashData>`+base64.StdEncoding.EncodeToString(hash)+`</h:HashData>`+
+			`<h:IsDefault>`+isDefault+`</h:IsDefault><h:Enabled>`+enabled+`</h:Enabled>`)
+}
+
+func TestCertificateHashes_When_Enumerated_Expect_DecodedHashes(t *testing.T) {
+	sha1 := bytes.Repeat([]byte{1}, 20)
+	sha256 := bytes.Repeat([]byte{2}, 32)
+	f := &fakeFirmware{}
+	f.set("AMT_ProvisioningCertificateHash Enumerate", enumerationBody(
+		certificateHashItem("Intel(r) AMT Certificate Hash: 0", "VeriSign Class 3", sha1, "true", "true"),
+		certificateHashItem("Intel(r) AMT Certificate Hash: 1", "fleet root", sha256, "false", "false"),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	hashes, err := client.CertificateHashes(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []CertificateHash{
+		{InstanceID: "Intel(r) AMT Certificate Hash: 0", Name: "VeriSign Class 3", Hash: sha1, Default: true, Enabled: true},
+		{InstanceID: "Intel(r) AMT Certificate Hash: 1", Name: "fleet root", Hash: sha256},
+	}, hashes)
+}
+
+func TestCertificateHashes_When_HashDataIsInvalid_Expect_Error(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_ProvisioningCertificateHash Enumerate", enumerationBody(
+		instanceBody(ResourceAMTProvisioningCertificateHash, `<h:InstanceID>hash</h:InstanceID><h:HashData>not base64!</h:HashData>`),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	_, err := client.CertificateHashes(context.Background())
+	assert.Error(t, err)
+}
+
+func TestAddCertificateHash_When_HashLengthIsKnown_Expect_HashType(t *testing.T) {
+	tests := map[string]struct {
+		size     int
+		hashType string
+	}{
+		"SHA-1":   {size: 20, hashType: "HashType>1<"},
+		"SHA-256": {size: 32, hashType: "HashType>2<"},
+		"SHA-384": {size: 48, hashType: "HashType>3<"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			hash := bytes.Repeat([]byte{3}, tt.size)
+			f := &fakeFirmware{}
+			f.set("AMT_ProvisioningCertificateHash Enumerate", enumerationBody())
+			f.set("AMT_ProvisioningCertificateHash Create", `<t:ResourceCreated xmlns:t="http://schemas.xmlsoap.org/ws/2004/09/transfer"/>`)
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			assert.NoError(t, client.AddCertificateHash(context.Background(), "fleet root", hash))
+			body := f.body("AMT_ProvisioningCertificateHash Create")
+			assert.Contains(t, body, tt.hashType)
+			assert.Contains(t, body, "HashData>"+base64.StdEncoding.EncodeToString(hash)+"<")
+			assert.Contains(t, body, "ElementName>fleet root<")
+			assert.Contains(t, body, "Enabled>true<")
+		})
+	}
+}
+
+func TestAddCertificateHash_When_HashLengthIsUnknown_Expect_ErrorWithoutRequest(t *testing.T) {
+	f := &fakeFirmware{}
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	err := client.AddCertificateHash(context.Background(), "md5 root", make([]byte, 16))
+	assert.EqualError(t, err, "a certificate hash of 16 bytes is not SHA-1, SHA-256 or SHA-384")
+	assert.Empty(t, f.received())
+}
+
+func TestDeleteCertificateHash_When_Called_Expect_SelectedByInstanceID(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_ProvisioningCertificateHash Delete", "")
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.NoError(t, client.DeleteCertificateHash(context.Background(), "Intel(r) AMT Certificate Hash: 1"))
+	assert.Contains(t, f.body("AMT_ProvisioningCertificateHash Delete"), `Name="InstanceID">Intel(r) AMT Certificate Hash: 1<`)
+}
@@ -0,0 +1,119 @@
+package amt
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+)
+
+// Certificate is a certificate installed in the firmware.
+type Certificate struct {
+	InstanceID string
+	Subject    string
+	Issuer     string
+	NotBefore  time.Time
+	NotAfter   time.Time
+	// TrustedRoot is true for CA certificates trusted by the firmware.
+	TrustedRoot bool
+	ReadOnly    bool
+	// UsedForTLS is true when the certificate is the TLS server certificate.
+	UsedForTLS bool
+	// UsedFor8021x is true when the certificate is used by an 802.1x profile.
+	UsedFor8021x bool
+	Certificate  *x509.Certificate
+}
+
+func getCertificates(ctx context.Context, client *Client) ([]Certificate, error) {
+	items, err := enumerate(ctx, client, client.resourceURI(ResourceAMTPublicKeyCertificate))
+	if err != nil {
+		return nil, err
+	}
+	certificates := make([]Certificate, 0, len(items))
+	for _, item := range items {
+		c, err := parseCertificate(item.Children())
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, *c)
+	}
+
+	tls, err := credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMTTLSCredentialContext))
+	if err != nil {
+		return nil, err
+	}
+	ieee8021x, err := credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMT8021xCredentialContext))
+	if err != nil {
+		// not every firmware has 802.1x, don't fail the listing because of it.
+		client.logger.V(1).Info("could not list the 802.1x certificates", "error", err.Error())
+	}
+	for i := range certificates {
+		certificates[i].UsedForTLS = tls[certificates[i].InstanceID]
+		certificates[i].UsedFor8021x = ieee8021x[certificates[i].InstanceID]
+	}
+	return certificates, nil
+}
+
+func parseCertificate(properties []*dom.Element) (*Certificate, error) {
+	c := &Certificate{
+		InstanceID: propertyContent(properties, "InstanceID"),
+		Subject:    propertyContent(properties, "Subject"),
+		Issuer:     propertyContent(properties, "Issuer"),
+		ReadOnly:   propertyContent(properties, "ReadOnlyCertificate") == "true",
+		// the property name is misspelled in the AMT schema.
+		TrustedRoot: propertyContent(properties, "TrustedRootCertficate") == "true",
+	}
+	der, err := base64.StdEncoding.DecodeString(propertyContent(properties, "X509Certificate"))
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %v", c.InstanceID, err)
+	}
+	c.Certificate, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s: %v", c.InstanceID, err)
+	}
+	c.NotBefore = c.Certificate.NotBefore
+	c.NotAfter = c.Certificate.NotAfter
+	return c, nil
+}
+
+// credentialContextCertificates returns the InstanceIDs of the certificates
+// that are the ElementInContext of a credential context.
+func credentialContextCertificates(ctx context.Context, client *Client, resource string) (map[string]bool, error) {
+	items, err := enumerate(ctx, client, resource)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, item := range items {
+		element := search.FirstTag("ElementInContext", "*", item.Children())
+		if element == nil {
+			continue
+		}
+		if id := instanceIDSelector(element); id != "" {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// ExpiringCertificates returns the certificates used for TLS or 802.1x that
+// expire within window, soonest first. Remote access breaks when they do.
+func ExpiringCertificates(certificates []Certificate, window time.Duration) []Certificate {
+	return expiringCertificates(certificates, time.Now().Add(window))
+}
+
+func expiringCertificates(certificates []Certificate, deadline time.Time) []Certificate {
+	expiring := []Certificate{}
+	for _, c := range certificates {
+		if (c.UsedForTLS || c.UsedFor8021x) && c.NotAfter.Before(deadline) {
+			expiring = append(expiring, c)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool { return expiring[i].NotAfter.Before(expiring[j].NotAfter) })
+	return expiring
+}
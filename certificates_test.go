@@ -0,0 +1,55 @@
+package amt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCertificate_When_CertificateIsValid_Expect_Expiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "amt"},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	c, err := parseCertificate([]*dom.Element{
+		dom.ElemC("InstanceID", ResourceAMTPublicKeyCertificate, "Intel(r) AMT Certificate: Handle: 0"),
+		dom.ElemC("X509Certificate", ResourceAMTPublicKeyCertificate, base64.StdEncoding.EncodeToString(der)),
+		dom.ElemC("TrustedRootCertficate", ResourceAMTPublicKeyCertificate, "false"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Intel(r) AMT Certificate: Handle: 0", c.InstanceID)
+	assert.Equal(t, notAfter, c.NotAfter)
+	assert.False(t, c.TrustedRoot)
+}
+
+func TestExpiringCertificates_When_UnusedCertificateExpires_Expect_Ignored(t *testing.T) {
+	now := time.Now()
+	certificates := []Certificate{
+		{InstanceID: "unused", NotAfter: now.Add(time.Hour)},
+		{InstanceID: "tls", NotAfter: now.Add(2 * time.Hour), UsedForTLS: true},
+		{InstanceID: "8021x", NotAfter: now.Add(time.Hour), UsedFor8021x: true},
+		{InstanceID: "later", NotAfter: now.Add(48 * time.Hour), UsedForTLS: true},
+	}
+	expiring := expiringCertificates(certificates, now.Add(24*time.Hour))
+	if assert.Len(t, expiring, 2) {
+		assert.Equal(t, "8021x", expiring[0].InstanceID)
+		assert.Equal(t, "tls", expiring[1].InstanceID)
+	}
+}
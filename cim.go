@@ -3,6 +3,7 @@ package amt
 import (
 	"context"
 	"fmt"
+	"path"
 	"strconv"
 
 	"github.com/VictorLowther/simplexml/dom"
@@ -10,19 +11,38 @@ import (
 	"github.com/jacobweinstock/wsman"
 )
 
+// Resource URIs of the CIM classes used by the client. Connection.ResourceURIs
+// can replace them.
 const (
-	resourceCIMAssociatedPowerManagementService = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_AssociatedPowerManagementService"
-	resourceCIMBootConfigSetting                = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootConfigSetting"
-	resourceCIMBootService                      = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootService"
-	resourceCIMBootSourceSetting                = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootSourceSetting"
-	resourceCIMPowerManagementService           = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_PowerManagementService"
-	resourceCIMComputerSystem                   = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ComputerSystem"
+	ResourceCIMAssociatedPowerManagementService = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_AssociatedPowerManagementService"
+	ResourceCIMBootConfigSetting                = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootConfigSetting"
+	ResourceCIMBootService                      = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootService"
+	ResourceCIMBootSourceSetting                = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BootSourceSetting"
+	ResourceCIMPowerManagementCapabilities      = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_PowerManagementCapabilities"
+	ResourceCIMPowerManagementService           = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_PowerManagementService"
+	ResourceCIMKVMRedirectionSAP                = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_KVMRedirectionSAP"
+	ResourceCIMOrderedComponent                 = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_OrderedComponent"
+	ResourceCIMComputerSystem                   = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ComputerSystem"
+	ResourceCIMComputerSystemPackage            = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ComputerSystemPackage"
+	ResourceCIMElementSettingData               = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ElementSettingData"
+	ResourceCIMEthernetPort                     = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_EthernetPort"
+	ResourceCIMWiFiEndpointSettings             = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_WiFiEndpointSettings"
+	ResourceCIMSoftwareIdentity                 = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_SoftwareIdentity"
+	ResourceCIMFilterCollection                 = "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_FilterCollection"
 )
 
+// resourceURI returns the resource URI the client uses in place of uri.
+func (c *Client) resourceURI(uri string) string {
+	if override, ok := c.resources[uri]; ok {
+		return override
+	}
+	return uri
+}
+
 func getEndpointReferenceBySelector(ctx context.Context, client *Client, namespace string, selectorName string, selectorValue string) (*dom.Element, error) {
 	message := client.wsManClient.EnumerateEPR(namespace)
 
-	response, err := message.Send(ctx)
+	response, err := client.send(ctx, message)
 	if err != nil {
 		return nil, err
 	}
@@ -46,31 +66,167 @@ func getEndpointReferenceByInstanceID(ctx context.Context, client *Client, names
 }
 
 func getComputerSystemRef(ctx context.Context, client *Client, name string) (*dom.Element, error) {
-	return getEndpointReferenceBySelector(ctx, client, resourceCIMComputerSystem, "Name", name)
+	return getEndpointReferenceBySelector(ctx, client, client.resourceURI(ResourceCIMComputerSystem), "Name", name)
+}
+
+// enumerate returns every instance of resource.
+func enumerate(ctx context.Context, client *Client, resource string) ([]*dom.Element, error) {
+	response, err := client.send(ctx, client.wsManClient.Enumerate(resource))
+	if err != nil {
+		return nil, err
+	}
+	return response.EnumItems()
+}
+
+// getInstance gets the single instance of resource and returns its properties.
+// The class name is the last element of the resource URI. In strict mode the
+// required properties must be present.
+func getInstance(ctx context.Context, client *Client, resource string, required ...string) ([]*dom.Element, error) {
+	return getInstanceByID(ctx, client, resource, "", required...)
+}
+
+// getInstanceByID is getInstance for the instance of resource with InstanceID
+// instanceID. An empty instanceID gets the single instance.
+func getInstanceByID(ctx context.Context, client *Client, resource, instanceID string, required ...string) ([]*dom.Element, error) {
+	message := client.wsManClient.Get(resource)
+	if instanceID != "" {
+		message.Selectors("InstanceID", instanceID)
+	}
+	response, err := client.send(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	class := path.Base(resource)
+	instance := client.namespaces.firstTag(class, resource, response.Body())
+	if instance == nil {
+		return nil, fmt.Errorf("response was missing the %s", class)
+	}
+	if client.strict {
+		if err := validateElements(client.namespaces, resource, instance.Children(), response, required...); err != nil {
+			return nil, err
+		}
+	}
+	return instance.Children(), nil
+}
+
+// propertyContent returns the content of the property name, or "" when it is missing.
+func propertyContent(properties []*dom.Element, name string) string {
+	for _, p := range properties {
+		if p.Name.Local == name {
+			return string(p.Content)
+		}
+	}
+	return ""
+}
+
+// updateInstance sets the property name of the single instance of resource to
+// value and returns the previous value.
+func updateInstance(ctx context.Context, client *Client, resource, name, value string) (string, error) {
+	return updateInstanceByID(ctx, client, resource, "", name, value)
+}
+
+// updateInstanceByID is updateInstance for the instance of resource with
+// InstanceID instanceID.
+func updateInstanceByID(ctx context.Context, client *Client, resource, instanceID, name, value string) (string, error) {
+	properties, err := getInstanceByID(ctx, client, resource, instanceID, name)
+	if err != nil {
+		return "", err
+	}
+	var previous *dom.Element
+	for _, p := range properties {
+		if p.Name.Local == name {
+			previous = p
+			break
+		}
+	}
+	if previous == nil {
+		return "", fmt.Errorf("%s has no %s property", path.Base(resource), name)
+	}
+	old := string(previous.Content)
+	previous.Content = []byte(value)
+
+	envelope := newEnvelope(client, client.wsManClient.Put(resource))
+	if instanceID != "" {
+		envelope.Selector("InstanceID", instanceID)
+	}
+	if _, err := envelope.Instance(properties...).Send(ctx); err != nil {
+		return "", err
+	}
+	return old, nil
+}
+
+// requestStateChange calls RequestStateChange on the single instance of resource.
+func requestStateChange(ctx context.Context, client *Client, resource string, state int) error {
+	message := client.wsManClient.Invoke(resource, "RequestStateChange")
+	message.Parameters("RequestedState", strconv.Itoa(state))
+	_, err := sendMessageForReturnValueInt(ctx, client, message)
+	return err
+}
+
+// deleteInstances deletes every instance of resource.
+func deleteInstances(ctx context.Context, client *Client, resource string) error {
+	response, err := client.send(ctx, client.wsManClient.EnumerateEPR(resource))
+	if err != nil {
+		return err
+	}
+	eprs, err := response.EnumItems()
+	if err != nil {
+		return err
+	}
+	for _, epr := range eprs {
+		message := client.wsManClient.Delete(resource)
+		addSelectorsFromReference(message, epr)
+		if _, err := client.send(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func getReturnValueInt(response *wsman.Message) (int, error) {
-	returnElement := search.FirstTag("ReturnValue", "*", response.AllBodyElements())
+func getReturnValueInt(client *Client, response *wsman.Message, namespace string) (int, error) {
+	returnElement := client.namespaces.firstTag("ReturnValue", namespace, response.AllBodyElements())
 	if returnElement == nil {
 		return -1, fmt.Errorf("no ReturnValue found in the response")
 	}
 	return strconv.Atoi(string(returnElement.Content))
 }
 
-func sendMessageForReturnValueInt(ctx context.Context, message *wsman.Message) (int, error) {
-	response, err := message.Send(ctx)
+func sendMessageForReturnValueInt(ctx context.Context, client *Client, message *wsman.Message) (int, error) {
+	_, returnValue, err := sendInvoke(ctx, client, message)
+	return returnValue, err
+}
+
+func sendInvoke(ctx context.Context, client *Client, message *wsman.Message) (*wsman.Message, int, error) {
+	response, err := client.send(ctx, message)
 	if err != nil {
-		return -1, err
+		return nil, -1, err
+	}
+	namespace := "*"
+	if client.strict {
+		if err := validateInvokeResponse(client.namespaces, message, response); err != nil {
+			return response, -1, err
+		}
+		namespace = message.GetResource()
 	}
-	returnValue, err := getReturnValueInt(response)
+	returnValue, err := getReturnValueInt(client, response, namespace)
 
 	if err != nil {
-		return -1, err
+		return response, -1, err
 	}
 
 	if returnValue == 0 {
-		return returnValue, nil
+		return response, returnValue, nil
 	}
 
-	return returnValue, fmt.Errorf("received invalid return value %d", returnValue)
+	if returnValue == returnValueFlashWriteLimitExceeded {
+		return response, returnValue, fmt.Errorf("%w: received return value %d", ErrFlashWriteLimitExceeded, returnValue)
+	}
+	return response, returnValue, fmt.Errorf("received invalid return value %d", returnValue)
+}
+
+// AddReferenceParameter adds the endpoint reference epr as the parameter name of an invoke message.
+func AddReferenceParameter(message *wsman.Message, name string, epr *dom.Element) {
+	param := message.MakeParameter(name)
+	param.AddChildren(epr.Children()...)
+	message.AddParameter(param)
 }
@@ -0,0 +1,88 @@
+//go:generate go run gen.go
+
+// Package cim has Go types for the commonly used CIM, AMT and IPS classes,
+// generated from classes.txt. They give typed access to the properties the
+// amt package does not expose, e.g.
+//
+//	var settings cim.AMTGeneralSettings
+//	err := client.GetInstance(ctx, &settings)
+//
+// Missing properties are left to their zero value.
+package cim
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// Class is an instance of a class.
+type Class interface {
+	// ResourceURI returns the resource URI of the class.
+	ResourceURI() string
+}
+
+// Decode sets the fields of v, a pointer to a class, from the properties of an
+// instance. Properties without a field are ignored and array properties are
+// appended, v should be the zero value.
+func Decode(properties []*dom.Element, v Class) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cim: decode needs a non-nil pointer to a struct, got %T", v)
+	}
+	rv = rv.Elem()
+	fields := map[string]reflect.Value{}
+	for i := 0; i < rv.NumField(); i++ {
+		if name := rv.Type().Field(i).Tag.Get("cim"); name != "" {
+			fields[name] = rv.Field(i)
+		}
+	}
+	for _, p := range properties {
+		field, ok := fields[p.Name.Local]
+		if !ok {
+			continue
+		}
+		if field.Kind() == reflect.Slice {
+			value := reflect.New(field.Type().Elem()).Elem()
+			if err := setValue(value, string(p.Content)); err != nil {
+				return fmt.Errorf("cim: %s: %w", p.Name.Local, err)
+			}
+			field.Set(reflect.Append(field, value))
+			continue
+		}
+		if err := setValue(field, string(p.Content)); err != nil {
+			return fmt.Errorf("cim: %s: %w", p.Name.Local, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, content string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(content)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(content)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(content, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(content, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package cim
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode_When_Properties_Expect_TypedFields(t *testing.T) {
+	ns := AMTEthernetPortSettings{}.ResourceURI()
+	properties := []*dom.Element{
+		dom.ElemC("InstanceID", ns, "Intel(r) AMT Ethernet Port Settings 0"),
+		dom.ElemC("DHCPEnabled", ns, "true"),
+		dom.ElemC("LinkPolicy", ns, "1"),
+		dom.ElemC("LinkPolicy", ns, "14"),
+		dom.ElemC("VLANTag", ns, "100"),
+		dom.ElemC("Unknown", ns, "ignored"),
+	}
+
+	var settings AMTEthernetPortSettings
+	assert.NoError(t, Decode(properties, &settings))
+	assert.Equal(t, AMTEthernetPortSettings{
+		InstanceID:  "Intel(r) AMT Ethernet Port Settings 0",
+		DHCPEnabled: true,
+		LinkPolicy:  []uint8{1, 14},
+		VLANTag:     100,
+	}, settings)
+
+	err := Decode([]*dom.Element{dom.ElemC("VLANTag", ns, "70000")}, &AMTEthernetPortSettings{})
+	assert.Error(t, err)
+	assert.Error(t, Decode(properties, AMTEthernetPortSettings{}))
+}
@@ -0,0 +1,317 @@
+// Code generated by gen.go from classes.txt; DO NOT EDIT.
+
+package cim
+
+// CIMAssociatedPowerManagementService is an instance of CIM_AssociatedPowerManagementService.
+type CIMAssociatedPowerManagementService struct {
+	PowerState                    uint16   `cim:"PowerState"`
+	OtherPowerState               string   `cim:"OtherPowerState"`
+	RequestedPowerState           uint16   `cim:"RequestedPowerState"`
+	AvailableRequestedPowerStates []uint16 `cim:"AvailableRequestedPowerStates"`
+}
+
+// ResourceURI returns the resource URI of CIM_AssociatedPowerManagementService.
+func (CIMAssociatedPowerManagementService) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_AssociatedPowerManagementService"
+}
+
+// CIMBIOSElement is an instance of CIM_BIOSElement.
+type CIMBIOSElement struct {
+	Name                  string `cim:"Name"`
+	ElementName           string `cim:"ElementName"`
+	Manufacturer          string `cim:"Manufacturer"`
+	Version               string `cim:"Version"`
+	SoftwareElementID     string `cim:"SoftwareElementID"`
+	SoftwareElementState  uint16 `cim:"SoftwareElementState"`
+	TargetOperatingSystem uint16 `cim:"TargetOperatingSystem"`
+	PrimaryBIOS           bool   `cim:"PrimaryBIOS"`
+}
+
+// ResourceURI returns the resource URI of CIM_BIOSElement.
+func (CIMBIOSElement) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_BIOSElement"
+}
+
+// CIMChassis is an instance of CIM_Chassis.
+type CIMChassis struct {
+	CreationClassName  string `cim:"CreationClassName"`
+	Tag                string `cim:"Tag"`
+	ElementName        string `cim:"ElementName"`
+	Manufacturer       string `cim:"Manufacturer"`
+	Model              string `cim:"Model"`
+	SerialNumber       string `cim:"SerialNumber"`
+	Version            string `cim:"Version"`
+	PackageType        uint16 `cim:"PackageType"`
+	ChassisPackageType uint16 `cim:"ChassisPackageType"`
+}
+
+// ResourceURI returns the resource URI of CIM_Chassis.
+func (CIMChassis) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_Chassis"
+}
+
+// CIMComputerSystemPackage is an instance of CIM_ComputerSystemPackage.
+type CIMComputerSystemPackage struct {
+	PlatformGUID string `cim:"PlatformGUID"`
+}
+
+// ResourceURI returns the resource URI of CIM_ComputerSystemPackage.
+func (CIMComputerSystemPackage) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ComputerSystemPackage"
+}
+
+// CIMKVMRedirectionSAP is an instance of CIM_KVMRedirectionSAP.
+type CIMKVMRedirectionSAP struct {
+	Name                    string `cim:"Name"`
+	CreationClassName       string `cim:"CreationClassName"`
+	SystemName              string `cim:"SystemName"`
+	SystemCreationClassName string `cim:"SystemCreationClassName"`
+	ElementName             string `cim:"ElementName"`
+	EnabledState            uint16 `cim:"EnabledState"`
+	RequestedState          uint16 `cim:"RequestedState"`
+	KVMProtocol             uint16 `cim:"KVMProtocol"`
+}
+
+// ResourceURI returns the resource URI of CIM_KVMRedirectionSAP.
+func (CIMKVMRedirectionSAP) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_KVMRedirectionSAP"
+}
+
+// CIMSoftwareIdentity is an instance of CIM_SoftwareIdentity.
+type CIMSoftwareIdentity struct {
+	InstanceID    string `cim:"InstanceID"`
+	VersionString string `cim:"VersionString"`
+	IsEntity      bool   `cim:"IsEntity"`
+}
+
+// ResourceURI returns the resource URI of CIM_SoftwareIdentity.
+func (CIMSoftwareIdentity) ResourceURI() string {
+	return "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_SoftwareIdentity"
+}
+
+// AMTAuthorizationService is an instance of AMT_AuthorizationService.
+type AMTAuthorizationService struct {
+	Name                    string `cim:"Name"`
+	CreationClassName       string `cim:"CreationClassName"`
+	SystemName              string `cim:"SystemName"`
+	SystemCreationClassName string `cim:"SystemCreationClassName"`
+	ElementName             string `cim:"ElementName"`
+	EnabledState            uint16 `cim:"EnabledState"`
+	RequestedState          uint16 `cim:"RequestedState"`
+	AllowHttpQopAuthOnly    uint32 `cim:"AllowHttpQopAuthOnly"`
+}
+
+// ResourceURI returns the resource URI of AMT_AuthorizationService.
+func (AMTAuthorizationService) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_AuthorizationService"
+}
+
+// AMTBootCapabilities is an instance of AMT_BootCapabilities.
+type AMTBootCapabilities struct {
+	InstanceID                         string `cim:"InstanceID"`
+	ElementName                        string `cim:"ElementName"`
+	IDER                               bool   `cim:"IDER"`
+	SOL                                bool   `cim:"SOL"`
+	BIOSReflash                        bool   `cim:"BIOSReflash"`
+	BIOSSetup                          bool   `cim:"BIOSSetup"`
+	BIOSPause                          bool   `cim:"BIOSPause"`
+	ForcePXEBoot                       bool   `cim:"ForcePXEBoot"`
+	ForceHardDriveBoot                 bool   `cim:"ForceHardDriveBoot"`
+	ForceHardDriveSafeModeBoot         bool   `cim:"ForceHardDriveSafeModeBoot"`
+	ForceDiagnosticBoot                bool   `cim:"ForceDiagnosticBoot"`
+	ForceCDorDVDBoot                   bool   `cim:"ForceCDorDVDBoot"`
+	VerbosityScreenBlank               bool   `cim:"VerbosityScreenBlank"`
+	PowerButtonLock                    bool   `cim:"PowerButtonLock"`
+	ResetButtonLock                    bool   `cim:"ResetButtonLock"`
+	KeyboardLock                       bool   `cim:"KeyboardLock"`
+	SleepButtonLock                    bool   `cim:"SleepButtonLock"`
+	UserPasswordBypass                 bool   `cim:"UserPasswordBypass"`
+	ForcedProgressEvents               bool   `cim:"ForcedProgressEvents"`
+	VerbosityVerbose                   bool   `cim:"VerbosityVerbose"`
+	VerbosityQuiet                     bool   `cim:"VerbosityQuiet"`
+	ConfigurationDataReset             bool   `cim:"ConfigurationDataReset"`
+	BIOSSecureBoot                     bool   `cim:"BIOSSecureBoot"`
+	SecureErase                        bool   `cim:"SecureErase"`
+	ForceWinREBoot                     bool   `cim:"ForceWinREBoot"`
+	ForceUEFILocalPBABoot              bool   `cim:"ForceUEFILocalPBABoot"`
+	ForceUEFIHTTPSBoot                 bool   `cim:"ForceUEFIHTTPSBoot"`
+	AMTSecureBootControl               bool   `cim:"AMTSecureBootControl"`
+	UEFIWiFiCoExistenceAndProfileShare bool   `cim:"UEFIWiFiCoExistenceAndProfileShare"`
+}
+
+// ResourceURI returns the resource URI of AMT_BootCapabilities.
+func (AMTBootCapabilities) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootCapabilities"
+}
+
+// AMTBootSettingData is an instance of AMT_BootSettingData.
+type AMTBootSettingData struct {
+	InstanceID             string `cim:"InstanceID"`
+	ElementName            string `cim:"ElementName"`
+	OwningEntity           string `cim:"OwningEntity"`
+	UseSOL                 bool   `cim:"UseSOL"`
+	UseSafeMode            bool   `cim:"UseSafeMode"`
+	ReflashBIOS            bool   `cim:"ReflashBIOS"`
+	BIOSSetup              bool   `cim:"BIOSSetup"`
+	BIOSPause              bool   `cim:"BIOSPause"`
+	LockPowerButton        bool   `cim:"LockPowerButton"`
+	LockResetButton        bool   `cim:"LockResetButton"`
+	LockKeyboard           bool   `cim:"LockKeyboard"`
+	LockSleepButton        bool   `cim:"LockSleepButton"`
+	UserPasswordBypass     bool   `cim:"UserPasswordBypass"`
+	ForcedProgressEvents   bool   `cim:"ForcedProgressEvents"`
+	FirmwareVerbosity      uint8  `cim:"FirmwareVerbosity"`
+	ConfigurationDataReset bool   `cim:"ConfigurationDataReset"`
+	IDERBootDevice         uint8  `cim:"IDERBootDevice"`
+	UseIDER                bool   `cim:"UseIDER"`
+	EnforceSecureBoot      bool   `cim:"EnforceSecureBoot"`
+	BootMediaIndex         uint16 `cim:"BootMediaIndex"`
+	SecureErase            bool   `cim:"SecureErase"`
+	OptionsCleared         bool   `cim:"OptionsCleared"`
+}
+
+// ResourceURI returns the resource URI of AMT_BootSettingData.
+func (AMTBootSettingData) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_BootSettingData"
+}
+
+// AMTEthernetPortSettings is an instance of AMT_EthernetPortSettings.
+type AMTEthernetPortSettings struct {
+	InstanceID                   string  `cim:"InstanceID"`
+	ElementName                  string  `cim:"ElementName"`
+	VLANTag                      uint16  `cim:"VLANTag"`
+	SharedMAC                    bool    `cim:"SharedMAC"`
+	MACAddress                   string  `cim:"MACAddress"`
+	LinkIsUp                     bool    `cim:"LinkIsUp"`
+	LinkPolicy                   []uint8 `cim:"LinkPolicy"`
+	LinkPreference               uint32  `cim:"LinkPreference"`
+	LinkControl                  uint32  `cim:"LinkControl"`
+	SharedStaticIp               bool    `cim:"SharedStaticIp"`
+	SharedDynamicIP              bool    `cim:"SharedDynamicIP"`
+	IpSyncEnabled                bool    `cim:"IpSyncEnabled"`
+	DHCPEnabled                  bool    `cim:"DHCPEnabled"`
+	IPAddress                    string  `cim:"IPAddress"`
+	SubnetMask                   string  `cim:"SubnetMask"`
+	DefaultGateway               string  `cim:"DefaultGateway"`
+	PrimaryDNS                   string  `cim:"PrimaryDNS"`
+	SecondaryDNS                 string  `cim:"SecondaryDNS"`
+	ConsoleTcpMaxRetransmissions uint32  `cim:"ConsoleTcpMaxRetransmissions"`
+	WLANLinkProtectionLevel      uint32  `cim:"WLANLinkProtectionLevel"`
+	PhysicalConnectionType       uint32  `cim:"PhysicalConnectionType"`
+	PhysicalNicMedium            uint32  `cim:"PhysicalNicMedium"`
+}
+
+// ResourceURI returns the resource URI of AMT_EthernetPortSettings.
+func (AMTEthernetPortSettings) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_EthernetPortSettings"
+}
+
+// AMTGeneralSettings is an instance of AMT_GeneralSettings.
+type AMTGeneralSettings struct {
+	InstanceID                    string `cim:"InstanceID"`
+	ElementName                   string `cim:"ElementName"`
+	NetworkInterfaceEnabled       bool   `cim:"NetworkInterfaceEnabled"`
+	DigestRealm                   string `cim:"DigestRealm"`
+	IdleWakeTimeout               uint32 `cim:"IdleWakeTimeout"`
+	HostName                      string `cim:"HostName"`
+	DomainName                    string `cim:"DomainName"`
+	PingResponseEnabled           bool   `cim:"PingResponseEnabled"`
+	WsmanOnlyMode                 bool   `cim:"WsmanOnlyMode"`
+	PreferredAddressFamily        uint32 `cim:"PreferredAddressFamily"`
+	DHCPv6ConfigurationTimeout    uint32 `cim:"DHCPv6ConfigurationTimeout"`
+	DDNSUpdateEnabled             bool   `cim:"DDNSUpdateEnabled"`
+	DDNSUpdateByDHCPServerEnabled bool   `cim:"DDNSUpdateByDHCPServerEnabled"`
+	SharedFQDN                    bool   `cim:"SharedFQDN"`
+	HostOSFQDN                    string `cim:"HostOSFQDN"`
+	DDNSTTL                       uint32 `cim:"DDNSTTL"`
+	AMTNetworkEnabled             uint32 `cim:"AMTNetworkEnabled"`
+	RmcpPingResponseEnabled       bool   `cim:"RmcpPingResponseEnabled"`
+	DDNSPeriodicUpdateInterval    uint32 `cim:"DDNSPeriodicUpdateInterval"`
+	PresenceNotificationInterval  uint32 `cim:"PresenceNotificationInterval"`
+	PrivacyLevel                  uint32 `cim:"PrivacyLevel"`
+	PowerSource                   uint32 `cim:"PowerSource"`
+	ThunderboltDockEnabled        uint32 `cim:"ThunderboltDockEnabled"`
+}
+
+// ResourceURI returns the resource URI of AMT_GeneralSettings.
+func (AMTGeneralSettings) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_GeneralSettings"
+}
+
+// AMTRedirectionService is an instance of AMT_RedirectionService.
+type AMTRedirectionService struct {
+	Name                    string   `cim:"Name"`
+	CreationClassName       string   `cim:"CreationClassName"`
+	SystemName              string   `cim:"SystemName"`
+	SystemCreationClassName string   `cim:"SystemCreationClassName"`
+	ElementName             string   `cim:"ElementName"`
+	EnabledState            uint16   `cim:"EnabledState"`
+	ListenerEnabled         bool     `cim:"ListenerEnabled"`
+	AccessLog               []string `cim:"AccessLog"`
+}
+
+// ResourceURI returns the resource URI of AMT_RedirectionService.
+func (AMTRedirectionService) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_RedirectionService"
+}
+
+// AMTSetupAndConfigurationService is an instance of AMT_SetupAndConfigurationService.
+type AMTSetupAndConfigurationService struct {
+	Name                          string `cim:"Name"`
+	CreationClassName             string `cim:"CreationClassName"`
+	SystemName                    string `cim:"SystemName"`
+	SystemCreationClassName       string `cim:"SystemCreationClassName"`
+	ElementName                   string `cim:"ElementName"`
+	EnabledState                  uint16 `cim:"EnabledState"`
+	RequestedState                uint16 `cim:"RequestedState"`
+	ProvisioningMode              uint16 `cim:"ProvisioningMode"`
+	ProvisioningState             uint32 `cim:"ProvisioningState"`
+	ZeroTouchConfigurationEnabled bool   `cim:"ZeroTouchConfigurationEnabled"`
+	ProvisioningServerOTP         string `cim:"ProvisioningServerOTP"`
+	ConfigurationServerFQDN       string `cim:"ConfigurationServerFQDN"`
+	PasswordModel                 uint32 `cim:"PasswordModel"`
+	DhcpDNSSuffix                 string `cim:"DhcpDNSSuffix"`
+	TrustedDNSSuffix              string `cim:"TrustedDNSSuffix"`
+}
+
+// ResourceURI returns the resource URI of AMT_SetupAndConfigurationService.
+func (AMTSetupAndConfigurationService) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/amt-schema/1/AMT_SetupAndConfigurationService"
+}
+
+// IPSHostBasedSetupService is an instance of IPS_HostBasedSetupService.
+type IPSHostBasedSetupService struct {
+	Name                    string   `cim:"Name"`
+	CreationClassName       string   `cim:"CreationClassName"`
+	SystemName              string   `cim:"SystemName"`
+	SystemCreationClassName string   `cim:"SystemCreationClassName"`
+	ElementName             string   `cim:"ElementName"`
+	CurrentControlMode      uint32   `cim:"CurrentControlMode"`
+	AllowedControlModes     []uint32 `cim:"AllowedControlModes"`
+	ConfigurationNonce      string   `cim:"ConfigurationNonce"`
+	CertChainStatus         uint32   `cim:"CertChainStatus"`
+}
+
+// ResourceURI returns the resource URI of IPS_HostBasedSetupService.
+func (IPSHostBasedSetupService) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_HostBasedSetupService"
+}
+
+// IPSOptInService is an instance of IPS_OptInService.
+type IPSOptInService struct {
+	Name                    string `cim:"Name"`
+	CreationClassName       string `cim:"CreationClassName"`
+	SystemName              string `cim:"SystemName"`
+	SystemCreationClassName string `cim:"SystemCreationClassName"`
+	ElementName             string `cim:"ElementName"`
+	OptInCodeTimeout        uint16 `cim:"OptInCodeTimeout"`
+	OptInRequired           uint32 `cim:"OptInRequired"`
+	OptInState              uint32 `cim:"OptInState"`
+	CanModifyOptInPolicy    uint32 `cim:"CanModifyOptInPolicy"`
+	OptInDisplayTimeout     uint16 `cim:"OptInDisplayTimeout"`
+}
+
+// ResourceURI returns the resource URI of IPS_OptInService.
+func (IPSOptInService) ResourceURI() string {
+	return "http://intel.com/wbem/wscim/1/ips-schema/1/IPS_OptInService"
+}
@@ -0,0 +1,122 @@
+//go:build ignore
+// +build ignore
+
+// gen generates classes.go from the class definitions of classes.txt.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+type property struct {
+	name    string
+	mofType string
+}
+
+type class struct {
+	name        string
+	resourceURI string
+	properties  []property
+}
+
+// goTypes are the Go types of the MOF types.
+var goTypes = map[string]string{
+	"string":  "string",
+	"boolean": "bool",
+	"uint8":   "uint8",
+	"uint16":  "uint16",
+	"uint32":  "uint32",
+	"uint64":  "uint64",
+	"sint8":   "int8",
+	"sint16":  "int16",
+	"sint32":  "int32",
+	"sint64":  "int64",
+}
+
+func main() {
+	classes, err := readClasses("classes.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by gen.go from classes.txt; DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, "package cim")
+	for _, c := range classes {
+		typeName := strings.Replace(c.name, "_", "", 1)
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "// %s is an instance of %s.\n", typeName, c.name)
+		fmt.Fprintf(&b, "type %s struct {\n", typeName)
+		for _, p := range c.properties {
+			goType, err := goType(p.mofType)
+			if err != nil {
+				log.Fatalf("%s.%s: %v", c.name, p.name, err)
+			}
+			fmt.Fprintf(&b, "\t%s %s `cim:%q`\n", p.name, goType, p.name)
+		}
+		fmt.Fprintln(&b, "}")
+		fmt.Fprintln(&b)
+		fmt.Fprintf(&b, "// ResourceURI returns the resource URI of %s.\n", c.name)
+		fmt.Fprintf(&b, "func (%s) ResourceURI() string {\n", typeName)
+		fmt.Fprintf(&b, "\treturn %q\n", c.resourceURI)
+		fmt.Fprintln(&b, "}")
+	}
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("classes.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func goType(mofType string) (string, error) {
+	array := strings.HasSuffix(mofType, "[]")
+	t, ok := goTypes[strings.TrimSuffix(mofType, "[]")]
+	if !ok {
+		return "", fmt.Errorf("unsupported type %q", mofType)
+	}
+	if array {
+		return "[]" + t, nil
+	}
+	return t, nil
+}
+
+// readClasses reads the classes of name. A class is its name and resource URI
+// followed by its indented properties.
+func readClasses(name string) ([]*class, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var classes []*class
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected 2 fields, got %d", name, line, len(fields))
+		}
+		if text[0] != ' ' && text[0] != '\t' {
+			classes = append(classes, &class{name: fields[0], resourceURI: fields[1]})
+			continue
+		}
+		if len(classes) == 0 {
+			return nil, fmt.Errorf("%s:%d: property outside of a class", name, line)
+		}
+		c := classes[len(classes)-1]
+		c.properties = append(c.properties, property{name: fields[0], mofType: fields[1]})
+	}
+	return classes, scanner.Err()
+}
@@ -2,40 +2,160 @@ package amt
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509/pkix"
 	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/VictorLowther/simplexml/dom"
 	"github.com/go-logr/logr"
+	"github.com/jacobweinstock/go-amt/cim"
 	"github.com/jacobweinstock/wsman"
 )
 
-// Client used to perform actions on the machine
+// Client used to perform actions on the machine. A Client is safe for
+// concurrent use by multiple goroutines. The methods that change the machine
+// are serialized, so operations made of several requests, such as SetPXE,
+// don't interleave. Reads aren't.
 type Client struct {
 	logger      logr.Logger
 	wsManClient *wsman.Client
+	strict      bool
+	hooks       Hooks
+	sink        OperationSink
+	host        string
+	resources   map[string]string
+	tls         bool
+	writes      *writeGuard
+	// readTimeout and mutationTimeout bound every request of their kind when set.
+	readTimeout     time.Duration
+	mutationTimeout time.Duration
+	stats           statsTracker
+	namespaces      namespaceMatcher
+	// secrets are removed from the errors of the client.
+	secrets  []string
+	progress ProgressReporter
+	clock    Clock
+	// dedupe remembers the power operations with an idempotency key.
+	dedupe     *powerDedupe
+	middleware []Middleware
+	// webUI reads the pages of the web UI at webUIBase, only set with
+	// Connection.WebUIFallback.
+	webUI     *http.Client
+	webUIBase string
+
+	// store caches the DeviceInfo of device, mu serializes its updates.
+	store  Store
+	device string
+	mu     sync.Mutex
+
+	// operationMu serializes every method that changes the machine.
+	operationMu sync.Mutex
 }
 
 // NewClient creates an amt client to use.
 func NewClient(connection Connection) (*Client, error) {
-	port := int(connection.Port)
+	scheme, port := "http", int(connection.Port)
+	if connection.TLS {
+		scheme = "https"
+	}
 	if port == 0 {
 		port = 16992
+		if connection.TLS {
+			port = 16993
+		}
 	}
 	path := connection.Path
 	if path == "" {
 		path = "/wsman"
 	}
-	target := fmt.Sprintf("http://%s:%d%s", connection.Host, port, path)
-	wsmanClient, err := wsman.NewClient(target, connection.User, connection.Pass, true)
+	target := fmt.Sprintf("%s://%s:%d%s", scheme, connection.Host, port, path)
+	// digest auth is done by our own transport so that it works over any
+	// connection.Transport. This also means no request is sent until the first call.
+	wsmanClient, err := wsman.NewClient(target, "", "", false)
 	if err != nil {
 		return nil, err
 	}
+	transport := connection.Transport
+	if transport == nil {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if connection.Fingerprints != nil {
+			tlsConfig = PinnedTLSConfig(connection.Host, connection.Fingerprints)
+		}
+		create := func() http.RoundTripper {
+			// compressionTransport negotiates the compression.
+			return &http.Transport{TLSClientConfig: tlsConfig, DialContext: connection.DialContext, DisableCompression: true}
+		}
+		if connection.Sessions != nil {
+			transport = connection.Sessions.defaultTransport(target, create)
+		} else {
+			transport = create()
+		}
+	}
+	transport = &availabilityTransport{next: transport}
+	if !connection.DisableCompression {
+		transport = &compressionTransport{next: transport}
+	}
+	transport = newLimitTransport(connection.MaxResponseSize, connection.MaxElementDepth, transport)
+	if connection.UserAgent != "" || len(connection.Header) > 0 {
+		transport = &headerTransport{userAgent: connection.UserAgent, header: connection.Header.Clone(), next: transport}
+	}
+	if connection.Sessions != nil {
+		transport = connection.Sessions.limit(target, transport)
+	}
+	clock := connection.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	transport = &sessionLimitTransport{wait: connection.SessionLimitWait, clock: clock, next: transport}
+	digest := newDigestTransport(connection.User, connection.Pass, transport)
+	digest.forbidMD5 = connection.ForbidMD5
+	if connection.Sessions != nil {
+		digest.session = connection.Sessions.digest(target, connection.User)
+	}
+	wsmanClient.Transport = digest
+	var webUI *http.Client
+	if connection.WebUIFallback {
+		webUI = &http.Client{Transport: digest}
+	}
 	wsmanClient.Debug = connection.Debug
+	store := connection.Store
+	if store == nil {
+		store = &MemoryStore{}
+	}
 	if connection.Logger.GetSink() == nil {
 		connection.Logger = logr.Discard()
 	}
+	base := fmt.Sprintf("%s://%s:%d", scheme, connection.Host, port)
+	device := connection.DeviceID
+	if device == "" {
+		device = base
+	}
 	return &Client{
-		logger:      connection.Logger,
-		wsManClient: wsmanClient,
+		logger:          connection.Logger,
+		wsManClient:     wsmanClient,
+		strict:          connection.Strict,
+		hooks:           connection.Hooks,
+		sink:            connection.OperationSink,
+		host:            connection.Host,
+		resources:       connection.ResourceURIs,
+		tls:             connection.TLS,
+		writes:          newWriteGuard(connection.WriteLimit),
+		readTimeout:     connection.ReadTimeout,
+		mutationTimeout: connection.MutationTimeout,
+		store:           store,
+		device:          device,
+		namespaces:      namespaceMatcher{mode: connection.NamespaceMatch, prefixes: connection.NamespacePrefixes},
+		secrets:         credentialSecrets(connection),
+		progress:        connection.Progress,
+		clock:           clock,
+		dedupe:          newPowerDedupe(connection.DedupeWindow, clock),
+		middleware:      append([]Middleware(nil), connection.Middleware...),
+		webUI:           webUI,
+		webUIBase:       base,
 	}, nil
 }
 
@@ -46,25 +166,898 @@ func (c *Client) Close() error {
 
 // PowerOn will power on a given machine.
 func (c *Client) PowerOn(ctx context.Context) error {
-	return powerOn(ctx, c)
+	return c.call(ctx, "PowerOn", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return powerOn(ctx, c)
+	})
 }
 
 // PowerOff will power off a given machine.
 func (c *Client) PowerOff(ctx context.Context) error {
-	return powerOff(ctx, c)
+	return c.call(ctx, "PowerOff", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return powerOff(ctx, c)
+	})
 }
 
 // PowerCycle will power cycle a given machine.
 func (c *Client) PowerCycle(ctx context.Context) error {
-	return powerCycle(ctx, c)
+	return c.call(ctx, "PowerCycle", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return powerCycle(ctx, c)
+	})
+}
+
+// Sleep puts a running machine to sleep.
+func (c *Client) Sleep(ctx context.Context) error {
+	return c.call(ctx, "Sleep", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := executePowerAction(ctx, c, PowerActionSleep)
+		return err
+	})
+}
+
+// RequestPowerState requests state, e.g. a vendor specific one, when the
+// firmware lists it in AvailableRequestedPowerStates. Prefer SetPower for the
+// standard transitions, it picks the state the firmware supports.
+func (c *Client) RequestPowerState(ctx context.Context, state PowerState) error {
+	return c.call(ctx, "RequestPowerState", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return requestPowerState(ctx, c, state)
+	})
+}
+
+// ForcePowerState requests state without first checking that the firmware
+// lists it in AvailableRequestedPowerStates, for models known to misreport
+// them. The firmware still rejects transitions it can't do, but nothing
+// stops e.g. a hard power off of a machine that could be shut down
+// gracefully, prefer SetPower otherwise.
+func (c *Client) ForcePowerState(ctx context.Context, state PowerState) error {
+	return c.call(ctx, "ForcePowerState", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return forcePowerState(ctx, c, state)
+	})
+}
+
+// SetPower runs the power action and tells whether anything was requested:
+// PowerOn, PowerOff, PowerCycle and Sleep return nil both when the machine
+// already was in the target state and when a transition was requested.
+func (c *Client) SetPower(ctx context.Context, action PowerAction) (PowerResult, error) {
+	var result PowerResult
+	err := c.call(ctx, "SetPower", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = executePowerAction(ctx, c, action)
+		return err
+	})
+	return result, err
+}
+
+// ChassisPower runs an ipmitool "chassis power" command, one of status, on,
+// off, cycle, reset, diag and soft, and returns the line ipmitool prints for
+// it, e.g. "Chassis Power is on". It eases moving ipmitool scripts to AMT.
+func (c *Client) ChassisPower(ctx context.Context, command string) (string, error) {
+	var result string
+	err := c.call(ctx, "ChassisPower", command != "status", func(ctx context.Context) (err error) {
+		if command != "status" {
+			c.operationMu.Lock()
+			defer c.operationMu.Unlock()
+		}
+		result, err = chassisPower(ctx, c, command)
+		return err
+	})
+	return result, err
+}
+
+// PlanPowerTransition returns the power state PowerOn, PowerOff, PowerCycle
+// or Sleep would request for action right now, and why, without requesting it.
+func (c *Client) PlanPowerTransition(ctx context.Context, action PowerAction) (*TransitionPlan, error) {
+	var result *TransitionPlan
+	err := c.call(ctx, "PlanPowerTransition", false, func(ctx context.Context) (err error) {
+		result, err = planPowerTransition(ctx, c, action)
+		return err
+	})
+	return result, err
+}
+
+// PowerCapabilities returns the power states and transitions the machine
+// supports and the plan of every power action from its current state.
+func (c *Client) PowerCapabilities(ctx context.Context) (*PowerCapabilities, error) {
+	var result *PowerCapabilities
+	err := c.call(ctx, "PowerCapabilities", false, func(ctx context.Context) (err error) {
+		result, err = getPowerCapabilities(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// CheckAdvisories checks the machine against the known AMT vulnerabilities,
+// e.g. INTEL-SA-00075: whether its firmware version is affected and whether
+// the preconditions of the attack are met.
+func (c *Client) CheckAdvisories(ctx context.Context) ([]AdvisoryExposure, error) {
+	var result []AdvisoryExposure
+	err := c.call(ctx, "CheckAdvisories", false, func(ctx context.Context) (err error) {
+		result, err = checkAdvisories(ctx, c)
+		return err
+	})
+	return result, err
 }
 
 // SetPXE makes sure the node will pxe boot next time.
 func (c *Client) SetPXE(ctx context.Context) error {
-	return setPXE(ctx, c)
+	return c.call(ctx, "SetPXE", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyNextBoot(ctx, c, BootSourcePXE)
+		return err
+	})
+}
+
+// BootSources lists the devices the machine can boot from, including the
+// vendor specific ones some firmware adds.
+func (c *Client) BootSources(ctx context.Context) ([]BootSource, error) {
+	var result []BootSource
+	err := c.call(ctx, "BootSources", false, func(ctx context.Context) (err error) {
+		result, err = getBootSources(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// SetNextBoot makes sure the node boots from the boot source with InstanceID
+// source next time. SetPXE is SetNextBoot with BootSourcePXE.
+func (c *Client) SetNextBoot(ctx context.Context, source string) error {
+	return c.call(ctx, "SetNextBoot", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyNextBoot(ctx, c, source)
+		return err
+	})
+}
+
+// ApplyNextBoot is SetNextBoot, telling whether the next boot changed. It
+// doesn't when the machine already boots from source next time.
+func (c *Client) ApplyNextBoot(ctx context.Context, source string) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyNextBoot", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyNextBoot(ctx, c, source)
+		return err
+	})
+	return result, err
+}
+
+// ResetBootSettings restores the default boot configuration, clearing the boot
+// order and the next boot options. Use it when the machine keeps booting from
+// the wrong device after failed boot changes.
+func (c *Client) ResetBootSettings(ctx context.Context) error {
+	return c.call(ctx, "ResetBootSettings", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return resetBootSettings(ctx, c)
+	})
+}
+
+// Recover boots the machine from the recovery image at options.URL with the
+// One-Click Recovery UEFI HTTPS boot of AMT 15 and newer. The client must
+// connect over TLS. Failures are returned as a *RecoveryError.
+func (c *Client) Recover(ctx context.Context, options RecoveryOptions) error {
+	return c.call(ctx, "Recover", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return recoverMachine(ctx, c, options)
+	})
+}
+
+// BootSettings reads back the options of the next boot, see BootSettings.Verify.
+func (c *Client) BootSettings(ctx context.Context) (*BootSettings, error) {
+	var result *BootSettings
+	err := c.call(ctx, "BootSettings", false, func(ctx context.Context) (err error) {
+		result, err = getBootSettings(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// NextBootOrder returns the boot order of the next boot as a list of boot
+// sources, e.g. BootSourceHardDrive, first to last. The firmware has no
+// persistent boot order: it clears the order once the machine booted, which
+// then boots in the order of the BIOS.
+func (c *Client) NextBootOrder(ctx context.Context) ([]string, error) {
+	var result []string
+	err := c.call(ctx, "NextBootOrder", false, func(ctx context.Context) (err error) {
+		result, err = getBootOrder(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// SetNextBootOrder makes the machine try sources, first to last, on the next
+// boot only. An empty sources clears the boot order so the BIOS order is used.
+// To enforce an order on every boot, set it again before each boot.
+func (c *Client) SetNextBootOrder(ctx context.Context, sources []string) error {
+	return c.call(ctx, "SetNextBootOrder", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyNextBootOrder(ctx, c, sources)
+		return err
+	})
+}
+
+// ApplyNextBootOrder is SetNextBootOrder, telling whether the boot order changed.
+func (c *Client) ApplyNextBootOrder(ctx context.Context, sources []string) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyNextBootOrder", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyNextBootOrder(ctx, c, sources)
+		return err
+	})
+	return result, err
+}
+
+// FeatureStates returns which redirection features (KVM, SOL, IDE-R) are
+// enabled and which of them need user consent.
+func (c *Client) FeatureStates(ctx context.Context) (*FeatureStates, error) {
+	var result *FeatureStates
+	err := c.call(ctx, "FeatureStates", false, func(ctx context.Context) (err error) {
+		result, err = getFeatureStates(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// SetFeatures enables or disables the redirection features and sets the user
+// consent policy. When a change fails the ones already made are rolled back,
+// unless config.NoRollback is set, and the error is an *ApplyError telling
+// which settings are left changed.
+func (c *Client) SetFeatures(ctx context.Context, config FeaturesConfig) error {
+	return c.call(ctx, "SetFeatures", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := setFeatures(ctx, c, config)
+		return err
+	})
+}
+
+// ApplyFeatures is SetFeatures, telling which settings changed.
+func (c *Client) ApplyFeatures(ctx context.Context, config FeaturesConfig) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyFeatures", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = setFeatures(ctx, c, config)
+		return err
+	})
+	return result, err
+}
+
+// Listeners returns which network interfaces of the firmware are enabled
+// besides WS-Management: the web UI, the redirection port and ping.
+func (c *Client) Listeners(ctx context.Context) (*Listeners, error) {
+	var result *Listeners
+	err := c.call(ctx, "Listeners", false, func(ctx context.Context) (err error) {
+		result, err = getListeners(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// ApplyListeners enables or disables the web UI, the redirection port and the
+// ping response, telling which settings changed. When a change fails the ones
+// already made are rolled back, unless config.NoRollback is set.
+func (c *Client) ApplyListeners(ctx context.Context, config ListenersConfig) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyListeners", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = setListeners(ctx, c, config)
+		return err
+	})
+	return result, err
+}
+
+// Certificates lists the certificates installed in the firmware. Use
+// ExpiringCertificates to find the ones in use that need renewing.
+func (c *Client) Certificates(ctx context.Context) ([]Certificate, error) {
+	var result []Certificate
+	err := c.call(ctx, "Certificates", false, func(ctx context.Context) (err error) {
+		result, err = getCertificates(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// IterateCertificates is Certificates, pulling the certificates lazily so
+// the caller can stop early. Close the returned iterator when stopping before
+// the end.
+func (c *Client) IterateCertificates(ctx context.Context) *CertificateIterator {
+	return &CertificateIterator{items: newEnumeration(ctx, c, c.resourceURI(ResourceAMTPublicKeyCertificate), 0)}
+}
+
+// GenerateKeyPair has the firmware generate an RSA key pair of bits (2048 is
+// the most widely supported) for certificate enrollment. It's the first step
+// of GenerateCSR, AddCertificate and BindTLSCertificate.
+func (c *Client) GenerateKeyPair(ctx context.Context, bits int) (*KeyPair, error) {
+	var result *KeyPair
+	err := c.call(ctx, "GenerateKeyPair", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = generateKeyPair(ctx, c, bits)
+		return err
+	})
+	return result, err
+}
+
+// GenerateCSR returns a DER encoded PKCS#10 certificate request for subject,
+// signed by the firmware with the private key of keyPair.
+func (c *Client) GenerateCSR(ctx context.Context, keyPair *KeyPair, subject pkix.Name) ([]byte, error) {
+	var result []byte
+	err := c.call(ctx, "GenerateCSR", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = generateCSR(ctx, c, keyPair, subject)
+		return err
+	})
+	return result, err
+}
+
+// AddCertificate installs the DER encoded certificate issued for a CSR and
+// returns its InstanceID.
+func (c *Client) AddCertificate(ctx context.Context, der []byte) (string, error) {
+	var result string
+	err := c.call(ctx, "AddCertificate", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = addCertificate(ctx, c, der)
+		return err
+	})
+	return result, err
+}
+
+// BindTLSCertificate makes the installed certificate certificateInstanceID
+// the TLS server certificate, replacing the current one.
+func (c *Client) BindTLSCertificate(ctx context.Context, certificateInstanceID string) error {
+	return c.call(ctx, "BindTLSCertificate", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return bindTLSCertificate(ctx, c, certificateInstanceID)
+	})
+}
+
+// EnrollTLSCertificate replaces the TLS certificate with one issued by
+// enroller for a key pair generated in the firmware, and returns the InstanceID
+// of the new certificate.
+func (c *Client) EnrollTLSCertificate(ctx context.Context, enroller Enroller, subject pkix.Name) (string, error) {
+	var result string
+	err := c.call(ctx, "EnrollTLSCertificate", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = enrollTLSCertificate(ctx, c, enroller, subject)
+		return err
+	})
+	return result, err
+}
+
+// CertificateHashes lists the trusted root certificate hashes used for admin
+// control mode activation.
+func (c *Client) CertificateHashes(ctx context.Context) ([]CertificateHash, error) {
+	var result []CertificateHash
+	err := c.call(ctx, "CertificateHashes", false, func(ctx context.Context) (err error) {
+		result, err = getCertificateHashes(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// AddCertificateHash trusts the root certificate with hash for admin control
+// mode activation. The algorithm follows from the length of hash.
+func (c *Client) AddCertificateHash(ctx context.Context, name string, hash []byte) error {
+	return c.call(ctx, "AddCertificateHash", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyCertificateHash(ctx, c, name, hash)
+		return err
+	})
+}
+
+// ApplyCertificateHash is AddCertificateHash, telling whether the hash was
+// added or enabled. A hash that is already trusted is left alone.
+func (c *Client) ApplyCertificateHash(ctx context.Context, name string, hash []byte) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyCertificateHash", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyCertificateHash(ctx, c, name, hash)
+		return err
+	})
+	return result, err
+}
+
+// DeleteCertificateHash removes the certificate hash instanceID.
+func (c *Client) DeleteCertificateHash(ctx context.Context, instanceID string) error {
+	return c.call(ctx, "DeleteCertificateHash", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return deleteCertificateHash(ctx, c, instanceID)
+	})
+}
+
+// LinkPolicy returns which of the firmware and the host owns the link of port.
+func (c *Client) LinkPolicy(ctx context.Context, port EthernetPort) (*LinkPolicy, error) {
+	var result *LinkPolicy
+	err := c.call(ctx, "LinkPolicy", false, func(ctx context.Context) (err error) {
+		result, err = getLinkPolicy(ctx, c, port)
+		return err
+	})
+	return result, err
+}
+
+// SetLinkPreference sets the preferred owner of the link of port. A preference
+// for LinkOwnerME reverts to the host after timeout.
+func (c *Client) SetLinkPreference(ctx context.Context, port EthernetPort, owner LinkOwner, timeout time.Duration) error {
+	return c.call(ctx, "SetLinkPreference", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyLinkPreference(ctx, c, port, owner, timeout)
+		return err
+	})
+}
+
+// ApplyLinkPreference is SetLinkPreference, telling whether it changed. A
+// preference for LinkOwnerME is always written, restarting its timeout.
+func (c *Client) ApplyLinkPreference(ctx context.Context, port EthernetPort, owner LinkOwner, timeout time.Duration) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyLinkPreference", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyLinkPreference(ctx, c, port, owner, timeout)
+		return err
+	})
+	return result, err
+}
+
+// SetLinkProtection sets how the firmware protects the link of port from the host.
+func (c *Client) SetLinkProtection(ctx context.Context, port EthernetPort, protection LinkProtection) error {
+	return c.call(ctx, "SetLinkProtection", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyLinkProtection(ctx, c, port, protection)
+		return err
+	})
+}
+
+// ApplyLinkProtection is SetLinkProtection, telling whether it changed.
+func (c *Client) ApplyLinkProtection(ctx context.Context, port EthernetPort, protection LinkProtection) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyLinkProtection", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyLinkProtection(ctx, c, port, protection)
+		return err
+	})
+	return result, err
+}
+
+// NetworkSettings returns the MAC and IP address settings of port, to tell
+// whether the firmware shares the NIC and the address of the host.
+func (c *Client) NetworkSettings(ctx context.Context, port EthernetPort) (*NetworkSettings, error) {
+	var result *NetworkSettings
+	err := c.call(ctx, "NetworkSettings", false, func(ctx context.Context) (err error) {
+		result, err = getNetworkSettings(ctx, c, port)
+		return err
+	})
+	return result, err
+}
+
+// LinkStatus returns whether the link of port is up, its speed and duplex, to
+// tell a cable or switch problem from a firmware one when a machine is
+// unreachable.
+func (c *Client) LinkStatus(ctx context.Context, port EthernetPort) (*LinkStatus, error) {
+	var result *LinkStatus
+	err := c.call(ctx, "LinkStatus", false, func(ctx context.Context) (err error) {
+		result, err = getLinkStatus(ctx, c, port)
+		return err
+	})
+	return result, err
+}
+
+// ReconcileAddresses compares the FQDN and the IP addresses of the firmware to
+// DNS, resolved with resolver or net.DefaultResolver when nil, and to
+// Connection.Host, and reports the mismatches, e.g. a stale FQDN.
+func (c *Client) ReconcileAddresses(ctx context.Context, resolver *net.Resolver) (*AddressReconciliation, error) {
+	var result *AddressReconciliation
+	err := c.call(ctx, "ReconcileAddresses", false, func(ctx context.Context) (err error) {
+		result, err = reconcileAddresses(ctx, c, resolver)
+		return err
+	})
+	return result, err
+}
+
+// IdleWakeTimeout returns how long the firmware stays awake after the
+// machine went to sleep or was woken up, before it sleeps too. A sleeping
+// firmware in Sx answers slowly or not at all.
+func (c *Client) IdleWakeTimeout(ctx context.Context) (time.Duration, error) {
+	var result time.Duration
+	err := c.call(ctx, "IdleWakeTimeout", false, func(ctx context.Context) (err error) {
+		result, err = getIdleWakeTimeout(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// SetIdleWakeTimeout sets the IdleWakeTimeout, in whole minutes between
+// MinIdleWakeTimeout and MaxIdleWakeTimeout: longer keeps the machine
+// reachable out of band in Sx, shorter saves power.
+func (c *Client) SetIdleWakeTimeout(ctx context.Context, timeout time.Duration) error {
+	return c.call(ctx, "SetIdleWakeTimeout", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyIdleWakeTimeout(ctx, c, timeout)
+		return err
+	})
+}
+
+// ApplyIdleWakeTimeout is SetIdleWakeTimeout, telling whether the timeout changed.
+func (c *Client) ApplyIdleWakeTimeout(ctx context.Context, timeout time.Duration) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyIdleWakeTimeout", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyIdleWakeTimeout(ctx, c, timeout)
+		return err
+	})
+	return result, err
+}
+
+// SetKVMState enables or disables KVM redirection, without touching the
+// redirection listener or the other features.
+func (c *Client) SetKVMState(ctx context.Context, enabled bool) error {
+	return c.call(ctx, "SetKVMState", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyKVMState(ctx, c, enabled)
+		return err
+	})
+}
+
+// ApplyKVMState is SetKVMState, telling whether the KVM state changed.
+func (c *Client) ApplyKVMState(ctx context.Context, enabled bool) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyKVMState", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyKVMState(ctx, c, enabled)
+		return err
+	})
+	return result, err
+}
+
+// SetRedirectionState enables or disables SOL and IDE-R redirection, without
+// touching the redirection listener or KVM.
+func (c *Client) SetRedirectionState(ctx context.Context, sol, ider bool) error {
+	return c.call(ctx, "SetRedirectionState", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyRedirectionState(ctx, c, sol, ider)
+		return err
+	})
+}
+
+// ApplyRedirectionState is SetRedirectionState, telling whether the
+// redirection state changed.
+func (c *Client) ApplyRedirectionState(ctx context.Context, sol, ider bool) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyRedirectionState", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyRedirectionState(ctx, c, sol, ider)
+		return err
+	})
+	return result, err
+}
+
+// PowerStatus returns the power state of the machine, with its ACPI state.
+func (c *Client) PowerStatus(ctx context.Context) (*PowerStatus, error) {
+	var result *PowerStatus
+	err := c.call(ctx, "PowerStatus", false, func(ctx context.Context) (err error) {
+		result, err = getPublicPowerStatus(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// HostOSStatus tells whether the host operating system appears to be up, from
+// the power state, the agent presence watchdogs and the link state, e.g. to
+// tell a hung operating system from a powered off machine.
+func (c *Client) HostOSStatus(ctx context.Context) (*HostOSStatus, error) {
+	var result *HostOSStatus
+	err := c.call(ctx, "HostOSStatus", false, func(ctx context.Context) (err error) {
+		result, err = getHostOSStatus(ctx, c)
+		return err
+	})
+	return result, err
 }
 
 // IsPoweredOn checks current power state.
 func (c *Client) IsPoweredOn(ctx context.Context) (bool, error) {
-	return isPoweredOn(ctx, c)
+	var result bool
+	err := c.call(ctx, "IsPoweredOn", false, func(ctx context.Context) (err error) {
+		result, err = isPoweredOn(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// WaitForPowerState waits until the machine is powered on, or off when on is
+// false, checking with options.
+func (c *Client) WaitForPowerState(ctx context.Context, on bool, options PollOptions) error {
+	if options.Clock == nil {
+		options.Clock = c.clock
+	}
+	return c.call(ctx, "WaitForPowerState", false, func(ctx context.Context) error {
+		return Poll(ctx, options, func(ctx context.Context) (bool, error) {
+			poweredOn, err := isPoweredOn(ctx, c)
+			if err != nil {
+				return false, err
+			}
+			return poweredOn == on, nil
+		})
+	})
+}
+
+// ActivateClientControlMode activates an unprovisioned machine in client control
+// mode (host based setup) and sets the admin password. This only works from the
+// managed host itself, through LMS, authenticated with the local system account
+// (see the mei package). adminPassword must pass ValidateAMTPassword.
+func (c *Client) ActivateClientControlMode(ctx context.Context, adminPassword string) error {
+	return c.call(ctx, "ActivateClientControlMode", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return activateClientControlMode(ctx, c, adminPassword)
+	})
+}
+
+// ApplyClientControlMode is ActivateClientControlMode, doing nothing when the
+// machine already is in client control mode. The result holds the conditions
+// of the activation steps.
+func (c *Client) ApplyClientControlMode(ctx context.Context, adminPassword string) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyClientControlMode", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyClientControlMode(ctx, c, adminPassword)
+		return err
+	})
+	return result, err
+}
+
+// ProvisioningState returns the state of the firmware in its provisioning
+// lifecycle, see ProvisioningState.CanTransition for what it can move to.
+func (c *Client) ProvisioningState(ctx context.Context) (ProvisioningState, error) {
+	var result ProvisioningState
+	err := c.call(ctx, "ProvisioningState", false, func(ctx context.Context) (err error) {
+		result, err = getProvisioningState(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// Decommission erases the wireless profiles, the 802.1x credentials, the CIRA
+// configuration and the user accounts, then fully unprovisions the firmware.
+// Nothing is unprovisioned when erasing fails, so it can be retried.
+func (c *Client) Decommission(ctx context.Context) error {
+	return c.call(ctx, "Decommission", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return decommission(ctx, c)
+	})
+}
+
+// Alarms lists the alarm clock occurrences that power on the machine.
+func (c *Client) Alarms(ctx context.Context) ([]Alarm, error) {
+	var result []Alarm
+	err := c.call(ctx, "Alarms", false, func(ctx context.Context) (err error) {
+		result, err = getAlarms(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// DeleteAlarm deletes the alarm clock occurrence with InstanceID instanceID.
+func (c *Client) DeleteAlarm(ctx context.Context, instanceID string) error {
+	return c.call(ctx, "DeleteAlarm", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		return deleteAlarm(ctx, c, instanceID)
+	})
+}
+
+// PruneAlarms deletes the expired and duplicate alarms, see StaleAlarms, and
+// returns the deleted ones. They accumulate on machines that run for years.
+func (c *Client) PruneAlarms(ctx context.Context) ([]Alarm, error) {
+	var result []Alarm
+	err := c.call(ctx, "PruneAlarms", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = pruneAlarms(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// EndpointReference returns the endpoint reference of the instance of resourceURI
+// whose selectorName selector equals selectorValue, for use with AddReferenceParameter.
+func (c *Client) EndpointReference(ctx context.Context, resourceURI, selectorName, selectorValue string) (*dom.Element, error) {
+	var result *dom.Element
+	err := c.call(ctx, "EndpointReference", false, func(ctx context.Context) (err error) {
+		result, err = getEndpointReferenceBySelector(ctx, c, c.resourceURI(resourceURI), selectorName, selectorValue)
+		return err
+	})
+	return result, err
+}
+
+// GetInstance gets the single instance of the class of v, e.g. a
+// *cim.AMTGeneralSettings, and sets its fields. Like EndpointReference, it
+// applies Connection.ResourceURIs to the resource URI of the class.
+func (c *Client) GetInstance(ctx context.Context, v cim.Class) error {
+	return c.call(ctx, "GetInstance", false, func(ctx context.Context) error {
+		properties, err := getInstance(ctx, c, c.resourceURI(v.ResourceURI()))
+		if err != nil {
+			return err
+		}
+		return cim.Decode(properties, v)
+	})
+}
+
+// Instances enumerates the instances of resourceURI. Decode the children of
+// each with cim.Decode.
+func (c *Client) Instances(ctx context.Context, resourceURI string) ([]*dom.Element, error) {
+	var result []*dom.Element
+	err := c.call(ctx, "Instances", false, func(ctx context.Context) (err error) {
+		result, err = enumerate(ctx, c, c.resourceURI(resourceURI))
+		return err
+	})
+	return result, err
+}
+
+// Enumerate enumerates the instances of resourceURI lazily, pulling
+// batchSize of them at a time, or a default batch size when it's 0. Close the
+// returned Enumeration when stopping before the end.
+func (c *Client) Enumerate(ctx context.Context, resourceURI string, batchSize int) *Enumeration {
+	return newEnumeration(ctx, c, c.resourceURI(resourceURI), batchSize)
+}
+
+// SubscribeWithHeartbeat subscribes to the events of the firmware. The
+// returned Subscription renews itself and watches the heartbeats until it is
+// closed; serve it at options.NotifyTo to receive the events.
+func (c *Client) SubscribeWithHeartbeat(ctx context.Context, options SubscriptionOptions) (*Subscription, error) {
+	var result *Subscription
+	err := c.call(ctx, "SubscribeWithHeartbeat", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = subscribeWithHeartbeat(ctx, c, options)
+		return err
+	})
+	return result, err
+}
+
+// ManagedSystemReference returns the endpoint reference of the managed CIM_ComputerSystem,
+// the ManagedElement of power state requests.
+func (c *Client) ManagedSystemReference(ctx context.Context) (*dom.Element, error) {
+	var result *dom.Element
+	err := c.call(ctx, "ManagedSystemReference", false, func(ctx context.Context) (err error) {
+		result, err = getManagedSystemRef(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// NewInvoke creates a message calling method on resourceURI. Add parameters
+// with its Parameters method or AddReferenceParameter and send it with RawInvoke.
+// Like EndpointReference, it applies Connection.ResourceURIs to resourceURI.
+func (c *Client) NewInvoke(resourceURI, method string) *wsman.Message {
+	return c.wsManClient.Invoke(c.resourceURI(resourceURI), method)
+}
+
+// RawInvoke sends an invoke message and returns the response and its ReturnValue.
+// A non zero ReturnValue is returned as an error alongside the response.
+func (c *Client) RawInvoke(ctx context.Context, message *wsman.Message) (*wsman.Message, int, error) {
+	var response *wsman.Message
+	var returnValue int
+	err := c.call(ctx, "RawInvoke", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		response, returnValue, err = sendInvoke(ctx, c, message)
+		return err
+	})
+	return response, returnValue, err
+}
+
+// Info returns the report of the device mirroring amtinfo: the version,
+// build and SKU, the UUID, the control mode, the DNS suffix, the CIRA
+// configuration, the network interfaces and the certificate hashes. Only the
+// version is required, the parts that can't be read are left empty.
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var result *Info
+	err := c.call(ctx, "Info", false, func(ctx context.Context) (err error) {
+		result, err = getInfo(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// RemoteAccessStatus returns the CIRA configuration: the MPS servers and
+// whether the host may open a connection on demand. The connection state is
+// only known from the host, see mei.HostInterface.RemoteAccessStatus.
+func (c *Client) RemoteAccessStatus(ctx context.Context) (*RemoteAccessStatus, error) {
+	var result *RemoteAccessStatus
+	err := c.call(ctx, "RemoteAccessStatus", false, func(ctx context.Context) (err error) {
+		result, err = getRemoteAccessStatus(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// SetUserInitiatedConnections allows or forbids the host to open and close
+// the CIRA connection on demand, with mei.HostInterface.OpenUserInitiatedConnection.
+func (c *Client) SetUserInitiatedConnections(ctx context.Context, enabled bool) error {
+	return c.call(ctx, "SetUserInitiatedConnections", true, func(ctx context.Context) error {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		_, err := applyUserInitiatedConnections(ctx, c, enabled)
+		return err
+	})
+}
+
+// ApplyUserInitiatedConnections is SetUserInitiatedConnections, telling
+// whether it changed.
+func (c *Client) ApplyUserInitiatedConnections(ctx context.Context, enabled bool) (ApplyResult, error) {
+	var result ApplyResult
+	err := c.call(ctx, "ApplyUserInitiatedConnections", true, func(ctx context.Context) (err error) {
+		c.operationMu.Lock()
+		defer c.operationMu.Unlock()
+		result, err = applyUserInitiatedConnections(ctx, c, enabled)
+		return err
+	})
+	return result, err
+}
+
+// SoftwareIdentities lists the firmware components and their versions, to
+// tell which machines need an update after a security advisory.
+func (c *Client) SoftwareIdentities(ctx context.Context) ([]SoftwareIdentity, error) {
+	var result []SoftwareIdentity
+	err := c.call(ctx, "SoftwareIdentities", false, func(ctx context.Context) (err error) {
+		result, err = getSoftwareIdentities(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// Version returns the AMT firmware version, e.g. "11.8.50". It is only queried once per Client.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var result string
+	err := c.call(ctx, "Version", false, func(ctx context.Context) (err error) {
+		result, err = getAMTVersion(ctx, c)
+		return err
+	})
+	return result, err
+}
+
+// Stats returns the counters of the requests sent to the firmware so far.
+func (c *Client) Stats() Stats {
+	return c.stats.get()
+}
+
+// Writes returns the number of mutating requests sent by the client, see
+// WriteLimit. The firmware does not expose its own flash write counter.
+func (c *Client) Writes() int {
+	return c.writes.count()
 }
@@ -0,0 +1,59 @@
+package amt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_When_OperationInProgress_Expect_MutationsWait(t *testing.T) {
+	tests := map[string]func(ctx context.Context, client *Client) error{
+		"SetLinkProtection": func(ctx context.Context, client *Client) error {
+			return client.SetLinkProtection(ctx, WiredPort, LinkProtectionNone)
+		},
+		"AddCertificateHash": func(ctx context.Context, client *Client) error {
+			return client.AddCertificateHash(ctx, "root", make([]byte, 32))
+		},
+		"DeleteCertificateHash": func(ctx context.Context, client *Client) error {
+			return client.DeleteCertificateHash(ctx, "hash")
+		},
+		"SetKVMState": func(ctx context.Context, client *Client) error {
+			return client.SetKVMState(ctx, true)
+		},
+		"SetRedirectionState": func(ctx context.Context, client *Client) error {
+			return client.SetRedirectionState(ctx, true, true)
+		},
+		"SetIdleWakeTimeout": func(ctx context.Context, client *Client) error {
+			return client.SetIdleWakeTimeout(ctx, time.Minute)
+		},
+		"ApplyLinkPreference": func(ctx context.Context, client *Client) error {
+			_, err := client.ApplyLinkPreference(ctx, WiredPort, LinkOwnerME, time.Minute)
+			return err
+		},
+		"DeleteAlarm": func(ctx context.Context, client *Client) error {
+			return client.DeleteAlarm(ctx, "alarm")
+		},
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeFirmware{}
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			client.operationMu.Lock()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				// the firmware fails every request, only whether it is sent matters.
+				mutate(context.Background(), client)
+			}()
+			time.Sleep(50 * time.Millisecond)
+			assert.Empty(t, f.received())
+			client.operationMu.Unlock()
+			<-done
+			assert.NotEmpty(t, f.received())
+		})
+	}
+}
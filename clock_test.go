@@ -0,0 +1,56 @@
+package amt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManualClock_When_Advanced_Expect_DueTimersFired(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	soon := clock.NewTimer(time.Second)
+	later := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), clock.Now())
+	select {
+	case fired := <-soon.C():
+		assert.Equal(t, start.Add(2*time.Second), fired)
+	default:
+		t.Fatal("timer due was not fired")
+	}
+	assert.Len(t, later.C(), 0)
+	assert.Len(t, stopped.C(), 0)
+	assert.Equal(t, 1, clock.Timers())
+
+	assert.True(t, later.Reset(time.Second))
+	clock.Advance(time.Second)
+	assert.Len(t, later.C(), 1)
+	assert.Equal(t, 0, clock.Timers())
+}
+
+func TestPoll_When_ManualClock_Expect_WaitsOnlyForAdvance(t *testing.T) {
+	clock := NewManualClock(time.Time{})
+	done := make(chan error)
+	calls := 0
+	go func() {
+		done <- Poll(context.Background(), PollOptions{Initial: time.Hour, Jitter: -1, Clock: clock}, func(ctx context.Context) (bool, error) {
+			calls++
+			return calls == 3, nil
+		})
+	}()
+	for i := 0; i < 2; i++ {
+		for clock.Timers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Hour)
+	}
+	assert.NoError(t, <-done)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2*time.Hour, clock.Now().Sub(time.Time{}))
+}
@@ -0,0 +1,82 @@
+package amt
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is the Accept-Encoding of the WSMAN requests when
+// compression is enabled.
+const acceptEncoding = "gzip, deflate"
+
+// compressionTransport asks for compressed responses and decompresses them,
+// so large enumerations over slow links transfer faster. Firmware that
+// doesn't compress answers as usual. Unlike the compression of http.Transport
+// it also works over a custom Connection.Transport and handles deflate.
+type compressionTransport struct {
+	next http.RoundTripper
+}
+
+func (t *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	var body io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		body = gz
+	case "deflate":
+		body, err = newDeflateReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	default:
+		return resp, nil
+	}
+	resp.Body = &decompressedBody{Reader: body, compressed: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// newDeflateReader decompresses a deflate body. It should be zlib wrapped
+// but some servers send raw deflate data.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// decompressedBody reads the decompressed body and closes the compressed one.
+type decompressedBody struct {
+	io.Reader
+	compressed io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return b.compressed.Close()
+}
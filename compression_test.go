@@ -0,0 +1,72 @@
+package amt
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionTransport_When_ResponseIsCompressed_Expect_Decompressed(t *testing.T) {
+	const body = "<a><b>ok</b></a>"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+		var buf bytes.Buffer
+		var writer io.WriteCloser
+		switch r.URL.Path {
+		case "/gzip":
+			writer = gzip.NewWriter(&buf)
+		case "/zlib":
+			writer = zlib.NewWriter(&buf)
+		case "/deflate":
+			writer, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		default:
+			w.Write([]byte(body))
+			return
+		}
+		writer.Write([]byte(body))
+		writer.Close()
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		if encoding == "zlib" {
+			encoding = "deflate"
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: &compressionTransport{next: &http.Transport{DisableCompression: true}}}
+
+	for _, path := range []string{"/gzip", "/zlib", "/deflate", "/plain"} {
+		resp, err := client.Get(server.URL + path)
+		if assert.NoError(t, err, path) {
+			got, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.NoError(t, err, path)
+			assert.Equal(t, body, string(got), path)
+			assert.Empty(t, resp.Header.Get("Content-Encoding"), path)
+		}
+	}
+}
+
+func TestCompressionTransport_When_DecompressedOverLimit_Expect_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte("<a>" + strings.Repeat("x", 1000) + "</a>"))
+		gz.Close()
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: newLimitTransport(100, 5, &compressionTransport{next: &http.Transport{DisableCompression: true}})}
+
+	_, err := client.Get(server.URL)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "%v", err)
+}
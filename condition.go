@@ -0,0 +1,102 @@
+package amt
+
+import (
+	"strings"
+	"time"
+)
+
+// ConditionStatus is the status of a Condition.
+type ConditionStatus string
+
+// Condition statuses, as in the conditions of Kubernetes.
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+// ConditionReady is the type of the condition summing up a multi-step
+// operation: True when every step succeeded.
+const ConditionReady = "Ready"
+
+// Reasons of the conditions of the steps.
+const (
+	ReasonApplied        = "Applied"
+	ReasonUpToDate       = "UpToDate"
+	ReasonFailed         = "Failed"
+	ReasonRolledBack     = "RolledBack"
+	ReasonRollbackFailed = "RollbackFailed"
+	ReasonNotAttempted   = "NotAttempted"
+)
+
+// Condition is the outcome of a step of a multi-step operation, shaped like
+// the conditions of Kubernetes so controllers can copy them into the status of
+// their resources, see SetCondition.
+type Condition struct {
+	// Type is the step in CamelCase, e.g. "KVMState", or ConditionReady.
+	Type   string
+	Status ConditionStatus
+	// Reason is a CamelCase reason, e.g. ReasonApplied, and Message the
+	// details, e.g. the error of a failed step.
+	Reason             string
+	Message            string
+	LastTransitionTime time.Time
+}
+
+// SetCondition sets condition in conditions, replacing the condition of the
+// same type. The LastTransitionTime of the replaced condition is kept when
+// the status didn't change.
+func SetCondition(conditions []Condition, condition Condition) []Condition {
+	for i, c := range conditions {
+		if c.Type != condition.Type {
+			continue
+		}
+		if c.Status == condition.Status {
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+		conditions[i] = condition
+		return conditions
+	}
+	return append(conditions, condition)
+}
+
+// FindCondition returns the condition of type conditionType, nil when there is none.
+func FindCondition(conditions []Condition, conditionType string) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// conditionType returns the type of the condition of step, e.g. "KVMState"
+// for "KVM state".
+func conditionType(step string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(step) {
+		b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return b.String()
+}
+
+// stepCondition returns the condition of step, failed with err when set.
+func stepCondition(step string, reason string, err error, now time.Time) Condition {
+	c := Condition{Type: conditionType(step), Status: ConditionTrue, Reason: reason, LastTransitionTime: now}
+	if err != nil {
+		c.Status, c.Message = ConditionFalse, err.Error()
+	}
+	return c
+}
+
+// readyCondition sums up the result of a multi-step operation.
+func readyCondition(result ApplyResult, err error, now time.Time) Condition {
+	ready := Condition{Type: ConditionReady, Status: ConditionTrue, Reason: ReasonUpToDate, LastTransitionTime: now}
+	if result.Changed {
+		ready.Reason = ReasonApplied
+	}
+	if err != nil {
+		ready.Status, ready.Reason, ready.Message = ConditionFalse, ReasonFailed, err.Error()
+	}
+	return ready
+}
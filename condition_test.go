@@ -0,0 +1,29 @@
+package amt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConditionType_When_StepName_Expect_CamelCase(t *testing.T) {
+	assert.Equal(t, "KVMState", conditionType(featureKVMState))
+	assert.Equal(t, "RedirectionListener", conditionType(featureRedirectionListener))
+	assert.Equal(t, "DigestRealm", conditionType("digest realm"))
+}
+
+func TestSetCondition_When_StatusUnchanged_Expect_TransitionTimeKept(t *testing.T) {
+	before := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	after := before.Add(time.Hour)
+	conditions := []Condition{{Type: ConditionReady, Status: ConditionTrue, Reason: ReasonApplied, LastTransitionTime: before}}
+
+	conditions = SetCondition(conditions, Condition{Type: ConditionReady, Status: ConditionTrue, Reason: ReasonUpToDate, LastTransitionTime: after})
+	assert.Len(t, conditions, 1)
+	assert.Equal(t, ReasonUpToDate, conditions[0].Reason)
+	assert.Equal(t, before, conditions[0].LastTransitionTime)
+
+	conditions = SetCondition(conditions, Condition{Type: ConditionReady, Status: ConditionFalse, Reason: ReasonFailed, LastTransitionTime: after})
+	assert.Equal(t, after, FindCondition(conditions, ConditionReady).LastTransitionTime)
+	assert.Nil(t, FindCondition(conditions, "KVMState"))
+}
@@ -1,6 +1,13 @@
 package amt
 
-import "github.com/go-logr/logr"
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
 
 // Connection properties for a Client
 type Connection struct {
@@ -11,4 +18,96 @@ type Connection struct {
 	Pass   string
 	Debug  bool
 	Logger logr.Logger
+	// Transport, when set, carries the WSMAN requests instead of a direct HTTP
+	// connection to Host. For example mei.NewTransport to reach the firmware of
+	// the local host without LMS. Digest authentication is layered on top. The
+	// client doesn't close it.
+	Transport http.RoundTripper
+	// DialContext opens the connections of the default transport instead of a
+	// net.Dialer, e.g. through a CIRA tunnel, an SSH jump host or a unix socket.
+	// TLS and Fingerprints still apply on top. It is unused with Transport.
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+	// Strict makes the client validate that responses contain the elements and
+	// namespaces it expects, instead of falling back to zero values.
+	Strict bool
+	// TLS connects to the TLS port (16993 unless Port is set) over https.
+	TLS bool
+	// Fingerprints, when set, pins the certificate of Host on first use instead
+	// of accepting any certificate. It is only used by the default transport.
+	Fingerprints FingerprintStore
+	// UserAgent, when set, replaces the User-Agent of every WSMAN request.
+	UserAgent string
+	// Header holds extra headers sent with every WSMAN request.
+	Header http.Header
+	// Hooks are called around every WSMAN request.
+	Hooks Hooks
+	// OperationSink, when set, receives a record of every mutating request.
+	OperationSink OperationSink
+	// ResourceURIs replaces resource URIs, e.g. ResourceCIMPowerManagementService,
+	// for firmware that uses different namespaces. Keys are the exported URIs.
+	ResourceURIs map[string]string
+	// MaxResponseSize is the largest response in bytes the client parses,
+	// DefaultMaxResponseSize when 0 and unlimited when negative.
+	MaxResponseSize int64
+	// DisableCompression stops asking for gzip or deflate compressed
+	// responses. Firmware that doesn't compress ignores the request, so it's
+	// only needed to work around a broken proxy or firmware. MaxResponseSize
+	// applies to the decompressed responses.
+	DisableCompression bool
+	// MaxElementDepth is the deepest nesting of elements the client parses,
+	// DefaultMaxElementDepth when 0 and unlimited when negative.
+	MaxElementDepth int
+	// NamespaceMatch relaxes how response elements are matched to the
+	// expected namespaces, for OEM derivatives of AMT.
+	NamespaceMatch NamespaceMatch
+	// NamespacePrefixes maps namespace prefixes used in responses to the
+	// standard ones, e.g. an OEM schema root to
+	// "http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/".
+	NamespacePrefixes map[string]string
+	// Store, when set, caches what the client discovers about the device,
+	// e.g. the firmware version, across clients and process restarts. Each
+	// client caches in its own MemoryStore otherwise.
+	Store Store
+	// DeviceID, when set, identifies the device in Store instead of the
+	// scheme, host and port, e.g. its UUID. It's needed when those don't tell
+	// devices apart, as with mei.NewTransport where every device is localhost
+	// or with a Transport or DialContext that ignores Host.
+	DeviceID string
+	// ReadTimeout, when set, bounds every get and enumeration, so a status
+	// check of an unresponsive machine fails fast.
+	ReadTimeout time.Duration
+	// MutationTimeout, when set, bounds every mutating request. Some, e.g.
+	// Unprovision, legitimately take minutes.
+	MutationTimeout time.Duration
+	// WriteLimit, when set, warns about or rejects mutating requests sent more
+	// often than the flash of the firmware should be written.
+	WriteLimit WriteLimit
+	// Progress, when set, receives the steps of the multi-step operations,
+	// e.g. SetFeatures, SetNextBoot, Recover and ActivateClientControlMode.
+	Progress ProgressReporter
+	// Sessions, when set, shares the digest authentication and the
+	// connections of Host with the other clients of the same Sessions,
+	// instead of each client opening its own session with the firmware.
+	Sessions *Sessions
+	// SessionLimitWait, when set, is how long a request refused because the
+	// firmware is out of sessions is retried before failing with
+	// ErrSessionLimit. It fails at once otherwise.
+	SessionLimitWait time.Duration
+	// Clock, when set, replaces SystemClock, e.g. a ManualClock in tests.
+	Clock Clock
+	// ForbidMD5 refuses the MD5 digest algorithms, failing with
+	// ErrMD5Forbidden when the firmware offers nothing stronger. The
+	// strongest algorithm offered is used either way, SHA-256 before MD5.
+	ForbidMD5 bool
+	// DedupeWindow is how long the power operations called with
+	// WithIdempotencyKey are remembered, DefaultDedupeWindow when 0.
+	DedupeWindow time.Duration
+	// Middleware wraps every method call of the client, the first one
+	// outermost, see Middleware.
+	Middleware []Middleware
+	// WebUIFallback lets Info and Version scrape the web UI pages of the
+	// firmware for the version and the network settings when the WSMAN
+	// classes holding them are missing, as on ancient firmware. The pages
+	// are not an API and vary across versions, so it's off by default.
+	WebUIFallback bool
 }
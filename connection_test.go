@@ -0,0 +1,27 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialContext_When_Set_Expect_UsedByDefaultTransport(t *testing.T) {
+	refused := errors.New("refused")
+	var dialed string
+	client, err := NewClient(Connection{
+		Host: "amt.example.com",
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = address
+			return nil, refused
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Version(context.Background())
+	assert.True(t, errors.Is(err, refused), "%v", err)
+	assert.Equal(t, "amt.example.com:16992", dialed)
+}
@@ -0,0 +1,245 @@
+package amt
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
+)
+
+// https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/HTMLDocuments/WS-Management_Class_Reference/AMT_PublicKeyManagementService.htm
+const (
+	keyAlgorithmRSA        = "0"
+	signingAlgorithmSHA256 = "1"
+	tlsEndpointCollection  = "TLSProtocolEndpointInstances Collection"
+)
+
+var (
+	oidRSAEncryption           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+)
+
+// Enroller gets a DER encoded certificate request signed by a CA and returns
+// the DER encoded certificate, e.g. est.Client.
+type Enroller interface {
+	Enroll(ctx context.Context, csr []byte) ([]byte, error)
+}
+
+// KeyPair is an RSA key pair generated by the firmware. The private key never leaves the device.
+type KeyPair struct {
+	InstanceID string
+	PublicKey  *rsa.PublicKey
+	ref        *dom.Element
+}
+
+func generateKeyPair(ctx context.Context, client *Client, bits int) (*KeyPair, error) {
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTPublicKeyManagementService), "GenerateKeyPair")
+	message.Parameters("KeyAlgorithm", keyAlgorithmRSA, "KeyLength", strconv.Itoa(bits))
+	response, _, err := sendInvoke(ctx, client, message)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := outputReference(response, "KeyPair")
+	if err != nil {
+		return nil, err
+	}
+	id := instanceIDSelector(ref)
+
+	keyPairResource := client.resourceURI(ResourceAMTPublicPrivateKeyPair)
+	get := client.wsManClient.Get(keyPairResource)
+	get.Selectors("InstanceID", id)
+	response, err = client.send(ctx, get)
+	if err != nil {
+		return nil, err
+	}
+	derKey := client.namespaces.firstTag("DERKey", keyPairResource, response.AllBodyElements())
+	if derKey == nil {
+		return nil, fmt.Errorf("response was missing the AMT_PublicPrivateKeyPair DERKey")
+	}
+	der, err := base64.StdEncoding.DecodeString(string(derKey.Content))
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyPair{InstanceID: id, PublicKey: publicKey, ref: ref}, nil
+}
+
+// generateCSR has the firmware sign a certificate request for subject with the key pair.
+func generateCSR(ctx context.Context, client *Client, keyPair *KeyPair, subject pkix.Name) ([]byte, error) {
+	request, err := nullSignedCSR(keyPair.PublicKey, subject)
+	if err != nil {
+		return nil, err
+	}
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTPublicKeyManagementService), "GeneratePKCS10RequestEx")
+	AddReferenceParameter(message, "KeyPair", keyPair.ref)
+	message.Parameters(
+		"SigningAlgorithm", signingAlgorithmSHA256,
+		"NullSignedCertificateRequest", base64.StdEncoding.EncodeToString(request),
+	)
+	response, _, err := sendInvoke(ctx, client, message)
+	if err != nil {
+		return nil, err
+	}
+	signed := search.FirstTag("SignedCertificateRequest", "*", response.AllBodyElements())
+	if signed == nil {
+		return nil, fmt.Errorf("response was missing the SignedCertificateRequest")
+	}
+	csr, err := base64.StdEncoding.DecodeString(string(signed.Content))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := x509.ParseCertificateRequest(csr); err != nil {
+		return nil, fmt.Errorf("firmware returned an invalid certificate request: %v", err)
+	}
+	return csr, nil
+}
+
+// nullSignedCSR encodes a PKCS#10 request whose signature is all zeros, for the firmware to sign.
+func nullSignedCSR(publicKey *rsa.PublicKey, subject pkix.Name) ([]byte, error) {
+	rawSubject, err := asn1.Marshal(subject.ToRDNSequence())
+	if err != nil {
+		return nil, err
+	}
+	publicKeyBytes := x509.MarshalPKCS1PublicKey(publicKey)
+	info, err := asn1.Marshal(struct {
+		Version       int
+		Subject       asn1.RawValue
+		PublicKey     publicKeyInfo
+		RawAttributes []asn1.RawValue `asn1:"tag:0"`
+	}{
+		Subject: asn1.RawValue{FullBytes: rawSubject},
+		PublicKey: publicKeyInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			PublicKey: asn1.BitString{Bytes: publicKeyBytes, BitLength: 8 * len(publicKeyBytes)},
+		},
+		RawAttributes: []asn1.RawValue{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]byte, publicKey.Size())
+	return asn1.Marshal(struct {
+		Info               asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          asn1.BitString
+	}{
+		Info:               asn1.RawValue{FullBytes: info},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256WithRSAEncryption, Parameters: asn1.NullRawValue},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+}
+
+type publicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// addCertificate installs a DER encoded certificate whose key pair is in the
+// firmware and returns its InstanceID.
+func addCertificate(ctx context.Context, client *Client, der []byte) (string, error) {
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTPublicKeyManagementService), "AddCertificate")
+	message.Parameters("CertificateBlob", base64.StdEncoding.EncodeToString(der))
+	response, _, err := sendInvoke(ctx, client, message)
+	if err != nil {
+		return "", err
+	}
+	ref, err := outputReference(response, "CreatedCertificate")
+	if err != nil {
+		return "", err
+	}
+	return instanceIDSelector(ref), nil
+}
+
+// bindTLSCertificate makes the certificate the TLS server certificate,
+// replacing the current one.
+func bindTLSCertificate(ctx context.Context, client *Client, certificateInstanceID string) error {
+	certificateRef, err := getEndpointReferenceByInstanceID(ctx, client, client.resourceURI(ResourceAMTPublicKeyCertificate), certificateInstanceID)
+	if err != nil {
+		return err
+	}
+	collectionRef, err := getEndpointReferenceBySelector(ctx, client, client.resourceURI(ResourceAMTTLSProtocolEndpointCollection), "ElementName", tlsEndpointCollection)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteInstances(ctx, client, client.resourceURI(ResourceAMTTLSCredentialContext)); err != nil {
+		return fmt.Errorf("removing the current TLS certificate: %v", err)
+	}
+
+	envelope := client.NewEnvelope(wsman.CREATE, ResourceAMTTLSCredentialContext)
+	envelope.Instance(
+		envelope.Reference("ElementInContext", certificateRef),
+		envelope.Reference("ElementProvidingContext", collectionRef),
+	)
+	_, err = envelope.Send(ctx)
+	return err
+}
+
+// enrollTLSCertificate runs the whole enrollment: a new key pair in the
+// firmware, its CSR signed by enroller, then the certificate installed and
+// bound to TLS.
+func enrollTLSCertificate(ctx context.Context, client *Client, enroller Enroller, subject pkix.Name) (string, error) {
+	keyPair, err := generateKeyPair(ctx, client, 2048)
+	if err != nil {
+		return "", fmt.Errorf("generating the key pair: %v", err)
+	}
+	csr, err := generateCSR(ctx, client, keyPair, subject)
+	if err != nil {
+		return "", fmt.Errorf("generating the certificate request: %v", err)
+	}
+	certificate, err := enroller.Enroll(ctx, csr)
+	if err != nil {
+		return "", fmt.Errorf("enrolling: %v", err)
+	}
+	id, err := addCertificate(ctx, client, certificate)
+	if err != nil {
+		return "", fmt.Errorf("installing the certificate: %v", err)
+	}
+	if err := bindTLSCertificate(ctx, client, id); err != nil {
+		return "", fmt.Errorf("binding the certificate to TLS: %v", err)
+	}
+	return id, nil
+}
+
+// outputReference returns the endpoint reference output parameter name of an invoke response.
+func outputReference(response *wsman.Message, name string) (*dom.Element, error) {
+	ref := search.FirstTag(name, "*", response.AllBodyElements())
+	if ref == nil {
+		return nil, fmt.Errorf("response was missing the %s reference", name)
+	}
+	return ref, nil
+}
+
+// addSelectorsFromReference targets message at the instance referenced by epr.
+func addSelectorsFromReference(message *wsman.Message, epr *dom.Element) {
+	for _, s := range search.All(search.Tag("Selector", wsman.NS_WSMAN), epr.Descendants()) {
+		if s.Parent() == nil || s.Parent().Name.Local != "SelectorSet" || s.Parent().Parent() == nil {
+			continue
+		}
+		// only the selectors of epr itself, not those of references nested in them.
+		if owner := s.Parent().Parent(); owner.Name.Local != "ReferenceParameters" || owner.Parent() != epr {
+			continue
+		}
+		name := ""
+		for _, a := range s.Attributes {
+			if a.Name.Local == "Name" {
+				name = a.Value
+			}
+		}
+		selector := message.MakeSelector(name)
+		selector.Content = s.Content
+		selector.AddChildren(s.Children()...)
+		message.AddSelector(selector)
+	}
+}
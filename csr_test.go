@@ -0,0 +1,28 @@
+package amt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNullSignedCSR_When_Encoded_Expect_ParsableRequest(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	der, err := nullSignedCSR(&key.PublicKey, pkix.Name{CommonName: "amt.example.com"})
+	assert.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "amt.example.com", csr.Subject.CommonName)
+	assert.Equal(t, &key.PublicKey, csr.PublicKey)
+	assert.Equal(t, x509.SHA256WithRSA, csr.SignatureAlgorithm)
+	// the firmware signs it.
+	assert.Error(t, csr.CheckSignature())
+}
@@ -0,0 +1,139 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+)
+
+const (
+	// userInitiatedConnectionsDisabled is the EnabledState of
+	// AMT_UserInitiatedConnectionService with every interface disabled.
+	userInitiatedConnectionsDisabled = 32768
+	// userInitiatedConnectionsEnabled enables them from the BIOS and the OS.
+	userInitiatedConnectionsEnabled = 32771
+	provisioningModeFull            = "1"
+)
+
+// decommission erases the secrets a new owner of the machine could recover:
+// the wireless profiles, the 802.1x credentials, the CIRA configuration and
+// the user accounts. It stops at the first failure, before unprovisioning,
+// so it can be retried.
+func decommission(ctx context.Context, client *Client) error {
+	steps := []struct {
+		name string
+		run  func(ctx context.Context, client *Client) error
+	}{
+		{"wireless profiles", func(ctx context.Context, client *Client) error {
+			return deleteInstances(ctx, client, client.resourceURI(ResourceCIMWiFiEndpointSettings))
+		}},
+		{"802.1x credentials", delete8021xCredentials},
+		{"CIRA configuration", deleteCIRAConfiguration},
+		{"user accounts", deleteUserAccounts},
+	}
+	for _, step := range steps {
+		if err := step.run(ctx, client); err != nil {
+			return fmt.Errorf("erasing the %s: %v", step.name, err)
+		}
+	}
+	return unprovision(ctx, client)
+}
+
+// delete8021xCredentials deletes the 802.1x credential contexts and their
+// certificates, except the ones also used for TLS.
+func delete8021xCredentials(ctx context.Context, client *Client) error {
+	ieee8021x, err := credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMT8021xCredentialContext))
+	if err != nil {
+		return err
+	}
+	tls, err := credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMTTLSCredentialContext))
+	if err != nil {
+		return err
+	}
+	if err := deleteInstances(ctx, client, client.resourceURI(ResourceAMT8021xCredentialContext)); err != nil {
+		return err
+	}
+	for id := range ieee8021x {
+		if tls[id] {
+			continue
+		}
+		message := client.wsManClient.Delete(client.resourceURI(ResourceAMTPublicKeyCertificate))
+		message.Selectors("InstanceID", id)
+		if _, err := client.send(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteCIRAConfiguration disables the user initiated connections and deletes
+// the MPS servers with the policies that use them.
+func deleteCIRAConfiguration(ctx context.Context, client *Client) error {
+	if err := requestStateChange(ctx, client, client.resourceURI(ResourceAMTUserInitiatedConnectionService), userInitiatedConnectionsDisabled); err != nil {
+		return err
+	}
+	if err := deleteInstances(ctx, client, client.resourceURI(ResourceAMTRemoteAccessPolicyAppliesToMPS)); err != nil {
+		return err
+	}
+	return deleteInstances(ctx, client, client.resourceURI(ResourceAMTManagementPresenceRemoteSAP))
+}
+
+// deleteUserAccounts removes every user ACL entry. The admin account is not
+// one of them.
+func deleteUserAccounts(ctx context.Context, client *Client) error {
+	handles, err := getUserACLHandles(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, handle := range handles {
+		message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTAuthorizationService), "RemoveUserAclEntry")
+		message.Parameters("Handle", handle)
+		if _, err := sendMessageForReturnValueInt(ctx, client, message); err != nil {
+			return fmt.Errorf("removing user ACL entry %s: %v", handle, err)
+		}
+	}
+	return nil
+}
+
+func getUserACLHandles(ctx context.Context, client *Client) ([]string, error) {
+	handles := []string{}
+	for {
+		message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTAuthorizationService), "EnumerateUserAclEntries")
+		message.Parameters("StartIndex", strconv.Itoa(len(handles)+1))
+		response, _, err := sendInvoke(ctx, client, message)
+		if err != nil {
+			return nil, err
+		}
+		total, page := parseUserACLEntries(response.AllBodyElements())
+		handles = append(handles, page...)
+		if len(page) == 0 || len(handles) >= total {
+			return handles, nil
+		}
+	}
+}
+
+// parseUserACLEntries returns the TotalCount and the Handles of an
+// EnumerateUserAclEntries response.
+func parseUserACLEntries(elements []*dom.Element) (int, []string) {
+	handles := []string{}
+	for _, h := range search.All(search.Tag("Handles", "*"), elements) {
+		handles = append(handles, string(h.Content))
+	}
+	total := len(handles)
+	if t := search.FirstTag("TotalCount", "*", elements); t != nil {
+		if n, err := strconv.Atoi(string(t.Content)); err == nil {
+			total = n
+		}
+	}
+	return total, handles
+}
+
+func unprovision(ctx context.Context, client *Client) error {
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTSetupAndConfigurationService), "Unprovision")
+	message.Parameters("ProvisioningMode", provisioningModeFull)
+	_, err := sendMessageForReturnValueInt(ctx, client, message)
+	return err
+}
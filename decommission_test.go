@@ -0,0 +1,21 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserACLEntries_When_FirstPage_Expect_TotalAndHandles(t *testing.T) {
+	elements := []*dom.Element{
+		dom.ElemC("TotalCount", ResourceAMTAuthorizationService, "3"),
+		dom.ElemC("HandlesCount", ResourceAMTAuthorizationService, "2"),
+		dom.ElemC("Handles", ResourceAMTAuthorizationService, "11"),
+		dom.ElemC("Handles", ResourceAMTAuthorizationService, "12"),
+		dom.ElemC("ReturnValue", ResourceAMTAuthorizationService, "0"),
+	}
+	total, handles := parseUserACLEntries(elements)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"11", "12"}, handles)
+}
@@ -0,0 +1,320 @@
+package amt
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// digestChallenge is a parsed WWW-Authenticate digest challenge.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       []string
+}
+
+func parseDigestChallenge(header string) (*digestChallenge, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, "Digest ") {
+		return nil, fmt.Errorf("not a digest challenge")
+	}
+	c := &digestChallenge{algorithm: "MD5"}
+	for key, value := range parseAuthParams(header[len("Digest "):]) {
+		switch strings.ToLower(key) {
+		case "realm":
+			c.realm = value
+		case "nonce":
+			c.nonce = value
+		case "opaque":
+			c.opaque = value
+		case "algorithm":
+			c.algorithm = value
+		case "qop":
+			for _, q := range strings.Split(value, ",") {
+				c.qop = append(c.qop, strings.TrimSpace(q))
+			}
+		}
+	}
+	if c.nonce == "" {
+		return nil, fmt.Errorf("digest challenge is missing the nonce")
+	}
+	return c, nil
+}
+
+// ErrMD5Forbidden is returned when Connection.ForbidMD5 is set and the server
+// only offers MD5 digest authentication.
+var ErrMD5Forbidden = errors.New("the server only offers MD5 digest authentication, which is forbidden")
+
+// digestAlgorithms are the supported digest algorithms, strongest first.
+var digestAlgorithms = []string{"SHA-256", "SHA-256-sess", "MD5", "MD5-sess"}
+
+// digestHash returns the hash function of algorithm, nil when unsupported.
+func digestHash(algorithm string) func(string) string {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "MD5":
+		return md5Hex
+	case "SHA-256":
+		return sha256Hex
+	}
+	return nil
+}
+
+func isMD5(algorithm string) bool {
+	return strings.HasPrefix(strings.ToUpper(algorithm), "MD5")
+}
+
+// selectDigestChallenge returns the challenge with the strongest supported
+// algorithm among the WWW-Authenticate headers, a server may offer one per
+// algorithm.
+func selectDigestChallenge(headers []string, forbidMD5 bool) (*digestChallenge, error) {
+	var challenges []*digestChallenge
+	for _, header := range headers {
+		if c, err := parseDigestChallenge(header); err == nil {
+			challenges = append(challenges, c)
+		}
+	}
+	if len(challenges) == 0 {
+		return nil, fmt.Errorf("no digest challenge")
+	}
+	for _, algorithm := range digestAlgorithms {
+		if forbidMD5 && isMD5(algorithm) {
+			continue
+		}
+		for _, c := range challenges {
+			if strings.EqualFold(c.algorithm, algorithm) {
+				return c, nil
+			}
+		}
+	}
+	for _, c := range challenges {
+		if digestHash(c.algorithm) != nil {
+			return nil, ErrMD5Forbidden
+		}
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %q", challenges[0].algorithm)
+}
+
+// parseAuthParams parses comma separated key=value pairs where values may be
+// quoted strings containing commas.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end > len(s) {
+				end = len(s)
+			}
+			value = strings.ReplaceAll(s[1:end], `\`, "")
+			if end < len(s) {
+				end++
+			}
+			s = s[end:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// digestTransport answers HTTP digest challenges on top of another RoundTripper.
+// The last challenge is remembered so following requests are authorized up front.
+type digestTransport struct {
+	username string
+	password string
+	next     http.RoundTripper
+	session  *digestSession
+	// forbidMD5 refuses the MD5 and MD5-sess algorithms.
+	forbidMD5 bool
+}
+
+// digestSession is the last challenge of a host and the nonce count of its
+// answers. Clients with the same Sessions and credentials share it.
+type digestSession struct {
+	mu         sync.Mutex
+	challenge  *digestChallenge
+	nonceCount int
+	// sessionHA1 is the HA1 of the -sess algorithms, computed once per
+	// challenge with sessionCnonce (RFC 7616 section 3.4.2).
+	sessionHA1    string
+	sessionCnonce string
+}
+
+func newDigestTransport(username, password string, next http.RoundTripper) *digestTransport {
+	return &digestTransport{
+		username: username,
+		password: password,
+		next:     next,
+		session:  &digestSession{},
+	}
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.username == "" && t.password == "" {
+		return t.next.RoundTrip(req)
+	}
+	if req.Body != nil && req.GetBody == nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	first := req.Clone(req.Context())
+	if auth, err := t.authorize(req.Method, req.URL.RequestURI()); err == nil {
+		first.Header.Set("Authorization", auth)
+	}
+	resp, err := t.next.RoundTrip(first)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge, err := selectDigestChallenge(resp.Header.Values("WWW-Authenticate"), t.forbidMD5)
+	if errors.Is(err, ErrMD5Forbidden) {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, err
+	}
+	if err != nil {
+		// not something we can answer, let the caller see the 401.
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.session.mu.Lock()
+	t.session.challenge = challenge
+	t.session.nonceCount = 0
+	t.session.sessionHA1, t.session.sessionCnonce = "", ""
+	t.session.mu.Unlock()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	auth, err := t.authorize(req.Method, req.URL.RequestURI())
+	if err != nil {
+		return nil, err
+	}
+	retry.Header.Set("Authorization", auth)
+	return t.next.RoundTrip(retry)
+}
+
+func (t *digestTransport) authorize(method, uri string) (string, error) {
+	t.session.mu.Lock()
+	defer t.session.mu.Unlock()
+	c := t.session.challenge
+	if c == nil {
+		return "", fmt.Errorf("no digest challenge received yet")
+	}
+	hash := digestHash(c.algorithm)
+	if hash == nil {
+		return "", fmt.Errorf("unsupported digest algorithm %q", c.algorithm)
+	}
+	if t.forbidMD5 && isMD5(c.algorithm) {
+		return "", ErrMD5Forbidden
+	}
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	ha1 := hash(t.username + ":" + c.realm + ":" + t.password)
+	sess := strings.HasSuffix(strings.ToLower(c.algorithm), "-sess")
+	if sess {
+		// the session key is bound to the first cnonce of the challenge.
+		if t.session.sessionHA1 == "" {
+			t.session.sessionHA1 = hash(ha1 + ":" + c.nonce + ":" + cnonce)
+			t.session.sessionCnonce = cnonce
+		}
+		ha1, cnonce = t.session.sessionHA1, t.session.sessionCnonce
+	}
+	ha2 := hash(method + ":" + uri)
+	fields := []string{
+		fmt.Sprintf(`username="%s"`, t.username),
+		fmt.Sprintf(`realm="%s"`, c.realm),
+		fmt.Sprintf(`nonce="%s"`, c.nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`algorithm=%s`, c.algorithm),
+	}
+	if containsString(c.qop, "auth") {
+		t.session.nonceCount++
+		nc := fmt.Sprintf("%08x", t.session.nonceCount)
+		response := hash(strings.Join([]string{ha1, c.nonce, nc, cnonce, "auth", ha2}, ":"))
+		fields = append(fields,
+			fmt.Sprintf(`response="%s"`, response),
+			"qop=auth",
+			"nc="+nc,
+			fmt.Sprintf(`cnonce="%s"`, cnonce),
+		)
+	} else {
+		fields = append(fields, fmt.Sprintf(`response="%s"`, hash(ha1+":"+c.nonce+":"+ha2)))
+		if sess {
+			fields = append(fields, fmt.Sprintf(`cnonce="%s"`, cnonce))
+		}
+	}
+	if c.opaque != "" {
+		fields = append(fields, fmt.Sprintf(`opaque="%s"`, c.opaque))
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+func md5Hex(s string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
+}
+
+func sha256Hex(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+func containsString(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package amt
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDigestChallenge_When_QopIsQuotedList_Expect_AllValues(t *testing.T) {
+	c, err := parseDigestChallenge(`Digest realm="Digest:A3829B3827DE4D33D4449B366831FD01", nonce="3ABc+WwAAAAAAAAA", stale="false", qop="auth,auth-int"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "Digest:A3829B3827DE4D33D4449B366831FD01", c.realm)
+	assert.Equal(t, "3ABc+WwAAAAAAAAA", c.nonce)
+	assert.Equal(t, []string{"auth", "auth-int"}, c.qop)
+}
+
+func TestDigestTransport_When_Challenged_Expect_AuthorizedRetry(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		params := parseAuthParams(auth[len("Digest "):])
+		ha1 := md5Hex("admin:realm:secret")
+		ha2 := md5Hex("POST:/wsman")
+		expected := md5Hex(strings.Join([]string{ha1, "nonce", params["nc"], params["cnonce"], "auth", ha2}, ":"))
+		if params["response"] != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newDigestTransport("admin", "secret", http.DefaultTransport)}
+	resp, err := client.Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+
+	// the challenge is reused, so the next request is authorized up front.
+	resp, err = client.Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, requests)
+}
+
+func TestDigestTransport_When_UsedConcurrently_Expect_AllAuthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newDigestTransport("admin", "secret", http.DefaultTransport)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDigestTransport_When_SHA256Offered_Expect_SHA256Used(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			w.Header().Add("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth", algorithm=MD5`)
+			w.Header().Add("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		params := parseAuthParams(auth[len("Digest "):])
+		ha1 := sha256Hex("admin:realm:secret")
+		ha2 := sha256Hex("POST:/wsman")
+		expected := sha256Hex(strings.Join([]string{ha1, "nonce", params["nc"], params["cnonce"], "auth", ha2}, ":"))
+		if params["algorithm"] != "SHA-256" || params["response"] != expected {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newDigestTransport("admin", "secret", http.DefaultTransport)}
+	resp, err := client.Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestDigestTransport_When_OnlyMD5AndForbidden_Expect_ErrMD5Forbidden(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth", algorithm=MD5-sess`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	transport := newDigestTransport("admin", "secret", http.DefaultTransport)
+	transport.forbidMD5 = true
+	_, err := (&http.Client{Transport: transport}).Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+	assert.ErrorIs(t, err, ErrMD5Forbidden)
+}
+
+func TestSelectDigestChallenge_When_SessOffered_Expect_SessResponse(t *testing.T) {
+	c, err := selectDigestChallenge([]string{`Digest realm="realm", nonce="nonce", algorithm=MD5-sess`}, false)
+	assert.NoError(t, err)
+	transport := newDigestTransport("admin", "secret", http.DefaultTransport)
+	transport.session.challenge = c
+	auth, err := transport.authorize("POST", "/wsman")
+	assert.NoError(t, err)
+	params := parseAuthParams(auth[len("Digest "):])
+	ha1 := md5Hex(md5Hex("admin:realm:secret") + ":nonce:" + params["cnonce"])
+	assert.Equal(t, md5Hex(ha1+":nonce:"+md5Hex("POST:/wsman")), params["response"])
+}
+
+func TestDigestTransport_When_SessRequestsFollow_Expect_SessionKeyReused(t *testing.T) {
+	c, err := selectDigestChallenge([]string{`Digest realm="realm", nonce="nonce", qop="auth", algorithm=SHA-256-sess`}, false)
+	assert.NoError(t, err)
+	transport := newDigestTransport("admin", "secret", http.DefaultTransport)
+	transport.session.challenge = c
+
+	var cnonces []string
+	for i, uri := range []string{"/wsman", "/index.htm"} {
+		auth, err := transport.authorize("POST", uri)
+		assert.NoError(t, err)
+		params := parseAuthParams(auth[len("Digest "):])
+		cnonces = append(cnonces, params["cnonce"])
+		// HA1 is computed with the cnonce of the first request of the challenge.
+		ha1 := sha256Hex(sha256Hex("admin:realm:secret") + ":nonce:" + cnonces[0])
+		nc := fmt.Sprintf("%08x", i+1)
+		assert.Equal(t, nc, params["nc"])
+		assert.Equal(t, sha256Hex(strings.Join([]string{ha1, "nonce", nc, cnonces[0], "auth", sha256Hex("POST:" + uri)}, ":")), params["response"])
+	}
+	assert.Equal(t, cnonces[0], cnonces[1])
+}
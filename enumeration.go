@@ -0,0 +1,220 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
+)
+
+// defaultBatchSize is the number of instances pulled at a time by an
+// Enumeration.
+const defaultBatchSize = 32
+
+// Enumeration pulls the instances of a resource lazily, a batch at a time,
+// so callers can stop early and memory stays bounded on devices with
+// thousands of instances. Its methods are safe to call from several
+// goroutines, e.g. Close to stop an enumeration running in another one.
+//
+//	items := client.Enumerate(ctx, amt.ResourceAMTPublicKeyCertificate, 0)
+//	defer items.Close()
+//	for items.Next() {
+//		properties := items.Item().Children()
+//		...
+//	}
+//	err := items.Err()
+//
+// Close releases the enumeration context of the firmware when the caller
+// stops before the end.
+type Enumeration struct {
+	ctx       context.Context
+	client    *Client
+	resource  string
+	batchSize int
+
+	mu      sync.Mutex
+	started bool
+	// context is the EnumerationContext of the firmware, nil at the end.
+	context *dom.Element
+	batch   []*dom.Element
+	item    *dom.Element
+	done    bool
+	err     error
+}
+
+func newEnumeration(ctx context.Context, client *Client, resource string, batchSize int) *Enumeration {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	return &Enumeration{ctx: ctx, client: client, resource: resource, batchSize: batchSize}
+}
+
+// Next advances to the next instance, pulling the next batch from the
+// firmware when needed. It returns false at the end or on error, see Err.
+func (e *Enumeration) Next() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.item = nil
+	for len(e.batch) == 0 {
+		if e.done {
+			return false
+		}
+		if err := e.pull(); err != nil {
+			e.err = err
+			e.done = true
+			return false
+		}
+	}
+	e.item, e.batch = e.batch[0], e.batch[1:]
+	return true
+}
+
+// Item returns the instance Next advanced to. Its children are the
+// properties, decode them with cim.Decode.
+func (e *Enumeration) Item() *dom.Element {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.item
+}
+
+// Err returns the error that stopped the enumeration, if any.
+func (e *Enumeration) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// Close stops the enumeration, releasing the enumeration context of the
+// firmware when the end was not reached.
+func (e *Enumeration) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.done = true
+	e.batch = nil
+	e.item = nil
+	if e.context == nil {
+		return nil
+	}
+	message := e.client.wsManClient.NewMessage(wsman.RELEASE).ResourceURI(e.resource)
+	message.SetBody(dom.Elem("Release", wsman.NS_WSMEN).AddChild(e.context))
+	e.context = nil
+	_, err := e.client.send(e.ctx, message)
+	return err
+}
+
+// pull gets the next batch, starting the enumeration the first time.
+func (e *Enumeration) pull() error {
+	var message *wsman.Message
+	first := !e.started
+	if first {
+		e.started = true
+		message = e.client.wsManClient.NewMessage(wsman.ENUMERATE).ResourceURI(e.resource)
+		message.SetBody(dom.Elem("Enumerate", wsman.NS_WSMEN).AddChildren(
+			dom.Elem("OptimizeEnumeration", wsman.NS_WSMAN),
+			dom.ElemC("MaxElements", wsman.NS_WSMAN, strconv.Itoa(e.batchSize)),
+		))
+	} else {
+		message = e.client.wsManClient.NewMessage(wsman.PULL).ResourceURI(e.resource)
+		message.SetBody(dom.Elem("Pull", wsman.NS_WSMEN).AddChildren(
+			e.context,
+			dom.ElemC("MaxElements", wsman.NS_WSMEN, strconv.Itoa(e.batchSize)),
+		))
+	}
+	response, err := e.client.send(e.ctx, message)
+	if err != nil {
+		// the firmware drops the context of a failed pull.
+		e.context = nil
+		return err
+	}
+
+	body := response.AllBodyElements()
+	if items := search.First(search.Tag("Items", "*"), body); items != nil {
+		e.batch = items.Children()
+	}
+	e.context = search.First(search.Tag("EnumerationContext", wsman.NS_WSMEN), body)
+	end := search.First(search.Tag("EndOfSequence", "*"), body) != nil
+	if first && e.context == nil && !end {
+		return errors.New("enumeration response was missing the EnumerationContext")
+	}
+	if end {
+		e.context = nil
+	}
+	if e.context == nil {
+		e.done = true
+	}
+	return nil
+}
+
+// CertificateIterator lists the certificates installed in the firmware
+// lazily, see Enumeration.
+type CertificateIterator struct {
+	items *Enumeration
+
+	mu          sync.Mutex
+	loaded      bool
+	tls         map[string]bool
+	ieee8021x   map[string]bool
+	certificate *Certificate
+	err         error
+}
+
+// Next advances to the next certificate. It returns false at the end or on
+// error, see Err.
+func (it *CertificateIterator) Next() bool {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.certificate = nil
+	if it.err != nil {
+		return false
+	}
+	if !it.loaded {
+		it.loaded = true
+		client, ctx := it.items.client, it.items.ctx
+		it.tls, it.err = credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMTTLSCredentialContext))
+		if it.err != nil {
+			return false
+		}
+		var err error
+		it.ieee8021x, err = credentialContextCertificates(ctx, client, client.resourceURI(ResourceAMT8021xCredentialContext))
+		if err != nil {
+			// not every firmware has 802.1x, don't fail the listing because of it.
+			client.logger.V(1).Info("could not list the 802.1x certificates", "error", err.Error())
+		}
+	}
+	if !it.items.Next() {
+		it.err = it.items.Err()
+		return false
+	}
+	c, err := parseCertificate(it.items.Item().Children())
+	if err != nil {
+		it.err = err
+		return false
+	}
+	c.UsedForTLS = it.tls[c.InstanceID]
+	c.UsedFor8021x = it.ieee8021x[c.InstanceID]
+	it.certificate = c
+	return true
+}
+
+// Certificate returns the certificate Next advanced to.
+func (it *CertificateIterator) Certificate() *Certificate {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.certificate
+}
+
+// Err returns the error that stopped the listing, if any.
+func (it *CertificateIterator) Err() error {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.err
+}
+
+// Close stops the listing, see Enumeration.Close.
+func (it *CertificateIterator) Close() error {
+	return it.items.Close()
+}
@@ -0,0 +1,102 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEnumerator enumerates count instances, MaxElements of them per
+// response, and records the actions it received.
+type fakeEnumerator struct {
+	count int
+
+	mu      sync.Mutex
+	next    int
+	actions []string
+}
+
+var maxElementsPattern = regexp.MustCompile(`MaxElements>(\d+)<`)
+
+func (f *fakeEnumerator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var action, response string
+	switch {
+	case strings.Contains(string(body), wsman.ENUMERATE), strings.Contains(string(body), wsman.PULL):
+		action = wsman.ENUMERATE
+		if strings.Contains(string(body), wsman.PULL) {
+			action = wsman.PULL
+		}
+		max := 1
+		if m := maxElementsPattern.FindSubmatch(body); m != nil {
+			max, _ = strconv.Atoi(string(m[1]))
+		}
+		var items strings.Builder
+		for i := 0; i < max && f.next < f.count; i++ {
+			fmt.Fprintf(&items, `<Item><InstanceID>%d</InstanceID></Item>`, f.next)
+			f.next++
+		}
+		end := ""
+		if f.next == f.count {
+			end = `<w:EndOfSequence/>`
+		}
+		response = fmt.Sprintf(`<n:Response xmlns:n="%s"><n:EnumerationContext>ctx</n:EnumerationContext><w:Items>%s</w:Items>%s</n:Response>`,
+			wsman.NS_WSMEN, items.String(), end)
+	case strings.Contains(string(body), wsman.RELEASE):
+		action = wsman.RELEASE
+	}
+	f.actions = append(f.actions, action)
+	w.Header().Set("Content-Type", "application/soap+xml")
+	fmt.Fprintf(w, testEnvelope, action+"Response", response)
+}
+
+func newEnumeratorClient(t *testing.T, f *fakeEnumerator) (*Client, func()) {
+	server := httptest.NewServer(f)
+	host, portString, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	port, _ := strconv.Atoi(portString)
+	client, err := NewClient(Connection{Host: host, Port: uint32(port), Path: "/wsman"})
+	assert.NoError(t, err)
+	return client, server.Close
+}
+
+func TestEnumeration_When_Iterated_Expect_AllInstancesPulledInBatches(t *testing.T) {
+	f := &fakeEnumerator{count: 5}
+	client, closeServer := newEnumeratorClient(t, f)
+	defer closeServer()
+
+	items := client.Enumerate(context.Background(), ResourceAMTPublicKeyCertificate, 2)
+	var ids []string
+	for items.Next() {
+		ids = append(ids, propertyContent(items.Item().Children(), "InstanceID"))
+	}
+	assert.NoError(t, items.Err())
+	assert.NoError(t, items.Close())
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	assert.Equal(t, []string{wsman.ENUMERATE, wsman.PULL, wsman.PULL}, f.actions)
+}
+
+func TestEnumeration_When_StoppedEarly_Expect_ContextReleased(t *testing.T) {
+	f := &fakeEnumerator{count: 100}
+	client, closeServer := newEnumeratorClient(t, f)
+	defer closeServer()
+
+	items := client.Enumerate(context.Background(), ResourceAMTPublicKeyCertificate, 10)
+	assert.True(t, items.Next())
+	assert.NoError(t, items.Close())
+	assert.False(t, items.Next())
+	assert.Equal(t, []string{wsman.ENUMERATE, wsman.RELEASE}, f.actions)
+	assert.Equal(t, 10, f.next)
+}
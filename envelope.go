@@ -0,0 +1,130 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+)
+
+// protocolNamespaces are the namespaces of the WS-* protocol elements, always
+// allowed in the body of an Envelope.
+var protocolNamespaces = []string{
+	wsman.NS_WSMAN,
+	wsman.NS_WSA,
+	wsman.NS_WSME,
+	wsman.NS_WSMEN,
+	wsman.NS_WSMT,
+}
+
+// Envelope builds a WSMAN request whose body elements are in the namespaces
+// the firmware expects. The class and properties of the resource are in its
+// resource URI, after Connection.ResourceURIs, and every other namespace of
+// the body must be registered with Register: an element in an unregistered
+// one, e.g. from a misspelled or unmapped resource URI, fails the request
+// before it's sent instead of being silently ignored by the firmware.
+type Envelope struct {
+	client   *Client
+	message  *wsman.Message
+	resource string
+	// namespaces are the registered namespaces of the body.
+	namespaces map[string]bool
+}
+
+// NewEnvelope creates an Envelope with action, e.g. wsman.PUT, on
+// resourceURI, after Connection.ResourceURIs.
+func (c *Client) NewEnvelope(action, resourceURI string) *Envelope {
+	return newEnvelope(c, c.wsManClient.NewMessage(action).ResourceURI(c.resourceURI(resourceURI)))
+}
+
+// newEnvelope wraps message, whose ResourceURI is already mapped.
+func newEnvelope(client *Client, message *wsman.Message) *Envelope {
+	e := &Envelope{
+		client:     client,
+		message:    message,
+		resource:   message.GetResource(),
+		namespaces: map[string]bool{},
+	}
+	e.namespaces[e.resource] = true
+	for _, ns := range protocolNamespaces {
+		e.namespaces[ns] = true
+	}
+	return e
+}
+
+// Resource returns the resource URI of the envelope, the namespace of its
+// class and properties.
+func (e *Envelope) Resource() string {
+	return e.resource
+}
+
+// Register allows the namespace of resourceURI, after
+// Connection.ResourceURIs, in the body and returns it, e.g. for the
+// properties of a referenced class.
+func (e *Envelope) Register(resourceURI string) string {
+	namespace := e.client.resourceURI(resourceURI)
+	e.namespaces[namespace] = true
+	return namespace
+}
+
+// Property creates the property name of the class of the envelope.
+func (e *Envelope) Property(name, value string) *dom.Element {
+	return dom.ElemC(name, e.resource, value)
+}
+
+// Reference creates the property name of the class of the envelope holding
+// the endpoint reference epr, e.g. the ElementInContext of a credential
+// context.
+func (e *Envelope) Reference(name string, epr *dom.Element) *dom.Element {
+	return dom.Elem(name, e.resource).AddChildren(epr.Children()...)
+}
+
+// Instance sets the body to the instance of the class of the envelope, the
+// last element of its resource URI, with properties. The properties are moved
+// to the namespace of the class, so those of a Get response can be sent back
+// whatever namespace the firmware answered in.
+func (e *Envelope) Instance(properties ...*dom.Element) *Envelope {
+	for _, p := range properties {
+		p.Name.Space = e.resource
+	}
+	return e.Body(dom.Elem(path.Base(e.resource), e.resource).AddChildren(properties...))
+}
+
+// Body sets the body of the envelope.
+func (e *Envelope) Body(elements ...*dom.Element) *Envelope {
+	e.message.SetBody(elements...)
+	return e
+}
+
+// Selector targets the envelope at the instance whose selector name is value.
+func (e *Envelope) Selector(name, value string) *Envelope {
+	e.message.Selectors(name, value)
+	return e
+}
+
+// SelectorsFrom targets the envelope at the instance referenced by epr.
+func (e *Envelope) SelectorsFrom(epr *dom.Element) *Envelope {
+	addSelectorsFromReference(e.message, epr)
+	return e
+}
+
+// Message checks the namespaces of the body and returns the request.
+func (e *Envelope) Message() (*wsman.Message, error) {
+	for _, element := range e.message.AllBodyElements() {
+		if !e.namespaces[element.Name.Space] {
+			return nil, fmt.Errorf("element %s is in the unregistered namespace %s", element.Name.Local, element.Name.Space)
+		}
+	}
+	return e.message, nil
+}
+
+// Send sends the envelope, see Message.
+func (e *Envelope) Send(ctx context.Context) (*wsman.Message, error) {
+	message, err := e.Message()
+	if err != nil {
+		return nil, err
+	}
+	return e.client.send(ctx, message)
+}
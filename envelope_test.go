@@ -0,0 +1,48 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope_When_InstanceBuilt_Expect_MappedClassNamespace(t *testing.T) {
+	const oem = "http://oem.example.com/wbem/AMT_BootSettingData"
+	client, err := NewClient(Connection{Host: "192.0.2.1", ResourceURIs: map[string]string{ResourceAMTBootSettingData: oem}})
+	assert.NoError(t, err)
+
+	envelope := client.NewEnvelope(wsman.PUT, ResourceAMTBootSettingData)
+	answered := dom.ElemC("BIOSPause", "http://other.example.com/answer", "false")
+	message, err := envelope.Instance(answered, envelope.Property("BootMediaIndex", "0")).Message()
+	if assert.NoError(t, err) && assert.Len(t, message.Body(), 1) {
+		instance := message.Body()[0]
+		assert.Equal(t, "AMT_BootSettingData", instance.Name.Local)
+		for _, e := range append([]*dom.Element{instance}, instance.Children()...) {
+			assert.Equal(t, oem, e.Name.Space, e.Name.Local)
+		}
+	}
+}
+
+func TestEnvelope_When_NamespaceUnregistered_Expect_NotSent(t *testing.T) {
+	sent := false
+	client, err := NewClient(Connection{
+		Host:  "192.0.2.1",
+		Hooks: Hooks{OnRequest: func(ctx context.Context, request *Request) error { sent = true; return nil }},
+	})
+	assert.NoError(t, err)
+
+	envelope := client.NewEnvelope(wsman.CREATE, ResourceAMTTLSCredentialContext)
+	envelope.Body(dom.Elem("AMT_TLSCredentialContext", envelope.Resource()).AddChild(
+		dom.ElemC("InstanceID", ResourceAMTPublicKeyCertificate, "cert"),
+	))
+	_, err = envelope.Send(context.Background())
+	assert.EqualError(t, err, "element InstanceID is in the unregistered namespace "+ResourceAMTPublicKeyCertificate)
+	assert.False(t, sent)
+
+	assert.Equal(t, ResourceAMTPublicKeyCertificate, envelope.Register(ResourceAMTPublicKeyCertificate))
+	_, err = envelope.Message()
+	assert.NoError(t, err)
+}
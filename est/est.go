@@ -0,0 +1,129 @@
+// Package est is a minimal Enrollment over Secure Transport (RFC 7030) client,
+// used to get certificate requests generated by the firmware signed by an
+// enterprise CA.
+package est
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxResponseSize bounds the responses read from the server.
+const maxResponseSize = 1 << 20
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// Client talks to an EST server.
+type Client struct {
+	// URL of the EST server up to and including the optional CA label,
+	// e.g. https://ca.example.com/.well-known/est or https://ca.example.com/.well-known/est/amt.
+	URL string
+	// HTTPClient is used for the requests. http.DefaultClient is used when nil.
+	HTTPClient *http.Client
+	// Username and Password authenticate with HTTP basic authentication when set.
+	Username string
+	Password string
+}
+
+// Enroll sends the DER encoded certificate request to simpleenroll and
+// returns the DER encoded certificate issued for it.
+func (c *Client) Enroll(ctx context.Context, csr []byte) ([]byte, error) {
+	certificates, err := c.do(ctx, http.MethodPost, "simpleenroll", csr)
+	if err != nil {
+		return nil, err
+	}
+	return certificates[0].Raw, nil
+}
+
+// CACerts returns the current CA certificates of the server.
+func (c *Client) CACerts(ctx context.Context) ([]*x509.Certificate, error) {
+	return c.do(ctx, http.MethodGet, "cacerts", nil)
+}
+
+func (c *Client) do(ctx context.Context, method, operation string, body []byte) ([]*x509.Certificate, error) {
+	var payload []byte
+	if body != nil {
+		payload = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+"/"+operation, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/pkcs10")
+		req.Header.Set("Content-Transfer-Encoding", "base64")
+	}
+	if c.Username != "" || c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("est %s: %s: %s", operation, resp.Status, strings.TrimSpace(string(data)))
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("est %s: %v", operation, err)
+	}
+	certificates, err := ParseCertsOnly(der)
+	if err != nil {
+		return nil, fmt.Errorf("est %s: %v", operation, err)
+	}
+	return certificates, nil
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// ParseCertsOnly returns the certificates of a DER encoded certs-only PKCS#7
+// message, the format EST servers answer with.
+func ParseCertsOnly(der []byte) ([]*x509.Certificate, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 content info: %v", err)
+	}
+	if !info.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("PKCS#7 content type is %v, expected signed data", info.ContentType)
+	}
+	var data signedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &data); err != nil {
+		return nil, fmt.Errorf("invalid PKCS#7 signed data: %v", err)
+	}
+	certificates, err := x509.ParseCertificates(data.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("PKCS#7 message has no certificates")
+	}
+	return certificates, nil
+}
@@ -0,0 +1,75 @@
+package est
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// certsOnly encodes a degenerate signed data message carrying der.
+func certsOnly(t *testing.T, der []byte) []byte {
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		ContentInfo:      asn1.RawValue{FullBytes: []byte{0x30, 0x0b, 0x06, 0x09, 0x2a, 0x86, 0x48, 0x86, 0xf7, 0x0d, 0x01, 0x07, 0x01}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+	})
+	assert.NoError(t, err)
+	info, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	})
+	assert.NoError(t, err)
+	return info
+}
+
+func TestEnroll_When_ServerIssuesCertificate_Expect_Certificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "amt"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/.well-known/est/simpleenroll", r.URL.Path)
+		assert.Equal(t, "application/pkcs10", r.Header.Get("Content-Type"))
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "user:pass", user+":"+pass)
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("csr")), string(body))
+
+		w.Header().Set("Content-Type", "application/pkcs7-mime; smime-type=certs-only")
+		encoded := base64.StdEncoding.EncodeToString(certsOnly(t, certificate))
+		// servers wrap the base64 at 64 columns.
+		for len(encoded) > 64 {
+			w.Write([]byte(encoded[:64] + "\r\n"))
+			encoded = encoded[64:]
+		}
+		w.Write([]byte(encoded))
+	}))
+	defer server.Close()
+
+	client := &Client{URL: server.URL + "/.well-known/est", Username: "user", Password: "pass"}
+	issued, err := client.Enroll(context.Background(), []byte("csr"))
+	assert.NoError(t, err)
+	assert.Equal(t, certificate, issued)
+}
@@ -0,0 +1,208 @@
+package amt
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// EthernetPort identifies a network interface of the firmware.
+type EthernetPort string
+
+// Ethernet ports, the InstanceIDs of AMT_EthernetPortSettings.
+const (
+	WiredPort    EthernetPort = "Intel(r) AMT Ethernet Port Settings 0"
+	WirelessPort EthernetPort = "Intel(r) AMT Ethernet Port Settings 1"
+)
+
+// LinkOwner is which of the firmware and the host operating system owns a shared link.
+type LinkOwner int
+
+// Link owners.
+const (
+	LinkOwnerME   LinkOwner = 1
+	LinkOwnerHost LinkOwner = 2
+)
+
+// LinkProtection controls how the firmware protects its link from being taken by the host.
+type LinkProtection int
+
+// Link protection levels.
+const (
+	LinkProtectionOverride LinkProtection = 0
+	LinkProtectionNone     LinkProtection = 1
+	LinkProtectionPassive  LinkProtection = 2
+	LinkProtectionHigh     LinkProtection = 3
+)
+
+// LinkPolicy is the ownership policy of a shared link.
+type LinkPolicy struct {
+	// Preference is the preferred owner.
+	Preference LinkOwner
+	// Control is the current owner.
+	Control    LinkOwner
+	Protection LinkProtection
+}
+
+func getLinkPolicy(ctx context.Context, client *Client, port EthernetPort) (*LinkPolicy, error) {
+	properties, err := getInstanceByID(ctx, client, client.resourceURI(ResourceAMTEthernetPortSettings), string(port), "LinkPreference", "LinkControl")
+	if err != nil {
+		return nil, err
+	}
+	policy := &LinkPolicy{}
+	preference, _ := strconv.Atoi(propertyContent(properties, "LinkPreference"))
+	control, _ := strconv.Atoi(propertyContent(properties, "LinkControl"))
+	protection, _ := strconv.Atoi(propertyContent(properties, "LinkProtection"))
+	policy.Preference = LinkOwner(preference)
+	policy.Control = LinkOwner(control)
+	policy.Protection = LinkProtection(protection)
+	return policy, nil
+}
+
+func setLinkPreference(ctx context.Context, client *Client, port EthernetPort, owner LinkOwner, timeout time.Duration) error {
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceAMTEthernetPortSettings), "SetLinkPreference")
+	message.Selectors("InstanceID", string(port))
+	message.Parameters(
+		"LinkPreference", strconv.Itoa(int(owner)),
+		"Timeout", strconv.Itoa(int(timeout/time.Second)),
+	)
+	_, err := sendMessageForReturnValueInt(ctx, client, message)
+	return err
+}
+
+func setLinkProtection(ctx context.Context, client *Client, port EthernetPort, protection LinkProtection) error {
+	_, err := updateInstanceByID(ctx, client, client.resourceURI(ResourceAMTEthernetPortSettings), string(port), "LinkProtection", strconv.Itoa(int(protection)))
+	return err
+}
+
+// NetworkSettings are the network settings of an ethernet port of the firmware.
+type NetworkSettings struct {
+	Port EthernetPort
+	// MACAddress of the firmware. With SharedMAC it's the MAC address of the host.
+	MACAddress string
+	SharedMAC  bool
+	// IPAddress of the firmware. With DHCPEnabled the firmware shares the IP
+	// address of the host, with SharedStaticIP it shares a static one.
+	IPAddress      string
+	DHCPEnabled    bool
+	SharedStaticIP bool
+	// LinkUp is true when the port has a network link.
+	LinkUp bool
+}
+
+// Dedicated reports whether the firmware has its own MAC address.
+func (s *NetworkSettings) Dedicated() bool {
+	return !s.SharedMAC
+}
+
+// SharesAddressWith reports whether the firmware uses the IP address hostIP of
+// the host. Redirection from that host to its own firmware doesn't work then.
+func (s *NetworkSettings) SharesAddressWith(hostIP net.IP) bool {
+	ip := net.ParseIP(s.IPAddress)
+	return ip != nil && ip.Equal(hostIP)
+}
+
+func getNetworkSettings(ctx context.Context, client *Client, port EthernetPort) (*NetworkSettings, error) {
+	properties, err := getInstanceByID(ctx, client, client.resourceURI(ResourceAMTEthernetPortSettings), string(port), "MACAddress", "SharedMAC")
+	if err != nil {
+		return nil, err
+	}
+	return parseNetworkSettings(port, properties), nil
+}
+
+func parseNetworkSettings(port EthernetPort, properties []*dom.Element) *NetworkSettings {
+	return &NetworkSettings{
+		Port:           port,
+		MACAddress:     propertyContent(properties, "MACAddress"),
+		SharedMAC:      propertyContent(properties, "SharedMAC") == "true",
+		IPAddress:      propertyContent(properties, "IPAddress"),
+		DHCPEnabled:    propertyContent(properties, "DHCPEnabled") == "true",
+		SharedStaticIP: propertyContent(properties, "SharedStaticIp") == "true",
+		LinkUp:         propertyContent(properties, "LinkIsUp") == "true",
+	}
+}
+
+// Duplex is the duplex mode of a link.
+type Duplex string
+
+// Duplex modes. DuplexUnknown is returned when the firmware doesn't report it.
+const (
+	DuplexUnknown Duplex = ""
+	DuplexFull    Duplex = "full"
+	DuplexHalf    Duplex = "half"
+)
+
+// AMT_EthernetPortSettings PhysicalConnectionType values.
+var physicalConnectionTypes = map[string]string{
+	"0": "integrated LAN NIC",
+	"1": "discrete LAN NIC",
+	"2": "LAN via a Thunderbolt dock",
+	"3": "wireless LAN",
+}
+
+// LinkStatus is the state of the link of a port as the firmware sees it, out
+// of band: a port down points at the cable or the switch rather than at the
+// firmware.
+type LinkStatus struct {
+	Port EthernetPort
+	Up   bool
+	// Speed is the bandwidth of the link in bits per second, 0 when the
+	// firmware doesn't report it.
+	Speed  uint64
+	Duplex Duplex
+	// Connection is the kind of NIC, e.g. "integrated LAN NIC", when the
+	// firmware reports it.
+	Connection string
+}
+
+func getLinkStatus(ctx context.Context, client *Client, port EthernetPort) (*LinkStatus, error) {
+	settings, err := getInstanceByID(ctx, client, client.resourceURI(ResourceAMTEthernetPortSettings), string(port), "LinkIsUp")
+	if err != nil {
+		return nil, err
+	}
+	// the speed and the duplex are optional, not every firmware has CIM_EthernetPort.
+	var ethernetPort []*dom.Element
+	if items, err := enumerate(ctx, client, client.resourceURI(ResourceCIMEthernetPort)); err == nil {
+		mac := normalizeMAC(propertyContent(settings, "MACAddress"))
+		for _, item := range items {
+			if mac != "" && normalizeMAC(propertyContent(item.Children(), "PermanentAddress")) == mac {
+				ethernetPort = item.Children()
+				break
+			}
+		}
+	} else {
+		client.logger.V(1).Info("could not list the ethernet ports", "error", err.Error())
+	}
+	return parseLinkStatus(port, settings, ethernetPort), nil
+}
+
+// parseLinkStatus reads the speed and the duplex from the CIM_EthernetPort
+// of the port, when there is one.
+func parseLinkStatus(port EthernetPort, settings, ethernetPort []*dom.Element) *LinkStatus {
+	status := &LinkStatus{
+		Port:       port,
+		Up:         propertyContent(settings, "LinkIsUp") == "true",
+		Connection: physicalConnectionTypes[propertyContent(settings, "PhysicalConnectionType")],
+	}
+	if ethernetPort == nil {
+		return status
+	}
+	status.Speed, _ = strconv.ParseUint(propertyContent(ethernetPort, "Speed"), 10, 64)
+	switch propertyContent(ethernetPort, "FullDuplex") {
+	case "true":
+		status.Duplex = DuplexFull
+	case "false":
+		status.Duplex = DuplexHalf
+	}
+	return status
+}
+
+// normalizeMAC returns the hex digits of mac in lower case, so
+// "00-1A-2B-3C-4D-5E" and "001a2b3c4d5e" compare equal.
+func normalizeMAC(mac string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", ":", "", ".", "").Replace(mac))
+}
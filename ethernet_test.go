@@ -0,0 +1,93 @@
+package amt
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNetworkSettings_When_SharedDHCP_Expect_SharedAddress(t *testing.T) {
+	settings := parseNetworkSettings(WiredPort, []*dom.Element{
+		dom.ElemC("MACAddress", ResourceAMTEthernetPortSettings, "00-11-22-33-44-55"),
+		dom.ElemC("SharedMAC", ResourceAMTEthernetPortSettings, "true"),
+		dom.ElemC("IPAddress", ResourceAMTEthernetPortSettings, "192.168.1.10"),
+		dom.ElemC("DHCPEnabled", ResourceAMTEthernetPortSettings, "true"),
+	})
+	assert.False(t, settings.Dedicated())
+	assert.True(t, settings.SharesAddressWith(net.ParseIP("192.168.1.10")))
+	assert.False(t, settings.SharesAddressWith(net.ParseIP("192.168.1.11")))
+}
+
+func TestParseLinkStatus_When_EthernetPortMissing_Expect_UnknownSpeed(t *testing.T) {
+	settings := []*dom.Element{
+		dom.ElemC("LinkIsUp", ResourceAMTEthernetPortSettings, "true"),
+		dom.ElemC("PhysicalConnectionType", ResourceAMTEthernetPortSettings, "0"),
+	}
+	assert.Equal(t, &LinkStatus{Port: WiredPort, Up: true, Connection: "integrated LAN NIC"}, parseLinkStatus(WiredPort, settings, nil))
+
+	ethernetPort := []*dom.Element{
+		dom.ElemC("Speed", ResourceCIMEthernetPort, "1000000000"),
+		dom.ElemC("FullDuplex", ResourceCIMEthernetPort, "true"),
+	}
+	status := parseLinkStatus(WiredPort, settings, ethernetPort)
+	assert.Equal(t, uint64(1000000000), status.Speed)
+	assert.Equal(t, DuplexFull, status.Duplex)
+	assert.Equal(t, normalizeMAC("00-1A-2B-3C-4D-5E"), normalizeMAC("001a2b3c4d5e"))
+}
+
+func TestLinkPolicy_When_Read_Expect_PreferenceControlAndProtection(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_EthernetPortSettings Get", instanceBody(ResourceAMTEthernetPortSettings,
+		`<h:InstanceID>Intel(r) AMT Ethernet Port Settings 1</h:InstanceID><h:LinkPreference>1</h:LinkPreference><h:LinkControl>2</h:LinkControl><h:LinkProtection>3</h:LinkProtection>`))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	policy, err := client.LinkPolicy(context.Background(), WirelessPort)
+	assert.NoError(t, err)
+	assert.Equal(t, &LinkPolicy{Preference: LinkOwnerME, Control: LinkOwnerHost, Protection: LinkProtectionHigh}, policy)
+	assert.Contains(t, f.body("AMT_EthernetPortSettings Get"), `Name="InstanceID">Intel(r) AMT Ethernet Port Settings 1<`)
+}
+
+func TestSetLinkPreference_When_Called_Expect_PreferenceAndTimeoutInSeconds(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_EthernetPortSettings SetLinkPreference", outputBody(ResourceAMTEthernetPortSettings, "SetLinkPreference", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.NoError(t, client.SetLinkPreference(context.Background(), WirelessPort, LinkOwnerME, 5*time.Minute))
+	body := f.body("AMT_EthernetPortSettings SetLinkPreference")
+	assert.Contains(t, body, `Name="InstanceID">Intel(r) AMT Ethernet Port Settings 1<`)
+	assert.Contains(t, body, "LinkPreference>1<")
+	assert.Contains(t, body, "Timeout>300<")
+}
+
+func TestSetLinkPreference_When_ReturnValueIsNonZero_Expect_Error(t *testing.T) {
+	f := &fakeFirmware{}
+	// the host isn't the preferred owner yet.
+	f.set("AMT_EthernetPortSettings Get", instanceBody(ResourceAMTEthernetPortSettings, `<h:LinkPreference>1</h:LinkPreference>`))
+	f.set("AMT_EthernetPortSettings SetLinkPreference", outputBody(ResourceAMTEthernetPortSettings, "SetLinkPreference", 2))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	err := client.SetLinkPreference(context.Background(), WirelessPort, LinkOwnerHost, 0)
+	assert.EqualError(t, err, "received invalid return value 2")
+}
+
+func TestSetLinkProtection_When_ProtectionChanges_Expect_OnlyProtectionPut(t *testing.T) {
+	f := &fakeFirmware{}
+	settings := `<h:InstanceID>Intel(r) AMT Ethernet Port Settings 0</h:InstanceID><h:LinkPreference>2</h:LinkPreference><h:LinkProtection>1</h:LinkProtection>`
+	f.set("AMT_EthernetPortSettings Get", instanceBody(ResourceAMTEthernetPortSettings, settings))
+	f.set("AMT_EthernetPortSettings Put", instanceBody(ResourceAMTEthernetPortSettings, settings))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.NoError(t, client.SetLinkProtection(context.Background(), WiredPort, LinkProtectionPassive))
+	body := f.body("AMT_EthernetPortSettings Put")
+	assert.Contains(t, body, `Name="InstanceID">Intel(r) AMT Ethernet Port Settings 0<`)
+	assert.Contains(t, body, "LinkProtection>2<")
+	assert.Contains(t, body, "LinkPreference>2<")
+}
@@ -0,0 +1,327 @@
+package amt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
+)
+
+// Defaults of SubscriptionOptions.
+const (
+	defaultSubscriptionFilter    = "Intel(r) AMT:All"
+	defaultSubscriptionExpires   = 10 * time.Minute
+	defaultSubscriptionHeartbeat = time.Minute
+)
+
+// deliveryModePush delivers every event in its own request to NotifyTo.
+const deliveryModePush = "http://schemas.dmtf.org/wbem/wsman/1/wsman/Push"
+
+// subscriptionTokenNamespace is the namespace of the SubscriptionToken
+// reference parameter of NotifyTo, which the firmware echoes as a header of
+// every event, heartbeat and end of the subscription.
+const subscriptionTokenNamespace = "http://github.com/jacobweinstock/go-amt/eventing"
+
+var (
+	// ErrHeartbeatMissed is passed to OnLapse when neither an event nor a
+	// heartbeat arrived for two heartbeat intervals.
+	ErrHeartbeatMissed = errors.New("no event or heartbeat received from the firmware")
+	// ErrSubscriptionEnded is passed to OnLapse when the firmware ended the subscription.
+	ErrSubscriptionEnded = errors.New("the firmware ended the subscription")
+)
+
+// SubscriptionOptions configure SubscribeWithHeartbeat. Zero values use the defaults.
+type SubscriptionOptions struct {
+	// NotifyTo is the URL the firmware posts the events to. The Subscription
+	// must be served there.
+	NotifyTo string
+	// Filter is the InstanceID of the CIM_FilterCollection subscribed to,
+	// "Intel(r) AMT:All" by default.
+	Filter string
+	// Expires is the lifetime requested for the subscription, 10m by default.
+	// The subscription is renewed when half of it has elapsed.
+	Expires time.Duration
+	// Heartbeat is the interval the firmware sends heartbeats at when there
+	// are no events, 1m by default.
+	Heartbeat time.Duration
+	// OnEvent is called with every event received.
+	OnEvent func(Event)
+	// OnLapse is called when events may have been missed: a renewal failed,
+	// heartbeats stopped or the firmware ended the subscription. The
+	// subscription keeps being renewed until Close.
+	OnLapse func(error)
+}
+
+// Event is an event pushed by the firmware.
+type Event struct {
+	// Action is the WS-Addressing action of the event, wsman.EVENT for
+	// most AMT events.
+	Action string
+	// Body is the content of the SOAP body, e.g. a CIM_AlertIndication.
+	Body []*dom.Element
+}
+
+// Subscription is a WS-Eventing subscription renewed in the background. It
+// is an http.Handler receiving the events at SubscriptionOptions.NotifyTo.
+type Subscription struct {
+	client  *Client
+	options SubscriptionOptions
+	// reference holds the reference parameters of the subscription manager,
+	// sent as headers of the renewals and the unsubscribe.
+	reference string
+	// token tells the requests of the firmware from the others posted to NotifyTo.
+	token string
+
+	alive  chan struct{}
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func subscribeWithHeartbeat(ctx context.Context, client *Client, options SubscriptionOptions) (*Subscription, error) {
+	if options.NotifyTo == "" {
+		return nil, errors.New("a NotifyTo URL is required")
+	}
+	if options.Filter == "" {
+		options.Filter = defaultSubscriptionFilter
+	}
+	if options.Expires <= 0 {
+		options.Expires = defaultSubscriptionExpires
+	}
+	if options.Heartbeat <= 0 {
+		options.Heartbeat = defaultSubscriptionHeartbeat
+	}
+
+	token, err := newSubscriptionToken()
+	if err != nil {
+		return nil, err
+	}
+	message := client.wsManClient.NewMessage(wsman.SUBSCRIBE).ResourceURI(client.resourceURI(ResourceCIMFilterCollection))
+	message.Selectors("InstanceID", options.Filter)
+	delivery := dom.Elem("Delivery", wsman.NS_WSME).Attr("Mode", "", deliveryModePush)
+	delivery.AddChildren(
+		dom.Elem("NotifyTo", wsman.NS_WSME).AddChildren(
+			dom.ElemC("Address", wsman.NS_WSA, options.NotifyTo),
+			dom.Elem("ReferenceParameters", wsman.NS_WSA).AddChild(dom.ElemC("SubscriptionToken", subscriptionTokenNamespace, token)),
+		),
+		dom.ElemC("Heartbeats", wsman.NS_WSMAN, formatXSDuration(options.Heartbeat)),
+	)
+	message.SetBody(dom.Elem("Subscribe", wsman.NS_WSME).AddChildren(
+		delivery,
+		dom.ElemC("Expires", wsman.NS_WSME, formatXSDuration(options.Expires)),
+	))
+	response, err := client.send(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := search.FirstTag("SubscribeResponse", wsman.NS_WSME, response.Body())
+	if subscribed == nil {
+		return nil, errors.New("response was missing the SubscribeResponse")
+	}
+	manager := search.FirstTag("SubscriptionManager", wsman.NS_WSME, subscribed.Children())
+	if manager == nil {
+		return nil, errors.New("response was missing the SubscriptionManager")
+	}
+	var reference strings.Builder
+	if parameters := search.FirstTag("ReferenceParameters", wsman.NS_WSA, manager.Children()); parameters != nil {
+		for _, p := range parameters.Children() {
+			reference.WriteString(p.String())
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	s := &Subscription{
+		client:    client,
+		options:   options,
+		reference: reference.String(),
+		token:     token,
+		alive:     make(chan struct{}, 1),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go s.run(runCtx, grantedExpires(subscribed.Children(), options.Expires))
+	return s, nil
+}
+
+// newSubscriptionToken returns a random SubscriptionToken.
+func newSubscriptionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+// grantedExpires returns the lifetime granted by the firmware, or requested
+// when the response has none.
+func grantedExpires(elements []*dom.Element, requested time.Duration) time.Duration {
+	if expires := search.FirstTag("Expires", wsman.NS_WSME, elements); expires != nil {
+		if d, err := parseXSDuration(strings.TrimSpace(string(expires.Content))); err == nil && d > 0 {
+			return d
+		}
+	}
+	return requested
+}
+
+// formatXSDuration formats d as an xs:duration in seconds, e.g. "PT60S".
+func formatXSDuration(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("PT%dS", seconds)
+}
+
+// run renews the subscription and watches the heartbeats until ctx is done.
+func (s *Subscription) run(ctx context.Context, expires time.Duration) {
+	defer close(s.done)
+	renew := s.client.clock.NewTimer(expires / 2)
+	defer renew.Stop()
+	lapse := s.client.clock.NewTimer(2 * s.options.Heartbeat)
+	defer lapse.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.alive:
+			if !lapse.Stop() {
+				<-lapse.C()
+			}
+			lapse.Reset(2 * s.options.Heartbeat)
+		case <-lapse.C():
+			s.lapse(ErrHeartbeatMissed)
+			lapse.Reset(2 * s.options.Heartbeat)
+		case <-renew.C():
+			granted, err := s.renew(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				s.lapse(fmt.Errorf("renewing the subscription: %w", err))
+				// retry before the subscription expires.
+				renew.Reset(expires / 4)
+				continue
+			}
+			expires = granted
+			renew.Reset(expires / 2)
+		}
+	}
+}
+
+func (s *Subscription) renew(ctx context.Context) (time.Duration, error) {
+	message, err := s.managerMessage(wsman.RENEW)
+	if err != nil {
+		return 0, err
+	}
+	message.SetBody(dom.Elem("Renew", wsman.NS_WSME).AddChild(
+		dom.ElemC("Expires", wsman.NS_WSME, formatXSDuration(s.options.Expires)),
+	))
+	response, err := s.client.send(ctx, message)
+	if err != nil {
+		return 0, err
+	}
+	renewed := search.FirstTag("RenewResponse", wsman.NS_WSME, response.Body())
+	if renewed == nil {
+		return s.options.Expires, nil
+	}
+	return grantedExpires(renewed.Children(), s.options.Expires), nil
+}
+
+// managerMessage creates a message with action to the subscription manager.
+// The reference parameters replace the ResourceURI when they have one.
+func (s *Subscription) managerMessage(action string) (*wsman.Message, error) {
+	message := s.client.wsManClient.NewMessage(action).ResourceURI(s.client.resourceURI(ResourceCIMFilterCollection))
+	if s.reference == "" {
+		return message, nil
+	}
+	parameters, err := dom.ParseElements(strings.NewReader(s.reference))
+	if err != nil {
+		return nil, fmt.Errorf("parsing the subscription reference: %w", err)
+	}
+	message.SetHeader(parameters...)
+	return message, nil
+}
+
+func (s *Subscription) lapse(err error) {
+	if s.options.OnLapse != nil {
+		s.options.OnLapse(err)
+	}
+}
+
+// ServeHTTP receives the events pushed by the firmware. Requests without the
+// SubscriptionToken the firmware was given in NotifyTo are refused with 403.
+func (s *Subscription) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	doc, err := dom.Parse(io.LimitReader(r.Body, DefaultMaxResponseSize))
+	if err != nil || doc.Root() == nil {
+		http.Error(w, "malformed event", http.StatusBadRequest)
+		return
+	}
+	var action, token string
+	var body []*dom.Element
+	for _, part := range doc.Root().Children() {
+		switch part.Name.Local {
+		case "Header":
+			if a := search.FirstTag("Action", wsman.NS_WSA, part.Children()); a != nil {
+				action = strings.TrimSpace(string(a.Content))
+			}
+			if t := search.FirstTag("SubscriptionToken", subscriptionTokenNamespace, part.Children()); t != nil {
+				token = strings.TrimSpace(string(t.Content))
+			}
+		case "Body":
+			body = part.Children()
+		}
+	}
+	// anything reaching NotifyTo could otherwise keep a dead subscription
+	// looking alive or inject events.
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		http.Error(w, "unknown subscription", http.StatusForbidden)
+		return
+	}
+
+	select {
+	case s.alive <- struct{}{}:
+	default:
+	}
+	switch action {
+	case wsman.HEARTBEAT:
+	case wsman.SUBSCRIBE_END:
+		s.lapse(ErrSubscriptionEnded)
+	default:
+		if s.options.OnEvent != nil {
+			s.options.OnEvent(Event{Action: action, Body: body})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Close stops the renewals and unsubscribes.
+func (s *Subscription) Close(ctx context.Context) error {
+	err := errors.New("the subscription is already closed")
+	s.once.Do(func() {
+		s.cancel()
+		<-s.done
+		var message *wsman.Message
+		message, err = s.managerMessage(wsman.UNSUBSCRIBE)
+		if err != nil {
+			return
+		}
+		message.SetBody(dom.Elem("Unsubscribe", wsman.NS_WSME))
+		_, err = s.client.send(ctx, message)
+	})
+	return err
+}
@@ -0,0 +1,156 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:e="http://schemas.xmlsoap.org/ws/2004/08/eventing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd">
+<s:Header><a:Action>%s</a:Action></s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+var subscriptionToken = regexp.MustCompile(`SubscriptionToken[^>]*>([^<]+)<`)
+
+// testEventEnvelope is an event echoing the SubscriptionToken of NotifyTo.
+const testEventEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" xmlns:t="` + subscriptionTokenNamespace + `">
+<s:Header><a:Action>%s</a:Action><t:SubscriptionToken>%s</t:SubscriptionToken></s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+// fakeEventSource answers the subscription requests and records their
+// actions. Renewals and unsubscribes must carry the subscription Identifier.
+type fakeEventSource struct {
+	mu      sync.Mutex
+	actions []string
+	// token is the SubscriptionToken of NotifyTo.
+	token string
+}
+
+func (f *fakeEventSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var action, response string
+	switch {
+	case strings.Contains(string(body), wsman.SUBSCRIBE):
+		action = wsman.SUBSCRIBE
+		if m := subscriptionToken.FindSubmatch(body); m != nil {
+			f.mu.Lock()
+			f.token = string(m[1])
+			f.mu.Unlock()
+		}
+		response = `<e:SubscribeResponse><e:SubscriptionManager><a:Address>http://device/wsman</a:Address>` +
+			`<a:ReferenceParameters><e:Identifier>uuid:1</e:Identifier></a:ReferenceParameters></e:SubscriptionManager>` +
+			`<e:Expires>PT0S</e:Expires></e:SubscribeResponse>`
+	case strings.Contains(string(body), wsman.RENEW) && strings.Contains(string(body), "uuid:1"):
+		action = wsman.RENEW
+		response = `<e:RenewResponse/>`
+	case strings.Contains(string(body), wsman.UNSUBSCRIBE) && strings.Contains(string(body), "uuid:1"):
+		action = wsman.UNSUBSCRIBE
+	}
+	f.mu.Lock()
+	f.actions = append(f.actions, action)
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/soap+xml")
+	fmt.Fprintf(w, testEnvelope, action+"Response", response)
+}
+
+func (f *fakeEventSource) seen(action string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, a := range f.actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSubscription_When_EventsAndHeartbeatsStop_Expect_EventsLapseAndRenewals(t *testing.T) {
+	source := &fakeEventSource{}
+	server := httptest.NewServer(source)
+	defer server.Close()
+	host, portString, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	port, _ := strconv.Atoi(portString)
+	client, err := NewClient(Connection{Host: host, Port: uint32(port), Path: "/wsman"})
+	assert.NoError(t, err)
+
+	events := make(chan Event, 1)
+	lapses := make(chan error, 10)
+	subscription, err := client.SubscribeWithHeartbeat(context.Background(), SubscriptionOptions{
+		NotifyTo:  "http://listener/events",
+		Expires:   40 * time.Millisecond,
+		Heartbeat: 20 * time.Millisecond,
+		OnEvent:   func(e Event) { events <- e },
+		OnLapse:   func(err error) { lapses <- err },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	push := func(token, action, body string) int {
+		w := httptest.NewRecorder()
+		subscription.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(fmt.Sprintf(testEventEnvelope, action, token, body))))
+		return w.Code
+	}
+	source.mu.Lock()
+	token := source.token
+	source.mu.Unlock()
+	assert.NotEmpty(t, token)
+	assert.Equal(t, http.StatusOK, push(token, wsman.HEARTBEAT, ""))
+	assert.Equal(t, http.StatusOK, push(token, wsman.EVENT, `<w:Alert>fan failure</w:Alert>`))
+	event := <-events
+	assert.Equal(t, wsman.EVENT, event.Action)
+	if assert.Len(t, event.Body, 1) {
+		assert.Equal(t, "Alert", event.Body[0].Name.Local)
+	}
+
+	select {
+	case err := <-lapses:
+		assert.Equal(t, ErrHeartbeatMissed, err)
+	case <-time.After(time.Second):
+		t.Fatal("no lapse reported")
+	}
+	assert.Eventually(t, func() bool { return source.seen(wsman.RENEW) }, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, subscription.Close(context.Background()))
+	assert.True(t, source.seen(wsman.UNSUBSCRIBE))
+	assert.Error(t, subscription.Close(context.Background()))
+}
+
+func TestSubscription_When_PostWithoutToken_Expect_Forbidden(t *testing.T) {
+	events := 0
+	subscription := &Subscription{
+		token:   "token",
+		alive:   make(chan struct{}, 1),
+		options: SubscriptionOptions{OnEvent: func(Event) { events++ }},
+	}
+	tests := map[string]string{
+		"no token":    fmt.Sprintf(testEnvelope, wsman.EVENT, `<w:Alert>spoofed</w:Alert>`),
+		"wrong token": fmt.Sprintf(testEventEnvelope, wsman.HEARTBEAT, "guess", ""),
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			subscription.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body)))
+			assert.Equal(t, http.StatusForbidden, w.Code)
+		})
+	}
+	assert.Zero(t, events)
+	// the heartbeat timer wasn't reset.
+	assert.Len(t, subscription.alive, 0)
+}
@@ -0,0 +1,284 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// AMT_RedirectionService EnabledState values.
+const (
+	redirectionEnabledNone    = 32768
+	redirectionEnabledIDER    = 32769
+	redirectionEnabledSOL     = 32770
+	redirectionEnabledIDERSOL = 32771
+)
+
+// CIM_KVMRedirectionSAP EnabledState values.
+const (
+	kvmEnabled        = 2
+	kvmDisabled       = 3
+	kvmEnabledOffline = 6
+)
+
+// UserConsent is the set of redirection operations that need the consent of
+// the user in front of the machine.
+type UserConsent string
+
+// IPS_OptInService OptInRequired values.
+const (
+	UserConsentNone UserConsent = "none"
+	UserConsentKVM  UserConsent = "kvm"
+	UserConsentAll  UserConsent = "all"
+)
+
+var optInRequired = map[string]UserConsent{
+	"0":          UserConsentNone,
+	"1":          UserConsentKVM,
+	"4294967295": UserConsentAll,
+}
+
+// FeatureStates reports which redirection features are enabled.
+type FeatureStates struct {
+	// Redirection is true when the redirection listener (port 16994/16995) is enabled.
+	Redirection bool
+	KVM         bool
+	SOL         bool
+	IDER        bool
+	UserConsent UserConsent
+	// OptInState is the raw IPS_OptInService OptInState, the progress of a consent request.
+	OptInState int
+}
+
+func getFeatureStates(ctx context.Context, client *Client) (*FeatureStates, error) {
+	redirection, err := getInstance(ctx, client, client.resourceURI(ResourceAMTRedirectionService), "EnabledState", "ListenerEnabled")
+	if err != nil {
+		return nil, err
+	}
+	kvm, err := getInstance(ctx, client, client.resourceURI(ResourceCIMKVMRedirectionSAP), "EnabledState")
+	if err != nil {
+		return nil, err
+	}
+	optIn, err := getInstance(ctx, client, client.resourceURI(ResourceIPSOptInService), "OptInRequired", "OptInState")
+	if err != nil {
+		return nil, err
+	}
+	return parseFeatureStates(redirection, kvm, optIn), nil
+}
+
+func parseFeatureStates(redirection, kvm, optIn []*dom.Element) *FeatureStates {
+	states := &FeatureStates{
+		Redirection: propertyContent(redirection, "ListenerEnabled") == "true",
+		UserConsent: optInRequired[propertyContent(optIn, "OptInRequired")],
+	}
+	switch enabled, _ := strconv.Atoi(propertyContent(redirection, "EnabledState")); enabled {
+	case redirectionEnabledIDER:
+		states.IDER = true
+	case redirectionEnabledSOL:
+		states.SOL = true
+	case redirectionEnabledIDERSOL:
+		states.IDER = true
+		states.SOL = true
+	}
+	switch enabled, _ := strconv.Atoi(propertyContent(kvm, "EnabledState")); enabled {
+	case kvmEnabled, kvmEnabledOffline:
+		states.KVM = true
+	}
+	states.OptInState, _ = strconv.Atoi(propertyContent(optIn, "OptInState"))
+	return states
+}
+
+// FeaturesConfig is the desired state of the redirection features. The
+// redirection listener is enabled when any of them is.
+type FeaturesConfig struct {
+	KVM  bool
+	SOL  bool
+	IDER bool
+	// UserConsent is the consent policy. Machines in client control mode
+	// only accept UserConsentAll. Left unchanged when empty.
+	UserConsent UserConsent
+	// NoRollback leaves the settings already changed when a later one fails,
+	// instead of restoring their prior values.
+	NoRollback bool
+}
+
+// featureStep is a single change of SetFeatures and the change undoing it.
+type featureStep struct {
+	name  string
+	apply func(ctx context.Context) error
+	undo  func(ctx context.Context) error
+}
+
+// Names of the settings of SetFeatures.
+const (
+	featureRedirectionState    = "redirection state"
+	featureKVMState            = "KVM state"
+	featureRedirectionListener = "redirection listener"
+	featureUserConsent         = "user consent"
+)
+
+// featureChanges returns the settings of current that differ from config.
+func featureChanges(current *FeatureStates, config FeaturesConfig) map[string]bool {
+	return map[string]bool{
+		featureRedirectionState:    current.SOL != config.SOL || current.IDER != config.IDER,
+		featureKVMState:            current.KVM != config.KVM,
+		featureRedirectionListener: current.Redirection != (config.KVM || config.SOL || config.IDER),
+		featureUserConsent:         config.UserConsent != "" && config.UserConsent != current.UserConsent,
+	}
+}
+
+func setFeatures(ctx context.Context, client *Client, config FeaturesConfig) (ApplyResult, error) {
+	current, err := getFeatureStates(ctx, client)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	// settings already in the desired state are not written again.
+	changes := featureChanges(current, config)
+	steps := []featureStep{}
+	for _, step := range featureSteps(client, current, config) {
+		if changes[step.name] {
+			steps = append(steps, step)
+		}
+	}
+
+	return applySteps(ctx, client, OperationSetFeatures, steps, !config.NoRollback)
+}
+
+// featureSteps returns the steps moving the settings from current to config.
+func featureSteps(client *Client, current *FeatureStates, config FeaturesConfig) []featureStep {
+	// the raw value is restored, current.UserConsent is empty for the values
+	// without a UserConsent.
+	var previousOptIn string
+	return []featureStep{
+		{
+			name: featureRedirectionState,
+			apply: func(ctx context.Context) error {
+				return requestStateChange(ctx, client, client.resourceURI(ResourceAMTRedirectionService), redirectionState(config.SOL, config.IDER))
+			},
+			undo: func(ctx context.Context) error {
+				return requestStateChange(ctx, client, client.resourceURI(ResourceAMTRedirectionService), redirectionState(current.SOL, current.IDER))
+			},
+		},
+		{
+			name: featureKVMState,
+			apply: func(ctx context.Context) error {
+				return requestStateChange(ctx, client, client.resourceURI(ResourceCIMKVMRedirectionSAP), kvmState(config.KVM))
+			},
+			undo: func(ctx context.Context) error {
+				return requestStateChange(ctx, client, client.resourceURI(ResourceCIMKVMRedirectionSAP), kvmState(current.KVM))
+			},
+		},
+		{
+			name: featureRedirectionListener,
+			apply: func(ctx context.Context) error {
+				listener := config.KVM || config.SOL || config.IDER
+				_, err := updateInstance(ctx, client, client.resourceURI(ResourceAMTRedirectionService), "ListenerEnabled", strconv.FormatBool(listener))
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				_, err := updateInstance(ctx, client, client.resourceURI(ResourceAMTRedirectionService), "ListenerEnabled", strconv.FormatBool(current.Redirection))
+				return err
+			},
+		},
+		{
+			name: featureUserConsent,
+			apply: func(ctx context.Context) (err error) {
+				previousOptIn, err = setUserConsent(ctx, client, config.UserConsent)
+				return err
+			},
+			undo: func(ctx context.Context) error {
+				_, err := updateInstance(ctx, client, client.resourceURI(ResourceIPSOptInService), "OptInRequired", previousOptIn)
+				return err
+			},
+		},
+	}
+}
+
+// applySteps applies steps in order. When one fails and rollback is set, the
+// steps already applied are undone in reverse order; the returned
+// *ApplyError tells how far the rollback got. The conditions of the steps are
+// returned in the result either way.
+func applySteps(ctx context.Context, client *Client, operation string, steps []featureStep, rollback bool) (ApplyResult, error) {
+	result := ApplyResult{}
+	var conditions []Condition
+	done := func(result ApplyResult, err error) (ApplyResult, error) {
+		result.Conditions = SetCondition(conditions, readyCondition(result, err, client.clock.Now()))
+		return result, err
+	}
+	for i, step := range steps {
+		apply := step.apply
+		err := client.step(operation, step.name, func() error { return apply(ctx) })
+		if err == nil {
+			result.add(step.name)
+			conditions = SetCondition(conditions, stepCondition(step.name, ReasonApplied, nil, client.clock.Now()))
+			continue
+		}
+		conditions = SetCondition(conditions, stepCondition(step.name, ReasonFailed, err, client.clock.Now()))
+		for _, skipped := range steps[i+1:] {
+			c := stepCondition(skipped.name, ReasonNotAttempted, nil, client.clock.Now())
+			c.Status = ConditionUnknown
+			conditions = SetCondition(conditions, c)
+		}
+		applyErr := &ApplyError{Step: step.name, Err: err}
+		if !rollback {
+			applyErr.Applied = result.Changes
+			return done(result, applyErr)
+		}
+		for j := i - 1; j >= 0; j-- {
+			undo := steps[j].undo
+			if undoErr := client.step(operation, "rollback "+steps[j].name, func() error { return undo(ctx) }); undoErr != nil {
+				applyErr.RollbackStep = steps[j].name
+				applyErr.RollbackErr = undoErr
+				// the step is still applied.
+				c := stepCondition(steps[j].name, ReasonRollbackFailed, nil, client.clock.Now())
+				c.Message = undoErr.Error()
+				conditions = SetCondition(conditions, c)
+				// the steps up to j are still applied.
+				result = ApplyResult{}
+				for _, applied := range steps[:j+1] {
+					result.add(applied.name)
+				}
+				applyErr.Applied = result.Changes
+				return done(result, applyErr)
+			}
+			applyErr.RolledBack = append(applyErr.RolledBack, steps[j].name)
+			rolledBack := stepCondition(steps[j].name, ReasonRolledBack, nil, client.clock.Now())
+			rolledBack.Status, rolledBack.Message = ConditionFalse, "rolled back after the "+step.name+" failed"
+			conditions = SetCondition(conditions, rolledBack)
+		}
+		return done(ApplyResult{}, applyErr)
+	}
+	return done(result, nil)
+}
+
+func redirectionState(sol, ider bool) int {
+	switch {
+	case sol && ider:
+		return redirectionEnabledIDERSOL
+	case sol:
+		return redirectionEnabledSOL
+	case ider:
+		return redirectionEnabledIDER
+	}
+	return redirectionEnabledNone
+}
+
+func kvmState(enabled bool) int {
+	if enabled {
+		return kvmEnabled
+	}
+	return kvmDisabled
+}
+
+// setUserConsent sets the consent policy and returns the previous raw
+// OptInRequired.
+func setUserConsent(ctx context.Context, client *Client, consent UserConsent) (string, error) {
+	for value, c := range optInRequired {
+		if c == consent {
+			return updateInstance(ctx, client, client.resourceURI(ResourceIPSOptInService), "OptInRequired", value)
+		}
+	}
+	return "", fmt.Errorf("unknown user consent %q", consent)
+}
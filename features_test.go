@@ -0,0 +1,222 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFeatureStates_When_SOLAndKVMAreEnabled_Expect_IDERDisabled(t *testing.T) {
+	redirection := []*dom.Element{
+		dom.ElemC("EnabledState", ResourceAMTRedirectionService, "32770"),
+		dom.ElemC("ListenerEnabled", ResourceAMTRedirectionService, "true"),
+	}
+	kvm := []*dom.Element{dom.ElemC("EnabledState", ResourceCIMKVMRedirectionSAP, "6")}
+	optIn := []*dom.Element{
+		dom.ElemC("OptInRequired", ResourceIPSOptInService, "4294967295"),
+		dom.ElemC("OptInState", ResourceIPSOptInService, "0"),
+	}
+	assert.Equal(t, &FeatureStates{
+		Redirection: true,
+		KVM:         true,
+		SOL:         true,
+		UserConsent: UserConsentAll,
+	}, parseFeatureStates(redirection, kvm, optIn))
+}
+
+func TestFeatureChanges_When_OnlyKVMDiffers_Expect_OnlyKVMState(t *testing.T) {
+	current := &FeatureStates{Redirection: true, SOL: true, UserConsent: UserConsentAll}
+	changes := featureChanges(current, FeaturesConfig{KVM: true, SOL: true, UserConsent: UserConsentAll})
+	assert.Equal(t, map[string]bool{
+		featureRedirectionState:    false,
+		featureKVMState:            true,
+		featureRedirectionListener: false,
+		featureUserConsent:         false,
+	}, changes)
+
+	changes = featureChanges(current, FeaturesConfig{SOL: true})
+	for name, changed := range changes {
+		assert.False(t, changed, name)
+	}
+}
+
+// recordedSteps returns steps named names whose apply and undo append to log,
+// failing the apply or undo of the names in failApply and failUndo.
+func recordedSteps(log *[]string, names []string, failApply, failUndo string) []featureStep {
+	steps := []featureStep{}
+	for _, name := range names {
+		name := name
+		steps = append(steps, featureStep{
+			name: name,
+			apply: func(ctx context.Context) error {
+				if name == failApply {
+					return errors.New("apply failed")
+				}
+				*log = append(*log, "apply "+name)
+				return nil
+			},
+			undo: func(ctx context.Context) error {
+				if name == failUndo {
+					return errors.New("undo failed")
+				}
+				*log = append(*log, "undo "+name)
+				return nil
+			},
+		})
+	}
+	return steps
+}
+
+func TestApplySteps_When_StepFails_Expect_PriorStepsRolledBack(t *testing.T) {
+	var log []string
+	steps := recordedSteps(&log, []string{"a", "b", "c"}, "c", "")
+	result, err := applySteps(context.Background(), &Client{clock: SystemClock}, OperationSetFeatures, steps, true)
+
+	var applyErr *ApplyError
+	if assert.True(t, errors.As(err, &applyErr)) {
+		assert.Equal(t, "c", applyErr.Step)
+		assert.Equal(t, []string{"b", "a"}, applyErr.RolledBack)
+		assert.Nil(t, applyErr.RollbackErr)
+		assert.Empty(t, applyErr.Applied)
+	}
+	assert.False(t, result.Changed)
+	assert.Equal(t, []string{"apply a", "apply b", "undo b", "undo a"}, log)
+}
+
+func TestApplySteps_When_RollbackFails_Expect_RemainingStepsReported(t *testing.T) {
+	var log []string
+	steps := recordedSteps(&log, []string{"a", "b", "c"}, "c", "a")
+	result, err := applySteps(context.Background(), &Client{clock: SystemClock}, OperationSetFeatures, steps, true)
+
+	var applyErr *ApplyError
+	if assert.True(t, errors.As(err, &applyErr)) {
+		assert.Equal(t, []string{"b"}, applyErr.RolledBack)
+		assert.Equal(t, "a", applyErr.RollbackStep)
+		assert.EqualError(t, applyErr.RollbackErr, "undo failed")
+		assert.Equal(t, []string{"a"}, applyErr.Applied)
+		assert.EqualError(t, err, "setting the c: apply failed. rolling back the a also failed: undo failed")
+	}
+	assert.Equal(t, []string{"a"}, result.Changes)
+}
+
+func TestApplySteps_When_RollbackIsOff_Expect_StepsLeftApplied(t *testing.T) {
+	var log []string
+	steps := recordedSteps(&log, []string{"a", "b", "c"}, "b", "")
+	result, err := applySteps(context.Background(), &Client{clock: SystemClock}, OperationSetFeatures, steps, false)
+
+	var applyErr *ApplyError
+	if assert.True(t, errors.As(err, &applyErr)) {
+		assert.Empty(t, applyErr.RolledBack)
+		assert.Equal(t, []string{"a"}, applyErr.Applied)
+	}
+	assert.Equal(t, []string{"a"}, result.Changes)
+	assert.Equal(t, []string{"apply a"}, log)
+}
+
+func TestApplySteps_When_StepFails_Expect_Conditions(t *testing.T) {
+	var log []string
+	steps := recordedSteps(&log, []string{"a", "b", "c"}, "b", "")
+	result, _ := applySteps(context.Background(), &Client{clock: SystemClock}, OperationSetFeatures, steps, true)
+
+	statuses := map[string]string{}
+	for _, c := range result.Conditions {
+		statuses[c.Type] = string(c.Status) + " " + c.Reason
+	}
+	assert.Equal(t, map[string]string{
+		"A":            "False RolledBack",
+		"B":            "False Failed",
+		"C":            "Unknown NotAttempted",
+		ConditionReady: "False Failed",
+	}, statuses)
+}
+
+func TestFeatureSteps_When_ConsentIsRolledBack_Expect_RawOptInRestored(t *testing.T) {
+	f := &fakeFirmware{}
+	// 2 is not one of the consent policies of optInRequired.
+	f.set("IPS_OptInService Get", instanceBody(ResourceIPSOptInService, `<h:OptInRequired>2</h:OptInRequired><h:OptInState>0</h:OptInState>`))
+	f.set("IPS_OptInService Put", instanceBody(ResourceIPSOptInService, `<h:OptInRequired>4294967295</h:OptInRequired>`))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	current := &FeatureStates{UserConsent: optInRequired["2"]}
+	var steps []featureStep
+	for _, step := range featureSteps(client, current, FeaturesConfig{UserConsent: UserConsentAll}) {
+		if step.name == featureUserConsent {
+			steps = append(steps, step)
+		}
+	}
+	steps = append(steps, featureStep{name: "next", apply: func(ctx context.Context) error {
+		return errors.New("apply failed")
+	}})
+	_, err := applySteps(context.Background(), client, OperationSetFeatures, steps, true)
+
+	var applyErr *ApplyError
+	if assert.True(t, errors.As(err, &applyErr)) {
+		assert.Equal(t, []string{featureUserConsent}, applyErr.RolledBack)
+		assert.Nil(t, applyErr.RollbackErr)
+	}
+	assert.Contains(t, f.body("IPS_OptInService Put"), "OptInRequired>2<")
+}
+
+func TestSetKVMState_When_Enabled_Expect_OnlyKVMStateChanged(t *testing.T) {
+	tests := map[string]struct {
+		current   string
+		enabled   bool
+		requested string
+	}{
+		"enable":  {current: "3", enabled: true, requested: "RequestedState>2<"},
+		"disable": {current: "6", enabled: false, requested: "RequestedState>3<"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeFirmware{}
+			f.set("CIM_KVMRedirectionSAP Get", instanceBody(ResourceCIMKVMRedirectionSAP, `<h:EnabledState>`+tt.current+`</h:EnabledState>`))
+			f.set("CIM_KVMRedirectionSAP RequestStateChange", outputBody(ResourceCIMKVMRedirectionSAP, "RequestStateChange", 0))
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			assert.NoError(t, client.SetKVMState(context.Background(), tt.enabled))
+			assert.Equal(t, []string{"CIM_KVMRedirectionSAP Get", "CIM_KVMRedirectionSAP RequestStateChange"}, f.received())
+			assert.Contains(t, f.body("CIM_KVMRedirectionSAP RequestStateChange"), tt.requested)
+		})
+	}
+}
+
+func TestSetRedirectionState_When_Called_Expect_ListenerUntouched(t *testing.T) {
+	tests := map[string]struct {
+		current   string
+		sol, ider bool
+		requested string
+	}{
+		"none":       {current: "32771", requested: "RequestedState>32768<"},
+		"IDE-R":      {current: "32768", ider: true, requested: "RequestedState>32769<"},
+		"SOL":        {current: "32771", sol: true, requested: "RequestedState>32770<"},
+		"SOL, IDE-R": {current: "32770", sol: true, ider: true, requested: "RequestedState>32771<"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeFirmware{}
+			f.set("AMT_RedirectionService Get", instanceBody(ResourceAMTRedirectionService, `<h:EnabledState>`+tt.current+`</h:EnabledState><h:ListenerEnabled>true</h:ListenerEnabled>`))
+			f.set("AMT_RedirectionService RequestStateChange", outputBody(ResourceAMTRedirectionService, "RequestStateChange", 0))
+			client, closeServer := newFirmwareClient(t, f, Connection{})
+			defer closeServer()
+
+			assert.NoError(t, client.SetRedirectionState(context.Background(), tt.sol, tt.ider))
+			assert.Equal(t, []string{"AMT_RedirectionService Get", "AMT_RedirectionService RequestStateChange"}, f.received())
+			assert.Contains(t, f.body("AMT_RedirectionService RequestStateChange"), tt.requested)
+		})
+	}
+}
+
+func TestSetRedirectionState_When_ChangeIsRefused_Expect_Error(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_RedirectionService Get", instanceBody(ResourceAMTRedirectionService, `<h:EnabledState>32768</h:EnabledState>`))
+	f.set("AMT_RedirectionService RequestStateChange", outputBody(ResourceAMTRedirectionService, "RequestStateChange", 2))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	assert.Error(t, client.SetRedirectionState(context.Background(), true, false))
+}
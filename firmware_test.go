@@ -0,0 +1,129 @@
+package amt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	requestAction   = regexp.MustCompile(`Action[^>]*>([^<]+)<`)
+	requestResource = regexp.MustCompile(`ResourceURI[^>]*>([^<]+)<`)
+)
+
+// fakeFirmware answers the WSMAN requests with canned bodies and records the
+// requests it received. The bodies are keyed by the class of the resource and
+// the last element of the action, e.g. "AMT_GeneralSettings Get" or
+// "CIM_BootService SetBootConfigRole". The requests without a body fail.
+type fakeFirmware struct {
+	mu        sync.Mutex
+	responses map[string]string
+	// actions are the actions of the responses by key, the action of the
+	// request followed by Response when missing.
+	actions  map[string]string
+	requests []string
+	bodies   []string
+}
+
+func (f *fakeFirmware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var action, resource string
+	if m := requestAction.FindSubmatch(body); m != nil {
+		action = string(m[1])
+	}
+	if m := requestResource.FindSubmatch(body); m != nil {
+		resource = string(m[1])
+	}
+	key := path.Base(resource) + " " + path.Base(action)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, key)
+	f.bodies = append(f.bodies, string(body))
+	response, ok := f.responses[key]
+	responseAction, custom := f.actions[key]
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, "no response for "+key, http.StatusInternalServerError)
+		return
+	}
+	if !custom {
+		responseAction = action + "Response"
+	}
+	w.Header().Set("Content-Type", "application/soap+xml")
+	fmt.Fprintf(w, testEnvelope, responseAction, response)
+}
+
+// set sets the body answering key.
+func (f *fakeFirmware) set(key, body string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.responses == nil {
+		f.responses = map[string]string{}
+	}
+	f.responses[key] = body
+}
+
+// received returns the keys of the requests received so far.
+func (f *fakeFirmware) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// body returns the body of the last request with key.
+func (f *fakeFirmware) body(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i] == key {
+			return f.bodies[i]
+		}
+	}
+	return ""
+}
+
+// newFirmwareClient returns a client of f, with the settings of connection
+// other than its address.
+func newFirmwareClient(t *testing.T, f *fakeFirmware, connection Connection) (*Client, func()) {
+	server := httptest.NewServer(f)
+	host, portString, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	port, _ := strconv.Atoi(portString)
+	connection.Host, connection.Port, connection.Path = host, uint32(port), "/wsman"
+	client, err := NewClient(connection)
+	assert.NoError(t, err)
+	return client, server.Close
+}
+
+// instanceBody is the body of a Get response of the instance of resource with
+// the properties, e.g. "<h:Name>value</h:Name>".
+func instanceBody(resource, properties string) string {
+	return fmt.Sprintf(`<h:%s xmlns:h="%s">%s</h:%s>`, path.Base(resource), resource, properties, path.Base(resource))
+}
+
+// enumerationBody is the body of an Enumerate response with the items.
+func enumerationBody(items ...string) string {
+	return fmt.Sprintf(`<n:EnumerateResponse xmlns:n="%s"><w:Items>%s</w:Items><w:EndOfSequence/></n:EnumerateResponse>`, wsman.NS_WSMEN, strings.Join(items, ""))
+}
+
+// referenceItem is an endpoint reference to the instance of resource selected
+// by name and value.
+func referenceItem(resource, name, value string) string {
+	return fmt.Sprintf(`<a:EndpointReference><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address><a:ReferenceParameters><w:ResourceURI>%s</w:ResourceURI><w:SelectorSet><w:Selector Name="%s">%s</w:Selector></w:SelectorSet></a:ReferenceParameters></a:EndpointReference>`, resource, name, value)
+}
+
+// outputBody is the body of the response of the method of resource returning
+// returnValue.
+func outputBody(resource, method string, returnValue int) string {
+	return fmt.Sprintf(`<g:%s_OUTPUT xmlns:g="%s"><g:ReturnValue>%d</g:ReturnValue></g:%s_OUTPUT>`, method, resource, returnValue, method)
+}
@@ -0,0 +1,69 @@
+//go:build go1.18
+// +build go1.18
+
+package amt
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// addResponses seeds f with the captured responses in testdata/dir.
+func addResponses(f *testing.F, dir string) {
+	files, err := filepath.Glob(filepath.Join("testdata", dir, "*.xml"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(body)
+	}
+}
+
+func FuzzParsePowerStatus(f *testing.F) {
+	addResponses(f, "power")
+	f.Fuzz(func(t *testing.T, body []byte) {
+		status, err := parsePowerStatusResponse(body)
+		if err != nil {
+			return
+		}
+		// everything derived from a parsed status must not panic either.
+		describePowerState(status.currentState)
+		status.currentState.ACPIState()
+		for _, action := range PowerActions {
+			if _, err := planTransition(quirks{}, status, action); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func FuzzParseEnumerationItems(f *testing.F) {
+	addResponses(f, "power")
+	f.Fuzz(func(t *testing.T, body []byte) {
+		items, err := enumerationItems(body)
+		if err != nil {
+			return
+		}
+		parseBootOrder(items, bootConfigSetting)
+		parseUserACLEntries(items)
+		watchdogs := [][]*dom.Element{}
+		for _, item := range items {
+			properties := item.Children()
+			parseAlarm(properties)
+			parseCertificate(properties)
+			parseCertificateHash(properties)
+			parseBootSettings(properties)
+			parseNetworkSettings(WiredPort, properties)
+			parseFeatureStates(properties, properties, properties)
+			watchdogs = append(watchdogs, properties)
+		}
+		parseWatchdogs(watchdogs)
+	})
+}
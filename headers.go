@@ -0,0 +1,24 @@
+package amt
+
+import "net/http"
+
+// headerTransport sets the User-Agent and extra headers on every request.
+type headerTransport struct {
+	userAgent string
+	header    http.Header
+	next      http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header.Del(name)
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if t.userAgent != "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
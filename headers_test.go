@@ -0,0 +1,27 @@
+package amt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderTransport_When_Configured_Expect_HeadersOnRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "fleet-manager/1.0", r.Header.Get("User-Agent"))
+		assert.Equal(t, "abc", r.Header.Get("X-Request-Id"))
+	}))
+	defer server.Close()
+
+	transport := &headerTransport{
+		userAgent: "fleet-manager/1.0",
+		header:    http.Header{"X-Request-Id": {"abc"}},
+		next:      http.DefaultTransport,
+	}
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,196 @@
+// Package hello listens for the hello packets of unprovisioned devices. With
+// remote configuration enabled, the firmware of a device that is not
+// configured yet resolves ProvisionServer in the DNS domain of its network
+// and sends a hello packet to port 9971 of that host, announcing itself to
+// the provisioning server.
+package hello
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Port is the TCP port the firmware sends hello packets to.
+	Port = 9971
+	// ProvisionServer is the host name the firmware resolves in its DNS domain.
+	ProvisionServer = "ProvisionServer"
+)
+
+// packetSize is the size of the hello packet: the protocol version, two
+// reserved bytes, the provisioning ID and the UUID.
+const packetSize = 28
+
+// readTimeout bounds the wait for the packet of a connection.
+const readTimeout = 10 * time.Second
+
+var (
+	// ErrServerClosed is returned by Serve after Close.
+	ErrServerClosed = errors.New("hello: listener closed")
+	// ErrShortPacket is returned for packets smaller than a hello packet.
+	ErrShortPacket = errors.New("hello: short packet")
+)
+
+// Packet is the hello packet of a device.
+type Packet struct {
+	MajorVersion uint8
+	MinorVersion uint8
+	// PID is the provisioning ID of the pre-shared key set in the device, all
+	// zeros when it has none.
+	PID [8]byte
+	// UUID of the device, e.g. "4c4c4544-0042-3510-8051-b4c04f4b4d32".
+	UUID       string
+	RemoteAddr net.Addr
+}
+
+// ParsePacket parses a hello packet.
+func ParsePacket(data []byte) (*Packet, error) {
+	if len(data) < packetSize {
+		return nil, ErrShortPacket
+	}
+	p := &Packet{MajorVersion: data[0], MinorVersion: data[1]}
+	copy(p.PID[:], data[4:12])
+	var uuid [16]byte
+	copy(uuid[:], data[12:28])
+	p.UUID = formatUUID(uuid)
+	return p, nil
+}
+
+// MarshalBinary encodes the packet the way the firmware sends it.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	data := make([]byte, packetSize)
+	data[0], data[1] = p.MajorVersion, p.MinorVersion
+	copy(data[4:12], p.PID[:])
+	uuid, err := parseUUID(p.UUID)
+	if err != nil {
+		return nil, err
+	}
+	copy(data[12:28], uuid[:])
+	return data, nil
+}
+
+// Listener receives hello packets.
+type Listener struct {
+	// OnHello is called with the packet of every device.
+	OnHello func(*Packet)
+	// OnError is called with the errors of connections that did not send a
+	// valid packet.
+	OnError func(error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]bool
+	closed    bool
+}
+
+// ListenAndServe listens on the TCP address addr, e.g. ":9971", and serves devices.
+func (l *Listener) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ln)
+}
+
+// Serve accepts device connections on ln until it fails or the listener is closed.
+func (l *Listener) Serve(ln net.Listener) error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	if l.listeners == nil {
+		l.listeners = map[net.Listener]bool{}
+	}
+	l.listeners[ln] = true
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.listeners, ln)
+		l.mu.Unlock()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.mu.Lock()
+			closed := l.closed
+			l.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go l.ServeConn(conn)
+	}
+}
+
+// ServeConn reads the hello packet of a single connection and closes it.
+func (l *Listener) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	data := make([]byte, packetSize)
+	if _, err := io.ReadFull(conn, data); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			err = ErrShortPacket
+		}
+		l.error(fmt.Errorf("device %v: %w", conn.RemoteAddr(), err))
+		return err
+	}
+	p, err := ParsePacket(data)
+	if err != nil {
+		l.error(fmt.Errorf("device %v: %w", conn.RemoteAddr(), err))
+		return err
+	}
+	p.RemoteAddr = conn.RemoteAddr()
+	if l.OnHello != nil {
+		l.OnHello(p)
+	}
+	return nil
+}
+
+func (l *Listener) error(err error) {
+	if l.OnError != nil {
+		l.OnError(err)
+	}
+}
+
+// Close stops the listeners.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	listeners := l.listeners
+	l.listeners = nil
+	l.mu.Unlock()
+	for ln := range listeners {
+		ln.Close()
+	}
+	return nil
+}
+
+// formatUUID formats the UUID sent by the firmware, whose first three fields
+// are little endian.
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15])
+}
+
+// parseUUID is the inverse of formatUUID.
+func parseUUID(s string) ([16]byte, error) {
+	var b [16]byte
+	raw, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(raw) != len(b) {
+		return b, fmt.Errorf("hello: invalid UUID %q", s)
+	}
+	copy(b[:], raw)
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b, nil
+}
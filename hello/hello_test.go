@@ -0,0 +1,41 @@
+package hello
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener_When_DeviceSaysHello_Expect_Packet(t *testing.T) {
+	hellos := make(chan *Packet, 1)
+	l := &Listener{OnHello: func(p *Packet) { hellos <- p }}
+	defer l.Close()
+	local, remote := net.Pipe()
+	go l.ServeConn(local)
+
+	sent := &Packet{MajorVersion: 1, PID: [8]byte{'A', 'B', 'C', 'D', '1', '2', '3', '4'}, UUID: "4c4c4544-0042-3510-8051-b4c04f4b4d32"}
+	data, err := sent.MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x44, 0x45, 0x4c, 0x4c, 0x42, 0x00, 0x10, 0x35}, data[12:20])
+	remote.Write(data)
+
+	p := <-hellos
+	assert.Equal(t, sent.UUID, p.UUID)
+	assert.Equal(t, sent.PID, p.PID)
+	assert.Equal(t, uint8(1), p.MajorVersion)
+	assert.NotNil(t, p.RemoteAddr)
+}
+
+func TestListener_When_ConnectionClosedEarly_Expect_ShortPacket(t *testing.T) {
+	errs := make(chan error, 1)
+	l := &Listener{OnError: func(err error) { errs <- err }}
+	local, remote := net.Pipe()
+	go l.ServeConn(local)
+	remote.Write([]byte{1, 0, 0, 0})
+	remote.Close()
+
+	assert.ErrorIs(t, <-errs, ErrShortPacket)
+	_, err := ParsePacket(make([]byte, 10))
+	assert.Equal(t, ErrShortPacket, err)
+}
@@ -0,0 +1,106 @@
+package amt
+
+import (
+	"context"
+	"time"
+
+	"github.com/jacobweinstock/wsman"
+)
+
+// Hooks are called around every WSMAN request of a Client, e.g. to record
+// metrics, audit log the changes or inject failures in tests. Any of them may be nil.
+type Hooks struct {
+	// OnRequest is called before a request is sent. Returning an error aborts
+	// the request, the error is returned to the caller.
+	OnRequest func(ctx context.Context, request *Request) error
+	// OnResponse is called after a successful request.
+	OnResponse func(ctx context.Context, request *Request, response *wsman.Message, duration time.Duration)
+	// OnError is called after a failed request, including the ones aborted by OnRequest.
+	OnError func(ctx context.Context, request *Request, err error, duration time.Duration)
+}
+
+// Request describes a WSMAN request.
+type Request struct {
+	// Action is the WS-Addressing action, e.g. wsman.GET or the method URI of an invoke.
+	Action      string
+	ResourceURI string
+	// Message is nil for the web UI pages read with Connection.WebUIFallback,
+	// whose Action is wsman.GET and ResourceURI the URL of the page. Their
+	// OnResponse gets a nil response.
+	Message *wsman.Message
+}
+
+// Mutating reports whether the request may change the machine, everything but gets and enumerations.
+func (r *Request) Mutating() bool {
+	switch r.Action {
+	case wsman.GET, wsman.ENUMERATE, wsman.PULL, wsman.RELEASE:
+		return false
+	}
+	return true
+}
+
+// checkWriteLimit counts a mutating request against the WriteLimit of the client.
+func (c *Client) checkWriteLimit(request *Request, now time.Time) error {
+	over, err := c.writes.allow(now)
+	if over {
+		c.logger.Info("write limit exceeded, frequent changes wear out the flash of the firmware",
+			"resourceURI", request.ResourceURI, "action", request.Action,
+			"writes", c.writes.limit.Writes, "period", c.writes.limit.Period.String(), "enforced", c.writes.limit.Enforce)
+	}
+	return err
+}
+
+// send sends message through the hooks and the operation sink of the client.
+func (c *Client) send(ctx context.Context, message *wsman.Message) (*wsman.Message, error) {
+	action, _ := message.GHC("Action")
+	request := &Request{Action: action, ResourceURI: message.GetResource(), Message: message}
+	return c.do(ctx, request, message.Send)
+}
+
+// do sends request with send, bounded by the timeouts and the write limit of
+// the client and reported to its hooks, stats and operation sink.
+func (c *Client) do(ctx context.Context, request *Request, send func(ctx context.Context) (*wsman.Message, error)) (*wsman.Message, error) {
+	hooks := c.hooks
+	timeout := c.readTimeout
+	if request.Mutating() {
+		timeout = c.mutationTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := c.clock.Now()
+	var response *wsman.Message
+	var err error
+	if request.Mutating() {
+		err = c.checkWriteLimit(request, start)
+	}
+	if err == nil && hooks.OnRequest != nil {
+		err = hooks.OnRequest(ctx, request)
+	}
+	sent := err == nil
+	if sent {
+		response, err = send(ctx)
+	}
+	duration := c.clock.Now().Sub(start)
+	err = c.redact(err)
+	if sent {
+		c.stats.record(err, duration, start.Add(duration))
+	}
+
+	if c.sink != nil && request.Mutating() {
+		c.sink.Record(newOperationRecord(start, c.host, request, response, err))
+	}
+	if err != nil {
+		if hooks.OnError != nil {
+			hooks.OnError(ctx, request, err, duration)
+		}
+		return response, err
+	}
+	if hooks.OnResponse != nil {
+		hooks.OnResponse(ctx, request, response, duration)
+	}
+	return response, nil
+}
@@ -0,0 +1,111 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks_When_OnRequestFails_Expect_RequestAborted(t *testing.T) {
+	injected := errors.New("injected")
+	var failed *Request
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				return injected
+			},
+			OnError: func(ctx context.Context, request *Request, err error, duration time.Duration) {
+				failed = request
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Version(context.Background())
+	assert.Equal(t, injected, err)
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, wsman.ENUMERATE, failed.Action)
+		assert.Equal(t, ResourceCIMSoftwareIdentity, failed.ResourceURI)
+		assert.False(t, failed.Mutating())
+	}
+}
+
+type recordingSink []OperationRecord
+
+func (s *recordingSink) Record(r OperationRecord) {
+	*s = append(*s, r)
+}
+
+func TestOperationSink_When_InvokeFails_Expect_RedactedRecord(t *testing.T) {
+	sink := &recordingSink{}
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				return errors.New("injected")
+			},
+		},
+		OperationSink: sink,
+	})
+	assert.NoError(t, err)
+
+	message := client.NewInvoke(ResourceIPSHostBasedSetupService, "Setup")
+	message.Parameters("NetAdminPassEncryptionType", "2", "NetworkAdminPassword", "secret")
+	_, _, err = client.RawInvoke(context.Background(), message)
+	assert.Error(t, err)
+	if assert.Len(t, *sink, 1) {
+		record := (*sink)[0]
+		assert.Equal(t, "192.0.2.1", record.Host)
+		assert.Equal(t, "Setup", record.Method)
+		assert.Equal(t, map[string]string{"NetAdminPassEncryptionType": "2", "NetworkAdminPassword": redacted}, record.Parameters)
+		assert.Equal(t, -1, record.ReturnValue)
+	}
+}
+
+func TestResourceURIs_When_Overridden_Expect_OverrideSent(t *testing.T) {
+	const oem = "http://example.com/wbem/wscim/1/oem-schema/1/CIM_SoftwareIdentity"
+	var sent string
+	client, err := NewClient(Connection{
+		Host:         "192.0.2.1",
+		ResourceURIs: map[string]string{ResourceCIMSoftwareIdentity: oem},
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				sent = request.ResourceURI
+				return errors.New("injected")
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.SoftwareIdentities(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, oem, sent)
+}
+
+func TestTimeouts_When_Set_Expect_DeadlinePerRequestKind(t *testing.T) {
+	deadlines := map[bool]time.Duration{}
+	client, err := NewClient(Connection{
+		Host:            "192.0.2.1",
+		ReadTimeout:     time.Second,
+		MutationTimeout: time.Hour,
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				if deadline, ok := ctx.Deadline(); ok {
+					deadlines[request.Mutating()] = time.Until(deadline)
+				}
+				return errors.New("injected")
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	client.Version(context.Background())
+	client.RawInvoke(context.Background(), client.NewInvoke(ResourceAMTSetupAndConfigurationService, "Unprovision"))
+	assert.InDelta(t, time.Second, deadlines[false], float64(time.Second/2))
+	assert.InDelta(t, time.Hour, deadlines[true], float64(time.Minute))
+}
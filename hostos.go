@@ -0,0 +1,113 @@
+package amt
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// CurrentState of AMT_AgentPresenceWatchdog, the others are not started (1),
+// stopped (2) and suspended (16).
+const (
+	watchdogRunning = 4
+	watchdogExpired = 8
+)
+
+// HostOSState is what the firmware can tell about the host operating system.
+type HostOSState string
+
+// Host OS states.
+const (
+	// HostOSOff is a machine that is not powered on.
+	HostOSOff HostOSState = "off"
+	// HostOSRunning is a machine whose agent sends heartbeats to the firmware.
+	HostOSRunning HostOSState = "running"
+	// HostOSUnresponsive is a powered on machine whose agent stopped sending
+	// heartbeats, usually a hung operating system.
+	HostOSUnresponsive HostOSState = "unresponsive"
+	// HostOSUnknown is a powered on machine without an agent, nothing tells
+	// whether its operating system is up.
+	HostOSUnknown HostOSState = "unknown"
+)
+
+// HostOSStatus is the state of the host operating system and the evidence it
+// was derived from.
+type HostOSStatus struct {
+	State HostOSState
+	Power PowerState
+	// LinkUp is true when the wired port has a network link, which a hung
+	// operating system usually keeps.
+	LinkUp bool
+	// RunningAgents and ExpiredAgents are the InstanceIDs of the agent
+	// presence watchdogs in these states.
+	RunningAgents []string
+	ExpiredAgents []string
+	// HostOSFQDN is the name reported by the operating system agent, e.g.
+	// LMS, the last time it ran.
+	HostOSFQDN string
+}
+
+// Up reports whether the host operating system appears to be running.
+func (s *HostOSStatus) Up() bool {
+	return s.State == HostOSRunning
+}
+
+func getHostOSStatus(ctx context.Context, client *Client) (*HostOSStatus, error) {
+	power, err := getPowerStatus(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	status := &HostOSStatus{Power: power.currentState}
+
+	// the other evidence is optional, not every firmware or configuration has it.
+	if settings, err := getNetworkSettings(ctx, client, WiredPort); err == nil {
+		status.LinkUp = settings.LinkUp
+	} else {
+		client.logger.V(1).Info("could not read the link state", "error", err.Error())
+	}
+	if general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings)); err == nil {
+		status.HostOSFQDN = propertyContent(general, "HostOSFQDN")
+	} else {
+		client.logger.V(1).Info("could not read the host OS FQDN", "error", err.Error())
+	}
+	if items, err := enumerate(ctx, client, client.resourceURI(ResourceAMTAgentPresenceWatchdog)); err == nil {
+		watchdogs := make([][]*dom.Element, 0, len(items))
+		for _, item := range items {
+			watchdogs = append(watchdogs, item.Children())
+		}
+		status.RunningAgents, status.ExpiredAgents = parseWatchdogs(watchdogs)
+	} else {
+		client.logger.V(1).Info("could not list the agent presence watchdogs", "error", err.Error())
+	}
+
+	status.State = hostOSState(status)
+	return status, nil
+}
+
+// parseWatchdogs returns the InstanceIDs of the running and the expired watchdogs.
+func parseWatchdogs(watchdogs [][]*dom.Element) (running, expired []string) {
+	for _, properties := range watchdogs {
+		id := propertyContent(properties, "InstanceID")
+		state, _ := strconv.Atoi(propertyContent(properties, "CurrentState"))
+		switch state {
+		case watchdogRunning:
+			running = append(running, id)
+		case watchdogExpired:
+			expired = append(expired, id)
+		}
+	}
+	return running, expired
+}
+
+func hostOSState(s *HostOSStatus) HostOSState {
+	switch {
+	case s.Power != PowerStateOn:
+		return HostOSOff
+	case len(s.RunningAgents) > 0:
+		return HostOSRunning
+	case len(s.ExpiredAgents) > 0:
+		return HostOSUnresponsive
+	}
+	return HostOSUnknown
+}
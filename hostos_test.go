@@ -0,0 +1,28 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostOSState_When_AgentExpired_Expect_Unresponsive(t *testing.T) {
+	running, expired := parseWatchdogs([][]*dom.Element{
+		{
+			dom.ElemC("InstanceID", ResourceAMTAgentPresenceWatchdog, "agent"),
+			dom.ElemC("CurrentState", ResourceAMTAgentPresenceWatchdog, "8"),
+		},
+	})
+	status := &HostOSStatus{Power: PowerStateOn, LinkUp: true, RunningAgents: running, ExpiredAgents: expired}
+	assert.Equal(t, HostOSUnresponsive, hostOSState(status))
+
+	status.Power = PowerStateOffSoft
+	assert.Equal(t, HostOSOff, hostOSState(status))
+}
+
+func TestHostOSState_When_OnWithoutAgents_Expect_Unknown(t *testing.T) {
+	status := &HostOSStatus{Power: PowerStateOn}
+	assert.Equal(t, HostOSUnknown, hostOSState(status))
+	assert.False(t, status.Up())
+}
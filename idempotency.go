@@ -0,0 +1,122 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDedupeWindow is how long the result of a power operation with an
+// idempotency key is remembered when Connection.DedupeWindow is 0.
+const DefaultDedupeWindow = time.Minute
+
+// ErrIdempotencyKeyReused is returned when an idempotency key still in the
+// dedupe window is used for a different power operation.
+var ErrIdempotencyKeyReused = errors.New("idempotency key already used for another power operation")
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context making the power operations called
+// with it idempotent: the same operation with the same key, called again
+// within the dedupe window of the client, returns the result of the first
+// call instead of being sent to the machine, so an orchestrator retrying a
+// reboot doesn't reboot the machine twice. A call made while the first one
+// runs waits for its result. Failed operations are not remembered, they run
+// again when retried. Keys are remembered by each Client, share the Client
+// to share them.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// dedupedPower is the result of a power operation with an idempotency key.
+// done is closed once the operation ran, at is zero until then.
+type dedupedPower struct {
+	operation string
+	result    PowerResult
+	at        time.Time
+	done      chan struct{}
+}
+
+// powerDedupe remembers the power operations with an idempotency key for window.
+type powerDedupe struct {
+	window time.Duration
+	clock  Clock
+	mu     sync.Mutex
+	seen   map[string]*dedupedPower
+}
+
+func newPowerDedupe(window time.Duration, clock Clock) *powerDedupe {
+	if window == 0 {
+		window = DefaultDedupeWindow
+	}
+	return &powerDedupe{window: window, clock: clock, seen: map[string]*dedupedPower{}}
+}
+
+// dedupePower runs operation unless it already ran or runs with the
+// idempotency key of ctx within the dedupe window. The key is reserved before
+// operation runs and released when it fails.
+func dedupePower(ctx context.Context, client *Client, operation string, run func() (PowerResult, error)) (PowerResult, error) {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	d := client.dedupe
+	if key == "" || d == nil {
+		return run()
+	}
+
+	for {
+		seen, reserved := d.reserve(key, operation)
+		if reserved {
+			result, err := run()
+			d.complete(key, seen, result, err)
+			return result, err
+		}
+		if seen.operation != operation {
+			return PowerResultNoOp, ErrIdempotencyKeyReused
+		}
+		select {
+		case <-seen.done:
+		case <-ctx.Done():
+			return PowerResultNoOp, ctx.Err()
+		}
+		d.mu.Lock()
+		result, ran := seen.result, !seen.at.IsZero()
+		d.mu.Unlock()
+		if ran {
+			client.logger.V(1).Info("skipping duplicate power operation", "operation", operation, "idempotencyKey", key)
+			return result, nil
+		}
+		// the operation failed and released the key, try to reserve it again.
+	}
+}
+
+// reserve returns the entry of key, reserving it for operation when there is
+// none in the window.
+func (d *powerDedupe) reserve(key, operation string) (*dedupedPower, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.clock.Now()
+	for k, seen := range d.seen {
+		if !seen.at.IsZero() && now.Sub(seen.at) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	if seen, ok := d.seen[key]; ok {
+		return seen, false
+	}
+	seen := &dedupedPower{operation: operation, done: make(chan struct{})}
+	d.seen[key] = seen
+	return seen, true
+}
+
+// complete records the result of the reserved entry of key, or releases key
+// when the operation failed.
+func (d *powerDedupe) complete(key string, seen *dedupedPower, result PowerResult, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		delete(d.seen, key)
+	} else {
+		seen.result, seen.at = result, d.clock.Now()
+	}
+	close(seen.done)
+}
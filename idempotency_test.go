@@ -0,0 +1,105 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupePower_When_SameKeyWithinWindow_Expect_RunOnce(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	client := &Client{logger: logr.Discard(), clock: clock, dedupe: newPowerDedupe(time.Minute, clock)}
+	runs := 0
+	run := func() (PowerResult, error) {
+		runs++
+		return PowerResultRequested, nil
+	}
+	ctx := WithIdempotencyKey(context.Background(), "reboot-1")
+
+	for i := 0; i < 3; i++ {
+		result, err := dedupePower(ctx, client, string(PowerActionCycle), run)
+		assert.NoError(t, err)
+		assert.Equal(t, PowerResultRequested, result)
+	}
+	assert.Equal(t, 1, runs)
+
+	_, err := dedupePower(ctx, client, string(PowerActionOff), run)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	// without a key every call runs.
+	_, _ = dedupePower(context.Background(), client, string(PowerActionCycle), run)
+	assert.Equal(t, 2, runs)
+
+	clock.Advance(time.Minute)
+	_, _ = dedupePower(ctx, client, string(PowerActionCycle), run)
+	assert.Equal(t, 3, runs)
+}
+
+func TestDedupePower_When_SameKeyConcurrently_Expect_RunOnce(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	client := &Client{logger: logr.Discard(), clock: clock, dedupe: newPowerDedupe(time.Minute, clock)}
+	var mu sync.Mutex
+	runs := 0
+	started, release := make(chan struct{}), make(chan struct{})
+	run := func() (PowerResult, error) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		close(started)
+		<-release
+		return PowerResultRequested, nil
+	}
+	ctx := WithIdempotencyKey(context.Background(), "reboot-1")
+
+	results := make(chan PowerResult, 2)
+	go func() {
+		result, err := dedupePower(ctx, client, string(PowerActionCycle), run)
+		assert.NoError(t, err)
+		results <- result
+	}()
+	<-started
+	go func() {
+		result, err := dedupePower(ctx, client, string(PowerActionCycle), run)
+		assert.NoError(t, err)
+		results <- result
+	}()
+
+	// another operation with the key is refused while the first one runs.
+	_, err := dedupePower(ctx, client, string(PowerActionOff), run)
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+
+	close(release)
+	assert.Equal(t, PowerResultRequested, <-results)
+	assert.Equal(t, PowerResultRequested, <-results)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, runs)
+}
+
+func TestDedupePower_When_RunFails_Expect_KeyReleased(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	client := &Client{logger: logr.Discard(), clock: clock, dedupe: newPowerDedupe(time.Minute, clock)}
+	runs := 0
+	fail := errors.New("power failed")
+	run := func() (PowerResult, error) {
+		runs++
+		if runs == 1 {
+			return PowerResultNoOp, fail
+		}
+		return PowerResultRequested, nil
+	}
+	ctx := WithIdempotencyKey(context.Background(), "reboot-1")
+
+	_, err := dedupePower(ctx, client, string(PowerActionCycle), run)
+	assert.ErrorIs(t, err, fail)
+
+	result, err := dedupePower(ctx, client, string(PowerActionCycle), run)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerResultRequested, result)
+	assert.Equal(t, 2, runs)
+}
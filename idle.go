@@ -0,0 +1,52 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Bounds of the IdleWakeTimeout of AMT_GeneralSettings, set in whole minutes.
+const (
+	MinIdleWakeTimeout = time.Minute
+	MaxIdleWakeTimeout = 65535 * time.Minute
+)
+
+func getIdleWakeTimeout(ctx context.Context, client *Client) (time.Duration, error) {
+	general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings), "IdleWakeTimeout")
+	if err != nil {
+		return 0, err
+	}
+	return parseIdleWakeTimeout(propertyContent(general, "IdleWakeTimeout")), nil
+}
+
+// parseIdleWakeTimeout returns the timeout of minutes, 0 when it isn't a number.
+func parseIdleWakeTimeout(minutes string) time.Duration {
+	n, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n) * time.Minute
+}
+
+// applyIdleWakeTimeout sets the idle wake timeout unless it already is timeout.
+func applyIdleWakeTimeout(ctx context.Context, client *Client, timeout time.Duration) (ApplyResult, error) {
+	if timeout < MinIdleWakeTimeout || timeout > MaxIdleWakeTimeout || timeout%time.Minute != 0 {
+		return ApplyResult{}, fmt.Errorf("idle wake timeout %v must be whole minutes between %v and %v", timeout, MinIdleWakeTimeout, MaxIdleWakeTimeout)
+	}
+	current, err := getIdleWakeTimeout(ctx, client)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	if current == timeout {
+		return ApplyResult{}, nil
+	}
+	minutes := strconv.Itoa(int(timeout / time.Minute))
+	if _, err := updateInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings), "IdleWakeTimeout", minutes); err != nil {
+		return ApplyResult{}, err
+	}
+	result := ApplyResult{}
+	result.add("idle wake timeout")
+	return result, nil
+}
@@ -0,0 +1,19 @@
+package amt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyIdleWakeTimeout_When_NotWholeMinutes_Expect_ErrorBeforeRequest(t *testing.T) {
+	client := &Client{}
+	for _, timeout := range []time.Duration{0, 90 * time.Second, MaxIdleWakeTimeout + time.Minute} {
+		_, err := applyIdleWakeTimeout(context.Background(), client, timeout)
+		assert.Error(t, err, timeout)
+	}
+	assert.Equal(t, 65*time.Minute, parseIdleWakeTimeout("65"))
+	assert.Equal(t, time.Duration(0), parseIdleWakeTimeout(""))
+}
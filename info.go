@@ -0,0 +1,239 @@
+package amt
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ControlMode is the provisioning mode of the firmware.
+type ControlMode string
+
+// IPS_HostBasedSetupService CurrentControlMode values. ControlModeUnknown is
+// returned when the mode could not be read.
+const (
+	ControlModeUnknown ControlMode = ""
+	ControlModeNone    ControlMode = "pre-provisioning"
+	ControlModeClient  ControlMode = "client control mode"
+	ControlModeAdmin   ControlMode = "admin control mode"
+)
+
+var controlModes = map[string]ControlMode{
+	"0": ControlModeNone,
+	"1": ControlModeClient,
+	"2": ControlModeAdmin,
+}
+
+// Info is the report of a device, like the amtinfo command of rpc-go: the
+// first thing to look at when diagnosing an AMT issue. The parts the firmware
+// doesn't have or didn't return are left empty.
+type Info struct {
+	// Version of AMT, e.g. "16.1.25", its Build number and SKU.
+	Version string
+	Build   string
+	SKU     string
+	// UUID of the platform, e.g. "4c4c4544-0037-3010-8052-b3c04f4e4432".
+	UUID        string
+	ControlMode ControlMode
+	// DNSSuffix is the domain name of the firmware.
+	DNSSuffix string
+	// HostName is the host name of the firmware.
+	HostName string
+	// IdleWakeTimeout is how long the firmware stays awake while the
+	// machine sleeps, see Client.SetIdleWakeTimeout.
+	IdleWakeTimeout time.Duration
+	// RemoteAccess is the CIRA configuration.
+	RemoteAccess RemoteAccessStatus
+	// Interfaces are the wired and the wireless interfaces.
+	Interfaces []NetworkSettings
+	// CertificateHashes are the trusted root certificate hashes of remote
+	// configuration.
+	CertificateHashes []CertificateHash
+}
+
+// RemoteAccessStatus is the CIRA (Client Initiated Remote Access)
+// configuration of the firmware. Whether the tunnel is connected is only
+// known from the host, see mei.HostInterface.RemoteAccessStatus.
+type RemoteAccessStatus struct {
+	// MPSServers are the addresses of the configured MPS servers.
+	MPSServers []string
+	// UserInitiated is true when the user initiated connections are enabled
+	// on an interface, so the host can open the tunnel on demand.
+	UserInitiated bool
+}
+
+func getRemoteAccessStatus(ctx context.Context, client *Client) (*RemoteAccessStatus, error) {
+	servers, err := enumerate(ctx, client, client.resourceURI(ResourceAMTManagementPresenceRemoteSAP))
+	if err != nil {
+		return nil, err
+	}
+	status := &RemoteAccessStatus{}
+	for _, server := range servers {
+		status.MPSServers = append(status.MPSServers, propertyContent(server.Children(), "AccessInfo"))
+	}
+	service, err := getInstance(ctx, client, client.resourceURI(ResourceAMTUserInitiatedConnectionService), "EnabledState")
+	if err != nil {
+		return nil, err
+	}
+	state, _ := strconv.Atoi(propertyContent(service, "EnabledState"))
+	status.UserInitiated = userInitiatedConnections(state)
+	return status, nil
+}
+
+// userInitiatedConnections reports whether the EnabledState of
+// AMT_UserInitiatedConnectionService enables the connections on an interface.
+func userInitiatedConnections(state int) bool {
+	return state != 0 && state != userInitiatedConnectionsDisabled
+}
+
+// setUserInitiatedConnections enables or disables the CIRA connections the
+// host can open on demand.
+func setUserInitiatedConnections(ctx context.Context, client *Client, enabled bool) error {
+	state := userInitiatedConnectionsDisabled
+	if enabled {
+		state = userInitiatedConnectionsEnabled
+	}
+	return requestStateChange(ctx, client, client.resourceURI(ResourceAMTUserInitiatedConnectionService), state)
+}
+
+func getInfo(ctx context.Context, client *Client) (*Info, error) {
+	identities, err := getSoftwareIdentities(ctx, client)
+	if err != nil {
+		info, scrapeErr := webUIInfo(ctx, client)
+		if scrapeErr != nil || info.Version == "" {
+			return nil, err
+		}
+		client.logger.V(1).Info("read the version from the web UI", "error", err.Error())
+		return info, nil
+	}
+	info := &Info{}
+	for _, identity := range identities {
+		switch identity.InstanceID {
+		case amtSoftwareIdentity:
+			info.Version = identity.Version
+		case "Build Number":
+			info.Build = identity.Version
+		case "Sku":
+			info.SKU = identity.Version
+		}
+	}
+
+	// the other parts are optional, a report is most needed when something is broken.
+	if system, err := enumerate(ctx, client, client.resourceURI(ResourceCIMComputerSystemPackage)); err == nil && len(system) > 0 {
+		info.UUID = formatPlatformGUID(propertyContent(system[0].Children(), "PlatformGUID"))
+	} else if err != nil {
+		client.logger.V(1).Info("could not read the platform GUID", "error", err.Error())
+	}
+	if setup, err := getInstance(ctx, client, client.resourceURI(ResourceIPSHostBasedSetupService)); err == nil {
+		info.ControlMode = controlModes[propertyContent(setup, "CurrentControlMode")]
+	} else {
+		client.logger.V(1).Info("could not read the control mode", "error", err.Error())
+	}
+	if general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings)); err == nil {
+		info.DNSSuffix = propertyContent(general, "DomainName")
+		info.HostName = propertyContent(general, "HostName")
+		info.IdleWakeTimeout = parseIdleWakeTimeout(propertyContent(general, "IdleWakeTimeout"))
+	} else {
+		client.logger.V(1).Info("could not read the general settings", "error", err.Error())
+	}
+	if remote, err := getRemoteAccessStatus(ctx, client); err == nil {
+		info.RemoteAccess = *remote
+	} else {
+		client.logger.V(1).Info("could not read the remote access configuration", "error", err.Error())
+	}
+	for _, port := range []EthernetPort{WiredPort, WirelessPort} {
+		settings, err := getNetworkSettings(ctx, client, port)
+		if err != nil {
+			// not every machine has a wireless interface.
+			client.logger.V(1).Info("could not read the interface", "port", string(port), "error", err.Error())
+			continue
+		}
+		info.Interfaces = append(info.Interfaces, *settings)
+	}
+	if hashes, err := getCertificateHashes(ctx, client); err == nil {
+		info.CertificateHashes = hashes
+	} else {
+		client.logger.V(1).Info("could not list the certificate hashes", "error", err.Error())
+	}
+	if client.webUI != nil && (info.HostName == "" || info.DNSSuffix == "" || len(info.Interfaces) == 0) {
+		if rows, err := scrapeWebUI(ctx, client); err == nil {
+			applyWebUI(info, rows)
+		} else {
+			client.logger.V(1).Info("could not read the web UI", "error", err.Error())
+		}
+	}
+	return info, nil
+}
+
+// webUIInfo is the Info scraped from the web UI, when the fallback is on.
+func webUIInfo(ctx context.Context, client *Client) (*Info, error) {
+	if client.webUI == nil {
+		return nil, errors.New("the web UI fallback is off")
+	}
+	rows, err := scrapeWebUI(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{}
+	applyWebUI(info, rows)
+	return info, nil
+}
+
+// formatPlatformGUID formats the hex PlatformGUID of CIM_ComputerSystemPackage
+// as a UUID. The first three fields are little endian, as in SMBIOS.
+func formatPlatformGUID(guid string) string {
+	b, err := hex.DecodeString(strings.TrimSpace(guid))
+	if err != nil || len(b) != 16 {
+		return guid
+	}
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%x-%x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8:10], b[10:])
+}
+
+// String formats the report like amtinfo.
+func (i *Info) String() string {
+	var b strings.Builder
+	line := func(name, value string) {
+		fmt.Fprintf(&b, "%-24s: %s\n", name, value)
+	}
+	line("Version", i.Version)
+	line("Build Number", i.Build)
+	line("SKU", i.SKU)
+	line("UUID", i.UUID)
+	line("Control Mode", string(i.ControlMode))
+	line("DNS Suffix", i.DNSSuffix)
+	line("Hostname", i.HostName)
+	if i.IdleWakeTimeout > 0 {
+		line("Idle Wake Timeout", i.IdleWakeTimeout.String())
+	}
+	line("RAS MPS Servers", strings.Join(i.RemoteAccess.MPSServers, ", "))
+	line("RAS User Initiated", strconv.FormatBool(i.RemoteAccess.UserInitiated))
+	for _, lan := range i.Interfaces {
+		name := "wired"
+		if lan.Port == WirelessPort {
+			name = "wireless"
+		}
+		link := "down"
+		if lan.LinkUp {
+			link = "up"
+		}
+		fmt.Fprintf(&b, "LAN Interface: %s\n", name)
+		line("  DHCP Enabled", strconv.FormatBool(lan.DHCPEnabled))
+		line("  Link Status", link)
+		line("  IP Address", lan.IPAddress)
+		line("  MAC Address", lan.MACAddress)
+	}
+	fmt.Fprintf(&b, "Certificate Hashes:\n")
+	for _, h := range i.CertificateHashes {
+		state := "disabled"
+		if h.Enabled {
+			state = "enabled"
+		}
+		fmt.Fprintf(&b, "  %s (%s): %x\n", h.Name, state, h.Hash)
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPlatformGUID_When_Hex_Expect_SwappedUUID(t *testing.T) {
+	assert.Equal(t, "4c4c4544-0037-3010-8052-b3c04f4e4432", formatPlatformGUID("44454C4C370010308052B3C04F4E4432"))
+	assert.Equal(t, "not hex", formatPlatformGUID("not hex"))
+}
+
+func TestInfo_When_Formatted_Expect_AmtinfoLines(t *testing.T) {
+	info := &Info{
+		Version:      "16.1.25",
+		ControlMode:  ControlModeClient,
+		RemoteAccess: RemoteAccessStatus{MPSServers: []string{"mps.example.com"}},
+		Interfaces:   []NetworkSettings{{Port: WiredPort, IPAddress: "192.0.2.10", LinkUp: true}},
+		CertificateHashes: []CertificateHash{
+			{Name: "Root", Hash: []byte{0xab, 0xcd}, Enabled: true},
+		},
+	}
+	s := info.String()
+	assert.Contains(t, s, "Version                 : 16.1.25\n")
+	assert.Contains(t, s, "Control Mode            : client control mode\n")
+	assert.Contains(t, s, "RAS MPS Servers         : mps.example.com\n")
+	assert.Contains(t, s, "LAN Interface: wired\n")
+	assert.Contains(t, s, "  Link Status           : up\n")
+	assert.Contains(t, s, "  Root (enabled): abcd\n")
+}
+
+func TestSetUserInitiatedConnections_When_Enabled_Expect_BIOSAndOSState(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("AMT_UserInitiatedConnectionService Get", instanceBody(ResourceAMTUserInitiatedConnectionService, `<h:EnabledState>32768</h:EnabledState>`))
+	f.set("AMT_UserInitiatedConnectionService RequestStateChange", outputBody(ResourceAMTUserInitiatedConnectionService, "RequestStateChange", 0))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	result, err := client.ApplyUserInitiatedConnections(context.Background(), true)
+	assert.NoError(t, err)
+	assert.True(t, result.Changed)
+	assert.Contains(t, f.body("AMT_UserInitiatedConnectionService RequestStateChange"), ">32771<")
+
+	f.set("AMT_UserInitiatedConnectionService Get", instanceBody(ResourceAMTUserInitiatedConnectionService, `<h:EnabledState>32771</h:EnabledState>`))
+	result, err = client.ApplyUserInitiatedConnections(context.Background(), true)
+	assert.NoError(t, err)
+	assert.False(t, result.Changed)
+}
@@ -0,0 +1,173 @@
+// Package wsframe implements the websocket framing (RFC 6455) shared by the
+// websocket relay client of the mps package and the websocket console server
+// of the redirection package. The handshakes are up to them.
+package wsframe
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// guid is appended to the client key to compute Sec-WebSocket-Accept.
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes of the frames.
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xa
+)
+
+// MaxPayload is the largest frame payload read.
+const MaxPayload = 1 << 20
+
+// Accept returns the Sec-WebSocket-Accept of the Sec-WebSocket-Key key.
+func Accept(key string) string {
+	sum := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Conn exchanges the payload of data frames as a byte stream. The client side
+// masks the frames it sends, the server side requires masked frames.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	client bool
+
+	writeMu sync.Mutex
+	pending []byte
+}
+
+// NewConn returns the websocket of conn after the handshake, read through r,
+// which may hold the first frames. client is true on the client side.
+func NewConn(conn net.Conn, r *bufio.Reader, client bool) *Conn {
+	return &Conn{Conn: conn, r: r, client: client}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case OpText, OpBinary, OpContinuation:
+			c.pending = payload
+		case OpPing:
+			if err := c.WriteFrame(OpPong, payload); err != nil {
+				return 0, err
+			}
+		case OpPong:
+		case OpClose:
+			c.WriteFrame(OpClose, nil)
+			return 0, io.EOF
+		default:
+			return 0, fmt.Errorf("unexpected websocket opcode %d", opcode)
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *Conn) readFrame() (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(c.r, ext); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext)
+	}
+	if length > MaxPayload {
+		return 0, nil, fmt.Errorf("websocket frame of %d bytes is too large", length)
+	}
+	if !masked && !c.client {
+		// clients must mask every frame.
+		return 0, nil, errors.New("received an unmasked websocket frame")
+	}
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.r, mask); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if err := c.WriteFrame(OpBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteFrame writes a single frame of opcode.
+func (c *Conn) WriteFrame(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	if c.client {
+		// servers must reject unmasked frames from clients.
+		mask := make([]byte, 4)
+		if _, err := rand.Read(mask); err != nil {
+			return err
+		}
+		frame = append(frame, mask...)
+		masked := make([]byte, len(payload))
+		for i := range payload {
+			masked[i] = payload[i] ^ mask[i%4]
+		}
+		payload = masked
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Conn.Write(append(frame, payload...))
+	return err
+}
@@ -0,0 +1,47 @@
+package wsframe
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccept_When_RFCSampleKey_Expect_RFCSampleAccept(t *testing.T) {
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", Accept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestConn_When_DataIsExchanged_Expect_PayloadStream(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	client := NewConn(clientSide, bufio.NewReader(clientSide), true)
+	server := NewConn(serverSide, bufio.NewReader(serverSide), false)
+	large := bytes.Repeat([]byte("x"), 70000)
+
+	go func() {
+		client.Write([]byte("ping"))
+		client.Write(large)
+		client.WriteFrame(OpClose, nil)
+	}()
+	p := make([]byte, 4)
+	_, err := io.ReadFull(server, p)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(p))
+	go ioutil.ReadAll(client)
+	received, err := ioutil.ReadAll(server)
+	assert.NoError(t, err)
+	assert.Equal(t, large, received)
+}
+
+func TestConn_When_ClientFrameIsUnmasked_Expect_Error(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	server := NewConn(serverSide, bufio.NewReader(serverSide), false)
+	// the server side doesn't mask its frames.
+	go NewConn(clientSide, bufio.NewReader(clientSide), false).Write([]byte("ping"))
+
+	_, err := server.Read(make([]byte, 4))
+	assert.EqualError(t, err, "received an unmasked websocket frame")
+}
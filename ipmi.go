@@ -0,0 +1,46 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+)
+
+// chassisActions are the ipmitool "chassis power" verbs that change the power
+// state, with the line ipmitool prints for them. Only "soft" involves the
+// operating system, off and cycle are hard like with ipmitool.
+var chassisActions = map[string]struct {
+	action PowerAction
+	output string
+}{
+	"on":    {PowerActionOn, "Chassis Power Control: Up/On"},
+	"off":   {PowerActionHardOff, "Chassis Power Control: Down/Off"},
+	"cycle": {PowerActionHardCycle, "Chassis Power Control: Cycle"},
+	"reset": {PowerActionReset, "Chassis Power Control: Reset"},
+	"diag":  {PowerActionDiag, "Chassis Power Control: Diag"},
+	"soft":  {PowerActionSoft, "Chassis Power Control: Soft"},
+}
+
+const chassisCommands = "status, on, off, cycle, reset, diag, soft"
+
+// chassisPower runs the ipmitool chassis power command and returns what
+// ipmitool would print.
+func chassisPower(ctx context.Context, client *Client, command string) (string, error) {
+	if command == "status" {
+		status, err := getPowerStatus(ctx, client)
+		if err != nil {
+			return "", err
+		}
+		if status.currentState == PowerStateOn {
+			return "Chassis Power is on", nil
+		}
+		return "Chassis Power is off", nil
+	}
+	c, ok := chassisActions[command]
+	if !ok {
+		return "", fmt.Errorf("invalid chassis power command %q, valid commands are %s", command, chassisCommands)
+	}
+	if _, err := executePowerAction(ctx, client, c.action); err != nil {
+		return "", err
+	}
+	return c.output, nil
+}
@@ -0,0 +1,50 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChassisPower_When_UnknownCommand_Expect_ValidCommandsListed(t *testing.T) {
+	client, err := NewClient(Connection{Host: "192.0.2.1"})
+	assert.NoError(t, err)
+
+	_, err = client.ChassisPower(context.Background(), "bounce")
+	assert.EqualError(t, err, `invalid chassis power command "bounce", valid commands are status, on, off, cycle, reset, diag, soft`)
+}
+
+func TestPlanTransition_When_ResetAndDiag_Expect_ResetAndNMIStates(t *testing.T) {
+	status := &powerStatus{
+		currentState:                  PowerStateOn,
+		AvailableRequestedpowerStates: []PowerState{PowerStateMasterBusResetGraceful, PowerStateDiagnosticInterruptNMI, PowerStateOffSoft},
+	}
+	plan, err := planTransition(quirks{}, status, PowerActionReset)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateMasterBusResetGraceful, plan.Request)
+	plan, err = planTransition(quirks{}, status, PowerActionDiag)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateDiagnosticInterruptNMI, plan.Request)
+	plan, err = planTransition(quirks{}, status, PowerActionSoft)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateUnknown, plan.Request)
+	assert.Contains(t, plan.Reason, "shut the machine down gracefully")
+}
+
+func TestChassisActions_When_OffAndCycle_Expect_NoGracefulStates(t *testing.T) {
+	available := []PowerState{}
+	for state := PowerStateOther; state <= PowerStateDiagnosticInterruptInit; state++ {
+		available = append(available, state)
+	}
+	for _, command := range []string{"off", "cycle"} {
+		// with every state available and none of them, where the standard ones are requested.
+		for _, states := range [][]PowerState{available, nil} {
+			status := &powerStatus{currentState: PowerStateOn, AvailableRequestedpowerStates: states}
+			plan, err := planTransition(quirks{}, status, chassisActions[command].action)
+			assert.NoError(t, err)
+			assert.NotEqual(t, PowerStateUnknown, plan.Request, command)
+			assert.False(t, plan.Request >= PowerStateOffSoftGraceful && plan.Request <= PowerStatePowerCycleOffHardGraceful, "%s requested %v", command, plan.Request)
+		}
+	}
+}
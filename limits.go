@@ -0,0 +1,97 @@
+package amt
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// Default limits of the WSMAN responses. Firmware responses are a few
+// kilobytes and about ten elements deep.
+const (
+	DefaultMaxResponseSize = 16 << 20
+	DefaultMaxElementDepth = 64
+)
+
+var (
+	// ErrResponseTooLarge is returned for responses larger than MaxResponseSize.
+	ErrResponseTooLarge = errors.New("wsman response is too large")
+	// ErrResponseTooDeep is returned for responses nesting elements deeper
+	// than MaxElementDepth.
+	ErrResponseTooDeep = errors.New("wsman response is nested too deep")
+)
+
+// limitTransport rejects responses over the size and element depth limits
+// before they are parsed, so a hostile or broken endpoint can't exhaust the
+// memory of the client.
+type limitTransport struct {
+	maxSize  int64
+	maxDepth int
+	next     http.RoundTripper
+}
+
+func newLimitTransport(maxSize int64, maxDepth int, next http.RoundTripper) *limitTransport {
+	if maxSize == 0 {
+		maxSize = DefaultMaxResponseSize
+	}
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxElementDepth
+	}
+	return &limitTransport{maxSize: maxSize, maxDepth: maxDepth, next: next}
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var body []byte
+	if t.maxSize > 0 {
+		body, err = ioutil.ReadAll(io.LimitReader(resp.Body, t.maxSize+1))
+		if err == nil && int64(len(body)) > t.maxSize {
+			err = fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, t.maxSize)
+		}
+	} else {
+		body, err = ioutil.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// WSMAN is posted, the gets are for the HTML pages of the web UI, whose
+	// unclosed elements aren't nested.
+	if t.maxDepth > 0 && req.Method != http.MethodGet {
+		if err := checkElementDepth(body, t.maxDepth); err != nil {
+			return nil, err
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// checkElementDepth returns ErrResponseTooDeep when elements of body nest
+// deeper than maxDepth. Malformed XML is left to the parser to report.
+func checkElementDepth(body []byte, maxDepth int) error {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return nil
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth > maxDepth {
+				return fmt.Errorf("%w: more than %d elements", ErrResponseTooDeep, maxDepth)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
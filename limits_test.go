@@ -0,0 +1,43 @@
+package amt
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitTransport_When_ResponseOverLimits_Expect_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deep":
+			w.Write([]byte(strings.Repeat("<a>", 10) + strings.Repeat("</a>", 10)))
+		case "/large":
+			w.Write([]byte("<a>" + strings.Repeat("x", 100) + "</a>"))
+		default:
+			w.Write([]byte("<a><b>ok</b></a>"))
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: newLimitTransport(100, 5, http.DefaultTransport)}
+
+	_, err := client.Post(server.URL+"/deep", "application/soap+xml", nil)
+	assert.True(t, errors.Is(err, ErrResponseTooDeep), "%v", err)
+	// the HTML pages of the web UI are got, their depth isn't checked.
+	resp, err := client.Get(server.URL + "/deep")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	_, err = client.Get(server.URL + "/large")
+	assert.True(t, errors.Is(err, ErrResponseTooLarge), "%v", err)
+
+	resp, err = client.Get(server.URL + "/ok")
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(t, "<a><b>ok</b></a>", string(body))
+	}
+}
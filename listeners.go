@@ -0,0 +1,133 @@
+package amt
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// AMT_WebUIService EnabledState values.
+const (
+	webUIEnabled  = 2
+	webUIDisabled = 3
+)
+
+// Listeners reports which network interfaces of the firmware are enabled
+// besides WS-Management. Disabling the unused ones reduces the attack surface
+// of the machine.
+type Listeners struct {
+	// WebUI is true when the web UI is served on port 16992/16993.
+	WebUI bool
+	// Redirection is true when the redirection listener (port 16994/16995)
+	// is enabled. SetFeatures enables it again when a feature is enabled.
+	Redirection bool
+	// PingResponse is true when the firmware answers ICMP echo requests.
+	PingResponse bool
+}
+
+// ListenersConfig is the desired state of the listeners.
+type ListenersConfig struct {
+	WebUI        bool
+	Redirection  bool
+	PingResponse bool
+	// NoRollback leaves the settings already changed when a later one fails,
+	// instead of restoring their prior values.
+	NoRollback bool
+}
+
+// Names of the settings of ApplyListeners.
+const (
+	listenerWebUI        = "web UI"
+	listenerRedirection  = "redirection listener"
+	listenerPingResponse = "ping response"
+)
+
+func getListeners(ctx context.Context, client *Client) (*Listeners, error) {
+	listeners, _, err := readListeners(ctx, client)
+	return listeners, err
+}
+
+// readListeners also tells whether the firmware has the AMT_WebUIService of
+// AMT 11 and newer. Older firmware disables the web UI with the WsmanOnlyMode
+// of AMT_GeneralSettings.
+func readListeners(ctx context.Context, client *Client) (*Listeners, bool, error) {
+	general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings))
+	if err != nil {
+		return nil, false, err
+	}
+	redirection, err := getInstance(ctx, client, client.resourceURI(ResourceAMTRedirectionService), "ListenerEnabled")
+	if err != nil {
+		return nil, false, err
+	}
+	webUI, err := getInstance(ctx, client, client.resourceURI(ResourceAMTWebUIService), "EnabledState")
+	if err != nil {
+		client.logger.V(1).Info("could not read the web UI service", "error", err.Error())
+		webUI = nil
+	}
+	return parseListeners(general, redirection, webUI), webUI != nil, nil
+}
+
+// parseListeners reads the web UI state from WsmanOnlyMode when webUI is nil.
+func parseListeners(general, redirection, webUI []*dom.Element) *Listeners {
+	listeners := &Listeners{
+		Redirection:  propertyContent(redirection, "ListenerEnabled") == "true",
+		PingResponse: propertyContent(general, "PingResponseEnabled") == "true",
+	}
+	if webUI == nil {
+		listeners.WebUI = propertyContent(general, "WsmanOnlyMode") != "true"
+	} else {
+		enabled, _ := strconv.Atoi(propertyContent(webUI, "EnabledState"))
+		listeners.WebUI = enabled == webUIEnabled
+	}
+	return listeners
+}
+
+func setListeners(ctx context.Context, client *Client, config ListenersConfig) (ApplyResult, error) {
+	current, webUIService, err := readListeners(ctx, client)
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	setWebUI := func(ctx context.Context, enabled bool) error {
+		if !webUIService {
+			_, err := updateInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings), "WsmanOnlyMode", strconv.FormatBool(!enabled))
+			return err
+		}
+		state := webUIDisabled
+		if enabled {
+			state = webUIEnabled
+		}
+		return requestStateChange(ctx, client, client.resourceURI(ResourceAMTWebUIService), state)
+	}
+	setBool := func(resource, name string) func(ctx context.Context, enabled bool) error {
+		return func(ctx context.Context, enabled bool) error {
+			_, err := updateInstance(ctx, client, client.resourceURI(resource), name, strconv.FormatBool(enabled))
+			return err
+		}
+	}
+
+	all := []struct {
+		name             string
+		current, desired bool
+		set              func(ctx context.Context, enabled bool) error
+	}{
+		{listenerWebUI, current.WebUI, config.WebUI, setWebUI},
+		{listenerRedirection, current.Redirection, config.Redirection, setBool(ResourceAMTRedirectionService, "ListenerEnabled")},
+		{listenerPingResponse, current.PingResponse, config.PingResponse, setBool(ResourceAMTGeneralSettings, "PingResponseEnabled")},
+	}
+	// settings already in the desired state are not written again.
+	steps := []featureStep{}
+	for _, setting := range all {
+		if setting.current == setting.desired {
+			continue
+		}
+		setting := setting
+		steps = append(steps, featureStep{
+			name:  setting.name,
+			apply: func(ctx context.Context) error { return setting.set(ctx, setting.desired) },
+			undo:  func(ctx context.Context) error { return setting.set(ctx, setting.current) },
+		})
+	}
+
+	return applySteps(ctx, client, OperationSetListeners, steps, !config.NoRollback)
+}
@@ -0,0 +1,30 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListeners_When_WebUIServiceDisabled_Expect_WebUIOff(t *testing.T) {
+	general := []*dom.Element{
+		dom.ElemC("PingResponseEnabled", ResourceAMTGeneralSettings, "true"),
+		dom.ElemC("WsmanOnlyMode", ResourceAMTGeneralSettings, "false"),
+	}
+	redirection := []*dom.Element{dom.ElemC("ListenerEnabled", ResourceAMTRedirectionService, "false")}
+	webUI := []*dom.Element{dom.ElemC("EnabledState", ResourceAMTWebUIService, "3")}
+	assert.Equal(t, &Listeners{PingResponse: true}, parseListeners(general, redirection, webUI))
+}
+
+func TestParseListeners_When_NoWebUIService_Expect_WsmanOnlyMode(t *testing.T) {
+	general := []*dom.Element{
+		dom.ElemC("PingResponseEnabled", ResourceAMTGeneralSettings, "false"),
+		dom.ElemC("WsmanOnlyMode", ResourceAMTGeneralSettings, "false"),
+	}
+	redirection := []*dom.Element{dom.ElemC("ListenerEnabled", ResourceAMTRedirectionService, "true")}
+	assert.Equal(t, &Listeners{WebUI: true, Redirection: true}, parseListeners(general, redirection, nil))
+
+	general[1].Content = []byte("true")
+	assert.False(t, parseListeners(general, redirection, nil).WebUI)
+}
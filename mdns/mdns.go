@@ -0,0 +1,377 @@
+// Package mdns discovers AMT devices that advertise themselves over multicast
+// DNS-SD, complementing probing address ranges in zero-config lab setups. The
+// firmware version of each candidate is read from the Server header of its
+// web server, which needs no credentials.
+package mdns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Service is the DNS-SD service type AMT devices advertise.
+const Service = "_amt._tcp.local."
+
+// Defaults of Options.
+const (
+	defaultTimeout = 3 * time.Second
+	defaultPort    = 16992
+)
+
+// serverPrefix starts the Server header of the web server of the firmware,
+// followed by the version, e.g. "Intel(R) Active Management Technology 11.8.50.3425".
+const serverPrefix = "Intel(R) Active Management Technology "
+
+// DNS record types.
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeTXT  = 16
+	typeAAAA = 28
+	typeSRV  = 33
+	classIN  = 1
+)
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// errMalformed is returned for DNS messages that could not be parsed.
+var errMalformed = errors.New("mdns: malformed message")
+
+// Options control Discover. Zero values use the defaults.
+type Options struct {
+	// Service is the DNS-SD service type queried, Service by default.
+	Service string
+	// Timeout is how long answers are collected, 3s by default.
+	Timeout time.Duration
+	// SkipVersion does not query the web server of the candidates for their version.
+	SkipVersion bool
+	// HTTPClient queries the versions, http.DefaultClient by default.
+	HTTPClient *http.Client
+}
+
+// Candidate is a device that answered the query.
+type Candidate struct {
+	// Instance is the DNS-SD instance name, e.g. "AMT-1234._amt._tcp.local.".
+	Instance string
+	// Host is the target host name, e.g. "amt-1234.local.".
+	Host  string
+	Addrs []net.IP
+	Port  uint16
+	// Text are the key/value pairs of the TXT record.
+	Text map[string]string
+	// Version is the firmware version, "" when it was skipped or unknown.
+	Version string
+}
+
+// Discover queries the local network for devices advertising options.Service
+// and returns the candidates that answered before the timeout.
+func Discover(ctx context.Context, options Options) ([]Candidate, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return discover(ctx, conn, mdnsAddr, options)
+}
+
+func discover(ctx context.Context, conn net.PacketConn, dst net.Addr, options Options) ([]Candidate, error) {
+	service := options.Service
+	if service == "" {
+		service = Service
+	}
+	service = fqdn(service)
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	collectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	query, err := buildQuery(service)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteTo(query, dst); err != nil {
+		return nil, err
+	}
+	go func() {
+		<-collectCtx.Done()
+		conn.SetReadDeadline(time.Now())
+	}()
+
+	var records []record
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if collectCtx.Err() != nil {
+				break
+			}
+			return nil, err
+		}
+		rs, err := parseMessage(buf[:n])
+		if err != nil {
+			// other responders share the multicast group, ignore their noise.
+			continue
+		}
+		records = append(records, rs...)
+	}
+
+	candidates := assemble(service, records)
+	if !options.SkipVersion {
+		client := options.HTTPClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		for i := range candidates {
+			candidates[i].Version = probeVersion(ctx, client, candidates[i])
+		}
+	}
+	return candidates, nil
+}
+
+// probeVersion returns the version in the Server header of the web server of
+// the candidate, or "".
+func probeVersion(ctx context.Context, client *http.Client, c Candidate) string {
+	if len(c.Addrs) == 0 {
+		return ""
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+	url := fmt.Sprintf("http://%s/", net.JoinHostPort(c.Addrs[0].String(), strconv.Itoa(int(port))))
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return ""
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return ""
+	}
+	response.Body.Close()
+	server := response.Header.Get("Server")
+	if !strings.HasPrefix(server, serverPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(server, serverPrefix))
+}
+
+// assemble joins the PTR records of service with the SRV, TXT and address
+// records of their instances.
+func assemble(service string, records []record) []Candidate {
+	byInstance := map[string]*Candidate{}
+	var instances []string
+	for _, r := range records {
+		if r.typ == typePTR && strings.EqualFold(r.name, service) {
+			if _, ok := byInstance[r.target]; !ok {
+				byInstance[r.target] = &Candidate{Instance: r.target, Text: map[string]string{}}
+				instances = append(instances, r.target)
+			}
+		}
+	}
+	addrs := map[string][]net.IP{}
+	for _, r := range records {
+		switch r.typ {
+		case typeSRV:
+			if c, ok := byInstance[r.name]; ok {
+				c.Host, c.Port = r.target, r.port
+			}
+		case typeTXT:
+			if c, ok := byInstance[r.name]; ok {
+				for k, v := range r.text {
+					c.Text[k] = v
+				}
+			}
+		case typeA, typeAAAA:
+			host := strings.ToLower(r.name)
+			if !containsIP(addrs[host], r.ip) {
+				addrs[host] = append(addrs[host], r.ip)
+			}
+		}
+	}
+	sort.Strings(instances)
+	candidates := make([]Candidate, 0, len(instances))
+	for _, instance := range instances {
+		c := byInstance[instance]
+		c.Addrs = addrs[strings.ToLower(c.Host)]
+		candidates = append(candidates, *c)
+	}
+	return candidates
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// record is a resource record of a response, with the fields of its type.
+type record struct {
+	name string
+	typ  uint16
+	// target is the name of a PTR or the target host of a SRV.
+	target string
+	port   uint16
+	text   map[string]string
+	ip     net.IP
+}
+
+// buildQuery builds the PTR query of name.
+func buildQuery(name string) ([]byte, error) {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[4:6], 1) // one question
+	msg, err := appendName(msg, name)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, 0, typePTR, 0, classIN)
+	return msg, nil
+}
+
+func appendName(msg []byte, name string) ([]byte, error) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("mdns: invalid name %q", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0), nil
+}
+
+// parseMessage returns the answer, authority and additional records of a
+// response.
+func parseMessage(msg []byte) ([]record, error) {
+	if len(msg) < 12 || msg[2]&0x80 == 0 {
+		return nil, errMalformed
+	}
+	questions := int(binary.BigEndian.Uint16(msg[4:6]))
+	count := int(binary.BigEndian.Uint16(msg[6:8])) + int(binary.BigEndian.Uint16(msg[8:10])) + int(binary.BigEndian.Uint16(msg[10:12]))
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+	var records []record
+	for i := 0; i < count; i++ {
+		name, next, err := readName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errMalformed
+		}
+		r := record{name: name, typ: binary.BigEndian.Uint16(msg[next : next+2])}
+		length := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		start := next + 10
+		end := start + length
+		if end > len(msg) {
+			return nil, errMalformed
+		}
+		switch r.typ {
+		case typePTR:
+			if r.target, _, err = readName(msg, start); err != nil {
+				return nil, err
+			}
+		case typeSRV:
+			if length < 7 {
+				return nil, errMalformed
+			}
+			r.port = binary.BigEndian.Uint16(msg[start+4 : start+6])
+			if r.target, _, err = readName(msg, start+6); err != nil {
+				return nil, err
+			}
+		case typeTXT:
+			r.text = parseText(msg[start:end])
+		case typeA, typeAAAA:
+			if length != net.IPv4len && length != net.IPv6len {
+				return nil, errMalformed
+			}
+			r.ip = net.IP(append([]byte{}, msg[start:end]...))
+		}
+		records = append(records, r)
+		offset = end
+	}
+	return records, nil
+}
+
+// readName reads the possibly compressed name at offset and returns it with
+// the offset following it.
+func readName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errMalformed
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) || jumps > 16 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:offset+2]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+// parseText parses the key=value strings of a TXT record.
+func parseText(data []byte) map[string]string {
+	text := map[string]string{}
+	for len(data) > 0 {
+		length := int(data[0])
+		if 1+length > len(data) {
+			break
+		}
+		entry := string(data[1 : 1+length])
+		data = data[1+length:]
+		if entry == "" {
+			continue
+		}
+		key, value := entry, ""
+		if i := strings.Index(entry, "="); i >= 0 {
+			key, value = entry[:i], entry[i+1:]
+		}
+		text[strings.ToLower(key)] = value
+	}
+	return text
+}
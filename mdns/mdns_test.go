@@ -0,0 +1,80 @@
+package mdns
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// appendRecord appends a resource record with rdata to msg.
+func appendRecord(t *testing.T, msg []byte, name string, typ uint16, rdata []byte) []byte {
+	msg, err := appendName(msg, name)
+	assert.NoError(t, err)
+	header := make([]byte, 10)
+	binary.BigEndian.PutUint16(header[0:2], typ)
+	binary.BigEndian.PutUint16(header[2:4], classIN)
+	binary.BigEndian.PutUint32(header[4:8], 120)
+	binary.BigEndian.PutUint16(header[8:10], uint16(len(rdata)))
+	return append(append(msg, header...), rdata...)
+}
+
+func TestDiscover_When_DeviceAnswers_Expect_CandidateWithVersion(t *testing.T) {
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "Intel(R) Active Management Technology 11.8.50.3425")
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer web.Close()
+	_, portString, _ := net.SplitHostPort(web.Listener.Addr().String())
+	port, _ := net.LookupPort("tcp", portString)
+
+	responder, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer responder.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, from, err := responder.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query, _ := buildQuery(Service)
+		if string(buf[:n]) != string(query) {
+			return
+		}
+		msg := []byte{0, 0, 0x84, 0, 0, 0, 0, 4, 0, 0, 0, 0}
+		instance, _ := appendName(nil, "AMT-1234._amt._tcp.local.")
+		msg = appendRecord(t, msg, Service, typePTR, instance)
+		srv := []byte{0, 0, 0, 0, byte(port >> 8), byte(port)}
+		srv, _ = appendName(srv, "amt-1234.local.")
+		msg = appendRecord(t, msg, "AMT-1234._amt._tcp.local.", typeSRV, srv)
+		msg = appendRecord(t, msg, "AMT-1234._amt._tcp.local.", typeTXT, append([]byte{7}, "tls=yes"...))
+		msg = appendRecord(t, msg, "amt-1234.local.", typeA, net.IPv4(127, 0, 0, 1).To4())
+		responder.WriteTo(msg, from)
+	}()
+
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	candidates, err := discover(context.Background(), conn, responder.LocalAddr(), Options{Timeout: 200 * time.Millisecond})
+	assert.NoError(t, err)
+	if assert.Len(t, candidates, 1) {
+		c := candidates[0]
+		assert.Equal(t, "AMT-1234._amt._tcp.local.", c.Instance)
+		assert.Equal(t, "amt-1234.local.", c.Host)
+		assert.Equal(t, uint16(port), c.Port)
+		assert.Equal(t, "yes", c.Text["tls"])
+		assert.True(t, c.Addrs[0].Equal(net.IPv4(127, 0, 0, 1)))
+		assert.Equal(t, "11.8.50.3425", c.Version)
+	}
+}
+
+func TestParseMessage_When_CompressionLoops_Expect_Error(t *testing.T) {
+	msg := []byte{0, 0, 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0xc0, 12}
+	_, err := parseMessage(msg)
+	assert.Equal(t, errMalformed, err)
+}
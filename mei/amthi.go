@@ -0,0 +1,384 @@
+package mei
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AMTHI command codes. Responses carry the same code with responseFlag set.
+const (
+	commandUnprovision                     = 0x04000010
+	commandGetProvisioningState            = 0x04000011
+	commandGetCodeVersions                 = 0x0400001A
+	commandGetDNSSuffix                    = 0x04000036
+	commandOpenUserInitiatedConnection     = 0x04000044
+	commandCloseUserInitiatedConnection    = 0x04000045
+	commandGetRemoteAccessConnectionStatus = 0x04000046
+	commandGetLANInterfaceSettings         = 0x04000048
+	commandGetUUID                         = 0x0400005C
+	commandGetLocalSystemAccount           = 0x04000067
+	commandGetControlMode                  = 0x0400006B
+	responseFlag                           = 0x00800000
+	headerSize                             = 12
+	maxACLUserLength                       = 33
+	amthiMajorVersion                      = 1
+	amthiMinorVersion                      = 1
+	unicodeStringLength                    = 20
+	maxCodeVersions                        = 50
+	biosVersionLength                      = 65
+	statusSuccess                          = 0
+)
+
+const (
+	lanInterfaceWired    uint32 = 0
+	lanInterfaceWireless uint32 = 1
+)
+
+// ProvisioningState of the AMT firmware.
+type ProvisioningState uint32
+
+// Provisioning states reported by the firmware.
+const (
+	ProvisioningStatePre  ProvisioningState = 0
+	ProvisioningStateIn   ProvisioningState = 1
+	ProvisioningStatePost ProvisioningState = 2
+)
+
+func (p ProvisioningState) String() string {
+	switch p {
+	case ProvisioningStatePre:
+		return "pre-provisioning"
+	case ProvisioningStateIn:
+		return "in-provisioning"
+	case ProvisioningStatePost:
+		return "post-provisioning"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(p))
+}
+
+// ControlMode AMT was activated in.
+type ControlMode uint32
+
+// Control modes reported by the firmware.
+const (
+	ControlModePreProvisioning ControlMode = 0
+	ControlModeClient          ControlMode = 1
+	ControlModeAdmin           ControlMode = 2
+)
+
+func (c ControlMode) String() string {
+	switch c {
+	case ControlModePreProvisioning:
+		return "pre-provisioning"
+	case ControlModeClient:
+		return "client control mode"
+	case ControlModeAdmin:
+		return "admin control mode"
+	}
+	return fmt.Sprintf("unknown(%d)", uint32(c))
+}
+
+// CodeVersions holds the firmware component versions.
+type CodeVersions struct {
+	BIOS     string
+	Versions map[string]string
+}
+
+// AMT returns the AMT firmware version.
+func (c *CodeVersions) AMT() string {
+	return c.Versions["AMT"]
+}
+
+// Build returns the AMT firmware build number.
+func (c *CodeVersions) Build() string {
+	return c.Versions["Build Number"]
+}
+
+// SKU returns the AMT firmware SKU.
+func (c *CodeVersions) SKU() string {
+	return c.Versions["Sku"]
+}
+
+// RemoteAccessStatus is the state of the CIRA connection to an MPS.
+type RemoteAccessStatus struct {
+	NetworkInterface uint32
+	// Status is one of RemoteAccessNotConnected, RemoteAccessConnecting and
+	// RemoteAccessConnected.
+	Status      uint32
+	Trigger     uint32
+	MPSHostname string
+}
+
+// RemoteAccessStatus Status values.
+const (
+	RemoteAccessNotConnected uint32 = 0
+	RemoteAccessConnecting   uint32 = 1
+	RemoteAccessConnected    uint32 = 2
+)
+
+// Connected reports whether the CIRA tunnel to the MPS is up.
+func (s *RemoteAccessStatus) Connected() bool {
+	return s.Status == RemoteAccessConnected
+}
+
+// LANInterfaceSettings of the wired or wireless AMT network interface.
+type LANInterfaceSettings struct {
+	Enabled     bool
+	IPAddress   net.IP
+	DHCPEnabled bool
+	DHCPIPMode  uint8
+	LinkUp      bool
+	MACAddress  net.HardwareAddr
+}
+
+type messenger interface {
+	Read(p []byte) (int, error)
+	Write(p []byte) (int, error)
+	MaxMessageLength() int
+	Close() error
+}
+
+// HostInterface is a connection to the AMT Host Interface (AMTHI) client.
+type HostInterface struct {
+	conn messenger
+}
+
+// OpenHostInterface connects to the AMTHI client of the MEI device at path.
+func OpenHostInterface(path string) (*HostInterface, error) {
+	dev, err := Open(path, AMTHI)
+	if err != nil {
+		return nil, err
+	}
+	return &HostInterface{conn: dev}, nil
+}
+
+// Close the connection.
+func (h *HostInterface) Close() error {
+	return h.conn.Close()
+}
+
+func (h *HostInterface) call(command uint32, body []byte) ([]byte, error) {
+	request := make([]byte, headerSize+len(body))
+	request[0] = amthiMajorVersion
+	request[1] = amthiMinorVersion
+	binary.LittleEndian.PutUint32(request[4:8], command)
+	binary.LittleEndian.PutUint32(request[8:12], uint32(len(body)))
+	copy(request[headerSize:], body)
+	if _, err := h.conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	size := h.conn.MaxMessageLength()
+	if size < headerSize+4 {
+		size = 4096
+	}
+	response := make([]byte, size)
+	n, err := h.conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+	response = response[:n]
+	if len(response) < headerSize+4 {
+		return nil, fmt.Errorf("short response to amthi command 0x%08x: %d bytes", command, len(response))
+	}
+	if code := binary.LittleEndian.Uint32(response[4:8]); code != command|responseFlag {
+		return nil, fmt.Errorf("unexpected response 0x%08x to amthi command 0x%08x", code, command)
+	}
+	if status := binary.LittleEndian.Uint32(response[headerSize : headerSize+4]); status != statusSuccess {
+		return nil, fmt.Errorf("amthi command 0x%08x failed with status %d", command, status)
+	}
+	return response[headerSize+4:], nil
+}
+
+func (h *HostInterface) callUint32(command uint32) (uint32, error) {
+	data, err := h.call(command, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 4 {
+		return 0, fmt.Errorf("short response to amthi command 0x%08x", command)
+	}
+	return binary.LittleEndian.Uint32(data), nil
+}
+
+// ProvisioningState returns the provisioning state of the firmware.
+func (h *HostInterface) ProvisioningState() (ProvisioningState, error) {
+	state, err := h.callUint32(commandGetProvisioningState)
+	return ProvisioningState(state), err
+}
+
+// ControlMode returns the mode AMT was activated in.
+func (h *HostInterface) ControlMode() (ControlMode, error) {
+	mode, err := h.callUint32(commandGetControlMode)
+	return ControlMode(mode), err
+}
+
+// UUID returns the platform UUID.
+func (h *HostInterface) UUID() (string, error) {
+	data, err := h.call(commandGetUUID, nil)
+	if err != nil {
+		return "", err
+	}
+	var g GUID
+	if len(data) < len(g) {
+		return "", fmt.Errorf("short response to get uuid")
+	}
+	copy(g[:], data)
+	return strings.ToLower(g.String()), nil
+}
+
+// DNSSuffix returns the DNS suffix configured in the firmware.
+func (h *HostInterface) DNSSuffix() (string, error) {
+	data, err := h.call(commandGetDNSSuffix, nil)
+	if err != nil {
+		return "", err
+	}
+	s, _, err := readAnsiString(data)
+	return s, err
+}
+
+// CodeVersions returns the BIOS and firmware component versions.
+func (h *HostInterface) CodeVersions() (*CodeVersions, error) {
+	data, err := h.call(commandGetCodeVersions, nil)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(data)
+	var raw struct {
+		BIOS     [biosVersionLength]byte
+		Count    uint32
+		Versions [maxCodeVersions]struct {
+			DescriptionLength uint16
+			Description       [unicodeStringLength]byte
+			VersionLength     uint16
+			Version           [unicodeStringLength]byte
+		}
+	}
+	if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+		return nil, fmt.Errorf("could not decode code versions: %v", err)
+	}
+	versions := &CodeVersions{
+		BIOS:     cString(raw.BIOS[:]),
+		Versions: map[string]string{},
+	}
+	if raw.Count > maxCodeVersions {
+		raw.Count = maxCodeVersions
+	}
+	for _, v := range raw.Versions[:raw.Count] {
+		versions.Versions[boundedString(v.Description[:], v.DescriptionLength)] = boundedString(v.Version[:], v.VersionLength)
+	}
+	return versions, nil
+}
+
+// LocalSystemAccount returns the credentials of the local system account,
+// which can be used to talk WSMAN to an unprovisioned firmware from the host.
+func (h *HostInterface) LocalSystemAccount() (username string, password string, err error) {
+	data, err := h.call(commandGetLocalSystemAccount, make([]byte, 40))
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) < 2*maxACLUserLength {
+		return "", "", fmt.Errorf("short response to get local system account")
+	}
+	return cString(data[:maxACLUserLength]), cString(data[maxACLUserLength : 2*maxACLUserLength]), nil
+}
+
+// RemoteAccessStatus returns the state of the CIRA connection.
+func (h *HostInterface) RemoteAccessStatus() (*RemoteAccessStatus, error) {
+	data, err := h.call(commandGetRemoteAccessConnectionStatus, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 {
+		return nil, fmt.Errorf("short response to get remote access connection status")
+	}
+	hostname, _, err := readAnsiString(data[12:])
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteAccessStatus{
+		NetworkInterface: binary.LittleEndian.Uint32(data[0:4]),
+		Status:           binary.LittleEndian.Uint32(data[4:8]),
+		Trigger:          binary.LittleEndian.Uint32(data[8:12]),
+		MPSHostname:      hostname,
+	}, nil
+}
+
+// OpenUserInitiatedConnection asks the firmware to open a CIRA connection to
+// its MPS, e.g. before a remote session. User initiated connections must be
+// enabled, see amt.Client.SetUserInitiatedConnections. The firmware connects
+// in the background, poll RemoteAccessStatus to know when the tunnel is up.
+func (h *HostInterface) OpenUserInitiatedConnection() error {
+	_, err := h.call(commandOpenUserInitiatedConnection, nil)
+	return err
+}
+
+// CloseUserInitiatedConnection closes the CIRA connection opened with
+// OpenUserInitiatedConnection.
+func (h *HostInterface) CloseUserInitiatedConnection() error {
+	_, err := h.call(commandCloseUserInitiatedConnection, nil)
+	return err
+}
+
+// LANInterfaceSettings returns the settings of the wired or wireless interface.
+func (h *HostInterface) LANInterfaceSettings(wireless bool) (*LANInterfaceSettings, error) {
+	body := make([]byte, 4)
+	if wireless {
+		binary.LittleEndian.PutUint32(body, lanInterfaceWireless)
+	} else {
+		binary.LittleEndian.PutUint32(body, lanInterfaceWired)
+	}
+	data, err := h.call(commandGetLANInterfaceSettings, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 20 {
+		return nil, fmt.Errorf("short response to get lan interface settings")
+	}
+	ip := binary.LittleEndian.Uint32(data[4:8])
+	return &LANInterfaceSettings{
+		Enabled:     binary.LittleEndian.Uint32(data[0:4]) != 0,
+		IPAddress:   net.IPv4(byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip)),
+		DHCPEnabled: binary.LittleEndian.Uint32(data[8:12]) != 0,
+		DHCPIPMode:  data[12],
+		LinkUp:      data[13] != 0,
+		MACAddress:  net.HardwareAddr(append([]byte{}, data[14:20]...)),
+	}, nil
+}
+
+// Unprovision returns the firmware to the pre-provisioning state. Only
+// allowed while in client control mode.
+func (h *HostInterface) Unprovision() error {
+	body := make([]byte, 4)
+	binary.LittleEndian.PutUint32(body, 1)
+	_, err := h.call(commandUnprovision, body)
+	return err
+}
+
+func readAnsiString(data []byte) (string, int, error) {
+	if len(data) < 2 {
+		return "", 0, fmt.Errorf("short ansi string")
+	}
+	length := int(binary.LittleEndian.Uint16(data))
+	if len(data) < 2+length {
+		return "", 0, fmt.Errorf("ansi string length %d exceeds response", length)
+	}
+	return cString(data[2 : 2+length]), 2 + length, nil
+}
+
+func boundedString(b []byte, length uint16) string {
+	if int(length) < len(b) {
+		b = b[:length]
+	}
+	return cString(b)
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
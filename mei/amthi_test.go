@@ -0,0 +1,88 @@
+package mei
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeMessenger struct {
+	written  []byte
+	response []byte
+}
+
+func (f *fakeMessenger) Write(p []byte) (int, error) {
+	f.written = append([]byte{}, p...)
+	return len(p), nil
+}
+
+func (f *fakeMessenger) Read(p []byte) (int, error) {
+	return copy(p, f.response), nil
+}
+
+func (f *fakeMessenger) MaxMessageLength() int { return 4096 }
+
+func (f *fakeMessenger) Close() error { return nil }
+
+func makeResponse(command uint32, status uint32, data []byte) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{amthiMajorVersion, amthiMinorVersion, 0, 0})
+	binary.Write(&b, binary.LittleEndian, command|responseFlag)
+	binary.Write(&b, binary.LittleEndian, uint32(4+len(data)))
+	binary.Write(&b, binary.LittleEndian, status)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestGUID_When_Parsed_Expect_RoundTrip(t *testing.T) {
+	g, err := ParseGUID("12F80028-B4B7-4B2D-ACA8-46E0FF65814C")
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x28), g[0])
+	assert.Equal(t, "12F80028-B4B7-4B2D-ACA8-46E0FF65814C", g.String())
+}
+
+func TestControlMode_When_StatusSuccess_Expect_Mode(t *testing.T) {
+	m := &fakeMessenger{response: makeResponse(commandGetControlMode, statusSuccess, []byte{2, 0, 0, 0})}
+	h := &HostInterface{conn: m}
+	mode, err := h.ControlMode()
+	assert.NoError(t, err)
+	assert.Equal(t, ControlModeAdmin, mode)
+	assert.Equal(t, uint32(commandGetControlMode), binary.LittleEndian.Uint32(m.written[4:8]))
+}
+
+func TestControlMode_When_StatusFailure_Expect_Error(t *testing.T) {
+	m := &fakeMessenger{response: makeResponse(commandGetControlMode, 1, nil)}
+	h := &HostInterface{conn: m}
+	_, err := h.ControlMode()
+	assert.Error(t, err)
+}
+
+func TestOpenUserInitiatedConnection_When_StatusSuccess_Expect_Command(t *testing.T) {
+	m := &fakeMessenger{response: makeResponse(commandOpenUserInitiatedConnection, statusSuccess, nil)}
+	h := &HostInterface{conn: m}
+	assert.NoError(t, h.OpenUserInitiatedConnection())
+	assert.Equal(t, uint32(commandOpenUserInitiatedConnection), binary.LittleEndian.Uint32(m.written[4:8]))
+	assert.Len(t, m.written, headerSize)
+}
+
+func TestRemoteAccessStatus_When_Connected_Expect_Connected(t *testing.T) {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data[4:8], RemoteAccessConnected)
+	data = append(data, 3, 0, 'm', 'p', 's')
+	m := &fakeMessenger{response: makeResponse(commandGetRemoteAccessConnectionStatus, statusSuccess, data)}
+	h := &HostInterface{conn: m}
+	status, err := h.RemoteAccessStatus()
+	if assert.NoError(t, err) {
+		assert.True(t, status.Connected())
+		assert.Equal(t, "mps", status.MPSHostname)
+	}
+}
+
+func TestDNSSuffix_When_LengthExceedsResponse_Expect_Error(t *testing.T) {
+	m := &fakeMessenger{response: makeResponse(commandGetDNSSuffix, statusSuccess, []byte{10, 0, 'a'})}
+	h := &HostInterface{conn: m}
+	_, err := h.DNSSuffix()
+	assert.Error(t, err)
+}
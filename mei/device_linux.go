@@ -0,0 +1,61 @@
+package mei
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// _IOWR('H', 0x01, struct mei_connect_client_data)
+const ioctlConnectClient = 0xC0104801
+
+// Device is an open connection to a single Management Engine client.
+type Device struct {
+	file          *os.File
+	maxMessageLen int
+}
+
+// Open opens the MEI device at path and connects to the given client.
+func Open(path string, client GUID) (*Device, error) {
+	if path == "" {
+		path = DefaultDevicePath
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	// in: the client uuid. out: max_msg_length (u32), protocol_version (u8), reserved.
+	var data [16]byte
+	copy(data[:], client[:])
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), ioctlConnectClient, uintptr(unsafe.Pointer(&data[0])))
+	if errno != 0 {
+		f.Close()
+		return nil, fmt.Errorf("could not connect to me client %v: %v", client, errno)
+	}
+	return &Device{
+		file:          f,
+		maxMessageLen: int(binary.LittleEndian.Uint32(data[0:4])),
+	}, nil
+}
+
+// MaxMessageLength is the largest message the connected client accepts.
+func (d *Device) MaxMessageLength() int {
+	return d.maxMessageLen
+}
+
+// Write sends a single message to the client.
+func (d *Device) Write(p []byte) (int, error) {
+	return d.file.Write(p)
+}
+
+// Read reads a single message from the client. p should be at least MaxMessageLength bytes.
+func (d *Device) Read(p []byte) (int, error) {
+	return d.file.Read(p)
+}
+
+// Close the connection to the client.
+func (d *Device) Close() error {
+	return d.file.Close()
+}
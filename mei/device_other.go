@@ -0,0 +1,31 @@
+//go:build !linux
+
+package mei
+
+// Device is an open connection to a single Management Engine client.
+type Device struct{}
+
+// Open opens the MEI device at path and connects to the given client.
+func Open(path string, client GUID) (*Device, error) {
+	return nil, ErrUnsupported
+}
+
+// MaxMessageLength is the largest message the connected client accepts.
+func (d *Device) MaxMessageLength() int {
+	return 0
+}
+
+// Write sends a single message to the client.
+func (d *Device) Write(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// Read reads a single message from the client.
+func (d *Device) Read(p []byte) (int, error) {
+	return 0, ErrUnsupported
+}
+
+// Close the connection to the client.
+func (d *Device) Close() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package mei
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/jacobweinstock/go-amt/apf"
+)
+
+// apfHeaderSize is the size of a CHANNEL_DATA message without its payload.
+const apfHeaderSize = 9
+
+// messageStream adapts a Device, which reads and writes whole messages, to a byte stream.
+type messageStream struct {
+	dev     *Device
+	buf     []byte
+	pending []byte
+}
+
+func (m *messageStream) Read(p []byte) (int, error) {
+	if len(m.pending) == 0 {
+		n, err := m.dev.Read(m.buf)
+		if err != nil {
+			return 0, err
+		}
+		m.pending = m.buf[:n]
+	}
+	n := copy(p, m.pending)
+	m.pending = m.pending[n:]
+	return n, nil
+}
+
+func (m *messageStream) Write(p []byte) (int, error) {
+	return m.dev.Write(p)
+}
+
+func (m *messageStream) Close() error {
+	return m.dev.Close()
+}
+
+// Dialer opens connections to the network services of the firmware (WSMAN on
+// 16992 and friends) through the LME client. It lets a process on the managed
+// host talk to AMT when LMS isn't installed.
+type Dialer struct {
+	// Path of the MEI device. DefaultDevicePath is used when empty.
+	Path string
+
+	mu      sync.Mutex
+	session *apf.Session
+}
+
+// DialContext opens a channel to the port in address. The host part is ignored,
+// the firmware is always the other end.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	_, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %v", portString, err)
+	}
+	s, err := d.getSession()
+	if err != nil {
+		return nil, err
+	}
+	return s.OpenChannel(ctx, "127.0.0.1", uint32(port))
+}
+
+// Close the connection to the LME client.
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session == nil {
+		return nil
+	}
+	err := d.session.Close()
+	d.session = nil
+	return err
+}
+
+func (d *Dialer) getSession() (*apf.Session, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.session != nil {
+		select {
+		case <-d.session.Done():
+			d.session = nil
+		default:
+			return d.session, nil
+		}
+	}
+	dev, err := Open(d.Path, LME)
+	if err != nil {
+		return nil, err
+	}
+	size := dev.MaxMessageLength()
+	if size <= apfHeaderSize {
+		size = 4096
+	}
+	s := apf.NewSession(&messageStream{dev: dev, buf: make([]byte, size)}, apf.Config{
+		MaxPacket: size - apfHeaderSize,
+	})
+	go s.Serve()
+	if err := s.Send(&apf.ProtocolVersion{Major: 1, Minor: 0, TriggerReason: apf.TriggerReasonLocal}); err != nil {
+		s.Close()
+		return nil, err
+	}
+	d.session = s
+	return s, nil
+}
+
+// Transport is an http.RoundTripper that carries requests over the LME client
+// of a MEI device. It holds the device and a session with the firmware until
+// it is closed.
+type Transport struct {
+	*http.Transport
+	dialer *Dialer
+}
+
+// NewTransport returns a Transport over the LME client of the MEI device at
+// path. Use it as the Transport of an amt.Connection to Host "localhost" to use
+// the library in-band without LMS, and close it when done.
+func NewTransport(path string) *Transport {
+	d := &Dialer{Path: path}
+	return &Transport{
+		Transport: &http.Transport{
+			DialContext:       d.DialContext,
+			DisableKeepAlives: true,
+			MaxConnsPerHost:   1,
+		},
+		dialer: d,
+	}
+}
+
+// Close closes the connections and releases the MEI device. A later request
+// opens it again.
+func (t *Transport) Close() error {
+	t.CloseIdleConnections()
+	return t.dialer.Close()
+}
@@ -0,0 +1,23 @@
+package mei
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/jacobweinstock/go-amt/apf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport_When_Closed_Expect_DeviceReleased(t *testing.T) {
+	device, firmware := net.Pipe()
+	transport := NewTransport("")
+	transport.dialer.session = apf.NewSession(device, apf.Config{})
+	router := &Router{route: RouteMEI, transport: transport}
+
+	assert.NoError(t, router.Close())
+	assert.Nil(t, transport.dialer.session)
+	// the firmware side sees the device closed.
+	_, err := ioutil.ReadAll(firmware)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,82 @@
+// Package mei talks to the Intel Management Engine Interface (MEI, also known
+// as HECI) of the machine it is running on. It is used for the local flows
+// (host based activation, local information queries) that do not go over the
+// network.
+package mei
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultDevicePath is the MEI character device on Linux.
+const DefaultDevicePath = "/dev/mei0"
+
+// ErrUnsupported is returned when the MEI device is not available on the current platform.
+var ErrUnsupported = errors.New("mei: not supported on this platform")
+
+// GUID identifies a Management Engine client.
+type GUID [16]byte
+
+var (
+	// AMTHI is the Intel AMT Host Interface client, used for local queries and commands.
+	AMTHI = MustParseGUID("12F80028-B4B7-4B2D-ACA8-46E0FF65814C")
+	// LME is the Local Manageability Engine client, used to tunnel WSMAN traffic without LMS.
+	LME = MustParseGUID("6733A4DB-0476-4E7B-B3AF-BCFC29BEE7A7")
+)
+
+// ParseGUID parses a GUID in its canonical string form. The first three groups
+// are stored little endian, which is the layout the MEI driver expects.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	parts := strings.Split(s, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return g, fmt.Errorf("invalid guid %q", s)
+	}
+	a, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return g, fmt.Errorf("invalid guid %q: %v", s, err)
+	}
+	b, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return g, fmt.Errorf("invalid guid %q: %v", s, err)
+	}
+	c, err := strconv.ParseUint(parts[2], 16, 16)
+	if err != nil {
+		return g, fmt.Errorf("invalid guid %q: %v", s, err)
+	}
+	binary.LittleEndian.PutUint32(g[0:4], uint32(a))
+	binary.LittleEndian.PutUint16(g[4:6], uint16(b))
+	binary.LittleEndian.PutUint16(g[6:8], uint16(c))
+	rest := parts[3] + parts[4]
+	for i := 0; i < 8; i++ {
+		v, err := strconv.ParseUint(rest[i*2:i*2+2], 16, 8)
+		if err != nil {
+			return g, fmt.Errorf("invalid guid %q: %v", s, err)
+		}
+		g[8+i] = byte(v)
+	}
+	return g, nil
+}
+
+// MustParseGUID is like ParseGUID but panics on error.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// String returns the canonical form of the GUID.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10],
+		g[10:16])
+}
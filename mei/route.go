@@ -0,0 +1,154 @@
+package mei
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Addresses LMS listens on for WSMAN when it's installed on the host.
+const (
+	lmsAddress    = "127.0.0.1:16992"
+	lmsTLSAddress = "127.0.0.1:16993"
+)
+
+// lmsDialTimeout bounds the check for LMS, which answers at once when it runs.
+const lmsDialTimeout = time.Second
+
+// Route is how the firmware is reached.
+type Route int
+
+// Routes to the firmware, from the most to the least preferred on the host.
+const (
+	// RouteLMS goes through the Local Manageability Service on localhost.
+	RouteLMS Route = iota + 1
+	// RouteMEI goes through the LME client of the MEI device, see NewTransport.
+	RouteMEI
+	// RouteNetwork goes over the network, the host has no local interface.
+	RouteNetwork
+)
+
+func (r Route) String() string {
+	switch r {
+	case RouteLMS:
+		return "LMS"
+	case RouteMEI:
+		return "MEI"
+	case RouteNetwork:
+		return "network"
+	}
+	return "unknown"
+}
+
+// Detect returns how the firmware of this host is reached locally: RouteLMS
+// when LMS listens on localhost, RouteMEI when the MEI device at path
+// (DefaultDevicePath when empty) opens, and RouteNetwork otherwise.
+func Detect(ctx context.Context, path string) Route {
+	return detect(ctx, path, lmsAddress)
+}
+
+func detect(ctx context.Context, path, lms string) Route {
+	dialer := &net.Dialer{Timeout: lmsDialTimeout}
+	if conn, err := dialer.DialContext(ctx, "tcp", lms); err == nil {
+		conn.Close()
+		return RouteLMS
+	}
+	// LMS holds the LME client while it runs, so this is only tried without it.
+	if path == "" {
+		path = DefaultDevicePath
+	}
+	if dev, err := Open(path, LME); err == nil {
+		dev.Close()
+		return RouteMEI
+	}
+	return RouteNetwork
+}
+
+// Router is an http.RoundTripper for tools that run either on the managed
+// host or remotely: it carries the requests over the local interface of the
+// host, LMS or else MEI, when there is one and over Network otherwise. Use it
+// as the Transport of an amt.Connection whose Host is the network address of
+// the firmware. The route is detected on the first request and kept. Close it
+// when done, it holds the MEI device on RouteMEI.
+type Router struct {
+	// Path of the MEI device. DefaultDevicePath is used when empty.
+	Path string
+	// Network carries the requests when the host has no local interface.
+	// http.DefaultTransport is used when nil.
+	Network http.RoundTripper
+
+	mu        sync.Mutex
+	route     Route
+	transport http.RoundTripper
+	// lms is the address of LMS, lmsAddress unless testing.
+	lms string
+}
+
+// Route returns the route of the requests, detecting it if needed.
+func (r *Router) Route(ctx context.Context) Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detect(ctx)
+	return r.route
+}
+
+func (r *Router) detect(ctx context.Context) {
+	if r.route != 0 {
+		return
+	}
+	lms := r.lms
+	if lms == "" {
+		lms = lmsAddress
+	}
+	r.route = detect(ctx, r.Path, lms)
+	switch r.route {
+	case RouteLMS:
+		// like the default transport of amt.Client, LMS presents the
+		// self-signed certificate of the firmware.
+		r.transport = &lmsTransport{address: lms, next: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	case RouteMEI:
+		r.transport = NewTransport(r.Path)
+	default:
+		r.transport = r.Network
+		if r.transport == nil {
+			r.transport = http.DefaultTransport
+		}
+	}
+}
+
+// RoundTrip sends req over the detected route.
+func (r *Router) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	r.detect(req.Context())
+	transport := r.transport
+	r.mu.Unlock()
+	return transport.RoundTrip(req)
+}
+
+// Close releases the MEI device when the requests go through it.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.transport.(*Transport); ok {
+		return t.Close()
+	}
+	return nil
+}
+
+// lmsTransport sends the requests to LMS whatever their host.
+type lmsTransport struct {
+	address string
+	next    http.RoundTripper
+}
+
+func (t *lmsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Host = t.address
+	if req.URL.Scheme == "https" && t.address == lmsAddress {
+		req.URL.Host = lmsTLSAddress
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,59 @@
+package mei
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingTransport struct {
+	hosts []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.hosts = append(t.hosts, req.URL.Host)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestRouter_When_LMSListens_Expect_RequestsToLMS(t *testing.T) {
+	var hosts []string
+	lms := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+	}))
+	defer lms.Close()
+	network := &recordingTransport{}
+	router := &Router{Network: network, lms: strings.TrimPrefix(lms.URL, "http://")}
+
+	resp, err := (&http.Client{Transport: router}).Get("http://192.0.2.1:16992/wsman")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, RouteLMS, router.Route(context.Background()))
+	assert.Len(t, hosts, 1)
+	assert.Empty(t, network.hosts)
+}
+
+func TestRouter_When_NoLocalInterface_Expect_Network(t *testing.T) {
+	// a closed port on the loopback.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	closed := listener.Addr().String()
+	listener.Close()
+	network := &recordingTransport{}
+	router := &Router{Path: filepath.Join(t.TempDir(), "mei0"), Network: network, lms: closed}
+
+	resp, err := (&http.Client{Transport: router}).Get("http://192.0.2.1:16992/wsman")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, RouteNetwork, router.Route(context.Background()))
+	assert.Equal(t, []string{"192.0.2.1:16992"}, network.hosts)
+}
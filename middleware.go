@@ -0,0 +1,36 @@
+package amt
+
+import "context"
+
+// Call is a call of a method of a Client, as seen by the Middleware.
+type Call struct {
+	// Method is the name of the method, e.g. "PowerOn".
+	Method string
+	// Mutating is true for the methods that may change the machine, e.g. to
+	// authorize them or to rate limit them separately from the reads.
+	Mutating bool
+}
+
+// Operation runs a call of a method of a Client.
+type Operation func(ctx context.Context, call Call) error
+
+// Middleware wraps the Operation of every method call of a Client, e.g. to
+// log, measure, rate limit or authorize the calls. It may return an error
+// without calling next to reject the call, or call next with a derived
+// context. Unlike Hooks, which see every WSMAN request, a middleware sees a
+// call once however many requests it takes.
+type Middleware func(next Operation) Operation
+
+// call runs fn as the call method through the middleware of the client. The
+// methods of the client call each other's internals, never each other, so a
+// call goes through the middleware once. The lazy iterators, e.g. Enumerate,
+// don't go through it.
+func (c *Client) call(ctx context.Context, method string, mutating bool, fn func(ctx context.Context) error) error {
+	var op Operation = func(ctx context.Context, _ Call) error {
+		return fn(ctx)
+	}
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		op = c.middleware[i](op)
+	}
+	return op(ctx, Call{Method: method, Mutating: mutating})
+}
@@ -0,0 +1,72 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_When_Chained_Expect_FirstOutermostOncePerCall(t *testing.T) {
+	var log []string
+	record := func(name string) Middleware {
+		return func(next Operation) Operation {
+			return func(ctx context.Context, call Call) error {
+				log = append(log, name+" "+call.Method)
+				return next(ctx, call)
+			}
+		}
+	}
+	requests := 0
+	errUnreachable := errors.New("unreachable")
+	client, err := NewClient(Connection{
+		Host:       "192.0.2.1",
+		Middleware: []Middleware{record("outer"), record("inner")},
+		Hooks: Hooks{OnRequest: func(ctx context.Context, request *Request) error {
+			requests++
+			return errUnreachable
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SetNextBootOrder is ApplyNextBootOrder but goes through the middleware once.
+	err = client.SetNextBootOrder(context.Background(), nil)
+	assert.ErrorIs(t, err, errUnreachable)
+	assert.Equal(t, []string{"outer SetNextBootOrder", "inner SetNextBootOrder"}, log)
+	assert.Equal(t, 1, requests)
+}
+
+func TestMiddleware_When_MutatingCallRejected_Expect_NoRequest(t *testing.T) {
+	errReadOnly := errors.New("read only")
+	requests := 0
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Middleware: []Middleware{func(next Operation) Operation {
+			return func(ctx context.Context, call Call) error {
+				if call.Mutating {
+					return errReadOnly
+				}
+				return next(ctx, call)
+			}
+		}},
+		Hooks: Hooks{OnRequest: func(ctx context.Context, request *Request) error {
+			requests++
+			return errors.New("unreachable")
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.SetPower(context.Background(), PowerActionCycle)
+	assert.ErrorIs(t, err, errReadOnly)
+	assert.Equal(t, PowerResultNoOp, result)
+	assert.Equal(t, 0, requests)
+
+	_, err = client.PowerStatus(context.Background())
+	assert.NotErrorIs(t, err, errReadOnly)
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,248 @@
+// Package mps implements a Management Presence Server (MPS), the server side
+// of CIRA. Devices behind NAT open a TLS connection to the MPS and speak APF
+// over it; the MPS then reaches the network services of the firmware through
+// the ports the device forwarded. RelayDialer reaches the devices connected to
+// an Open AMT MPS instead.
+package mps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/jacobweinstock/go-amt/apf"
+)
+
+// Port is the usual MPS port devices connect to.
+const Port = 4433
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("mps: server closed")
+
+// Server accepts CIRA connections from devices.
+type Server struct {
+	// TLSConfig is used by ListenAndServe. Devices only connect over TLS.
+	TLSConfig *tls.Config
+	// Authenticate validates the MPS credentials configured in the device.
+	// When nil every device is rejected.
+	Authenticate func(username, password string) bool
+	// OnConnect is called when a device authenticated.
+	OnConnect func(*Device)
+	// OnDisconnect is called when the connection of a device ended.
+	OnDisconnect func(*Device)
+	// OnError is called with the errors of connections that failed before
+	// the device authenticated.
+	OnError func(error)
+
+	mu        sync.Mutex
+	devices   map[string]*Device
+	listeners map[net.Listener]bool
+	closed    bool
+}
+
+// Device is a connected device.
+type Device struct {
+	// UUID of the device, e.g. "4c4c4544-0042-3510-8051-b4c04f4b4d32".
+	UUID       string
+	Username   string
+	RemoteAddr net.Addr
+
+	session *apf.Session
+}
+
+// ListenAndServe listens on the TCP address addr with TLSConfig and serves devices.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.TLSConfig == nil {
+		return fmt.Errorf("mps: TLSConfig is required")
+	}
+	l, err := tls.Listen("tcp", addr, s.TLSConfig)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts device connections on l until it fails or the server is closed.
+// l is expected to terminate TLS.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]bool{}
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves a single device connection until it ends.
+func (s *Server) ServeConn(conn net.Conn) error {
+	device := &Device{RemoteAddr: conn.RemoteAddr()}
+	var session *apf.Session
+	session = apf.NewSession(conn, apf.Config{
+		Authenticate: func(username, password string) bool {
+			if s.Authenticate == nil || !s.Authenticate(username, password) {
+				return false
+			}
+			// the UUID identifies the device, without it the device can't be reached.
+			version := session.ProtocolVersion()
+			if version == nil {
+				return false
+			}
+			device.UUID = formatUUID(version.UUID)
+			device.Username = username
+			device.session = session
+			if !s.register(device) {
+				return false
+			}
+			if s.OnConnect != nil {
+				go s.OnConnect(device)
+			}
+			return true
+		},
+	})
+	err := session.Serve()
+
+	if device.session == nil {
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("device %v: %v", device.RemoteAddr, err))
+		}
+		return err
+	}
+	s.mu.Lock()
+	if s.devices[device.UUID] == device {
+		delete(s.devices, device.UUID)
+	}
+	s.mu.Unlock()
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(device)
+	}
+	return err
+}
+
+// register makes device the connected device with its UUID, replacing the
+// previous connection of the same device.
+func (s *Server) register(device *Device) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+	if s.devices == nil {
+		s.devices = map[string]*Device{}
+	}
+	previous := s.devices[device.UUID]
+	s.devices[device.UUID] = device
+	s.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return true
+}
+
+// Device returns the connected device with the UUID uuid, or nil.
+func (s *Server) Device(uuid string) *Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.devices[uuid]
+}
+
+// Devices returns the connected devices.
+func (s *Server) Devices() []*Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices := make([]*Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// Close stops the listeners and disconnects every device.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	listeners := s.listeners
+	devices := s.devices
+	s.listeners = nil
+	s.devices = nil
+	s.mu.Unlock()
+	for l := range listeners {
+		l.Close()
+	}
+	for _, d := range devices {
+		d.Close()
+	}
+	return nil
+}
+
+// DialContext opens a channel to the port in address on the device, which
+// must have forwarded it. The host part is ignored.
+func (d *Device) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	_, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %v", portString, err)
+	}
+	forwarded, ok := d.session.ForwardedAddress(uint32(port))
+	if !ok {
+		return nil, fmt.Errorf("device %s did not forward port %d", d.UUID, port)
+	}
+	return d.session.OpenChannel(ctx, forwarded, uint32(port))
+}
+
+// Transport returns an http.RoundTripper that carries requests to the device.
+// Use it as the Transport of an amt.Connection to reach the device over CIRA.
+func (d *Device) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext:       d.DialContext,
+		DisableKeepAlives: true,
+	}
+}
+
+// Done is closed once the device disconnected.
+func (d *Device) Done() <-chan struct{} {
+	return d.session.Done()
+}
+
+// Close disconnects the device.
+func (d *Device) Close() error {
+	return d.session.Close()
+}
+
+// formatUUID formats the UUID sent by the firmware, whose first three fields
+// are little endian.
+func formatUUID(b [16]byte) string {
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6], b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15])
+}
@@ -0,0 +1,88 @@
+package mps
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jacobweinstock/go-amt/apf"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDevice connects like the firmware does over CIRA, forwards 16992 and
+// echoes the data of the channels opened to it.
+func fakeDevice(t *testing.T, conn net.Conn, uuid [16]byte) {
+	r := bufio.NewReader(conn)
+	// net.Pipe is unbuffered, write while the answers are read.
+	// ReadMessage can't tell whether a RequestSuccess carries a port, so the
+	// forward doesn't ask for a reply.
+	go func() {
+		conn.Write(apf.Marshal(&apf.ProtocolVersion{Major: 1, Minor: 0, UUID: uuid}))
+		conn.Write(apf.Marshal(&apf.ServiceRequest{Service: apf.ServiceAuth}))
+		conn.Write(apf.Marshal(&apf.UserAuthRequest{Username: "cira", Service: apf.ServicePortForward, Method: apf.AuthMethodPassword, Password: "secret"}))
+		conn.Write(apf.Marshal(&apf.GlobalRequest{Name: apf.RequestTCPIPForward, Address: "device.example.com", Port: 16992}))
+	}()
+	for {
+		m, err := apf.ReadMessage(r)
+		if err != nil {
+			return
+		}
+		switch m := m.(type) {
+		case *apf.ChannelOpen:
+			assert.Equal(t, "device.example.com", m.ConnectedAddress)
+			conn.Write(apf.Marshal(&apf.ChannelOpenConfirmation{RecipientChannel: m.SenderChannel, SenderChannel: 7, InitialWindow: 4096}))
+		case *apf.ChannelData:
+			conn.Write(apf.Marshal(&apf.ChannelData{RecipientChannel: 0, Data: m.Data}))
+			conn.Write(apf.Marshal(&apf.ChannelClose{RecipientChannel: 0}))
+		}
+	}
+}
+
+func TestServer_When_DeviceAuthenticates_Expect_ChannelToForwardedPort(t *testing.T) {
+	connected := make(chan *Device, 1)
+	s := &Server{
+		Authenticate: func(username, password string) bool {
+			return username == "cira" && password == "secret"
+		},
+		OnConnect: func(d *Device) { connected <- d },
+	}
+	defer s.Close()
+	local, remote := net.Pipe()
+	go s.ServeConn(local)
+	uuid := [16]byte{0x44, 0x45, 0x4c, 0x4c, 0x42, 0x00, 0x10, 0x35, 0x80, 0x51, 0xb4, 0xc0, 0x4f, 0x4b, 0x4d, 0x32}
+	go fakeDevice(t, remote, uuid)
+
+	var device *Device
+	select {
+	case device = <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("device did not connect")
+	}
+	assert.Equal(t, "4c4c4544-0042-3510-8051-b4c04f4b4d32", device.UUID)
+	assert.Equal(t, device, s.Device(device.UUID))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the forward may still be in flight right after the authentication.
+	var conn net.Conn
+	var err error
+	for ctx.Err() == nil {
+		if conn, err = device.DialContext(ctx, "tcp", "ignored:16992"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn.Write([]byte("ping"))
+	echoed, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(echoed))
+
+	_, err = device.DialContext(ctx, "tcp", "ignored:16993")
+	assert.Error(t, err)
+}
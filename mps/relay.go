@@ -0,0 +1,162 @@
+package mps
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jacobweinstock/go-amt/internal/wsframe"
+)
+
+// RelayDialer connects to the ports of a device through the websocket relay of
+// an Open AMT MPS, which forwards the connection over the CIRA connection of
+// the device. Use its Transport as the Transport of an amt.Connection to call
+// the device like one on the local network.
+type RelayDialer struct {
+	// URL of the relay, e.g. "wss://mps.example.com/relay/webrelay.ashx".
+	URL string
+	// Token is the JWT issued by the authorize API of the MPS.
+	Token string
+	// GUID of the device, as listed by the devices API of the MPS.
+	GUID string
+	// TLSConfig is used for wss URLs.
+	TLSConfig *tls.Config
+	// Dialer dials the MPS, a zero net.Dialer when nil.
+	Dialer *net.Dialer
+}
+
+// DialContext opens a connection to the port in address on the device. The
+// host part is ignored, the device is GUID.
+func (d *RelayDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	_, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %v", portString, err)
+	}
+	target, err := d.relayURL(port)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", target.Host)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme == "wss" {
+		config := &tls.Config{}
+		if d.TLSConfig != nil {
+			config = d.TLSConfig.Clone()
+		}
+		if config.ServerName == "" {
+			config.ServerName = target.Hostname()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	// the handshake is bounded by the context, the connection itself is not.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	ws, err := d.handshake(conn, target)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("relay to device %s port %d: %w", d.GUID, port, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+// Transport returns an http.Transport that carries requests to the device.
+func (d *RelayDialer) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext:       d.DialContext,
+		DisableKeepAlives: true,
+	}
+}
+
+func (d *RelayDialer) relayURL(port uint64) (*url.URL, error) {
+	if d.GUID == "" {
+		return nil, errors.New("mps: RelayDialer needs the GUID of the device")
+	}
+	target, err := url.Parse(d.URL)
+	if err != nil {
+		return nil, err
+	}
+	if target.Scheme != "ws" && target.Scheme != "wss" {
+		return nil, fmt.Errorf("mps: unsupported relay scheme %q", target.Scheme)
+	}
+	if target.Port() == "" {
+		if target.Scheme == "wss" {
+			target.Host = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			target.Host = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+	// p=2 relays a TCP port of the device, tls=0 leaves TLS to the caller.
+	query := target.Query()
+	query.Set("p", "2")
+	query.Set("host", d.GUID)
+	query.Set("port", strconv.FormatUint(port, 10))
+	query.Set("tls", "0")
+	query.Set("tls1only", "0")
+	target.RawQuery = query.Encode()
+	return target, nil
+}
+
+func (d *RelayDialer) handshake(conn net.Conn, target *url.URL) (*wsframe.Conn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	req, err := http.NewRequest(http.MethodGet, "http://"+target.Host+target.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	// the MPS takes the token as the websocket protocol, browsers can't set headers.
+	if d.Token != "" {
+		req.Header.Set("Sec-WebSocket-Protocol", d.Token)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsframe.Accept(key) {
+		return nil, errors.New("invalid Sec-WebSocket-Accept")
+	}
+	return wsframe.NewConn(conn, r, true), nil
+}
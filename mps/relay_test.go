@@ -0,0 +1,64 @@
+package mps
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacobweinstock/go-amt/internal/wsframe"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRelay upgrades the relay requests of the device and port it expects
+// and echoes the data.
+func fakeRelay(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.Header.Get("Sec-WebSocket-Protocol") != "token" || q.Get("host") != "guid" || q.Get("port") != "16992" || q.Get("p") != "2" {
+			http.Error(w, "unexpected relay request "+r.URL.String(), http.StatusUnauthorized)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + wsframe.Accept(r.Header.Get("Sec-WebSocket-Key")) + "\r\nSec-WebSocket-Protocol: token\r\n\r\n")
+		rw.Flush()
+		ws := wsframe.NewConn(conn, rw.Reader, false)
+		p := make([]byte, 64)
+		n, err := ws.Read(p)
+		if err != nil {
+			return
+		}
+		ws.Write(p[:n])
+		ws.WriteFrame(wsframe.OpClose, nil)
+	}
+}
+
+func TestRelayDialer_When_Upgraded_Expect_StreamToDevice(t *testing.T) {
+	server := httptest.NewServer(fakeRelay(t))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d := &RelayDialer{URL: "ws" + strings.TrimPrefix(server.URL, "http") + "/relay/webrelay.ashx", Token: "token", GUID: "guid"}
+	conn, err := d.DialContext(ctx, "tcp", "guid:16992")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	echoed, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", string(echoed))
+
+	d.Token = "expired"
+	_, err = d.DialContext(ctx, "tcp", "guid:16992")
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package amt
+
+import (
+	"strings"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+)
+
+// NamespaceMatch is how the elements of responses are matched to the
+// namespaces the client expects.
+type NamespaceMatch int
+
+// Namespace matching modes.
+const (
+	// NamespaceMatchExact requires the expected namespace, or one mapped to
+	// it by NamespacePrefixes.
+	NamespaceMatchExact NamespaceMatch = iota
+	// NamespaceMatchLocalName ignores namespaces and matches elements by
+	// their local name, for OEM stacks answering in namespaces of their own.
+	NamespaceMatchLocalName
+)
+
+// namespaceMatcher matches the namespaces of response elements.
+type namespaceMatcher struct {
+	mode NamespaceMatch
+	// prefixes maps namespace prefixes of responses to the expected ones.
+	prefixes map[string]string
+}
+
+// matches reports whether actual, the namespace of a response element, is
+// expected. An expected "*" matches any namespace, like in search.Tag.
+func (m namespaceMatcher) matches(expected, actual string) bool {
+	if actual == expected || expected == "*" || m.mode == NamespaceMatchLocalName {
+		return true
+	}
+	for from, to := range m.prefixes {
+		if strings.HasPrefix(actual, from) && to+strings.TrimPrefix(actual, from) == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func (m namespaceMatcher) tag(name, space string) search.Match {
+	return func(e *dom.Element) bool {
+		return e.Name.Local == name && m.matches(space, e.Name.Space)
+	}
+}
+
+// firstTag is search.FirstTag with the namespace matching of the client.
+func (m namespaceMatcher) firstTag(name, space string, nodes []*dom.Element) *dom.Element {
+	return search.First(m.tag(name, space), nodes)
+}
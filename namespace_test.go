@@ -0,0 +1,27 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamespaceMatcher_When_OEMNamespace_Expect_MatchedByMode(t *testing.T) {
+	const oem = "http://oem.example.com/wbem/wscim/1/cim-schema/2/CIM_AssociatedPowerManagementService"
+	items := []*dom.Element{dom.Elem("CIM_AssociatedPowerManagementService", oem)}
+
+	_, err := getPowerManagementElements(namespaceMatcher{}, items, ResourceCIMAssociatedPowerManagementService)
+	assert.Error(t, err)
+	_, err = getPowerManagementElements(namespaceMatcher{mode: NamespaceMatchLocalName}, items, ResourceCIMAssociatedPowerManagementService)
+	assert.NoError(t, err)
+	prefixes := map[string]string{"http://oem.example.com/": "http://schemas.dmtf.org/"}
+	_, err = getPowerManagementElements(namespaceMatcher{prefixes: prefixes}, items, ResourceCIMAssociatedPowerManagementService)
+	assert.NoError(t, err)
+	assert.False(t, namespaceMatcher{prefixes: prefixes}.matches(ResourceCIMPowerManagementService, oem))
+}
+
+func TestNamespaceMatcher_When_AnyNamespace_Expect_Matched(t *testing.T) {
+	returnValue := dom.Elem("ReturnValue", ResourceCIMBootService)
+	assert.Equal(t, returnValue, namespaceMatcher{}.firstTag("ReturnValue", "*", []*dom.Element{returnValue}))
+}
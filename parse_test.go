@@ -0,0 +1,83 @@
+package amt
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/VictorLowther/simplexml/search"
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+// enumerationItems returns the items of a raw enumeration response, e.g. one
+// captured from firmware.
+func enumerationItems(body []byte) ([]*dom.Element, error) {
+	doc, err := dom.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if doc.Root() == nil {
+		return nil, errors.New("empty document")
+	}
+	items := search.First(search.Tag("Items", wsman.NS_WSMAN), doc.Root().All())
+	if items == nil {
+		return nil, errors.New("no enumeration items")
+	}
+	return items.Children(), nil
+}
+
+// parsePowerStatusResponse parses a raw CIM_AssociatedPowerManagementService
+// enumeration response.
+func parsePowerStatusResponse(body []byte) (*powerStatus, error) {
+	items, err := enumerationItems(body)
+	if err != nil {
+		return nil, err
+	}
+	properties, err := getPowerManagementElements(namespaceMatcher{}, items, ResourceCIMAssociatedPowerManagementService)
+	if err != nil {
+		return nil, err
+	}
+	return parsePowerStatus(properties)
+}
+
+func TestParsePowerStatus_When_FirmwareResponses_Expect_States(t *testing.T) {
+	tests := map[string]*powerStatus{
+		"on.xml": {
+			currentState:                  PowerStateOn,
+			RequestedpowerState:           PowerStateOn,
+			AvailableRequestedpowerStates: []PowerState{PowerStateOffSoft, PowerStateMasterBusReset, PowerStatePowerCycleOffSoft, PowerStateOffSoftGraceful, PowerStateMasterBusResetGraceful},
+		},
+		"off.xml": {
+			currentState:                  PowerStateOffSoft,
+			RequestedpowerState:           PowerStateOffSoft,
+			AvailableRequestedpowerStates: []PowerState{PowerStateOn},
+		},
+		"empty-available.xml": {
+			currentState:                  PowerStateOn,
+			AvailableRequestedpowerStates: []PowerState{},
+		},
+	}
+	for name, want := range tests {
+		t.Run(name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(filepath.Join("testdata", "power", name))
+			if !assert.NoError(t, err) {
+				return
+			}
+			status, err := parsePowerStatusResponse(body)
+			assert.NoError(t, err)
+			assert.Equal(t, want, status)
+		})
+	}
+}
+
+func TestParsePowerStatus_When_StateIsNotANumber_Expect_Error(t *testing.T) {
+	const ns = ResourceCIMAssociatedPowerManagementService
+	_, err := parsePowerStatus([]*dom.Element{dom.ElemC("PowerState", ns, "2"), dom.ElemC("AvailableRequestedPowerStates", ns, "eight")})
+	assert.EqualError(t, err, `invalid AvailableRequestedPowerStates "eight": strconv.ParseUint: parsing "eight": invalid syntax`)
+	_, err = parsePowerStatus([]*dom.Element{dom.ElemC("PowerState", ns, "99999999999999999999")})
+	assert.Error(t, err)
+}
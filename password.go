@@ -0,0 +1,72 @@
+package amt
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Length limits of AMT passwords.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 32
+)
+
+// passwordDisallowed are the characters AMT rejects in passwords.
+const passwordDisallowed = `:,"`
+
+// ErrInvalidPassword is returned, wrapped with the broken rules, for
+// passwords the firmware would reject.
+var ErrInvalidPassword = errors.New("invalid AMT password")
+
+// ValidateAMTPassword checks password against the complexity rules of the
+// firmware, so rotation jobs fail before sending it: 8 to 32 printable 7-bit
+// ASCII characters with at least one digit, one lower case letter, one upper
+// case letter and one symbol other than _ and space, and none of : , or ".
+func ValidateAMTPassword(password string) error {
+	var problems []string
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		problems = append(problems, fmt.Sprintf("must be %d to %d characters long", minPasswordLength, maxPasswordLength))
+	}
+	var digit, lower, upper, symbol, invalid, disallowed bool
+	for _, r := range password {
+		switch {
+		case r < ' ' || r > '~':
+			invalid = true
+		case strings.ContainsRune(passwordDisallowed, r):
+			disallowed = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r == '_' || r == ' ':
+			// valid but not counted as a symbol.
+		default:
+			symbol = true
+		}
+	}
+	if !digit {
+		problems = append(problems, "needs a digit")
+	}
+	if !lower {
+		problems = append(problems, "needs a lower case letter")
+	}
+	if !upper {
+		problems = append(problems, "needs an upper case letter")
+	}
+	if !symbol {
+		problems = append(problems, "needs a symbol other than _ and space")
+	}
+	if invalid {
+		problems = append(problems, "must only contain printable 7-bit ASCII characters")
+	}
+	if disallowed {
+		problems = append(problems, `must not contain : , or "`)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidPassword, strings.Join(problems, ", "))
+	}
+	return nil
+}
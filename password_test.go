@@ -0,0 +1,44 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAMTPassword_When_RulesBroken_Expect_Reasons(t *testing.T) {
+	assert.NoError(t, ValidateAMTPassword("P@ssw0rd"))
+	assert.NoError(t, ValidateAMTPassword("Long enough_1!"))
+
+	tests := map[string]string{
+		"Sh0rt!":      "must be 8 to 32 characters long",
+		"password1!":  "needs an upper case letter",
+		"Password_1 ": "needs a symbol other than _ and space",
+		"Pass:word1!": `must not contain : , or "`,
+		"Pässword1!":  "must only contain printable 7-bit ASCII characters",
+		"PASSWORD!!":  "needs a digit, needs a lower case letter",
+	}
+	for password, reason := range tests {
+		err := ValidateAMTPassword(password)
+		if assert.Error(t, err, password) {
+			assert.True(t, errors.Is(err, ErrInvalidPassword))
+			assert.Contains(t, err.Error(), reason, password)
+		}
+	}
+}
+
+func TestActivateClientControlMode_When_WeakPassword_Expect_NoRequest(t *testing.T) {
+	requests := 0
+	client, err := NewClient(Connection{Host: "192.0.2.1", Hooks: Hooks{
+		OnRequest: func(ctx context.Context, request *Request) error {
+			requests++
+			return errors.New("unreachable")
+		},
+	}})
+	assert.NoError(t, err)
+	err = client.ActivateClientControlMode(context.Background(), "admin")
+	assert.True(t, errors.Is(err, ErrInvalidPassword))
+	assert.Equal(t, 0, requests)
+}
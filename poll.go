@@ -0,0 +1,81 @@
+package amt
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Defaults of PollOptions.
+const (
+	defaultPollInitial    = time.Second
+	defaultPollMax        = 30 * time.Second
+	defaultPollMultiplier = 2
+	defaultPollJitter     = 0.1
+)
+
+// PollOptions control the waits of Poll. Zero values use the defaults.
+type PollOptions struct {
+	// Initial wait after the first check, 1s by default.
+	Initial time.Duration
+	// Max caps the wait, 30s by default.
+	Max time.Duration
+	// Multiplier grows the wait after every check, 2 by default.
+	Multiplier float64
+	// Jitter randomizes each wait by up to this fraction, 0.1 by default.
+	// A negative Jitter disables it.
+	Jitter float64
+	// Clock waits, SystemClock when nil.
+	Clock Clock
+}
+
+// Poll calls condition until it returns true or an error, or ctx is done,
+// waiting with exponential backoff in between. It returns the error of
+// condition or of ctx.
+func Poll(ctx context.Context, options PollOptions, condition func(ctx context.Context) (bool, error)) error {
+	wait := options.Initial
+	if wait <= 0 {
+		wait = defaultPollInitial
+	}
+	max := options.Max
+	if max <= 0 {
+		max = defaultPollMax
+	}
+	multiplier := options.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultPollMultiplier
+	}
+	jitter := options.Jitter
+	if jitter == 0 {
+		jitter = defaultPollJitter
+	}
+	clock := options.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	for {
+		done, err := condition(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		d := wait
+		if jitter > 0 {
+			d += time.Duration((rand.Float64()*2 - 1) * jitter * float64(wait))
+		}
+		timer := clock.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+		wait = time.Duration(float64(wait) * multiplier)
+		if wait > max {
+			wait = max
+		}
+	}
+}
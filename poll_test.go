@@ -0,0 +1,28 @@
+package amt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoll_When_ConditionBecomesTrue_Expect_NoError(t *testing.T) {
+	calls := 0
+	err := Poll(context.Background(), PollOptions{Initial: time.Millisecond}, func(ctx context.Context) (bool, error) {
+		calls++
+		return calls == 3, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestPoll_When_ContextExpires_Expect_ContextError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := Poll(ctx, PollOptions{Initial: time.Millisecond, Max: 5 * time.Millisecond}, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
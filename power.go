@@ -1,4 +1,4 @@
-//go:generate stringer -type=powerState -trimprefix=powerState -linecomment
+//go:generate stringer -type=PowerState -trimprefix=PowerState -linecomment
 
 package amt
 
@@ -6,134 +6,235 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/VictorLowther/simplexml/dom"
 	"github.com/go-logr/logr"
-	"github.com/jacobweinstock/wsman"
 )
 
-type powerState int
+// PowerState is a CIM power state, the current state of a machine or a requested one.
+type PowerState int
 
+// Power states.
 // https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/HTMLDocuments/WS-Management_Class_Reference/CIM_AssociatedPowerManagementService.htm#powerState
 // https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/default.htm?turl=WordDocuments%2Fgetsystempowerstate.htm
 const (
-	powerStateUnknown                   powerState = 0
-	powerStateOther                     powerState = 1
-	powerStateOn                        powerState = 2
-	powerStateSleepLight                powerState = 3
-	powerStateSleepDeep                 powerState = 4
-	powerStatePowerCycleOffSoft         powerState = 5
-	powerStateOffHard                   powerState = 6
-	powerStateHibernateOffSoft          powerState = 7
-	powerStateOffSoft                   powerState = 8
-	powerStatePowerCycleOffHard         powerState = 9
-	powerStateMasterBusReset            powerState = 10
-	powerStateDiagnosticInterruptNMI    powerState = 11
-	powerStateOffSoftGraceful           powerState = 12
-	powerStateOffHardGraceful           powerState = 13
-	powerStateMasterBusResetGraceful    powerState = 14
-	powerStatePowerCycleOffSoftGraceful powerState = 15
-	powerStatePowerCycleOffHardGraceful powerState = 16
-	powerStateDiagnosticInterruptInit   powerState = 17
+	PowerStateUnknown                   PowerState = 0
+	PowerStateOther                     PowerState = 1
+	PowerStateOn                        PowerState = 2
+	PowerStateSleepLight                PowerState = 3
+	PowerStateSleepDeep                 PowerState = 4
+	PowerStatePowerCycleOffSoft         PowerState = 5
+	PowerStateOffHard                   PowerState = 6
+	PowerStateHibernateOffSoft          PowerState = 7
+	PowerStateOffSoft                   PowerState = 8
+	PowerStatePowerCycleOffHard         PowerState = 9
+	PowerStateMasterBusReset            PowerState = 10
+	PowerStateDiagnosticInterruptNMI    PowerState = 11
+	PowerStateOffSoftGraceful           PowerState = 12
+	PowerStateOffHardGraceful           PowerState = 13
+	PowerStateMasterBusResetGraceful    PowerState = 14
+	PowerStatePowerCycleOffSoftGraceful PowerState = 15
+	PowerStatePowerCycleOffHardGraceful PowerState = 16
+	PowerStateDiagnosticInterruptInit   PowerState = 17
 	// DMTF Reserverd = ..
-	// Vendor Specific = 0x7FFF..0xFFFF
 )
 
+// Range of the vendor specific power states, see RegisterVendorPowerState.
+const (
+	PowerStateVendorMin PowerState = 0x7FFF
+	PowerStateVendorMax PowerState = 0xFFFF
+)
+
+// vendorPowerState is a registered vendor specific power state.
+type vendorPowerState struct {
+	name string
+	acpi string
+}
+
+var (
+	vendorPowerStatesMu sync.RWMutex
+	vendorPowerStates   = map[PowerState]vendorPowerState{}
+)
+
+// RegisterVendorPowerState names the vendor specific power state of an OEM
+// firmware, with its ACPI state or "" for a transition, so it's reported by
+// ACPIState and PowerStatus like the standard ones. Vendor states are requested
+// with RequestPowerState or ForcePowerState.
+func RegisterVendorPowerState(state PowerState, name, acpiState string) error {
+	if !state.IsVendor() {
+		return fmt.Errorf("power state %d is not in the vendor range %d to %d", state, PowerStateVendorMin, PowerStateVendorMax)
+	}
+	vendorPowerStatesMu.Lock()
+	defer vendorPowerStatesMu.Unlock()
+	if registered, ok := vendorPowerStates[state]; ok {
+		return fmt.Errorf("power state %d is already registered as %s", state, registered.name)
+	}
+	vendorPowerStates[state] = vendorPowerState{name: name, acpi: acpiState}
+	return nil
+}
+
+func lookupVendorPowerState(s PowerState) (vendorPowerState, bool) {
+	vendorPowerStatesMu.RLock()
+	defer vendorPowerStatesMu.RUnlock()
+	v, ok := vendorPowerStates[s]
+	return v, ok
+}
+
+// IsVendor reports whether s is in the range of the vendor specific states.
+func (s PowerState) IsVendor() bool {
+	return s >= PowerStateVendorMin && s <= PowerStateVendorMax
+}
+
+// ACPIState returns the ACPI sleep state, S0 to S5, or G3 for a mechanical
+// off, matching s. Transitions such as a power cycle have none and return "".
+func (s PowerState) ACPIState() string {
+	switch s {
+	case PowerStateOn:
+		return "S0"
+	case PowerStateSleepLight:
+		// S1 or S2, the firmware doesn't tell them apart.
+		return "S1"
+	case PowerStateSleepDeep:
+		return "S3"
+	case PowerStateHibernateOffSoft:
+		return "S4"
+	case PowerStateOffSoft, PowerStateOffSoftGraceful:
+		return "S5"
+	case PowerStateOffHard, PowerStateOffHardGraceful:
+		return "G3"
+	}
+	if v, ok := lookupVendorPowerState(s); ok {
+		return v.acpi
+	}
+	return ""
+}
+
+// describePowerState returns s with its ACPI state, e.g. "OffSoft (S5)", and
+// registered vendor states by name.
+func describePowerState(s PowerState) string {
+	name := s.String()
+	if v, ok := lookupVendorPowerState(s); ok {
+		name = fmt.Sprintf("%s (vendor %d)", v.name, s)
+	}
+	if acpi := s.ACPIState(); acpi != "" {
+		return fmt.Sprintf("%s (%s)", name, acpi)
+	}
+	return name
+}
+
+// PowerStatus is the power state of a machine.
+type PowerStatus struct {
+	State PowerState
+	// ACPIState is State as an ACPI state, see PowerState.ACPIState.
+	ACPIState string
+	// Available are the states the firmware can transition to.
+	Available []PowerState
+}
+
+func (s PowerStatus) String() string {
+	return describePowerState(s.State)
+}
+
+func getPublicPowerStatus(ctx context.Context, client *Client) (*PowerStatus, error) {
+	status, err := getPowerStatus(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return &PowerStatus{
+		State:     status.currentState,
+		ACPIState: status.currentState.ACPIState(),
+		Available: status.AvailableRequestedpowerStates,
+	}, nil
+}
+
 type powerStatus struct {
-	AvailableRequestedpowerStates []powerState
-	powerState                    powerState
-	RequestedpowerState           powerState
+	AvailableRequestedpowerStates []PowerState
+	currentState                  PowerState
+	RequestedpowerState           PowerState
 }
 
 func getPowerStatus(ctx context.Context, client *Client) (*powerStatus, error) {
 	// https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/default.htm?turl=WordDocuments%2Fgetsystempowerstate.htm
-	message := client.wsManClient.Enumerate(resourceCIMAssociatedPowerManagementService)
+	resource := client.resourceURI(ResourceCIMAssociatedPowerManagementService)
+	message := client.wsManClient.Enumerate(resource)
 
-	response, err := message.Send(ctx)
+	response, err := client.send(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	items, err := response.EnumItems()
 	if err != nil {
 		return nil, err
 	}
-	pmElms, err := getPowerManagementElements(response)
+	pmElms, err := getPowerManagementElements(client.namespaces, items, resource)
 	if err != nil {
 		return nil, err
 	}
+	if client.strict {
+		if err := validateElements(client.namespaces, resource, pmElms, response, "PowerState"); err != nil {
+			return nil, err
+		}
+	}
+	return parsePowerStatus(pmElms)
+}
 
+// parsePowerStatus parses the properties of CIM_AssociatedPowerManagementService.
+func parsePowerStatus(properties []*dom.Element) (*powerStatus, error) {
 	status := &powerStatus{
-		AvailableRequestedpowerStates: []powerState{},
+		AvailableRequestedpowerStates: []PowerState{},
 	}
-	for _, e := range pmElms {
+	for _, e := range properties {
 		switch e.Name.Local {
 		case "PowerState":
-			val, err := strconv.Atoi(string(e.Content))
+			val, err := parsePowerStateValue(e)
 			if err != nil {
 				return nil, err
 			}
-			status.powerState = powerState(val)
+			status.currentState = val
 		case "RequestedPowerState":
-			val, err := strconv.Atoi(string(e.Content))
+			val, err := parsePowerStateValue(e)
 			if err != nil {
 				return nil, err
 			}
-			status.RequestedpowerState = powerState(val)
+			status.RequestedpowerState = val
 		case "AvailableRequestedPowerStates":
-			val, err := strconv.Atoi(string(e.Content))
+			// some firmware sends an empty element when no state is available.
+			if strings.TrimSpace(string(e.Content)) == "" {
+				continue
+			}
+			val, err := parsePowerStateValue(e)
 			if err != nil {
 				return nil, err
 			}
-			status.AvailableRequestedpowerStates = append(status.AvailableRequestedpowerStates, powerState(val))
+			status.AvailableRequestedpowerStates = append(status.AvailableRequestedpowerStates, val)
 		}
 	}
-
 	return status, nil
 }
 
-func powerOn(ctx context.Context, client *Client) error {
-	isOn, err := isPoweredOn(ctx, client)
+func parsePowerStateValue(e *dom.Element) (PowerState, error) {
+	val, err := strconv.ParseUint(strings.TrimSpace(string(e.Content)), 10, 16)
 	if err != nil {
-		return err
-	}
-	if isOn {
-		return nil
+		return PowerStateUnknown, fmt.Errorf("invalid %s %q: %v", e.Name.Local, e.Content, err)
 	}
-	_, err = requestpowerState(ctx, client, powerStateOn)
+	return PowerState(val), nil
+}
+
+func powerOn(ctx context.Context, client *Client) error {
+	_, err := executePowerAction(ctx, client, PowerActionOn)
 	return err
 }
 
 func powerOff(ctx context.Context, client *Client) error {
-	status, err := getPowerStatus(ctx, client)
-	if err != nil {
-		return err
-	}
-	if isPoweredOnGivenStatus(client.logger, status) {
-		request := selectNextState(getPowerOffStates(), status.AvailableRequestedpowerStates)
-
-		if request != powerStateUnknown {
-			_, err := requestpowerState(ctx, client, request)
-			return err
-		}
-		return fmt.Errorf("there is no implemented transition state to power off the machine from the current machine state %d. available states are: %v", status.powerState, status.AvailableRequestedpowerStates)
-	}
-	return nil
+	_, err := executePowerAction(ctx, client, PowerActionOff)
+	return err
 }
 
 func powerCycle(ctx context.Context, client *Client) error {
-	status, err := getPowerStatus(ctx, client)
-	if err != nil {
-		return err
-	}
-
-	if !isPoweredOnGivenStatus(client.logger, status) {
-		return powerOn(ctx, client)
-	}
-
-	request := selectNextState(getPowerCycleStates(), status.AvailableRequestedpowerStates)
-
-	if request >= 0 {
-		_, err := requestpowerState(ctx, client, request)
-		return err
-	}
-
-	return fmt.Errorf("there is no implemented transition state to power cycle the machine from the current machine state %d. available states are: %v", status.powerState, status.AvailableRequestedpowerStates)
+	_, err := executePowerAction(ctx, client, PowerActionCycle)
+	return err
 }
 
 func isPoweredOn(ctx context.Context, client *Client) (bool, error) {
@@ -145,9 +246,9 @@ func isPoweredOn(ctx context.Context, client *Client) (bool, error) {
 }
 
 func isPoweredOnGivenStatus(log logr.Logger, status *powerStatus) bool {
-	log.V(1).Info("states", "currentState", fmt.Sprintf("%v", status.powerState), "availableStates", fmt.Sprintf("%v", status.AvailableRequestedpowerStates))
-	switch status.powerState {
-	case powerStateOn:
+	log.V(1).Info("states", "currentState", describePowerState(status.currentState), "availableStates", fmt.Sprintf("%v", status.AvailableRequestedpowerStates))
+	switch status.currentState {
+	case PowerStateOn:
 		return true
 	default:
 		return false
@@ -155,29 +256,70 @@ func isPoweredOnGivenStatus(log logr.Logger, status *powerStatus) bool {
 }
 
 // https://software.intel.com/sites/manageability/AMT_Implementation_and_Reference_Guide/default.htm?turl=WordDocuments%2Fchangesystempowerstate.htm
-func requestpowerState(ctx context.Context, client *Client, requestedpowerState powerState) (int, error) {
+func requestpowerState(ctx context.Context, client *Client, requestedpowerState PowerState) (int, error) {
 	status, err := getPowerStatus(ctx, client)
 	if err != nil {
 		return -1, err
 	}
-	if !containspowerState(status.AvailableRequestedpowerStates, requestedpowerState) {
-		return -1, fmt.Errorf("there is no implemented transition state to <%d> from the current machine state <%d>. available states are: %v", requestedpowerState, status.powerState, status.AvailableRequestedpowerStates)
+	checkAvailable := len(status.AvailableRequestedpowerStates) > 0 && !getQuirks(ctx, client).ignoreAvailablePowerStates
+	if checkAvailable && !containspowerState(status.AvailableRequestedpowerStates, requestedpowerState) {
+		return -1, &TransitionError{Current: status.currentState, Requested: requestedpowerState, Available: status.AvailableRequestedpowerStates}
 	}
+	if len(status.AvailableRequestedpowerStates) == 0 {
+		client.logger.V(1).Info("firmware advertised no available power states, requesting anyway", "PowerState", requestedpowerState)
+	}
+	return requestPowerStateChange(ctx, client, requestedpowerState)
+}
+
+// requestPowerState requests state when the firmware advertises it.
+func requestPowerState(ctx context.Context, client *Client, state PowerState) error {
+	_, err := dedupePower(ctx, client, "request "+state.String(), func() (PowerResult, error) {
+		returnValue, err := requestpowerState(ctx, client, state)
+		if err != nil {
+			return PowerResultNoOp, err
+		}
+		if returnValue != 0 {
+			return PowerResultNoOp, fmt.Errorf("requesting %s failed with return value %d", describePowerState(state), returnValue)
+		}
+		return PowerResultRequested, nil
+	})
+	return err
+}
+
+// forcePowerState requests state without checking that the firmware
+// advertises it as available.
+func forcePowerState(ctx context.Context, client *Client, state PowerState) error {
+	_, err := dedupePower(ctx, client, "force "+state.String(), func() (PowerResult, error) {
+		returnValue, err := requestPowerStateChange(ctx, client, state)
+		if err != nil {
+			return PowerResultNoOp, err
+		}
+		if returnValue != 0 {
+			return PowerResultNoOp, fmt.Errorf("requesting %s failed with return value %d", describePowerState(state), returnValue)
+		}
+		return PowerResultRequested, nil
+	})
+	return err
+}
+
+// requestPowerStateChange sends the RequestPowerStateChange of
+// requestedpowerState and returns its return value.
+func requestPowerStateChange(ctx context.Context, client *Client, requestedpowerState PowerState) (int, error) {
 	client.logger.V(1).Info("sending request to machine", "PowerState", requestedpowerState)
-	message := client.wsManClient.Invoke(resourceCIMPowerManagementService, "RequestPowerStateChange")
+	message := client.wsManClient.Invoke(client.resourceURI(ResourceCIMPowerManagementService), "RequestPowerStateChange")
 	message.Parameters("PowerState", fmt.Sprint(int(requestedpowerState)))
-	managedElement, err := makeManagedElement(ctx, client, message)
+	managedSystemRef, err := getManagedSystemRef(ctx, client)
 	if err != nil {
 		return -1, err
 	}
-	message.AddParameter(managedElement)
+	AddReferenceParameter(message, "ManagedElement", managedSystemRef)
 
-	response, err := message.Send(ctx)
+	response, err := client.send(ctx, message)
 	if err != nil {
 		return -1, err
 	}
 
-	body := response.GetBody(dom.Elem("RequestPowerStateChange_OUTPUT", resourceCIMPowerManagementService))
+	body := client.namespaces.firstTag("RequestPowerStateChange_OUTPUT", client.resourceURI(ResourceCIMPowerManagementService), response.Body())
 	if body == nil || len(body.Children()) != 1 {
 		return -1, fmt.Errorf("received unknown response requesting power state change: %v", response)
 	}
@@ -189,64 +331,64 @@ func requestpowerState(ctx context.Context, client *Client, requestedpowerState
 	return val, nil
 }
 
-func getPowerManagementElements(response *wsman.Message) ([]*dom.Element, error) {
-	items, err := response.EnumItems()
-
-	if err != nil {
-		return nil, err
-	}
-
+// getPowerManagementElements returns the properties of the
+// CIM_AssociatedPowerManagementService in the enumeration items.
+func getPowerManagementElements(m namespaceMatcher, items []*dom.Element, resource string) ([]*dom.Element, error) {
 	for _, e := range items {
-		if e.Name.Local == "CIM_AssociatedPowerManagementService" && e.Name.Space == resourceCIMAssociatedPowerManagementService {
+		if e.Name.Local == "CIM_AssociatedPowerManagementService" && m.matches(resource, e.Name.Space) {
 			return e.Children(), nil
 		}
 	}
 	return nil, fmt.Errorf("did not receive %s enumeration item", "CIM_AssociatedPowerManagementService")
 }
 
-func makeManagedElement(ctx context.Context, client *Client, message *wsman.Message) (*dom.Element, error) {
-	managedSystemRef, err := getComputerSystemRef(ctx, client, "ManagedSystem")
-	if err != nil {
-		return nil, err
-	}
-	if managedSystemRef == nil {
-		return nil, fmt.Errorf("could not retrieve the managed system endpoint reference")
-	}
-	managedElement := message.MakeParameter("ManagedElement")
-	managedElement.AddChildren(managedSystemRef.Children()...)
-	return managedElement, nil
-}
-
-func getPowerOffStates() []powerState {
-	return []powerState{
-		powerStateOffSoftGraceful,
-		powerStateOffSoft,
-		powerStateOffHardGraceful,
-		powerStateOffHard,
+func getPowerOffStates() []PowerState {
+	return []PowerState{
+		PowerStateOffSoftGraceful,
+		PowerStateOffSoft,
+		PowerStateOffHardGraceful,
+		PowerStateOffHard,
 	}
 }
 
-func getPowerCycleStates() []powerState {
-	return []powerState{
-		powerStatePowerCycleOffSoftGraceful,
-		powerStatePowerCycleOffSoft,
-		powerStateMasterBusResetGraceful,
-		powerStatePowerCycleOffHardGraceful,
-		powerStatePowerCycleOffHard,
-		powerStateMasterBusReset,
+func getPowerCycleStates() []PowerState {
+	return []PowerState{
+		PowerStatePowerCycleOffSoftGraceful,
+		PowerStatePowerCycleOffSoft,
+		PowerStateMasterBusResetGraceful,
+		PowerStatePowerCycleOffHardGraceful,
+		PowerStatePowerCycleOffHard,
+		PowerStateMasterBusReset,
 	}
 }
 
-func selectNextState(requestedStates []powerState, availableStates []powerState) powerState {
+func selectNextState(requestedStates []PowerState, availableStates []PowerState) PowerState {
 	for _, a := range requestedStates {
 		if containspowerState(availableStates, a) {
 			return a
 		}
 	}
-	return powerStateUnknown
+	return PowerStateUnknown
+}
+
+// selectNextStateWithQuirks is selectNextState for firmware with known quirks.
+func selectNextStateWithQuirks(q quirks, requestedStates []PowerState, availableStates []PowerState) PowerState {
+	if len(availableStates) == 0 {
+		// some firmware advertises nothing even though the standard, non graceful, transitions work.
+		q.noGracefulTransitions = true
+		q.ignoreAvailablePowerStates = true
+	}
+	requestedStates = q.applyToStates(requestedStates)
+	if q.ignoreAvailablePowerStates {
+		if len(requestedStates) == 0 {
+			return PowerStateUnknown
+		}
+		return requestedStates[0]
+	}
+	return selectNextState(requestedStates, availableStates)
 }
 
-func containspowerState(s []powerState, e powerState) bool {
+func containspowerState(s []PowerState, e PowerState) bool {
 	for _, a := range s {
 		if a == e {
 			return true
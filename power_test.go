@@ -1,6 +1,8 @@
 package amt
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/go-logr/logr"
@@ -8,31 +10,73 @@ import (
 )
 
 func TestSelectNextState_When_NoneOfTheRequestedStatesAreAvailable_Expect_Unknown(t *testing.T) {
-	availableStates := []powerState{powerStateOn}
+	availableStates := []PowerState{PowerStateOn}
 	nextState := selectNextState(getPowerOffStates(), availableStates)
-	assert.Equal(t, powerStateUnknown, nextState)
+	assert.Equal(t, PowerStateUnknown, nextState)
 }
 
 func TestSelectNextState_When_OneOfTheRequestedStatesAreAvailable_Expect_RequestedState(t *testing.T) {
 	requestedStates := getPowerOffStates()
-	availableStates := []powerState{requestedStates[0]}
+	availableStates := []PowerState{requestedStates[0]}
 	nextState := selectNextState(requestedStates, availableStates)
 	assert.Equal(t, requestedStates[0], nextState)
 }
 func TestSelectNextState_When_MultipleOfTheRequestedStatesAreAvailable_Expect_FirstAvailableRequestedState(t *testing.T) {
 	requestedStates := getPowerOffStates()
-	availableStates := []powerState{requestedStates[1], requestedStates[2]}
+	availableStates := []PowerState{requestedStates[1], requestedStates[2]}
 	nextState := selectNextState(requestedStates, availableStates)
 	assert.Equal(t, requestedStates[1], nextState)
 }
 
 func TestIsPoweredOnGivenStatus_When_powerStateOn_Expect_True(t *testing.T) {
-	status := &powerStatus{powerState: powerStateOn}
+	status := &powerStatus{currentState: PowerStateOn}
 	actual := isPoweredOnGivenStatus(logr.Discard(), status)
 	assert.Equal(t, true, actual)
 }
 func TestIsPoweredOnGivenStatus_When_powerStateOffSoft_Expect_False(t *testing.T) {
-	status := &powerStatus{powerState: powerStateOffSoft}
+	status := &powerStatus{currentState: PowerStateOffSoft}
 	actual := isPoweredOnGivenStatus(logr.Discard(), status)
 	assert.Equal(t, false, actual)
 }
+
+func TestSelectNextStateWithQuirks_When_NoStatesAreAvailable_Expect_StandardState(t *testing.T) {
+	assert.Equal(t, PowerStateOffSoft, selectNextStateWithQuirks(quirks{}, getPowerOffStates(), []PowerState{}))
+	assert.Equal(t, PowerStatePowerCycleOffSoft, selectNextStateWithQuirks(quirks{}, getPowerCycleStates(), nil))
+}
+
+func TestPowerStatus_When_OffSoft_Expect_S5(t *testing.T) {
+	status := PowerStatus{State: PowerStateOffSoft, ACPIState: PowerStateOffSoft.ACPIState()}
+	assert.Equal(t, "S5", status.ACPIState)
+	assert.Equal(t, "OffSoft (S5)", status.String())
+	assert.Equal(t, "PowerCycleOffSoft", describePowerState(PowerStatePowerCycleOffSoft))
+}
+
+func TestForcePowerState_When_Called_Expect_NoPowerStatusCheck(t *testing.T) {
+	injected := errors.New("injected")
+	var resources []string
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Hooks: Hooks{OnRequest: func(ctx context.Context, request *Request) error {
+			resources = append(resources, request.ResourceURI)
+			return injected
+		}},
+	})
+	assert.NoError(t, err)
+
+	err = client.ForcePowerState(context.Background(), PowerStateOffHard)
+	assert.ErrorIs(t, err, injected)
+	assert.NotContains(t, resources, ResourceCIMAssociatedPowerManagementService)
+	assert.NotEmpty(t, resources)
+}
+
+func TestRegisterVendorPowerState_When_Registered_Expect_Reported(t *testing.T) {
+	const state = PowerState(0x8001)
+	assert.NoError(t, RegisterVendorPowerState(state, "OEMStandby", "S3"))
+	assert.True(t, state.IsVendor())
+	assert.Equal(t, "S3", state.ACPIState())
+	assert.Equal(t, "OEMStandby (vendor 32769) (S3)", PowerStatus{State: state, ACPIState: state.ACPIState()}.String())
+
+	assert.Error(t, RegisterVendorPowerState(state, "Other", ""))
+	assert.Error(t, RegisterVendorPowerState(PowerStateOn, "On", "S0"))
+	assert.Equal(t, "", PowerState(0x8002).ACPIState())
+}
@@ -0,0 +1,67 @@
+package amt
+
+import "time"
+
+// ProgressKind tells whether a step started, finished or failed.
+type ProgressKind string
+
+// Kinds of ProgressEvent.
+const (
+	ProgressStarted  ProgressKind = "started"
+	ProgressFinished ProgressKind = "finished"
+	ProgressFailed   ProgressKind = "failed"
+)
+
+// Operations reporting their progress.
+const (
+	OperationActivate          = "activate client control mode"
+	OperationSetFeatures       = "set features"
+	OperationSetNextBoot       = "set next boot"
+	OperationRecover           = "recover"
+	OperationResetBootSettings = "reset boot settings"
+	OperationSetListeners      = "set listeners"
+)
+
+// ProgressEvent is the start, end or failure of a step of a multi-step
+// operation, e.g. the "boot order" step of OperationSetNextBoot.
+type ProgressEvent struct {
+	Time      time.Time
+	Operation string
+	Step      string
+	Kind      ProgressKind
+	// Err is the error of a failed step.
+	Err error
+}
+
+// ProgressReporter receives the progress of the multi-step operations of a
+// Client, e.g. to show the current step in a UI.
+type ProgressReporter interface {
+	Progress(ProgressEvent)
+}
+
+// ProgressFunc is a ProgressReporter function.
+type ProgressFunc func(ProgressEvent)
+
+// Progress calls f.
+func (f ProgressFunc) Progress(event ProgressEvent) {
+	f(event)
+}
+
+// step runs fn as the step of operation, reporting its progress.
+func (c *Client) step(operation, step string, fn func() error) error {
+	c.reportProgress(operation, step, ProgressStarted, nil)
+	err := fn()
+	if err != nil {
+		c.reportProgress(operation, step, ProgressFailed, err)
+		return err
+	}
+	c.reportProgress(operation, step, ProgressFinished, nil)
+	return nil
+}
+
+func (c *Client) reportProgress(operation, step string, kind ProgressKind, err error) {
+	if c.progress == nil {
+		return
+	}
+	c.progress.Progress(ProgressEvent{Time: c.clock.Now(), Operation: operation, Step: step, Kind: kind, Err: err})
+}
@@ -0,0 +1,42 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress_When_StepFails_Expect_StartedAndFailedEvents(t *testing.T) {
+	injected := errors.New("injected")
+	var events []ProgressEvent
+	f := &fakeFirmware{}
+	f.set("CIM_OrderedComponent Enumerate", enumerationBody())
+	client, closeServer := newFirmwareClient(t, f, Connection{
+		Hooks: Hooks{
+			// the boot order is read before the boot settings are changed.
+			OnRequest: func(ctx context.Context, request *Request) error {
+				if request.ResourceURI == ResourceCIMOrderedComponent {
+					return nil
+				}
+				return injected
+			},
+		},
+		Progress: ProgressFunc(func(event ProgressEvent) {
+			events = append(events, event)
+		}),
+	})
+	defer closeServer()
+
+	err := client.SetNextBoot(context.Background(), BootSourcePXE)
+	assert.ErrorIs(t, err, injected)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, OperationSetNextBoot, events[0].Operation)
+		assert.Equal(t, "boot settings", events[0].Step)
+		assert.Equal(t, ProgressStarted, events[0].Kind)
+		assert.Equal(t, ProgressFailed, events[1].Kind)
+		assert.ErrorIs(t, events[1].Err, injected)
+		assert.False(t, events[1].Time.IsZero())
+	}
+}
@@ -0,0 +1,156 @@
+// Package provider implements the bmclib provider interfaces Rufio, the
+// Tinkerbell BMC controller, uses to manage machines: power state, power
+// actions and the next boot device. It lets AMT machines join a Tinkerbell
+// fleet like machines with a BMC.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	amt "github.com/jacobweinstock/go-amt"
+)
+
+const (
+	// ProviderName is the name of the provider in bmclib.
+	ProviderName = "IntelAMT"
+	// ProviderProtocol is the protocol of the provider in bmclib.
+	ProviderProtocol = "wsman"
+)
+
+// Features of the provider, with the names of the bmclib registrar.
+var Features = []string{
+	"powerstate",
+	"powerset",
+	"bootdeviceset",
+}
+
+var (
+	// ErrNotOpen is returned when the connection was not opened.
+	ErrNotOpen = errors.New("the connection is not open")
+	// ErrUnsupportedPowerState is returned for power states other than on,
+	// off, soft, reset and cycle.
+	ErrUnsupportedPowerState = errors.New("unsupported power state")
+	// ErrUnsupportedBootDevice is returned for boot devices other than pxe,
+	// disk and cdrom.
+	ErrUnsupportedBootDevice = errors.New("unsupported boot device")
+	// ErrPersistentBootDevice is returned when a persistent boot device is
+	// requested, AMT only overrides the next boot.
+	ErrPersistentBootDevice = errors.New("persistent boot devices are not supported")
+)
+
+// powerActions maps the bmclib power states to power actions. Like the other
+// bmclib providers, only soft asks the operating system to shut down.
+var powerActions = map[string]amt.PowerAction{
+	"on":    amt.PowerActionOn,
+	"off":   amt.PowerActionHardOff,
+	"soft":  amt.PowerActionSoft,
+	"reset": amt.PowerActionReset,
+	"cycle": amt.PowerActionHardCycle,
+}
+
+var bootDevices = map[string]string{
+	"pxe":   amt.BootSourcePXE,
+	"disk":  amt.BootSourceHardDrive,
+	"cdrom": amt.BootSourceCDDVD,
+}
+
+// Conn is a bmclib provider for a machine.
+type Conn struct {
+	connection amt.Connection
+	client     *amt.Client
+}
+
+// New returns the provider of the machine reached with connection.
+func New(connection amt.Connection) *Conn {
+	return &Conn{connection: connection}
+}
+
+// Name of the provider.
+func (c *Conn) Name() string {
+	return ProviderName
+}
+
+// Open creates the client and checks the firmware answers.
+func (c *Conn) Open(ctx context.Context) error {
+	client, err := amt.NewClient(c.connection)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Version(ctx); err != nil {
+		return fmt.Errorf("%s: %w", ProviderName, err)
+	}
+	c.client = client
+	return nil
+}
+
+// Close the connection.
+func (c *Conn) Close(ctx context.Context) error {
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
+
+// Compatible reports whether the machine answers as an AMT machine.
+func (c *Conn) Compatible(ctx context.Context) bool {
+	if err := c.Open(ctx); err != nil {
+		return false
+	}
+	c.Close(ctx)
+	return true
+}
+
+// PowerStateGet returns "on" or "off".
+func (c *Conn) PowerStateGet(ctx context.Context) (string, error) {
+	if c.client == nil {
+		return "", ErrNotOpen
+	}
+	on, err := c.client.IsPoweredOn(ctx)
+	if err != nil {
+		return "", err
+	}
+	if on {
+		return "on", nil
+	}
+	return "off", nil
+}
+
+// PowerSet runs the power action state, one of on, off, soft, reset and cycle.
+func (c *Conn) PowerSet(ctx context.Context, state string) (bool, error) {
+	action, ok := powerActions[strings.ToLower(state)]
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedPowerState, state)
+	}
+	if c.client == nil {
+		return false, ErrNotOpen
+	}
+	if _, err := c.client.SetPower(ctx, action); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BootDeviceSet makes the machine boot from bootDevice, one of pxe, disk and
+// cdrom, next time. efiBoot is ignored, the firmware boots the way the BIOS
+// is configured.
+func (c *Conn) BootDeviceSet(ctx context.Context, bootDevice string, setPersistent, efiBoot bool) (bool, error) {
+	source, ok := bootDevices[strings.ToLower(bootDevice)]
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnsupportedBootDevice, bootDevice)
+	}
+	if setPersistent {
+		return false, ErrPersistentBootDevice
+	}
+	if c.client == nil {
+		return false, ErrNotOpen
+	}
+	if err := c.client.SetNextBoot(ctx, source); err != nil {
+		return false, err
+	}
+	return true, nil
+}
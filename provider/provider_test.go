@@ -0,0 +1,117 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	amt "github.com/jacobweinstock/go-amt"
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn_When_UnsupportedRequests_Expect_TypedErrors(t *testing.T) {
+	ctx := context.Background()
+	c := New(amt.Connection{Host: "192.0.2.1"})
+
+	_, err := c.PowerSet(ctx, "bounce")
+	assert.True(t, errors.Is(err, ErrUnsupportedPowerState), "%v", err)
+	_, err = c.BootDeviceSet(ctx, "floppy", false, false)
+	assert.True(t, errors.Is(err, ErrUnsupportedBootDevice), "%v", err)
+	_, err = c.BootDeviceSet(ctx, "pxe", true, false)
+	assert.Equal(t, ErrPersistentBootDevice, err)
+	_, err = c.PowerSet(ctx, "On")
+	assert.Equal(t, ErrNotOpen, err)
+}
+
+func TestConn_When_FirmwareUnreachable_Expect_OpenFails(t *testing.T) {
+	unreachable := errors.New("unreachable")
+	c := New(amt.Connection{
+		Host: "192.0.2.1",
+		Hooks: amt.Hooks{
+			OnRequest: func(ctx context.Context, request *amt.Request) error {
+				return unreachable
+			},
+		},
+	})
+
+	err := c.Open(context.Background())
+	assert.True(t, errors.Is(err, unreachable), "%v", err)
+	assert.False(t, c.Compatible(context.Background()))
+	_, err = c.PowerStateGet(context.Background())
+	assert.Equal(t, ErrNotOpen, err)
+}
+
+const firmwareEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd">
+<s:Header><a:Action>%s</a:Action></s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+var requestedPowerState = regexp.MustCompile(`PowerState>(\d+)<`)
+
+// newFirmware returns a running machine advertising every power state, which
+// records the states requested from it.
+func newFirmware(requested *[]amt.PowerState) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var action, response string
+		switch {
+		case strings.Contains(string(body), "RequestPowerStateChange"):
+			state, _ := strconv.Atoi(string(requestedPowerState.FindSubmatch(body)[1]))
+			*requested = append(*requested, amt.PowerState(state))
+			action = amt.ResourceCIMPowerManagementService + "/RequestPowerStateChangeResponse"
+			response = fmt.Sprintf(`<g:RequestPowerStateChange_OUTPUT xmlns:g="%s"><g:ReturnValue>0</g:ReturnValue></g:RequestPowerStateChange_OUTPUT>`, amt.ResourceCIMPowerManagementService)
+		case strings.Contains(string(body), "CIM_AssociatedPowerManagementService"):
+			var available strings.Builder
+			for s := amt.PowerStateOn; s <= amt.PowerStatePowerCycleOffHardGraceful; s++ {
+				fmt.Fprintf(&available, `<h:AvailableRequestedPowerStates>%d</h:AvailableRequestedPowerStates>`, s)
+			}
+			action = wsman.ENUMERATE + "Response"
+			response = fmt.Sprintf(`<n:EnumerateResponse xmlns:n="%s"><w:Items><h:CIM_AssociatedPowerManagementService xmlns:h="%s"><h:PowerState>2</h:PowerState>%s</h:CIM_AssociatedPowerManagementService></w:Items><w:EndOfSequence/></n:EnumerateResponse>`,
+				wsman.NS_WSMEN, amt.ResourceCIMAssociatedPowerManagementService, available.String())
+		case strings.Contains(string(body), "CIM_ComputerSystem"):
+			action = wsman.ENUMERATE + "Response"
+			response = fmt.Sprintf(`<n:EnumerateResponse xmlns:n="%s"><w:Items><a:EndpointReference><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address><a:ReferenceParameters><w:ResourceURI>%s</w:ResourceURI><w:SelectorSet><w:Selector Name="Name">ManagedSystem</w:Selector></w:SelectorSet></a:ReferenceParameters></a:EndpointReference></w:Items><w:EndOfSequence/></n:EnumerateResponse>`,
+				wsman.NS_WSMEN, amt.ResourceCIMComputerSystem)
+		default:
+			http.Error(w, "not implemented", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/soap+xml")
+		fmt.Fprintf(w, firmwareEnvelope, action, response)
+	}))
+}
+
+func TestConn_When_PowerSet_Expect_OnlySoftGraceful(t *testing.T) {
+	tests := map[string]amt.PowerState{
+		"off":   amt.PowerStateOffSoft,
+		"soft":  amt.PowerStateOffSoftGraceful,
+		"cycle": amt.PowerStatePowerCycleOffSoft,
+	}
+	for state, want := range tests {
+		t.Run(state, func(t *testing.T) {
+			var requested []amt.PowerState
+			server := newFirmware(&requested)
+			defer server.Close()
+			host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+			portNumber, _ := strconv.Atoi(port)
+			client, err := amt.NewClient(amt.Connection{Host: host, Port: uint32(portNumber), Path: "/wsman"})
+			assert.NoError(t, err)
+			c := &Conn{client: client}
+
+			ok, err := c.PowerSet(context.Background(), state)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []amt.PowerState{want}, requested)
+		})
+	}
+}
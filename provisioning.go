@@ -0,0 +1,152 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+)
+
+// AMT_SetupAndConfigurationService ProvisioningState values.
+const (
+	provisioningStatePre  = "0"
+	provisioningStateIn   = "1"
+	provisioningStatePost = "2"
+)
+
+// ProvisioningState is a state of the provisioning lifecycle of the firmware:
+// unprovisioned, being provisioned remotely, then in client or admin control
+// mode. See CanTransition for the transitions the firmware allows.
+type ProvisioningState string
+
+// Provisioning states. ProvisioningUnknown is returned when the state could
+// not be read.
+const (
+	ProvisioningUnknown ProvisioningState = ""
+	ProvisioningPre     ProvisioningState = "pre-provisioning"
+	ProvisioningIn      ProvisioningState = "in provisioning"
+	ProvisioningClient  ProvisioningState = "client control mode"
+	ProvisioningAdmin   ProvisioningState = "admin control mode"
+)
+
+// provisioningTransitions are the states each state can move to:
+//   - pre-provisioning to client or admin control mode with host based setup,
+//     or in provisioning when remote configuration starts
+//   - in provisioning to admin control mode when remote configuration
+//     completes, back to pre-provisioning when it is aborted or times out
+//   - client control mode to admin control mode with UpgradeClientToAdmin
+//   - any provisioned state back to pre-provisioning with Unprovision
+var provisioningTransitions = map[ProvisioningState][]ProvisioningState{
+	ProvisioningPre:    {ProvisioningIn, ProvisioningClient, ProvisioningAdmin},
+	ProvisioningIn:     {ProvisioningAdmin, ProvisioningPre},
+	ProvisioningClient: {ProvisioningAdmin, ProvisioningPre},
+	ProvisioningAdmin:  {ProvisioningPre},
+}
+
+// ProvisioningTransitionError is returned when the firmware can't move from
+// one provisioning state to another.
+type ProvisioningTransitionError struct {
+	From, To ProvisioningState
+}
+
+func (e *ProvisioningTransitionError) Error() string {
+	return fmt.Sprintf("the firmware can't go from %s to %s", describeProvisioningState(e.From), describeProvisioningState(e.To))
+}
+
+// Next returns the states s can move to, none for ProvisioningUnknown.
+func (s ProvisioningState) Next() []ProvisioningState {
+	return append([]ProvisioningState(nil), provisioningTransitions[s]...)
+}
+
+// CanTransition reports whether the firmware allows moving from s to to.
+func (s ProvisioningState) CanTransition(to ProvisioningState) bool {
+	for _, next := range provisioningTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition returns a *ProvisioningTransitionError when the firmware doesn't
+// allow moving from s to to.
+func (s ProvisioningState) Transition(to ProvisioningState) error {
+	if !s.CanTransition(to) {
+		return &ProvisioningTransitionError{From: s, To: to}
+	}
+	return nil
+}
+
+// Provisioned reports whether the firmware is in client or admin control mode.
+func (s ProvisioningState) Provisioned() bool {
+	return s == ProvisioningClient || s == ProvisioningAdmin
+}
+
+// CanActivate reports whether the firmware can be activated, in client or
+// admin control mode.
+func (s ProvisioningState) CanActivate() bool {
+	return s == ProvisioningPre
+}
+
+// CanUnprovision reports whether the firmware can be returned to
+// pre-provisioning.
+func (s ProvisioningState) CanUnprovision() bool {
+	return s.CanTransition(ProvisioningPre)
+}
+
+// ControlMode returns the control mode of s, ControlModeUnknown while it is
+// in provisioning.
+func (s ProvisioningState) ControlMode() ControlMode {
+	switch s {
+	case ProvisioningPre:
+		return ControlModeNone
+	case ProvisioningClient:
+		return ControlModeClient
+	case ProvisioningAdmin:
+		return ControlModeAdmin
+	}
+	return ControlModeUnknown
+}
+
+func describeProvisioningState(s ProvisioningState) string {
+	if s == ProvisioningUnknown {
+		return "an unknown provisioning state"
+	}
+	return string(s)
+}
+
+func getProvisioningState(ctx context.Context, client *Client) (ProvisioningState, error) {
+	setup, err := getInstance(ctx, client, client.resourceURI(ResourceAMTSetupAndConfigurationService), "ProvisioningState")
+	if err != nil {
+		return ProvisioningUnknown, err
+	}
+	provisioningState := propertyContent(setup, "ProvisioningState")
+	if provisioningState != provisioningStatePost {
+		return parseProvisioningState(provisioningState, "")
+	}
+	// only the host based setup service tells client from admin control mode.
+	hostBased, err := getInstance(ctx, client, client.resourceURI(ResourceIPSHostBasedSetupService), "CurrentControlMode")
+	if err != nil {
+		return ProvisioningUnknown, err
+	}
+	return parseProvisioningState(provisioningState, propertyContent(hostBased, "CurrentControlMode"))
+}
+
+// parseProvisioningState returns the state of the ProvisioningState of
+// AMT_SetupAndConfigurationService and, once provisioned, the
+// CurrentControlMode of IPS_HostBasedSetupService.
+func parseProvisioningState(provisioningState, controlMode string) (ProvisioningState, error) {
+	switch provisioningState {
+	case provisioningStatePre:
+		return ProvisioningPre, nil
+	case provisioningStateIn:
+		return ProvisioningIn, nil
+	case provisioningStatePost:
+		switch controlModes[controlMode] {
+		case ControlModeClient:
+			return ProvisioningClient, nil
+		case ControlModeAdmin:
+			return ProvisioningAdmin, nil
+		}
+		return ProvisioningUnknown, fmt.Errorf("unknown control mode %q of a provisioned firmware", controlMode)
+	}
+	return ProvisioningUnknown, fmt.Errorf("unknown provisioning state %q", provisioningState)
+}
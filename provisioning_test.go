@@ -0,0 +1,43 @@
+package amt
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProvisioningState_When_Provisioned_Expect_ControlMode(t *testing.T) {
+	tests := []struct {
+		provisioningState, controlMode string
+		want                           ProvisioningState
+	}{
+		{"0", "", ProvisioningPre},
+		{"1", "", ProvisioningIn},
+		{"2", "1", ProvisioningClient},
+		{"2", "2", ProvisioningAdmin},
+	}
+	for _, tt := range tests {
+		got, err := parseProvisioningState(tt.provisioningState, tt.controlMode)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+
+	_, err := parseProvisioningState("2", "0")
+	assert.Error(t, err)
+}
+
+func TestProvisioningStateTransition_When_AdminToClient_Expect_Error(t *testing.T) {
+	assert.NoError(t, ProvisioningPre.Transition(ProvisioningClient))
+	assert.NoError(t, ProvisioningClient.Transition(ProvisioningAdmin))
+	assert.True(t, ProvisioningIn.CanUnprovision())
+	assert.False(t, ProvisioningPre.CanUnprovision())
+	assert.Empty(t, ProvisioningUnknown.Next())
+
+	err := ProvisioningAdmin.Transition(ProvisioningClient)
+	var transitionErr *ProvisioningTransitionError
+	if assert.True(t, errors.As(err, &transitionErr)) {
+		assert.Equal(t, ProvisioningAdmin, transitionErr.From)
+		assert.Equal(t, "the firmware can't go from admin control mode to client control mode", err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package amt
+
+import "context"
+
+// quirks adjust behavior for known firmware bugs.
+type quirks struct {
+	// noGracefulTransitions is set for firmware that advertises the graceful
+	// power states but fails to execute them.
+	noGracefulTransitions bool
+	// ignoreAvailablePowerStates is set for firmware that misreports
+	// AvailableRequestedPowerStates, so requests are sent without checking it.
+	ignoreAvailablePowerStates bool
+}
+
+type quirkEntry struct {
+	// minVersion is inclusive, maxVersion is exclusive. Empty means unbounded.
+	minVersion string
+	maxVersion string
+	quirks     quirks
+}
+
+// knownQuirks is matched in order, every matching entry applies.
+var knownQuirks = []quirkEntry{
+	// graceful transitions need the OS notification support added in AMT 9.0.
+	{maxVersion: "9.0", quirks: quirks{noGracefulTransitions: true}},
+}
+
+func quirksForVersion(version string) quirks {
+	var q quirks
+	for _, e := range knownQuirks {
+		if e.minVersion != "" && compareVersions(version, e.minVersion) < 0 {
+			continue
+		}
+		if e.maxVersion != "" && compareVersions(version, e.maxVersion) >= 0 {
+			continue
+		}
+		q.noGracefulTransitions = q.noGracefulTransitions || e.quirks.noGracefulTransitions
+		q.ignoreAvailablePowerStates = q.ignoreAvailablePowerStates || e.quirks.ignoreAvailablePowerStates
+	}
+	return q
+}
+
+// getQuirks returns the quirks of the firmware. When the version can't be
+// detected no quirks apply, a failed detection shouldn't block power actions.
+func getQuirks(ctx context.Context, client *Client) quirks {
+	version, err := getAMTVersion(ctx, client)
+	if err != nil {
+		client.logger.V(1).Info("could not detect the amt version, no quirks applied", "error", err.Error())
+		return quirks{}
+	}
+	return quirksForVersion(version)
+}
+
+func isGracefulState(s PowerState) bool {
+	switch s {
+	case PowerStateOffSoftGraceful, PowerStateOffHardGraceful, PowerStateMasterBusResetGraceful,
+		PowerStatePowerCycleOffSoftGraceful, PowerStatePowerCycleOffHardGraceful:
+		return true
+	}
+	return false
+}
+
+// applyToStates removes the states the quirks rule out from the ones we'd request.
+func (q quirks) applyToStates(states []PowerState) []PowerState {
+	if !q.noGracefulTransitions {
+		return states
+	}
+	filtered := []PowerState{}
+	for _, s := range states {
+		if !isGracefulState(s) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,24 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareVersions_When_ComponentCountDiffers_Expect_MissingAsZero(t *testing.T) {
+	assert.Equal(t, 0, compareVersions("9.0", "9.0.0"))
+	assert.Equal(t, -1, compareVersions("8.1.71", "9.0"))
+	assert.Equal(t, 1, compareVersions("11.8.50", "11.6"))
+}
+
+func TestQuirksForVersion_When_Before9_Expect_NoGracefulTransitions(t *testing.T) {
+	assert.True(t, quirksForVersion("8.1.71").noGracefulTransitions)
+	assert.False(t, quirksForVersion("11.8.50").noGracefulTransitions)
+}
+
+func TestSelectNextStateWithQuirks_When_NoGracefulTransitions_Expect_FirstNonGracefulState(t *testing.T) {
+	available := []PowerState{PowerStateOffSoftGraceful, PowerStateOffSoft}
+	nextState := selectNextStateWithQuirks(quirks{noGracefulTransitions: true}, getPowerOffStates(), available)
+	assert.Equal(t, PowerStateOffSoft, nextState)
+}
@@ -0,0 +1,136 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressReconciliation compares the name and addresses the firmware is
+// configured with to DNS and to the address the client connects to. A stale
+// FQDN in the firmware is the most common cause of failing TLS and CIRA
+// connections: the certificates are issued for it and the MPS matches it.
+type AddressReconciliation struct {
+	// FQDN is the HostName.DomainName of AMT_GeneralSettings.
+	FQDN string
+	// HostOSFQDN is the name reported by the operating system agent, when
+	// there is one.
+	HostOSFQDN string
+	// Target is Connection.Host.
+	Target string
+	// FirmwareIPs are the IP addresses of the network interfaces of the firmware.
+	FirmwareIPs []string
+	// ResolvedIPs are the addresses DNS returns for FQDN and TargetIPs those
+	// of Target, Target itself when it is an IP address.
+	ResolvedIPs []string
+	TargetIPs   []string
+	// Mismatches explain what doesn't match, none when everything does.
+	Mismatches []string
+}
+
+// Consistent reports whether everything matched.
+func (r *AddressReconciliation) Consistent() bool {
+	return len(r.Mismatches) == 0
+}
+
+// lookupHost resolves a name like net.Resolver.LookupHost.
+type lookupHost func(ctx context.Context, host string) ([]string, error)
+
+func reconcileAddresses(ctx context.Context, client *Client, resolver *net.Resolver) (*AddressReconciliation, error) {
+	general, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings))
+	if err != nil {
+		return nil, err
+	}
+	r := &AddressReconciliation{
+		FQDN:       firmwareFQDN(propertyContent(general, "HostName"), propertyContent(general, "DomainName")),
+		HostOSFQDN: propertyContent(general, "HostOSFQDN"),
+		Target:     client.host,
+	}
+	for _, port := range []EthernetPort{WiredPort, WirelessPort} {
+		settings, err := getNetworkSettings(ctx, client, port)
+		if err != nil {
+			// not every machine has a wireless interface.
+			client.logger.V(1).Info("could not read the network settings", "port", string(port), "error", err.Error())
+			continue
+		}
+		if settings.IPAddress != "" && settings.IPAddress != "0.0.0.0" {
+			r.FirmwareIPs = append(r.FirmwareIPs, settings.IPAddress)
+		}
+	}
+
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	r.reconcile(ctx, resolver.LookupHost)
+	return r, nil
+}
+
+func firmwareFQDN(hostName, domainName string) string {
+	if hostName == "" || domainName == "" {
+		return hostName
+	}
+	return hostName + "." + domainName
+}
+
+// reconcile resolves FQDN and Target with lookup and records the mismatches.
+func (r *AddressReconciliation) reconcile(ctx context.Context, lookup lookupHost) {
+	mismatch := func(format string, args ...interface{}) {
+		r.Mismatches = append(r.Mismatches, fmt.Sprintf(format, args...))
+	}
+
+	if r.FQDN == "" {
+		mismatch("the firmware has no FQDN, set its HostName and DomainName")
+	} else {
+		if r.HostOSFQDN != "" && !sameHostName(r.FQDN, r.HostOSFQDN) {
+			mismatch("the firmware FQDN %s is not the FQDN %s of the operating system", r.FQDN, r.HostOSFQDN)
+		}
+		if ips, err := lookup(ctx, r.FQDN); err != nil {
+			mismatch("the firmware FQDN %s does not resolve: %v", r.FQDN, err)
+		} else {
+			r.ResolvedIPs = ips
+			if len(r.FirmwareIPs) > 0 && !intersects(ips, r.FirmwareIPs) {
+				mismatch("the firmware FQDN %s resolves to %s, not to the firmware addresses %s", r.FQDN, strings.Join(ips, ", "), strings.Join(r.FirmwareIPs, ", "))
+			}
+		}
+	}
+
+	if r.Target == "" {
+		return
+	}
+	if net.ParseIP(r.Target) != nil {
+		r.TargetIPs = []string{r.Target}
+	} else {
+		if r.FQDN != "" && !sameHostName(r.Target, r.FQDN) {
+			mismatch("the target %s is not the firmware FQDN %s, TLS certificates issued for the FQDN won't match", r.Target, r.FQDN)
+		}
+		ips, err := lookup(ctx, r.Target)
+		if err != nil {
+			mismatch("the target %s does not resolve: %v", r.Target, err)
+			return
+		}
+		r.TargetIPs = ips
+	}
+	if len(r.FirmwareIPs) > 0 && !intersects(r.TargetIPs, r.FirmwareIPs) {
+		mismatch("the target %s is at %s, not at the firmware addresses %s", r.Target, strings.Join(r.TargetIPs, ", "), strings.Join(r.FirmwareIPs, ", "))
+	}
+}
+
+// sameHostName compares DNS names, which are case insensitive and may be
+// fully qualified with a trailing dot.
+func sameHostName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// intersects reports whether a and b share an IP address.
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		ipX := net.ParseIP(x)
+		for _, y := range b {
+			if ipX != nil && ipX.Equal(net.ParseIP(y)) {
+				return true
+			}
+		}
+	}
+	return false
+}
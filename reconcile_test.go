@@ -0,0 +1,44 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeLookup(records map[string][]string) lookupHost {
+	return func(ctx context.Context, host string) ([]string, error) {
+		if ips, ok := records[host]; ok {
+			return ips, nil
+		}
+		return nil, errors.New("no such host")
+	}
+}
+
+func TestReconcile_When_FQDNMatches_Expect_Consistent(t *testing.T) {
+	r := &AddressReconciliation{
+		FQDN:        "node1.example.com",
+		HostOSFQDN:  "NODE1.example.com.",
+		Target:      "node1.example.com",
+		FirmwareIPs: []string{"10.0.0.5"},
+	}
+	r.reconcile(context.Background(), fakeLookup(map[string][]string{"node1.example.com": {"10.0.0.5"}}))
+	assert.True(t, r.Consistent(), r.Mismatches)
+	assert.Equal(t, []string{"10.0.0.5"}, r.TargetIPs)
+}
+
+func TestReconcile_When_FQDNStale_Expect_Mismatches(t *testing.T) {
+	r := &AddressReconciliation{
+		FQDN:        "old-name.example.com",
+		HostOSFQDN:  "node1.example.com",
+		Target:      "10.0.0.5",
+		FirmwareIPs: []string{"10.0.0.5"},
+	}
+	r.reconcile(context.Background(), fakeLookup(map[string][]string{"old-name.example.com": {"10.0.0.99"}}))
+	assert.Equal(t, []string{
+		"the firmware FQDN old-name.example.com is not the FQDN node1.example.com of the operating system",
+		"the firmware FQDN old-name.example.com resolves to 10.0.0.99, not to the firmware addresses 10.0.0.5",
+	}, r.Mismatches)
+}
@@ -0,0 +1,191 @@
+package amt
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// minimumRecoveryVersion is the first AMT version with One-Click Recovery.
+const minimumRecoveryVersion = "15"
+
+// EnabledState of CIM_BootService, telling whether One-Click Recovery (OCR)
+// and Remote Platform Erase (RPE) are enabled.
+const (
+	bootServiceOCRDisabledRPEDisabled = 32768
+	bootServiceOCREnabledRPEDisabled  = 32769
+	bootServiceOCRDisabledRPEEnabled  = 32770
+	bootServiceOCREnabledRPEEnabled   = 32771
+)
+
+// Types of the UEFI boot parameters, all in the Intel vendor space.
+const (
+	uefiBootParameterVendor        = 0x8086
+	uefiBootParameterNetworkPath   = 1
+	uefiBootParameterHTTPSUser     = 20
+	uefiBootParameterHTTPSPassword = 21
+)
+
+var (
+	// ErrRecoveryNotSupported is returned when the firmware can't do One-Click Recovery.
+	ErrRecoveryNotSupported = errors.New("one-click recovery is not supported by the firmware")
+	// ErrRecoveryDisabled is returned when the BIOS doesn't allow the UEFI HTTPS boot.
+	ErrRecoveryDisabled = errors.New("one-click recovery HTTPS boot is disabled in the BIOS")
+	// ErrRecoveryRequiresTLS is returned when the connection to the firmware or
+	// the recovery image URL is not protected by TLS.
+	ErrRecoveryRequiresTLS = errors.New("one-click recovery requires TLS")
+)
+
+// RecoveryStep is a step of the One-Click Recovery flow.
+type RecoveryStep string
+
+// Steps of Recover, in order.
+const (
+	RecoveryStepTLS          RecoveryStep = "tls"
+	RecoveryStepCapabilities RecoveryStep = "capabilities"
+	RecoveryStepEnable       RecoveryStep = "enable"
+	RecoveryStepBootSettings RecoveryStep = "boot settings"
+	RecoveryStepBootOrder    RecoveryStep = "boot order"
+	RecoveryStepPower        RecoveryStep = "power"
+)
+
+// RecoveryError is returned by Recover with the step that failed. Err is one
+// of the ErrRecovery errors or the error of the request.
+type RecoveryError struct {
+	Step RecoveryStep
+	Err  error
+}
+
+func (e *RecoveryError) Error() string {
+	return fmt.Sprintf("one-click recovery failed at the %s step: %v", e.Step, e.Err)
+}
+
+func (e *RecoveryError) Unwrap() error {
+	return e.Err
+}
+
+// RecoveryOptions describe the image booted by Recover.
+type RecoveryOptions struct {
+	// URL of the UEFI boot image, it must be https.
+	URL string
+	// Username and Password authenticate to the HTTPS server, when set.
+	Username string
+	Password string
+}
+
+type uefiBootParameter struct {
+	Type  uint16
+	Value []byte
+}
+
+// encodeUEFIBootParameters encodes params as the base64 UefiBootParametersArray
+// of AMT_BootSettingData: the vendor and the type as 16 bit, the length as 32 bit
+// little endian integers followed by the value.
+func encodeUEFIBootParameters(params []uefiBootParameter) string {
+	var b bytes.Buffer
+	for _, p := range params {
+		header := make([]byte, 8)
+		binary.LittleEndian.PutUint16(header[0:2], uefiBootParameterVendor)
+		binary.LittleEndian.PutUint16(header[2:4], p.Type)
+		binary.LittleEndian.PutUint32(header[4:8], uint32(len(p.Value)))
+		b.Write(header)
+		b.Write(p.Value)
+	}
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+func (o RecoveryOptions) bootParameters() []uefiBootParameter {
+	params := []uefiBootParameter{{Type: uefiBootParameterNetworkPath, Value: []byte(o.URL)}}
+	if o.Username != "" {
+		params = append(params, uefiBootParameter{Type: uefiBootParameterHTTPSUser, Value: []byte(o.Username)})
+	}
+	if o.Password != "" {
+		params = append(params, uefiBootParameter{Type: uefiBootParameterHTTPSPassword, Value: []byte(o.Password)})
+	}
+	return params
+}
+
+func recoverMachine(ctx context.Context, client *Client, options RecoveryOptions) error {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return &RecoveryError{Step: RecoveryStepTLS, Err: client.redact(err, options.Password)}
+	}
+	// the boot parameters may hold the credentials of the HTTPS server.
+	if !client.tls || u.Scheme != "https" {
+		return &RecoveryError{Step: RecoveryStepTLS, Err: ErrRecoveryRequiresTLS}
+	}
+
+	steps := []struct {
+		step RecoveryStep
+		run  func() error
+	}{
+		{RecoveryStepCapabilities, func() error { return checkRecoveryCapabilities(ctx, client) }},
+		{RecoveryStepEnable, func() error { return enableRecovery(ctx, client) }},
+		{RecoveryStepBootSettings, func() error { return setBootSettingData(ctx, client, options.bootParameters()...) }},
+		{RecoveryStepBootOrder, func() error {
+			if err := setBootConfigRole(ctx, client, bootConfigRoleIsNextSingleUse); err != nil {
+				return err
+			}
+			return changeBootOrder(ctx, client, []string{BootSourceOCRHTTPS})
+		}},
+		{RecoveryStepPower, func() error { return powerCycle(ctx, client) }},
+	}
+	for _, s := range steps {
+		run := s.run
+		if err := client.step(OperationRecover, string(s.step), func() error { return client.redact(run(), options.Password) }); err != nil {
+			return &RecoveryError{Step: s.step, Err: err}
+		}
+	}
+	return nil
+}
+
+func checkRecoveryCapabilities(ctx context.Context, client *Client) error {
+	version, err := getAMTVersion(ctx, client)
+	if err != nil {
+		return err
+	}
+	if compareVersions(version, minimumRecoveryVersion) < 0 {
+		return fmt.Errorf("%w: AMT %s is older than %s", ErrRecoveryNotSupported, version, minimumRecoveryVersion)
+	}
+	capabilities, err := getInstance(ctx, client, client.resourceURI(ResourceAMTBootCapabilities), "ForceUEFIHTTPSBoot")
+	if err != nil {
+		return err
+	}
+	if propertyContent(capabilities, "ForceUEFIHTTPSBoot") != "true" {
+		return ErrRecoveryNotSupported
+	}
+	settings, err := getBootSettingData(ctx, client)
+	if err != nil {
+		return err
+	}
+	if propertyContent(settings, "UEFIHTTPSBootEnabled") != "true" {
+		return ErrRecoveryDisabled
+	}
+	return nil
+}
+
+// enableRecovery enables One-Click Recovery in CIM_BootService, keeping the
+// state of Remote Platform Erase.
+func enableRecovery(ctx context.Context, client *Client) error {
+	resource := client.resourceURI(ResourceCIMBootService)
+	properties, err := getInstance(ctx, client, resource, "EnabledState")
+	if err != nil {
+		return err
+	}
+	state, err := strconv.Atoi(propertyContent(properties, "EnabledState"))
+	if err != nil {
+		return fmt.Errorf("invalid CIM_BootService EnabledState: %v", err)
+	}
+	switch state {
+	case bootServiceOCRDisabledRPEDisabled:
+		return requestStateChange(ctx, client, resource, bootServiceOCREnabledRPEDisabled)
+	case bootServiceOCRDisabledRPEEnabled:
+		return requestStateChange(ctx, client, resource, bootServiceOCREnabledRPEEnabled)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package amt
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeUEFIBootParameters_When_URLAndUser_Expect_IntelTLV(t *testing.T) {
+	params := RecoveryOptions{URL: "https://a/b", Username: "u"}.bootParameters()
+	encoded, err := base64.StdEncoding.DecodeString(encodeUEFIBootParameters(params))
+	assert.NoError(t, err)
+	expected := append([]byte{0x86, 0x80, 1, 0, 11, 0, 0, 0}, "https://a/b"...)
+	expected = append(expected, 0x86, 0x80, 20, 0, 1, 0, 0, 0, 'u')
+	assert.Equal(t, expected, encoded)
+}
+
+func TestRecover_When_NotTLS_Expect_RecoveryError(t *testing.T) {
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				t.Errorf("unexpected request %s", request.Action)
+				return errors.New("unexpected")
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	err = client.Recover(context.Background(), RecoveryOptions{URL: "https://192.0.2.2/recovery.efi"})
+	var recoveryErr *RecoveryError
+	if assert.True(t, errors.As(err, &recoveryErr)) {
+		assert.Equal(t, RecoveryStepTLS, recoveryErr.Step)
+	}
+	assert.True(t, errors.Is(err, ErrRecoveryRequiresTLS))
+}
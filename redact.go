@@ -0,0 +1,81 @@
+package amt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// authorizationPatterns match authorization material echoed in errors, e.g.
+// by a firmware or proxy returning the request in an error page, with their
+// replacement.
+var authorizationPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)((?:proxy-)?authorization["']?\s*[:=]\s*)[^\r\n]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(Digest\s+)username="[^\r\n]*`), "${1}" + redacted},
+	{regexp.MustCompile(`(//)[^/@\s:]+:[^/@\s]+@`), "${1}" + redacted + "@"},
+}
+
+// redactedError is an error whose message had secrets removed. It unwraps to
+// the original error so errors.Is and errors.As keep working; the secrets are
+// only reachable by unwrapping.
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// credentialSecrets returns the secrets of connection: the password and the
+// authorization headers.
+func credentialSecrets(connection Connection) []string {
+	var secrets []string
+	if connection.Pass != "" {
+		secrets = append(secrets, connection.Pass)
+	}
+	for _, name := range []string{"Authorization", "Proxy-Authorization"} {
+		for _, value := range connection.Header.Values(name) {
+			if value != "" {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+	return secrets
+}
+
+// redactError removes secrets and authorization material from the message
+// of err. It returns err itself when there was nothing to remove.
+func redactError(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+	message := redactString(err.Error(), secrets...)
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, message: message}
+}
+
+func redactString(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	for _, p := range authorizationPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// redact removes the credentials of the client and secrets from the message of err.
+func (c *Client) redact(err error, secrets ...string) error {
+	return redactError(err, append(append([]string{}, c.secrets...), secrets...)...)
+}
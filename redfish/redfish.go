@@ -0,0 +1,303 @@
+// Package redfish serves a minimal Redfish API backed by AMT: the power state,
+// ComputerSystem.Reset and a one time boot override of each machine. It lets
+// Redfish only tooling, e.g. the redfish driver of Ironic, drive AMT machines.
+package redfish
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	amt "github.com/jacobweinstock/go-amt"
+)
+
+// Machine is the part of *amt.Client the handler uses.
+type Machine interface {
+	PowerStatus(ctx context.Context) (*amt.PowerStatus, error)
+	SetPower(ctx context.Context, action amt.PowerAction) (amt.PowerResult, error)
+	SetNextBoot(ctx context.Context, source string) error
+}
+
+const (
+	rootPath    = "/redfish/v1"
+	systemsPath = rootPath + "/Systems"
+	resetAction = "/Actions/ComputerSystem.Reset"
+)
+
+// resetActions maps the Redfish ResetType values to power actions. The
+// graceful types only request the states the operating system takes part in
+// and the forced ones only those it doesn't, neither falls back to the other.
+var resetActions = map[string]amt.PowerAction{
+	"On":               amt.PowerActionOn,
+	"ForceOn":          amt.PowerActionOn,
+	"ForceOff":         amt.PowerActionHardOff,
+	"GracefulShutdown": amt.PowerActionSoft,
+	"ForceRestart":     amt.PowerActionHardCycle,
+	"GracefulRestart":  amt.PowerActionSoftCycle,
+	"PowerCycle":       amt.PowerActionHardCycle,
+}
+
+// bootTargets maps the Redfish BootSourceOverrideTarget values to boot sources.
+var bootTargets = map[string]string{
+	"Pxe": amt.BootSourcePXE,
+	"Hdd": amt.BootSourceHardDrive,
+	"Cd":  amt.BootSourceCDDVD,
+}
+
+// Handler serves the Redfish API of Systems. Access control is up to the
+// caller, anyone reaching the handler can power the machines.
+type Handler struct {
+	// Systems are the machines by their Redfish Id, e.g. "1".
+	Systems map[string]Machine
+	// OnError, when set, is called with the errors of the machines.
+	OnError func(error)
+
+	mu sync.Mutex
+	// overrides are the boot override targets set since the last reset.
+	overrides map[string]string
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == rootPath:
+		h.serveRoot(w, r)
+	case path == systemsPath:
+		h.serveSystems(w, r)
+	case strings.HasPrefix(path, systemsPath+"/"):
+		id := strings.TrimPrefix(path, systemsPath+"/")
+		action := ""
+		if i := strings.Index(id, "/"); i >= 0 {
+			id, action = id[:i], id[i:]
+		}
+		machine, ok := h.Systems[id]
+		if !ok || (action != "" && action != resetAction) {
+			writeError(w, http.StatusNotFound, "Base.1.0.ResourceMissingAtURI", fmt.Sprintf("%s was not found", r.URL.Path))
+			return
+		}
+		if action == resetAction {
+			h.serveReset(w, r, id, machine)
+			return
+		}
+		h.serveSystem(w, r, id, machine)
+	default:
+		writeError(w, http.StatusNotFound, "Base.1.0.ResourceMissingAtURI", fmt.Sprintf("%s was not found", r.URL.Path))
+	}
+}
+
+func (h *Handler) serveRoot(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@odata.id":      rootPath,
+		"@odata.type":    "#ServiceRoot.v1_5_0.ServiceRoot",
+		"Id":             "RootService",
+		"Name":           "AMT Redfish Service",
+		"RedfishVersion": "1.6.0",
+		"Systems":        link(systemsPath),
+	})
+}
+
+func (h *Handler) serveSystems(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+	ids := make([]string, 0, len(h.Systems))
+	for id := range h.Systems {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, link(systemsPath+"/"+id))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@odata.id":           systemsPath,
+		"@odata.type":         "#ComputerSystemCollection.ComputerSystemCollection",
+		"Name":                "Computer System Collection",
+		"Members":             members,
+		"Members@odata.count": len(members),
+	})
+}
+
+func (h *Handler) serveSystem(w http.ResponseWriter, r *http.Request, id string, machine Machine) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPatch) {
+		return
+	}
+	if r.Method == http.MethodPatch {
+		var patch struct {
+			Boot *struct {
+				BootSourceOverrideEnabled string
+				BootSourceOverrideTarget  string
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "Base.1.0.MalformedJSON", err.Error())
+			return
+		}
+		if patch.Boot != nil {
+			if status, code, err := h.setBootOverride(r.Context(), id, machine, patch.Boot.BootSourceOverrideEnabled, patch.Boot.BootSourceOverrideTarget); err != nil {
+				writeError(w, status, code, err.Error())
+				return
+			}
+		}
+	}
+
+	// PowerState is null when it can't be read after a patch, which was
+	// applied all the same.
+	var powerState interface{}
+	status, err := machine.PowerStatus(r.Context())
+	switch {
+	case err == nil && status.State == amt.PowerStateOn:
+		powerState = "On"
+	case err == nil:
+		powerState = "Off"
+	case r.Method == http.MethodPatch:
+		h.error(fmt.Errorf("system %s: %w", id, err))
+	default:
+		h.error(fmt.Errorf("system %s: %w", id, err))
+		writeError(w, http.StatusBadGateway, "Base.1.0.GeneralError", err.Error())
+		return
+	}
+	h.mu.Lock()
+	target := h.overrides[id]
+	h.mu.Unlock()
+	enabled := "Once"
+	if target == "" {
+		target, enabled = "None", "Disabled"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"@odata.id":   systemsPath + "/" + id,
+		"@odata.type": "#ComputerSystem.v1_10_0.ComputerSystem",
+		"Id":          id,
+		"Name":        "Intel AMT System " + id,
+		"PowerState":  powerState,
+		"Boot": map[string]interface{}{
+			"BootSourceOverrideEnabled":                        enabled,
+			"BootSourceOverrideTarget":                         target,
+			"BootSourceOverrideTarget@Redfish.AllowableValues": []string{"None", "Pxe", "Hdd", "Cd"},
+		},
+		"Actions": map[string]interface{}{
+			"#ComputerSystem.Reset": map[string]interface{}{
+				"target":                            systemsPath + "/" + id + resetAction,
+				"ResetType@Redfish.AllowableValues": allowedResetTypes(),
+			},
+		},
+	})
+}
+
+// setBootOverride sets the next boot source of the machine. AMT boot
+// overrides apply to the next boot only, so only Once is supported.
+func (h *Handler) setBootOverride(ctx context.Context, id string, machine Machine, enabled, target string) (int, string, error) {
+	if enabled == "Continuous" {
+		return http.StatusBadRequest, "Base.1.0.PropertyValueNotInList", fmt.Errorf("BootSourceOverrideEnabled %q is not supported, AMT only overrides the next boot", enabled)
+	}
+	if enabled == "Disabled" || target == "None" {
+		h.setOverride(id, "")
+		return 0, "", nil
+	}
+	if target == "" {
+		return 0, "", nil
+	}
+	source, ok := bootTargets[target]
+	if !ok {
+		return http.StatusBadRequest, "Base.1.0.PropertyValueNotInList", fmt.Errorf("BootSourceOverrideTarget %q is not supported", target)
+	}
+	if err := machine.SetNextBoot(ctx, source); err != nil {
+		h.error(fmt.Errorf("system %s: %w", id, err))
+		return http.StatusBadGateway, "Base.1.0.GeneralError", err
+	}
+	h.setOverride(id, target)
+	return 0, "", nil
+}
+
+func (h *Handler) setOverride(id, target string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.overrides == nil {
+		h.overrides = map[string]string{}
+	}
+	if target == "" {
+		delete(h.overrides, id)
+		return
+	}
+	h.overrides[id] = target
+}
+
+func (h *Handler) serveReset(w http.ResponseWriter, r *http.Request, id string, machine Machine) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var body struct {
+		ResetType string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "Base.1.0.MalformedJSON", err.Error())
+		return
+	}
+	action, ok := resetActions[body.ResetType]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Base.1.0.ActionParameterNotSupported", fmt.Sprintf("ResetType %q is not supported, allowed values are %v", body.ResetType, allowedResetTypes()))
+		return
+	}
+	if _, err := machine.SetPower(r.Context(), action); err != nil {
+		h.error(fmt.Errorf("system %s: %w", id, err))
+		writeError(w, http.StatusBadGateway, "Base.1.0.GeneralError", err.Error())
+		return
+	}
+	// the override was consumed by the boot, if there was one.
+	if action != amt.PowerActionHardOff && action != amt.PowerActionSoft {
+		h.setOverride(id, "")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) error(err error) {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+}
+
+func allowedResetTypes() []string {
+	types := make([]string, 0, len(resetActions))
+	for t := range resetActions {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Base.1.0.GeneralError", fmt.Sprintf("method %s is not allowed", r.Method))
+	return false
+}
+
+func link(path string) map[string]string {
+	return map[string]string{"@odata.id": path}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
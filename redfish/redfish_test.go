@@ -0,0 +1,187 @@
+package redfish
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	amt "github.com/jacobweinstock/go-amt"
+	"github.com/jacobweinstock/wsman"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ Machine = (*amt.Client)(nil)
+
+type fakeMachine struct {
+	state     amt.PowerState
+	statusErr error
+	actions   []amt.PowerAction
+	nextBoot  string
+}
+
+func (m *fakeMachine) PowerStatus(ctx context.Context) (*amt.PowerStatus, error) {
+	if m.statusErr != nil {
+		return nil, m.statusErr
+	}
+	return &amt.PowerStatus{State: m.state}, nil
+}
+
+func (m *fakeMachine) SetPower(ctx context.Context, action amt.PowerAction) (amt.PowerResult, error) {
+	m.actions = append(m.actions, action)
+	return amt.PowerResultRequested, nil
+}
+
+func (m *fakeMachine) SetNextBoot(ctx context.Context, source string) error {
+	m.nextBoot = source
+	return nil
+}
+
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestHandler_When_BootOverrideAndReset_Expect_MachineDriven(t *testing.T) {
+	machine := &fakeMachine{state: amt.PowerStateOn}
+	h := &Handler{Systems: map[string]Machine{"1": machine}}
+
+	w := serve(h, http.MethodGet, "/redfish/v1/Systems", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"/redfish/v1/Systems/1"`)
+
+	w = serve(h, http.MethodPatch, "/redfish/v1/Systems/1", `{"Boot":{"BootSourceOverrideEnabled":"Once","BootSourceOverrideTarget":"Pxe"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, amt.BootSourcePXE, machine.nextBoot)
+	var system struct {
+		PowerState string
+		Boot       struct {
+			BootSourceOverrideEnabled string
+			BootSourceOverrideTarget  string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &system))
+	assert.Equal(t, "On", system.PowerState)
+	assert.Equal(t, "Once", system.Boot.BootSourceOverrideEnabled)
+	assert.Equal(t, "Pxe", system.Boot.BootSourceOverrideTarget)
+
+	w = serve(h, http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", `{"ResetType":"ForceRestart"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []amt.PowerAction{amt.PowerActionHardCycle}, machine.actions)
+	w = serve(h, http.MethodGet, "/redfish/v1/Systems/1", "")
+	assert.Contains(t, w.Body.String(), `"BootSourceOverrideEnabled":"Disabled"`)
+
+	w = serve(h, http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", `{"ResetType":"Nmi"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(h, http.MethodPatch, "/redfish/v1/Systems/1", `{"Boot":{"BootSourceOverrideEnabled":"Continuous","BootSourceOverrideTarget":"Hdd"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(h, http.MethodGet, "/redfish/v1/Systems/2", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_When_PowerStatusFailsAfterPatch_Expect_OverrideReported(t *testing.T) {
+	machine := &fakeMachine{statusErr: errors.New("connection reset")}
+	h := &Handler{Systems: map[string]Machine{"1": machine}}
+
+	w := serve(h, http.MethodPatch, "/redfish/v1/Systems/1", `{"Boot":{"BootSourceOverrideEnabled":"Once","BootSourceOverrideTarget":"Pxe"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, amt.BootSourcePXE, machine.nextBoot)
+	var system struct {
+		PowerState *string
+		Boot       struct {
+			BootSourceOverrideEnabled string
+			BootSourceOverrideTarget  string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &system))
+	assert.Nil(t, system.PowerState)
+	assert.Equal(t, "Once", system.Boot.BootSourceOverrideEnabled)
+	assert.Equal(t, "Pxe", system.Boot.BootSourceOverrideTarget)
+
+	// nothing was changed by a get, the failure is reported.
+	w = serve(h, http.MethodGet, "/redfish/v1/Systems/1", "")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+const firmwareEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd">
+<s:Header><a:Action>%s</a:Action></s:Header>
+<s:Body>%s</s:Body>
+</s:Envelope>`
+
+var requestedPowerState = regexp.MustCompile(`PowerState>(\d+)<`)
+
+// fakeFirmware is a running machine advertising every power state. It
+// records the states requested from it.
+type fakeFirmware struct {
+	mu        sync.Mutex
+	requested []amt.PowerState
+}
+
+func (f *fakeFirmware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var action, response string
+	switch {
+	case strings.Contains(string(body), "RequestPowerStateChange"):
+		state, _ := strconv.Atoi(string(requestedPowerState.FindSubmatch(body)[1]))
+		f.mu.Lock()
+		f.requested = append(f.requested, amt.PowerState(state))
+		f.mu.Unlock()
+		action = amt.ResourceCIMPowerManagementService + "/RequestPowerStateChangeResponse"
+		response = fmt.Sprintf(`<g:RequestPowerStateChange_OUTPUT xmlns:g="%s"><g:ReturnValue>0</g:ReturnValue></g:RequestPowerStateChange_OUTPUT>`, amt.ResourceCIMPowerManagementService)
+	case strings.Contains(string(body), "CIM_AssociatedPowerManagementService"):
+		var available strings.Builder
+		for s := amt.PowerStateOn; s <= amt.PowerStatePowerCycleOffHardGraceful; s++ {
+			fmt.Fprintf(&available, `<h:AvailableRequestedPowerStates>%d</h:AvailableRequestedPowerStates>`, s)
+		}
+		action = wsman.ENUMERATE + "Response"
+		response = fmt.Sprintf(`<n:EnumerateResponse xmlns:n="%s"><w:Items><h:CIM_AssociatedPowerManagementService xmlns:h="%s"><h:PowerState>2</h:PowerState>%s</h:CIM_AssociatedPowerManagementService></w:Items><w:EndOfSequence/></n:EnumerateResponse>`,
+			wsman.NS_WSMEN, amt.ResourceCIMAssociatedPowerManagementService, available.String())
+	case strings.Contains(string(body), "CIM_ComputerSystem"):
+		action = wsman.ENUMERATE + "Response"
+		response = fmt.Sprintf(`<n:EnumerateResponse xmlns:n="%s"><w:Items><a:EndpointReference><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address><a:ReferenceParameters><w:ResourceURI>%s</w:ResourceURI><w:SelectorSet><w:Selector Name="Name">ManagedSystem</w:Selector></w:SelectorSet></a:ReferenceParameters></a:EndpointReference></w:Items><w:EndOfSequence/></n:EnumerateResponse>`,
+			wsman.NS_WSMEN, amt.ResourceCIMComputerSystem)
+	default:
+		// e.g. the software identities of the quirks, the client does without them.
+		http.Error(w, "not implemented", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/soap+xml")
+	fmt.Fprintf(w, firmwareEnvelope, action, response)
+}
+
+func TestHandler_When_Reset_Expect_GracefulOnlyForGracefulTypes(t *testing.T) {
+	tests := map[string]amt.PowerState{
+		"ForceOff":         amt.PowerStateOffSoft,
+		"GracefulShutdown": amt.PowerStateOffSoftGraceful,
+		"ForceRestart":     amt.PowerStatePowerCycleOffSoft,
+		"GracefulRestart":  amt.PowerStatePowerCycleOffSoftGraceful,
+		"PowerCycle":       amt.PowerStatePowerCycleOffSoft,
+	}
+	for resetType, want := range tests {
+		t.Run(resetType, func(t *testing.T) {
+			firmware := &fakeFirmware{}
+			server := httptest.NewServer(firmware)
+			defer server.Close()
+			host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+			portNumber, _ := strconv.Atoi(port)
+			client, err := amt.NewClient(amt.Connection{Host: host, Port: uint32(portNumber), Path: "/wsman"})
+			assert.NoError(t, err)
+			h := &Handler{Systems: map[string]Machine{"1": client}}
+
+			w := serve(h, http.MethodPost, "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset", fmt.Sprintf(`{"ResetType":%q}`, resetType))
+			assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+			assert.Equal(t, []amt.PowerState{want}, firmware.requested)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package redirection
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+)
+
+// KVMProxy exposes the KVM of a machine as a plain RFB (VNC) endpoint. Each
+// accepted connection gets its own redirection session, so any VNC client can
+// connect without knowing about the redirection handshake. KVM must be enabled
+// on the machine and, in client control mode, user consent given.
+type KVMProxy struct {
+	// Host of the machine, with an optional port.
+	Host   string
+	Config Config
+	// OnError, when set, is called with the errors of individual connections.
+	OnError func(error)
+}
+
+// Serve accepts connections on l until it is closed.
+func (p *KVMProxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := p.ServeConn(context.Background(), conn); err != nil && p.OnError != nil {
+				p.OnError(err)
+			}
+		}()
+	}
+}
+
+// ListenAndServe listens on the local address and calls Serve.
+func (p *KVMProxy) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return p.Serve(l)
+}
+
+// ServeConn proxies a single RFB client connection. conn is closed when done.
+func (p *KVMProxy) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	remote, err := Dial(ctx, p.Host, ProtocolKVM, p.Config)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	return pipe(conn, remote)
+}
+
+// pipe copies between a and b until either side is done.
+func pipe(a, b io.ReadWriteCloser) error {
+	var once sync.Once
+	var result error
+	done := make(chan struct{})
+	copyTo := func(dst, src io.ReadWriteCloser) {
+		_, err := io.Copy(dst, src)
+		once.Do(func() {
+			result = err
+			close(done)
+		})
+	}
+	go copyTo(a, b)
+	go copyTo(b, a)
+	<-done
+	// unblock the other copy.
+	a.Close()
+	b.Close()
+	return result
+}
@@ -0,0 +1,300 @@
+// Package redirection implements the AMT redirection protocol used by the
+// Serial-over-LAN, IDE redirection and KVM features. A session starts with a
+// small handshake on port 16994 (16995 with TLS) that selects the feature and
+// authenticates the user, after which the connection carries the raw feature
+// traffic.
+package redirection
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Default redirection ports.
+const (
+	Port    = 16994
+	TLSPort = 16995
+)
+
+// Protocol selects the feature of a redirection session.
+type Protocol string
+
+// Redirection protocols.
+const (
+	ProtocolSOL  Protocol = "SOL "
+	ProtocolIDER Protocol = "IDER"
+	ProtocolKVM  Protocol = "KVMR"
+)
+
+const (
+	startRedirectionSession      = 0x10
+	startRedirectionSessionReply = 0x11
+	authenticateSession          = 0x13
+	authenticateSessionReply     = 0x14
+)
+
+const (
+	authQuery        = 0
+	authUserPassword = 1
+	authDigest       = 4
+
+	authStatusSuccess = 0
+	authStatusFailure = 1
+)
+
+// authURI is the URI the digest response is computed over.
+const authURI = "/RedirectionService"
+
+// maxAuthDataLength bounds the auth data of a reply so a bad peer can't make us allocate freely.
+const maxAuthDataLength = 1 << 16
+
+// ErrAuthentication is returned when the firmware rejects the credentials.
+var ErrAuthentication = errors.New("redirection: authentication failed")
+
+// Config controls how redirection sessions are established.
+type Config struct {
+	Username string
+	Password string
+	// TLSConfig enables TLS. The default port becomes TLSPort.
+	TLSConfig *tls.Config
+	// DialContext opens the underlying connection. A net.Dialer is used when nil.
+	DialContext func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Dial connects to the redirection service of host and starts a session for
+// protocol. When host has no port the default one is used. The returned
+// connection carries the feature traffic, e.g. RFB for ProtocolKVM.
+func Dial(ctx context.Context, host string, protocol Protocol, config Config) (net.Conn, error) {
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		port := Port
+		if config.TLSConfig != nil {
+			port = TLSPort
+		}
+		address = net.JoinHostPort(host, fmt.Sprint(port))
+	}
+	dial := config.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if config.TLSConfig != nil {
+		tlsConn := tls.Client(conn, config.TLSConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := Handshake(conn, protocol, config.Username, config.Password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// Handshake starts a session for protocol on conn and authenticates. The
+// returned connection must be used instead of conn, it holds data the firmware
+// may already have sent past the handshake.
+func Handshake(conn net.Conn, protocol Protocol, username, password string) (net.Conn, error) {
+	if len(protocol) != 4 {
+		return nil, fmt.Errorf("invalid redirection protocol %q", protocol)
+	}
+	r := bufio.NewReader(conn)
+
+	if _, err := conn.Write(append([]byte{startRedirectionSession, 0, 0, 0}, protocol...)); err != nil {
+		return nil, err
+	}
+	if err := readStartReply(r); err != nil {
+		return nil, err
+	}
+
+	if err := writeAuth(conn, authQuery, nil); err != nil {
+		return nil, err
+	}
+	status, authType, data, err := readAuthReply(r)
+	if err != nil {
+		return nil, err
+	}
+	if authType != authQuery || status != authStatusSuccess {
+		return nil, fmt.Errorf("unexpected reply to the authentication query: type %d, status %d", authType, status)
+	}
+
+	switch {
+	case containsByte(data, authDigest):
+		// an empty digest request makes the firmware send its challenge.
+		err = writeAuth(conn, authDigest, joinFields(username, "", "", authURI, "", "", "", ""))
+		if err != nil {
+			return nil, err
+		}
+		status, authType, data, err = readAuthReply(r)
+		if err != nil {
+			return nil, err
+		}
+		if status != authStatusFailure || authType != authDigest {
+			return nil, fmt.Errorf("unexpected reply to the digest request: type %d, status %d", authType, status)
+		}
+		response, err := digestResponse(username, password, data)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeAuth(conn, authDigest, response); err != nil {
+			return nil, err
+		}
+	case containsByte(data, authUserPassword):
+		if err := writeAuth(conn, authUserPassword, joinFields(username, password)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("no supported authentication method offered: %v", data)
+	}
+
+	status, _, _, err = readAuthReply(r)
+	if err != nil {
+		return nil, err
+	}
+	if status != authStatusSuccess {
+		return nil, ErrAuthentication
+	}
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+func readStartReply(r *bufio.Reader) error {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return err
+	}
+	if header[0] != startRedirectionSessionReply {
+		return fmt.Errorf("unexpected message 0x%02x, expected a session reply", header[0])
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("redirection session refused with status %d", header[1])
+	}
+	if _, err := io.ReadFull(r, header[2:]); err != nil {
+		return err
+	}
+	// the reply ends with OEM defined data.
+	_, err := io.CopyN(io.Discard, r, int64(header[12]))
+	return err
+}
+
+func writeAuth(w io.Writer, authType byte, data []byte) error {
+	msg := make([]byte, 9, 9+len(data))
+	msg[0] = authenticateSession
+	msg[4] = authType
+	binary.LittleEndian.PutUint32(msg[5:9], uint32(len(data)))
+	_, err := w.Write(append(msg, data...))
+	return err
+}
+
+func readAuthReply(r *bufio.Reader) (status, authType byte, data []byte, err error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	if header[0] != authenticateSessionReply {
+		return 0, 0, nil, fmt.Errorf("unexpected message 0x%02x, expected an authentication reply", header[0])
+	}
+	length := binary.LittleEndian.Uint32(header[5:9])
+	if length > maxAuthDataLength {
+		return 0, 0, nil, fmt.Errorf("authentication reply of %d bytes is too long", length)
+	}
+	data = make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, 0, nil, err
+	}
+	return header[1], header[4], data, nil
+}
+
+// digestResponse answers the digest challenge, holding the realm, nonce and qop.
+func digestResponse(username, password string, challenge []byte) ([]byte, error) {
+	fields, err := splitFields(challenge, 3)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest challenge: %v", err)
+	}
+	realm, nonce, qop := fields[0], fields[1], fields[2]
+	cnonce, err := newCnonce()
+	if err != nil {
+		return nil, err
+	}
+	nc := "00000002"
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex("POST:" + authURI)
+	response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	return joinFields(username, realm, nonce, authURI, cnonce, nc, response, qop), nil
+}
+
+// joinFields encodes strings prefixed with their one byte length.
+func joinFields(fields ...string) []byte {
+	var b []byte
+	for _, f := range fields {
+		b = append(b, byte(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func splitFields(b []byte, n int) ([]string, error) {
+	fields := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if len(b) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		l := int(b[0])
+		if len(b) < 1+l {
+			return nil, io.ErrUnexpectedEOF
+		}
+		fields = append(fields, string(b[1:1+l]))
+		b = b[1+l:]
+	}
+	return fields, nil
+}
+
+func containsByte(b []byte, c byte) bool {
+	for _, x := range b {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", b), nil
+}
+
+func md5Hex(s string) string {
+	return fmt.Sprintf("%x", md5.Sum([]byte(s)))
+}
+
+// bufferedConn reads through the buffer used during the handshake.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,360 @@
+package redirection
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeFirmware answers the handshake for protocol with a digest challenge and
+// checks the response for username and password.
+func fakeFirmware(t *testing.T, conn net.Conn, protocol Protocol, username, password string) {
+	t.Helper()
+	r := bufio.NewReader(conn)
+	start := make([]byte, 8)
+	if _, err := io.ReadFull(r, start); err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, append([]byte{startRedirectionSession, 0, 0, 0}, protocol...), start)
+	conn.Write([]byte{startRedirectionSessionReply, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0xaa, 0xbb})
+
+	reply := func(status, authType byte, data []byte) {
+		msg := make([]byte, 9)
+		msg[0] = authenticateSessionReply
+		msg[1] = status
+		msg[4] = authType
+		binary.LittleEndian.PutUint32(msg[5:], uint32(len(data)))
+		conn.Write(append(msg, data...))
+	}
+
+	_, authType, _, err := readAuth(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, byte(authQuery), authType)
+	reply(authStatusSuccess, authQuery, []byte{authUserPassword, authDigest})
+
+	_, data, err := readAuthData(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, joinFields(username, "", "", authURI, "", "", "", ""), data)
+	reply(authStatusFailure, authDigest, joinFields("Digest:realm", "nonce", "auth"))
+
+	_, data, err = readAuthData(r)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fields, err := splitFields(data, 8)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ha1 := md5Hex(username + ":Digest:realm:" + password)
+	want := md5Hex(ha1 + ":nonce:" + fields[5] + ":" + fields[4] + ":auth:" + md5Hex("POST:"+authURI))
+	if fields[6] != want {
+		reply(authStatusFailure, authDigest, nil)
+		return
+	}
+	reply(authStatusSuccess, authDigest, nil)
+	if protocol == ProtocolKVM {
+		// the RFB server speaks first.
+		conn.Write([]byte("RFB 003.008\n"))
+	}
+}
+
+func readAuth(r *bufio.Reader) (status, authType byte, data []byte, err error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	data = make([]byte, binary.LittleEndian.Uint32(header[5:]))
+	_, err = io.ReadFull(r, data)
+	return header[1], header[4], data, err
+}
+
+func readAuthData(r *bufio.Reader) (byte, []byte, error) {
+	_, authType, data, err := readAuth(r)
+	return authType, data, err
+}
+
+func TestHandshake_When_DigestIsOffered_Expect_Authenticated(t *testing.T) {
+	client, firmware := net.Pipe()
+	defer client.Close()
+	go fakeFirmware(t, firmware, ProtocolKVM, "admin", "secret")
+
+	conn, err := Handshake(client, ProtocolKVM, "admin", "secret")
+	if !assert.NoError(t, err) {
+		return
+	}
+	version := make([]byte, 12)
+	_, err = io.ReadFull(conn, version)
+	assert.NoError(t, err)
+	assert.Equal(t, "RFB 003.008\n", string(version))
+}
+
+func TestHandshake_When_PasswordIsWrong_Expect_ErrAuthentication(t *testing.T) {
+	client, firmware := net.Pipe()
+	defer client.Close()
+	go fakeFirmware(t, firmware, ProtocolKVM, "admin", "secret")
+
+	_, err := Handshake(client, ProtocolKVM, "admin", "wrong")
+	assert.Equal(t, ErrAuthentication, err)
+}
+
+func TestSOL_When_DataIsExchanged_Expect_FramedMessages(t *testing.T) {
+	client, firmware := net.Pipe()
+	defer client.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		settings := make([]byte, 24)
+		if _, err := io.ReadFull(firmware, settings); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, byte(solSettings), settings[0])
+		reply := make([]byte, solSettingsReplySize)
+		reply[0] = solSettingsReply
+		firmware.Write(reply)
+		control := make([]byte, 14)
+		if _, err := io.ReadFull(firmware, control); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, byte(solControl), control[0])
+
+		firmware.Write([]byte{solHeartbeat, 0, 0, 0, 1, 0, 0, 0})
+		firmware.Write([]byte{solDataFromHost, 0, 0, 0, 2, 0, 0, 0, 6, 0, 'l', 'o', 'g', 'i', 'n', ':'})
+
+		input := make([]byte, solDataHeaderSize+4)
+		if _, err := io.ReadFull(firmware, input); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, byte(solDataToHost), input[0])
+		assert.Equal(t, uint16(4), binary.LittleEndian.Uint16(input[8:10]))
+		assert.Equal(t, "root", string(input[solDataHeaderSize:]))
+	}()
+
+	sol, err := NewSOL(client)
+	if !assert.NoError(t, err) {
+		return
+	}
+	output := make([]byte, 6)
+	_, err = io.ReadFull(sol, output)
+	assert.NoError(t, err)
+	assert.Equal(t, "login:", string(output))
+	_, err = sol.Write([]byte("root"))
+	assert.NoError(t, err)
+	<-done
+}
+
+func TestSOLProxy_When_TerminalAttached_Expect_ConsoleBridged(t *testing.T) {
+	client, firmware := net.Pipe()
+	go func() {
+		fakeFirmware(t, firmware, ProtocolSOL, "admin", "secret")
+		settings := make([]byte, 24)
+		if _, err := io.ReadFull(firmware, settings); err != nil {
+			t.Error(err)
+			return
+		}
+		reply := make([]byte, solSettingsReplySize)
+		reply[0] = solSettingsReply
+		firmware.Write(reply)
+		control := make([]byte, 14)
+		if _, err := io.ReadFull(firmware, control); err != nil {
+			t.Error(err)
+			return
+		}
+		firmware.Write([]byte{solDataFromHost, 0, 0, 0, 1, 0, 0, 0, 6, 0, 'l', 'o', 'g', 'i', 'n', ':'})
+		input := make([]byte, solDataHeaderSize+4)
+		if _, err := io.ReadFull(firmware, input); err != nil {
+			t.Error(err)
+			return
+		}
+		assert.Equal(t, "root", string(input[solDataHeaderSize:]))
+		firmware.Close()
+	}()
+	p := &SOLProxy{Host: "machine", Config: Config{
+		Username: "admin",
+		Password: "secret",
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			assert.Equal(t, "machine:16994", address)
+			return client, nil
+		},
+	}}
+	terminal, proxied := net.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- p.ServeConn(context.Background(), proxied)
+	}()
+
+	output := make([]byte, 6)
+	_, err := io.ReadFull(terminal, output)
+	assert.NoError(t, err)
+	assert.Equal(t, "login:", string(output))
+	terminal.Write([]byte("root"))
+	<-done
+	// the terminal is closed with the session.
+	_, err = terminal.Read(output)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestTimestampWriter_When_LinesAreSplit_Expect_OnePrefixPerLine(t *testing.T) {
+	var out bytes.Buffer
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	w := &timestampWriter{w: &out, now: func() time.Time { return now }, lineStart: true}
+	w.Write([]byte("BIOS "))
+	w.Write([]byte("1.0\r\nboot"))
+	w.Write([]byte("ing\n"))
+	assert.Equal(t, "2024-01-02T03:04:05Z BIOS 1.0\r\n2024-01-02T03:04:05Z booting\n", out.String())
+}
+
+// fakeRFBServer runs the server side of the RFB handshake.
+func fakeRFBServer(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.Write([]byte(rfbVersion38))
+	version := make([]byte, 12)
+	io.ReadFull(conn, version)
+	assert.Equal(t, rfbVersion38, string(version))
+	conn.Write([]byte{2, 2, rfbSecurityNone})
+	choice := make([]byte, 1)
+	io.ReadFull(conn, choice)
+	assert.Equal(t, byte(rfbSecurityNone), choice[0])
+	conn.Write([]byte{0, 0, 0, 0})
+	shared := make([]byte, 1)
+	io.ReadFull(conn, shared)
+
+	serverInit := make([]byte, 24)
+	binary.BigEndian.PutUint16(serverInit[0:], 1024)
+	binary.BigEndian.PutUint16(serverInit[2:], 768)
+	binary.BigEndian.PutUint32(serverInit[20:], 3)
+	conn.Write(append(serverInit, "AMT"...))
+}
+
+func TestKVM_When_KeysArePressed_Expect_ReleasedInReverse(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	done := make(chan []uint32)
+	go func() {
+		fakeRFBServer(t, server)
+		events := []uint32{}
+		for i := 0; i < 6; i++ {
+			event := make([]byte, 8)
+			if _, err := io.ReadFull(server, event); err != nil {
+				t.Error(err)
+				break
+			}
+			assert.Equal(t, byte(rfbKeyEvent), event[0])
+			keysym := binary.BigEndian.Uint32(event[4:])
+			if event[1] == 0 {
+				// mark releases.
+				keysym |= 1 << 31
+			}
+			events = append(events, keysym)
+		}
+		done <- events
+	}()
+
+	kvm, err := NewKVM(client)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 1024, kvm.Width)
+	assert.Equal(t, 768, kvm.Height)
+	assert.Equal(t, "AMT", kvm.Name)
+	assert.NoError(t, kvm.PressKeys(KeyControl, KeyAlt, KeyDelete))
+	const released = 1 << 31
+	assert.Equal(t, []uint32{KeyControl, KeyAlt, KeyDelete, KeyDelete | released, KeyAlt | released, KeyControl | released}, <-done)
+}
+
+func TestKVM_When_WaitingForScreen_Expect_MatchingScreenshot(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		fakeRFBServer(t, server)
+		setup := make([]byte, 20+4+8)
+		if _, err := io.ReadFull(server, setup); err != nil {
+			return
+		}
+		assert.Equal(t, byte(rfbSetPixelFormat), setup[0])
+		assert.Equal(t, byte(rfbSetEncodings), setup[20])
+		// the second screen turns the pixel red.
+		for _, red := range []byte{0, 0xff} {
+			request := make([]byte, 10)
+			if _, err := io.ReadFull(server, request); err != nil {
+				return
+			}
+			assert.Equal(t, byte(rfbFramebufferUpdateRequest), request[0])
+			update := []byte{rfbFramebufferUpdate, 0, 0, 2}
+			resize := make([]byte, 12)
+			binary.BigEndian.PutUint16(resize[4:], 1)
+			binary.BigEndian.PutUint16(resize[6:], 1)
+			binary.BigEndian.PutUint32(resize[8:], uint32(0xffffff21)) // -223
+			raw := make([]byte, 12)
+			binary.BigEndian.PutUint16(raw[4:], 1)
+			binary.BigEndian.PutUint16(raw[6:], 1)
+			update = append(update, resize...)
+			update = append(update, raw...)
+			server.Write(append(update, 0, 0, red, 0))
+		}
+	}()
+
+	kvm, err := NewKVM(client)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	screen, err := kvm.WaitForScreen(ctx, time.Millisecond, func(screen image.Image) (bool, error) {
+		r, _, _, _ := screen.At(0, 0).RGBA()
+		return r == 0xffff, nil
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, image.Rect(0, 0, 1, 1), screen.Bounds())
+	assert.Equal(t, 1, kvm.Width)
+}
+
+func TestWebSocketHandler_When_ForeignOrigin_Expect_Forbidden(t *testing.T) {
+	upgrade := func(h *WebSocketHandler, origin string) int {
+		r := httptest.NewRequest(http.MethodGet, "http://console.example.com/kvm", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	// nothing listens on the machine, the sessions allowed fail to open.
+	h := &WebSocketHandler{Host: "127.0.0.1:1", Protocol: ProtocolKVM}
+
+	assert.Equal(t, http.StatusForbidden, upgrade(h, "https://evil.example.com"))
+	assert.Equal(t, http.StatusBadGateway, upgrade(h, "https://console.example.com"))
+	assert.Equal(t, http.StatusBadGateway, upgrade(h, ""))
+
+	h.CheckOrigin = func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://evil.example.com"
+	}
+	assert.Equal(t, http.StatusBadGateway, upgrade(h, "https://evil.example.com"))
+	assert.Equal(t, http.StatusForbidden, upgrade(h, "https://console.example.com"))
+}
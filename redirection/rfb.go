@@ -0,0 +1,275 @@
+package redirection
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+)
+
+const (
+	rfbVersion38 = "RFB 003.008\n"
+	rfbVersion33 = "RFB 003.003\n"
+
+	rfbSecurityNone = 1
+
+	rfbKeyEvent     = 4
+	rfbPointerEvent = 5
+
+	// maxRFBReason bounds the failure reasons read from the server.
+	maxRFBReason = 1 << 16
+)
+
+// X11 keysyms of the keys without a printable character, for KVM.KeyEvent and KVM.PressKeys.
+const (
+	KeyBackspace uint32 = 0xff08
+	KeyTab       uint32 = 0xff09
+	KeyReturn    uint32 = 0xff0d
+	KeyEscape    uint32 = 0xff1b
+	KeyHome      uint32 = 0xff50
+	KeyLeft      uint32 = 0xff51
+	KeyUp        uint32 = 0xff52
+	KeyRight     uint32 = 0xff53
+	KeyDown      uint32 = 0xff54
+	KeyPageUp    uint32 = 0xff55
+	KeyPageDown  uint32 = 0xff56
+	KeyEnd       uint32 = 0xff57
+	KeyInsert    uint32 = 0xff63
+	KeyF1        uint32 = 0xffbe
+	KeyShift     uint32 = 0xffe1
+	KeyControl   uint32 = 0xffe3
+	KeyAlt       uint32 = 0xffe9
+	KeyDelete    uint32 = 0xffff
+)
+
+// KeyF returns the keysym of the function key Fn, e.g. KeyF(2) for F2.
+func KeyF(n int) uint32 {
+	return KeyF1 + uint32(n-1)
+}
+
+// Pointer buttons, combined in the buttons of KVM.PointerEvent.
+const (
+	ButtonLeft   uint8 = 1 << 0
+	ButtonMiddle uint8 = 1 << 1
+	ButtonRight  uint8 = 1 << 2
+)
+
+// KVM is an RFB client on a KVM redirection session, for automation that
+// drives the machine without a human at a VNC client.
+type KVM struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// Width and Height of the screen, as announced when the session started.
+	Width  int
+	Height int
+	// Name of the desktop.
+	Name string
+
+	writeMu   sync.Mutex
+	formatSet bool
+}
+
+// DialKVM connects to host and starts a KVM session.
+func DialKVM(ctx context.Context, host string, config Config) (*KVM, error) {
+	conn, err := Dial(ctx, host, ProtocolKVM, config)
+	if err != nil {
+		return nil, err
+	}
+	k, err := NewKVM(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewKVM runs the RFB handshake on conn, which must have completed the
+// Handshake for ProtocolKVM.
+func NewKVM(conn net.Conn) (*KVM, error) {
+	k := &KVM{conn: conn, r: bufio.NewReader(conn)}
+
+	version := make([]byte, len(rfbVersion38))
+	if _, err := io.ReadFull(k.r, version); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(version), "RFB ") {
+		return nil, fmt.Errorf("not an RFB server: %q", version)
+	}
+	reply := rfbVersion38
+	if string(version) < rfbVersion38 {
+		reply = rfbVersion33
+	}
+	if _, err := conn.Write([]byte(reply)); err != nil {
+		return nil, err
+	}
+	if err := k.negotiateSecurity(reply == rfbVersion33); err != nil {
+		return nil, err
+	}
+
+	// shared, don't disconnect other viewers.
+	if _, err := conn.Write([]byte{1}); err != nil {
+		return nil, err
+	}
+	serverInit := make([]byte, 24)
+	if _, err := io.ReadFull(k.r, serverInit); err != nil {
+		return nil, err
+	}
+	k.Width = int(binary.BigEndian.Uint16(serverInit[0:2]))
+	k.Height = int(binary.BigEndian.Uint16(serverInit[2:4]))
+	name, err := k.readString(binary.BigEndian.Uint32(serverInit[20:24]))
+	if err != nil {
+		return nil, err
+	}
+	k.Name = name
+	return k, nil
+}
+
+func (k *KVM) negotiateSecurity(version33 bool) error {
+	if version33 {
+		security := make([]byte, 4)
+		if _, err := io.ReadFull(k.r, security); err != nil {
+			return err
+		}
+		switch t := binary.BigEndian.Uint32(security); t {
+		case rfbSecurityNone:
+			return nil
+		case 0:
+			return k.readFailure()
+		default:
+			return fmt.Errorf("unsupported RFB security type %d", t)
+		}
+	}
+
+	count, err := k.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return k.readFailure()
+	}
+	types := make([]byte, count)
+	if _, err := io.ReadFull(k.r, types); err != nil {
+		return err
+	}
+	if !containsByte(types, rfbSecurityNone) {
+		return fmt.Errorf("the RFB server offers no supported security type: %v", types)
+	}
+	if _, err := k.conn.Write([]byte{rfbSecurityNone}); err != nil {
+		return err
+	}
+	result := make([]byte, 4)
+	if _, err := io.ReadFull(k.r, result); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(result) != 0 {
+		return k.readFailure()
+	}
+	return nil
+}
+
+// readFailure returns the error of a failed security handshake, with the reason sent by the server.
+func (k *KVM) readFailure() error {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(k.r, length); err != nil {
+		return fmt.Errorf("RFB security handshake failed")
+	}
+	reason, err := k.readString(binary.BigEndian.Uint32(length))
+	if err != nil {
+		return fmt.Errorf("RFB security handshake failed")
+	}
+	return fmt.Errorf("RFB security handshake failed: %s", reason)
+}
+
+func (k *KVM) readString(length uint32) (string, error) {
+	if length > maxRFBReason {
+		return "", fmt.Errorf("RFB string of %d bytes is too long", length)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(k.r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (k *KVM) write(msg []byte) error {
+	k.writeMu.Lock()
+	defer k.writeMu.Unlock()
+	_, err := k.conn.Write(msg)
+	return err
+}
+
+// KeyEvent presses, or releases when down is false, the key keysym.
+func (k *KVM) KeyEvent(keysym uint32, down bool) error {
+	msg := make([]byte, 8)
+	msg[0] = rfbKeyEvent
+	if down {
+		msg[1] = 1
+	}
+	binary.BigEndian.PutUint32(msg[4:8], keysym)
+	return k.write(msg)
+}
+
+// PressKeys presses the keys in order and releases them in reverse, e.g.
+// PressKeys(KeyControl, KeyAlt, KeyDelete).
+func (k *KVM) PressKeys(keysyms ...uint32) error {
+	for _, keysym := range keysyms {
+		if err := k.KeyEvent(keysym, true); err != nil {
+			return err
+		}
+	}
+	for i := len(keysyms) - 1; i >= 0; i-- {
+		if err := k.KeyEvent(keysyms[i], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Type types s. Only Latin-1 characters, newlines and tabs can be typed.
+func (k *KVM) Type(s string) error {
+	for _, r := range s {
+		var keysym uint32
+		switch {
+		case r == '\n':
+			keysym = KeyReturn
+		case r == '\t':
+			keysym = KeyTab
+		case r >= 0x20 && r <= 0xff:
+			keysym = uint32(r)
+		default:
+			return fmt.Errorf("can't type %q", r)
+		}
+		if err := k.PressKeys(keysym); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PointerEvent moves the pointer to x, y with buttons held down.
+func (k *KVM) PointerEvent(x, y int, buttons uint8) error {
+	msg := make([]byte, 6)
+	msg[0] = rfbPointerEvent
+	msg[1] = buttons
+	binary.BigEndian.PutUint16(msg[2:4], uint16(x))
+	binary.BigEndian.PutUint16(msg[4:6], uint16(y))
+	return k.write(msg)
+}
+
+// Click clicks button at x, y.
+func (k *KVM) Click(x, y int, button uint8) error {
+	if err := k.PointerEvent(x, y, button); err != nil {
+		return err
+	}
+	return k.PointerEvent(x, y, 0)
+}
+
+// Close ends the session.
+func (k *KVM) Close() error {
+	return k.conn.Close()
+}
@@ -0,0 +1,180 @@
+package redirection
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"time"
+)
+
+const (
+	rfbSetPixelFormat           = 0
+	rfbSetEncodings             = 2
+	rfbFramebufferUpdateRequest = 3
+
+	rfbFramebufferUpdate   = 0
+	rfbSetColourMapEntries = 1
+	rfbBell                = 2
+	rfbServerCutText       = 3
+
+	rfbEncodingRaw         = 0
+	rfbEncodingDesktopSize = -223
+
+	bytesPerPixel = 4
+)
+
+// ScreenMatcher reports whether a screenshot shows the expected screen, e.g.
+// by running OCR on it and looking for a prompt.
+type ScreenMatcher func(screen image.Image) (bool, error)
+
+// WaitForScreen takes a screenshot every interval until match accepts one,
+// which is returned, or ctx is done.
+func (k *KVM) WaitForScreen(ctx context.Context, interval time.Duration, match ScreenMatcher) (image.Image, error) {
+	for {
+		screen, err := k.Screenshot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := match(screen)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return screen, nil
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Screenshot captures the whole screen.
+func (k *KVM) Screenshot(ctx context.Context) (*image.RGBA, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		k.conn.SetReadDeadline(deadline)
+		defer k.conn.SetReadDeadline(time.Time{})
+	}
+	if !k.formatSet {
+		if err := k.setFormat(); err != nil {
+			return nil, err
+		}
+		k.formatSet = true
+	}
+
+	request := make([]byte, 10)
+	request[0] = rfbFramebufferUpdateRequest
+	binary.BigEndian.PutUint16(request[6:8], uint16(k.Width))
+	binary.BigEndian.PutUint16(request[8:10], uint16(k.Height))
+	if err := k.write(request); err != nil {
+		return nil, err
+	}
+	for {
+		messageType, err := k.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch messageType {
+		case rfbFramebufferUpdate:
+			return k.readFramebufferUpdate()
+		case rfbSetColourMapEntries:
+			header := make([]byte, 5)
+			if _, err := io.ReadFull(k.r, header); err != nil {
+				return nil, err
+			}
+			if _, err := k.r.Discard(6 * int(binary.BigEndian.Uint16(header[3:5]))); err != nil {
+				return nil, err
+			}
+		case rfbBell:
+		case rfbServerCutText:
+			header := make([]byte, 7)
+			if _, err := io.ReadFull(k.r, header); err != nil {
+				return nil, err
+			}
+			if _, err := k.readString(binary.BigEndian.Uint32(header[3:7])); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected RFB message %d", messageType)
+		}
+	}
+}
+
+// setFormat asks for 32 bit true colour pixels in raw encoding.
+func (k *KVM) setFormat() error {
+	format := make([]byte, 20)
+	format[0] = rfbSetPixelFormat
+	format[4] = 32 // bits per pixel
+	format[5] = 24 // depth
+	format[6] = 0  // little endian
+	format[7] = 1  // true colour
+	binary.BigEndian.PutUint16(format[8:10], 255)
+	binary.BigEndian.PutUint16(format[10:12], 255)
+	binary.BigEndian.PutUint16(format[12:14], 255)
+	format[14] = 16 // red shift
+	format[15] = 8  // green shift
+	format[16] = 0  // blue shift
+	if err := k.write(format); err != nil {
+		return err
+	}
+
+	encodings := []int32{rfbEncodingRaw, rfbEncodingDesktopSize}
+	msg := make([]byte, 4+4*len(encodings))
+	msg[0] = rfbSetEncodings
+	binary.BigEndian.PutUint16(msg[2:4], uint16(len(encodings)))
+	for i, e := range encodings {
+		binary.BigEndian.PutUint32(msg[4+4*i:], uint32(e))
+	}
+	return k.write(msg)
+}
+
+func (k *KVM) readFramebufferUpdate() (*image.RGBA, error) {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(k.r, header); err != nil {
+		return nil, err
+	}
+	rects := int(binary.BigEndian.Uint16(header[1:3]))
+	screen := image.NewRGBA(image.Rect(0, 0, k.Width, k.Height))
+	for i := 0; i < rects; i++ {
+		rect := make([]byte, 12)
+		if _, err := io.ReadFull(k.r, rect); err != nil {
+			return nil, err
+		}
+		x := int(binary.BigEndian.Uint16(rect[0:2]))
+		y := int(binary.BigEndian.Uint16(rect[2:4]))
+		w := int(binary.BigEndian.Uint16(rect[4:6]))
+		h := int(binary.BigEndian.Uint16(rect[6:8]))
+		switch encoding := int32(binary.BigEndian.Uint32(rect[8:12])); encoding {
+		case rfbEncodingRaw:
+			pixels := make([]byte, w*h*bytesPerPixel)
+			if _, err := io.ReadFull(k.r, pixels); err != nil {
+				return nil, err
+			}
+			for row := 0; row < h; row++ {
+				for col := 0; col < w; col++ {
+					p := pixels[(row*w+col)*bytesPerPixel:]
+					if !(image.Point{X: x + col, Y: y + row}).In(screen.Rect) {
+						continue
+					}
+					o := screen.PixOffset(x+col, y+row)
+					// little endian 0x00RRGGBB.
+					screen.Pix[o+0] = p[2]
+					screen.Pix[o+1] = p[1]
+					screen.Pix[o+2] = p[0]
+					screen.Pix[o+3] = 0xff
+				}
+			}
+		case rfbEncodingDesktopSize:
+			k.Width, k.Height = w, h
+			screen = image.NewRGBA(image.Rect(0, 0, w, h))
+		default:
+			return nil, fmt.Errorf("unexpected RFB encoding %d", encoding)
+		}
+	}
+	return screen, nil
+}
@@ -0,0 +1,257 @@
+package redirection
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	endRedirectionSession = 0x12
+	solSettings           = 0x20
+	solSettingsReply      = 0x21
+	solControl            = 0x27
+	solDataToHost         = 0x28
+	solSerialSettings     = 0x29
+	solDataFromHost       = 0x2a
+	solHeartbeat          = 0x2b
+
+	solSettingsReplySize   = 23
+	solSerialSettingsSize  = 10
+	solHeartbeatSize       = 8
+	solDataHeaderSize      = 10
+	solMaxTxBuffer         = 10000
+	solMaxWrite            = 1000
+	solTxTimeout           = 100
+	solRxTimeout           = 10000
+	solRxFlushTimeout      = 100
+	solControlRTSDTRActive = 0x1b
+)
+
+// SOL is a Serial-over-LAN session. Reads return the output of the serial
+// console of the machine, writes are sent as its input.
+type SOL struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	writeMu  sync.Mutex
+	sequence uint32
+	pending  []byte
+
+	teeMu sync.Mutex
+	tee   *timestampWriter
+}
+
+// Tee copies the console output to w, each line prefixed with the time it was
+// received, e.g. to archive boot logs. Input isn't copied, consoles echo it.
+// Write errors are ignored so they don't break the session. A nil w stops it.
+func (s *SOL) Tee(w io.Writer) {
+	s.teeMu.Lock()
+	defer s.teeMu.Unlock()
+	if w == nil {
+		s.tee = nil
+		return
+	}
+	s.tee = &timestampWriter{w: w, now: time.Now, lineStart: true}
+}
+
+// DialSOL connects to host and starts a Serial-over-LAN session.
+func DialSOL(ctx context.Context, host string, config Config) (*SOL, error) {
+	conn, err := Dial(ctx, host, ProtocolSOL, config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := NewSOL(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSOL starts the Serial-over-LAN session on conn, which must have completed
+// the Handshake for ProtocolSOL.
+func NewSOL(conn net.Conn) (*SOL, error) {
+	s := &SOL{conn: conn, r: bufio.NewReader(conn), sequence: 1}
+
+	settings := s.header(solSettings, 24)
+	binary.LittleEndian.PutUint16(settings[8:], solMaxTxBuffer)
+	binary.LittleEndian.PutUint16(settings[10:], solTxTimeout)
+	// TxOverflowTimeout (12:14) stays 0.
+	binary.LittleEndian.PutUint16(settings[14:], solRxTimeout)
+	binary.LittleEndian.PutUint16(settings[16:], solRxFlushTimeout)
+	// the heartbeat interval (18:20) and reserved (20:24) stay 0.
+	if _, err := conn.Write(settings); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, solSettingsReplySize)
+	if _, err := io.ReadFull(s.r, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != solSettingsReply {
+		return nil, fmt.Errorf("unexpected message 0x%02x, expected the SOL settings reply", reply[0])
+	}
+
+	control := s.header(solControl, 14)
+	control[10] = solControlRTSDTRActive
+	if _, err := conn.Write(control); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// header returns a message of size bytes with the type and the next sequence number set.
+func (s *SOL) header(messageType byte, size int) []byte {
+	msg := make([]byte, size)
+	msg[0] = messageType
+	binary.LittleEndian.PutUint32(msg[4:8], s.sequence)
+	s.sequence++
+	return msg
+}
+
+// Read reads console output.
+func (s *SOL) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		messageType, err := s.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch messageType {
+		case solDataFromHost:
+			header := make([]byte, solDataHeaderSize-1)
+			if _, err := io.ReadFull(s.r, header); err != nil {
+				return 0, err
+			}
+			data := make([]byte, binary.LittleEndian.Uint16(header[7:9]))
+			if _, err := io.ReadFull(s.r, data); err != nil {
+				return 0, err
+			}
+			s.pending = data
+			s.teeMu.Lock()
+			if s.tee != nil {
+				s.tee.Write(data)
+			}
+			s.teeMu.Unlock()
+		case solHeartbeat:
+			if _, err := s.r.Discard(solHeartbeatSize - 1); err != nil {
+				return 0, err
+			}
+		case solSerialSettings:
+			if _, err := s.r.Discard(solSerialSettingsSize - 1); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("unexpected SOL message 0x%02x", messageType)
+		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Write sends console input.
+func (s *SOL) Write(p []byte) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	written := 0
+	for written < len(p) {
+		n := len(p) - written
+		if n > solMaxWrite {
+			n = solMaxWrite
+		}
+		msg := s.header(solDataToHost, solDataHeaderSize)
+		binary.LittleEndian.PutUint16(msg[8:10], uint16(n))
+		if _, err := s.conn.Write(append(msg, p[written:written+n]...)); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close ends the session.
+func (s *SOL) Close() error {
+	s.writeMu.Lock()
+	s.conn.Write(s.header(endRedirectionSession, 8))
+	s.writeMu.Unlock()
+	return s.conn.Close()
+}
+
+// SOLProxy exposes the serial console of a machine as a raw TCP endpoint, or
+// on a PTY, for standard terminal tools like telnet or conserver. Each
+// connection gets its own Serial-over-LAN session. SOL must be enabled on the
+// machine.
+type SOLProxy struct {
+	// Host of the machine, with an optional port.
+	Host   string
+	Config Config
+	// OnError, when set, is called with the errors of individual connections.
+	OnError func(error)
+}
+
+// Serve accepts connections on l until it is closed.
+func (p *SOLProxy) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := p.ServeConn(context.Background(), conn); err != nil && p.OnError != nil {
+				p.OnError(err)
+			}
+		}()
+	}
+}
+
+// ListenAndServe listens on the local address and calls Serve.
+func (p *SOLProxy) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return p.Serve(l)
+}
+
+// ServeConn bridges a single terminal to the serial console. conn is a
+// network connection or the master side of a PTY, it is closed when done.
+func (p *SOLProxy) ServeConn(ctx context.Context, conn io.ReadWriteCloser) error {
+	defer conn.Close()
+	sol, err := DialSOL(ctx, p.Host, p.Config)
+	if err != nil {
+		return err
+	}
+	defer sol.Close()
+	return pipe(conn, sol)
+}
+
+// timestampWriter prefixes every line written to w with a timestamp.
+type timestampWriter struct {
+	w         io.Writer
+	now       func() time.Time
+	lineStart bool
+}
+
+func (t *timestampWriter) Write(p []byte) (int, error) {
+	var out []byte
+	for _, b := range p {
+		if t.lineStart {
+			out = append(out, t.now().UTC().Format(time.RFC3339Nano)+" "...)
+			t.lineStart = false
+		}
+		out = append(out, b)
+		if b == '\n' {
+			t.lineStart = true
+		}
+	}
+	if _, err := t.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
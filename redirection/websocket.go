@@ -0,0 +1,131 @@
+package redirection
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jacobweinstock/go-amt/internal/wsframe"
+)
+
+// WebSocketHandler serves a redirection session over WebSocket, compatible with
+// websockify clients: noVNC for ProtocolKVM and xterm.js for ProtocolSOL. Every
+// request opens its own session to Host. Access control is up to the caller,
+// anyone reaching the handler gets the console; CheckOrigin only keeps other
+// web sites from opening it in the browser of a user.
+type WebSocketHandler struct {
+	// Host of the machine, with an optional port.
+	Host   string
+	Config Config
+	// Protocol is ProtocolKVM or ProtocolSOL.
+	Protocol Protocol
+	// OnError, when set, is called with the errors of individual sessions.
+	OnError func(error)
+	// CheckOrigin reports whether the upgrade request may open a session,
+	// it is refused with 403 Forbidden otherwise. When nil, the requests
+	// with an Origin header must come from the host of the request.
+	CheckOrigin func(r *http.Request) bool
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Protocol != ProtocolKVM && h.Protocol != ProtocolSOL {
+		http.Error(w, fmt.Sprintf("unsupported redirection protocol %q", h.Protocol), http.StatusInternalServerError)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return
+	}
+	checkOrigin := h.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	var remote io.ReadWriteCloser
+	var err error
+	if h.Protocol == ProtocolSOL {
+		remote, err = DialSOL(r.Context(), h.Host, h.Config)
+	} else {
+		remote, err = Dial(r.Context(), h.Host, h.Protocol, h.Config)
+	}
+	if err != nil {
+		h.error(err)
+		http.Error(w, "could not open the redirection session", http.StatusBadGateway)
+		return
+	}
+	defer remote.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket upgrade is not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		h.error(err)
+		return
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsframe.Accept(key) + "\r\n"
+	// noVNC asks for the binary subprotocol of websockify.
+	if headerContains(r.Header, "Sec-WebSocket-Protocol", "binary") {
+		response += "Sec-WebSocket-Protocol: binary\r\n"
+	}
+	if _, err := rw.WriteString(response + "\r\n"); err != nil {
+		conn.Close()
+		h.error(err)
+		return
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		h.error(err)
+		return
+	}
+
+	ws := wsframe.NewConn(conn, rw.Reader, false)
+	if err := pipe(ws, remote); err != nil && !errors.Is(err, net.ErrClosed) {
+		h.error(err)
+	}
+}
+
+func (h *WebSocketHandler) error(err error) {
+	if h.OnError != nil {
+		h.OnError(err)
+	}
+}
+
+// sameOrigin reports whether the Origin of r, if any, is the host of r. The
+// browsers send it with every websocket, the other clients rarely do.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContains(header http.Header, name, value string) bool {
+	for _, v := range header.Values(name) {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package amt
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// ErrSessionLimit is returned when the firmware refused a request because it
+// already has as many sessions open as it handles, usually because other
+// tools are managing the machine at the same time. See
+// Connection.SessionLimitWait and Sessions.MaxConcurrent.
+var ErrSessionLimit = errors.New("firmware session limit reached")
+
+// Backoff between the attempts of a request refused for the session limit.
+const (
+	sessionLimitBackoff    = 250 * time.Millisecond
+	sessionLimitMaxBackoff = 4 * time.Second
+)
+
+// sessionLimitTransport turns the 503 Service Unavailable of a firmware out
+// of sessions into ErrSessionLimit, after retrying the request for up to wait.
+type sessionLimitTransport struct {
+	wait  time.Duration
+	clock Clock
+	next  http.RoundTripper
+}
+
+func (t *sessionLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := t.clock.Now().Add(t.wait)
+	backoff := sessionLimitBackoff
+	attempt := req
+	for {
+		resp, err := t.next.RoundTrip(attempt)
+		if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, err
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if req.Body != nil && req.GetBody == nil || t.clock.Now().Add(backoff).After(deadline) {
+			return nil, ErrSessionLimit
+		}
+
+		timer := t.clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		if backoff *= 2; backoff > sessionLimitMaxBackoff {
+			backoff = sessionLimitMaxBackoff
+		}
+
+		attempt = req.Clone(req.Context())
+		if req.GetBody != nil {
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package amt
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionLimitTransport_When_Refused_Expect_ErrSessionLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	transport := &sessionLimitTransport{clock: SystemClock, next: http.DefaultTransport}
+	_, err := (&http.Client{Transport: transport}).Post(server.URL, "application/soap+xml", strings.NewReader("<body/>"))
+	assert.ErrorIs(t, err, ErrSessionLimit)
+}
+
+func TestSessionLimitTransport_When_SessionFreed_Expect_RetriedRequest(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, "<body/>", string(body))
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	transport := &sessionLimitTransport{wait: 5 * time.Second, clock: SystemClock, next: http.DefaultTransport}
+	resp, err := (&http.Client{Transport: transport}).Post(server.URL, "application/soap+xml", strings.NewReader("<body/>"))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, 3, requests)
+}
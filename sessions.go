@@ -0,0 +1,135 @@
+package amt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Sessions shares the authentication state and the connections of the
+// clients of the same hosts, e.g. of a power controller and an inventory
+// collector in one process. The firmware only handles a few concurrent
+// sessions: clients with their own digest challenges and connections each
+// open one and may be refused. Set the same Sessions as the
+// Connection.Sessions of the clients; the zero value is ready to use.
+type Sessions struct {
+	// MaxConcurrent, when set, is the most requests in flight to a host
+	// across the clients, the others wait for their turn. 1 serializes the
+	// requests to each host, which avoids ErrSessionLimit between the
+	// clients of the process.
+	MaxConcurrent int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSession
+}
+
+// hostSession is what the clients of a host share.
+type hostSession struct {
+	// transport is the default transport of the host, created by the first
+	// client without a Connection.Transport.
+	transport http.RoundTripper
+	// digests are the digest sessions of each user.
+	digests map[string]*digestSession
+	// slots holds a value per request in flight when MaxConcurrent is set.
+	slots chan struct{}
+}
+
+// host returns the session of target, the URL of the firmware.
+func (s *Sessions) host(target string) *hostSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts == nil {
+		s.hosts = map[string]*hostSession{}
+	}
+	h, ok := s.hosts[target]
+	if !ok {
+		h = &hostSession{digests: map[string]*digestSession{}}
+		if s.MaxConcurrent > 0 {
+			h.slots = make(chan struct{}, s.MaxConcurrent)
+		}
+		s.hosts[target] = h
+	}
+	return h
+}
+
+// defaultTransport returns the shared default transport of target, created
+// with create by the first client. The TLS configuration of that client is
+// used by all.
+func (s *Sessions) defaultTransport(target string, create func() http.RoundTripper) http.RoundTripper {
+	h := s.host(target)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if h.transport == nil {
+		h.transport = create()
+	}
+	return h.transport
+}
+
+// digest returns the digest session of user on target.
+func (s *Sessions) digest(target, user string) *digestSession {
+	h := s.host(target)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := h.digests[user]
+	if !ok {
+		d = &digestSession{}
+		h.digests[user] = d
+	}
+	return d
+}
+
+// limit wraps next so the requests to target count against MaxConcurrent.
+func (s *Sessions) limit(target string, next http.RoundTripper) http.RoundTripper {
+	h := s.host(target)
+	if h.slots == nil {
+		return next
+	}
+	return &sessionTransport{slots: h.slots, next: next}
+}
+
+// sessionTransport holds a slot of its host from the request until the
+// response body is closed.
+type sessionTransport struct {
+	slots chan struct{}
+	next  http.RoundTripper
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.release()
+		return nil, err
+	}
+	resp.Body = &sessionBody{ReadCloser: resp.Body, release: t.release}
+	return resp, nil
+}
+
+func (t *sessionTransport) acquire(ctx context.Context) error {
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *sessionTransport) release() {
+	<-t.slots
+}
+
+// sessionBody releases the slot of its request once, on Close.
+type sessionBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *sessionBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
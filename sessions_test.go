@@ -0,0 +1,83 @@
+package amt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions_When_ClientsShareHost_Expect_SingleChallenge(t *testing.T) {
+	var mu sync.Mutex
+	challenges := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Digest ") {
+			mu.Lock()
+			challenges++
+			mu.Unlock()
+			w.Header().Set("WWW-Authenticate", `Digest realm="realm", nonce="nonce", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	assert.NoError(t, err)
+
+	sessions := &Sessions{}
+	for i := 0; i < 3; i++ {
+		client, err := NewClient(Connection{Host: u.Hostname(), Port: uint32(port), User: "admin", Pass: "secret", Sessions: sessions})
+		assert.NoError(t, err)
+		resp, err := (&http.Client{Transport: client.wsManClient.Transport}).Post(server.URL+"/wsman", "application/soap+xml", strings.NewReader("<body/>"))
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}
+	assert.Equal(t, 1, challenges)
+}
+
+func TestSessions_When_MaxConcurrentReached_Expect_RequestWaits(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	sessions := &Sessions{MaxConcurrent: 1}
+	transport := sessions.limit(server.URL, http.DefaultTransport)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+		}
+	}()
+	// wait for the first request to hold the slot.
+	for len(sessions.host(server.URL).slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	_, err = transport.RoundTrip(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	<-done
+	assert.Len(t, sessions.host(server.URL).slots, 0)
+}
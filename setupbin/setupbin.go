@@ -0,0 +1,197 @@
+// Package setupbin generates the setup.bin file used to provision Intel AMT
+// from a USB key (one-touch provisioning). The MEBx reads one record per
+// machine from the key, applies its variables and marks the record consumed.
+package setupbin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	chunkSize             = 512
+	fileHeaderSize        = 38
+	recordHeaderSize      = 24
+	variableHeaderSize    = 8
+	recordTypeData        = 1
+	recordFlagValid       = 1
+	maxStringVariableSize = 255
+)
+
+// fileTypes are the header GUIDs identifying each version of the file format.
+var fileTypes = map[int][16]byte{
+	1: {0xb5, 0x16, 0xfb, 0x71, 0x87, 0xcb, 0xf9, 0x4a, 0xb4, 0x41, 0xca, 0x7b, 0x38, 0x35, 0x78, 0xf9},
+	2: {0x96, 0xb2, 0x81, 0x58, 0xcf, 0x6b, 0x72, 0x4c, 0x8b, 0x91, 0xa1, 0x5e, 0x51, 0x2e, 0x99, 0xc4},
+	3: {0xa7, 0xf7, 0xf6, 0xc6, 0x89, 0xc4, 0xf6, 0x47, 0x93, 0xed, 0xe2, 0xe5, 0x02, 0x0d, 0xa5, 0x1d},
+}
+
+// Module identifiers.
+const (
+	ModuleME  uint16 = 1
+	ModuleAMT uint16 = 2
+)
+
+// Variable identifiers of ModuleME.
+const (
+	VarCurrentPassword               uint16 = 1
+	VarNewPassword                   uint16 = 2
+	VarManageabilityFeatureSelection uint16 = 3
+	VarFirmwareLocalUpdate           uint16 = 4
+)
+
+// Variable identifiers of ModuleAMT.
+const (
+	VarPID                        uint16 = 1
+	VarPPS                        uint16 = 2
+	VarPKIDNSSuffix               uint16 = 3
+	VarConfigurationServerFQDN    uint16 = 4
+	VarRemoteConfigurationEnabled uint16 = 5
+	VarPreInstalledCertificates   uint16 = 6
+	VarRedirectionState           uint16 = 10
+	VarKVMState                   uint16 = 11
+	VarProvisioningServerPort     uint16 = 13
+	VarUserConsentRequired        uint16 = 20
+)
+
+// Variable is a single setting applied by the MEBx.
+type Variable struct {
+	Module uint16
+	ID     uint16
+	Value  []byte
+}
+
+// Record holds the variables applied to a single machine.
+type Record struct {
+	Variables []Variable
+}
+
+// File is a setup.bin file.
+type File struct {
+	// Version of the file format, 1 to 3. Version 3 is required by AMT 7 and newer.
+	Version int
+	Records []Record
+}
+
+// StringVariable returns a variable holding s.
+func StringVariable(module, id uint16, s string) Variable {
+	return Variable{Module: module, ID: id, Value: []byte(s)}
+}
+
+// ByteVariable returns a variable holding a single byte.
+func ByteVariable(module, id uint16, b byte) Variable {
+	return Variable{Module: module, ID: id, Value: []byte{b}}
+}
+
+// Uint16Variable returns a variable holding v.
+func Uint16Variable(module, id uint16, v uint16) Variable {
+	value := make([]byte, 2)
+	binary.LittleEndian.PutUint16(value, v)
+	return Variable{Module: module, ID: id, Value: value}
+}
+
+// New returns a file with count identical records that change the MEBx
+// password from currentPassword ("admin" on a new machine) to newPassword and
+// set the PKI DNS suffix used to match the provisioning certificate. An empty
+// dnsSuffix is left unset.
+func New(version int, currentPassword, newPassword, dnsSuffix string, count int) *File {
+	variables := []Variable{
+		StringVariable(ModuleME, VarCurrentPassword, currentPassword),
+		StringVariable(ModuleME, VarNewPassword, newPassword),
+		// 1 = Intel AMT
+		ByteVariable(ModuleME, VarManageabilityFeatureSelection, 1),
+	}
+	if dnsSuffix != "" {
+		variables = append(variables, StringVariable(ModuleAMT, VarPKIDNSSuffix, dnsSuffix))
+	}
+	f := &File{Version: version}
+	for i := 0; i < count; i++ {
+		f.Records = append(f.Records, Record{Variables: variables})
+	}
+	return f
+}
+
+// MarshalBinary encodes the file. Every record occupies the same number of
+// 512 byte chunks, sized for the largest record.
+func (f *File) MarshalBinary() ([]byte, error) {
+	fileType, ok := fileTypes[f.Version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported setup.bin version %d", f.Version)
+	}
+	if len(f.Records) == 0 {
+		return nil, fmt.Errorf("setup.bin needs at least one record")
+	}
+
+	records := make([][]byte, len(f.Records))
+	chunks := 1
+	for i, r := range f.Records {
+		body, err := r.encodeVariables()
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %v", i, err)
+		}
+		records[i] = body
+		if n := (recordHeaderSize + len(body) + chunkSize - 1) / chunkSize; n > chunks {
+			chunks = n
+		}
+	}
+
+	// the file header is record 0, a single chunk.
+	var out bytes.Buffer
+	header := make([]byte, chunkSize)
+	copy(header[0:16], fileType[:])
+	binary.LittleEndian.PutUint16(header[16:18], 1)
+	binary.LittleEndian.PutUint16(header[18:20], fileHeaderSize)
+	binary.LittleEndian.PutUint32(header[20:24], 0)
+	header[24] = byte(f.Version)
+	header[25] = 0
+	binary.LittleEndian.PutUint32(header[26:30], uint32(len(records)))
+	// data records consumed (30:34) stays zero, the MEBx counts them.
+	binary.LittleEndian.PutUint16(header[34:36], uint16(chunks))
+	binary.LittleEndian.PutUint16(header[36:38], uint16(f.moduleCount()))
+	out.Write(header)
+
+	for i, body := range records {
+		record := make([]byte, chunks*chunkSize)
+		binary.LittleEndian.PutUint32(record[0:4], recordTypeData)
+		binary.LittleEndian.PutUint32(record[4:8], recordFlagValid)
+		// reserved (8:16)
+		binary.LittleEndian.PutUint16(record[16:18], uint16(chunks))
+		binary.LittleEndian.PutUint16(record[18:20], recordHeaderSize)
+		binary.LittleEndian.PutUint16(record[20:22], uint16(i+1))
+		binary.LittleEndian.PutUint16(record[22:24], uint16(len(f.Records[i].Variables)))
+		copy(record[recordHeaderSize:], body)
+		out.Write(record)
+	}
+	return out.Bytes(), nil
+}
+
+// moduleCount returns the number of modules the variables of the records belong to.
+func (f *File) moduleCount() int {
+	modules := map[uint16]bool{}
+	for _, r := range f.Records {
+		for _, v := range r.Variables {
+			modules[v.Module] = true
+		}
+	}
+	return len(modules)
+}
+
+func (r Record) encodeVariables() ([]byte, error) {
+	var b bytes.Buffer
+	for _, v := range r.Variables {
+		if len(v.Value) > maxStringVariableSize {
+			return nil, fmt.Errorf("variable %d.%d is %d bytes, the maximum is %d", v.Module, v.ID, len(v.Value), maxStringVariableSize)
+		}
+		header := make([]byte, variableHeaderSize)
+		binary.LittleEndian.PutUint16(header[0:2], v.Module)
+		binary.LittleEndian.PutUint16(header[2:4], v.ID)
+		binary.LittleEndian.PutUint16(header[4:6], uint16(len(v.Value)))
+		b.Write(header)
+		b.Write(v.Value)
+		// variables are 4 byte aligned.
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,48 @@
+package setupbin
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalBinary_When_TwoRecords_Expect_HeaderAndChunkAlignedRecords(t *testing.T) {
+	data, err := New(3, "admin", "P@ssw0rd", "example.com", 2).MarshalBinary()
+	assert.NoError(t, err)
+	assert.Equal(t, 3*chunkSize, len(data))
+	// the header of a version 3 setup.bin of two single chunk records for the
+	// ME and the AMT modules, laid out as in the Intel setup.bin format.
+	assert.Equal(t, []byte{
+		// FileTypeUUID
+		0xa7, 0xf7, 0xf6, 0xc6, 0x89, 0xc4, 0xf6, 0x47, 0x93, 0xed, 0xe2, 0xe5, 0x02, 0x0d, 0xa5, 0x1d,
+		// RecordChunkCount, RecordHeaderByteCount
+		0x01, 0x00, 0x26, 0x00,
+		// RecordNumber
+		0x00, 0x00, 0x00, 0x00,
+		// MajorVersion, MinorVersion
+		0x03, 0x00,
+		// DataRecordCount, DataRecordsConsumed
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// DataRecordChunkCount, ModuleCount
+		0x01, 0x00, 0x02, 0x00,
+	}, data[0:fileHeaderSize])
+	assert.Equal(t, make([]byte, chunkSize-fileHeaderSize), data[fileHeaderSize:chunkSize])
+
+	record := data[chunkSize : 2*chunkSize]
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(record[20:22]))
+	assert.Equal(t, uint16(4), binary.LittleEndian.Uint16(record[22:24]))
+	// first variable: module 1, id 1, "admin" padded to 8 bytes.
+	assert.Equal(t, []byte{1, 0, 1, 0, 5, 0, 0, 0, 'a', 'd', 'm', 'i', 'n', 0, 0, 0}, record[24:40])
+}
+
+func TestMarshalBinary_When_VariableTooLong_Expect_Error(t *testing.T) {
+	_, err := New(3, "admin", "P@ssw0rd", strings.Repeat("a", 300), 1).MarshalBinary()
+	assert.Error(t, err)
+}
+
+func TestMarshalBinary_When_UnknownVersion_Expect_Error(t *testing.T) {
+	_, err := New(9, "admin", "P@ssw0rd", "", 1).MarshalBinary()
+	assert.Error(t, err)
+}
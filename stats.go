@@ -0,0 +1,47 @@
+package amt
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats are the counters of the requests a Client sent to the firmware, e.g.
+// to rank flaky devices. Requests rejected before they were sent, by a hook or
+// the write limit, are not counted.
+type Stats struct {
+	Successes int
+	Failures  int
+	// LastError is the error of the last failed request and LastErrorTime
+	// when it failed.
+	LastError     error
+	LastErrorTime time.Time
+	// AverageLatency is the mean duration of the requests, failed ones included.
+	AverageLatency time.Duration
+}
+
+// statsTracker counts the requests of a client.
+type statsTracker struct {
+	mu        sync.Mutex
+	stats     Stats
+	totalTime time.Duration
+}
+
+func (t *statsTracker) record(err error, duration time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.stats.Failures++
+		t.stats.LastError = err
+		t.stats.LastErrorTime = now
+	} else {
+		t.stats.Successes++
+	}
+	t.totalTime += duration
+	t.stats.AverageLatency = t.totalTime / time.Duration(t.stats.Successes+t.stats.Failures)
+}
+
+func (t *statsTracker) get() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
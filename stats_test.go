@@ -0,0 +1,48 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsTracker_When_Recorded_Expect_CountsAndAverage(t *testing.T) {
+	tracker := &statsTracker{}
+	failed := errors.New("failed")
+	now := time.Unix(1600000000, 0)
+	tracker.record(nil, time.Second, now)
+	tracker.record(failed, 3*time.Second, now)
+
+	assert.Equal(t, Stats{Successes: 1, Failures: 1, LastError: failed, LastErrorTime: now, AverageLatency: 2 * time.Second}, tracker.get())
+}
+
+func TestStats_When_RequestRejectedByHook_Expect_NotCounted(t *testing.T) {
+	reject := true
+	client, err := NewClient(Connection{
+		Host: "192.0.2.1",
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("refused")
+		},
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				if reject {
+					return errors.New("injected")
+				}
+				return nil
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	client.Version(context.Background())
+	assert.Equal(t, Stats{}, client.Stats())
+	reject = false
+	client.Version(context.Background())
+	stats := client.Stats()
+	assert.Equal(t, 1, stats.Failures)
+	assert.Contains(t, stats.LastError.Error(), "refused")
+}
@@ -0,0 +1,107 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/VictorLowther/simplexml/dom"
+)
+
+// DeviceInfo is what a Client discovers about a device that doesn't change
+// between connections, so it can be reused after a process restart.
+type DeviceInfo struct {
+	// Version is the AMT firmware version. The quirks of the firmware follow from it.
+	Version string
+	// ManagedSystem is the XML encoded endpoint reference of the managed
+	// CIM_ComputerSystem, used by every power request.
+	ManagedSystem string
+}
+
+// Store keeps the DeviceInfo of each device, e.g. in Redis or a bolt database
+// shared by the processes of a fleet controller. Devices are keyed by
+// Connection.DeviceID, or by the scheme, host and port of the connection,
+// e.g. "https://10.0.0.5:16993", when it isn't set.
+type Store interface {
+	// Get returns the DeviceInfo stored for device, or nil when there is none.
+	Get(device string) (*DeviceInfo, error)
+	// Put stores the DeviceInfo of device.
+	Put(device string, info *DeviceInfo) error
+}
+
+// MemoryStore is a Store kept in memory, the default of a Client.
+type MemoryStore struct {
+	mu      sync.Mutex
+	devices map[string]DeviceInfo
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(device string) (*DeviceInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.devices[device]
+	if !ok {
+		return nil, nil
+	}
+	return &info, nil
+}
+
+// Put implements Store.
+func (s *MemoryStore) Put(device string, info *DeviceInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.devices == nil {
+		s.devices = map[string]DeviceInfo{}
+	}
+	s.devices[device] = *info
+	return nil
+}
+
+// deviceInfo returns the stored DeviceInfo of the device of the client. Store
+// failures only cost the requests the cache saves, they are logged.
+func (c *Client) deviceInfo() DeviceInfo {
+	info, err := c.store.Get(c.device)
+	if err != nil {
+		c.logger.V(1).Info("could not read the device cache", "error", err.Error())
+		return DeviceInfo{}
+	}
+	if info == nil {
+		return DeviceInfo{}
+	}
+	return *info
+}
+
+// updateDeviceInfo changes the stored DeviceInfo of the device of the client with update.
+func (c *Client) updateDeviceInfo(update func(*DeviceInfo)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := c.deviceInfo()
+	update(&info)
+	if err := c.store.Put(c.device, &info); err != nil {
+		c.logger.V(1).Info("could not write the device cache", "error", err.Error())
+	}
+}
+
+// getManagedSystemRef returns the endpoint reference of the managed system,
+// from the store when it's there.
+func getManagedSystemRef(ctx context.Context, client *Client) (*dom.Element, error) {
+	if cached := client.deviceInfo().ManagedSystem; cached != "" {
+		elements, err := dom.ParseElements(strings.NewReader(cached))
+		if err == nil && len(elements) == 1 {
+			return elements[0], nil
+		}
+		client.logger.V(1).Info("ignoring the invalid cached managed system reference")
+	}
+	managedSystemRef, err := getComputerSystemRef(ctx, client, "ManagedSystem")
+	if err != nil {
+		return nil, err
+	}
+	if managedSystemRef == nil {
+		return nil, fmt.Errorf("could not retrieve the managed system endpoint reference")
+	}
+	client.updateDeviceInfo(func(info *DeviceInfo) {
+		info.ManagedSystem = managedSystemRef.String()
+	})
+	return managedSystemRef, nil
+}
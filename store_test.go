@@ -0,0 +1,58 @@
+package amt
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore_When_DeviceInfoStored_Expect_NoRequests(t *testing.T) {
+	ref := dom.Elem("EndpointReference", "http://schemas.xmlsoap.org/ws/2004/08/addressing")
+	ref.AddChild(dom.ElemC("Address", "http://schemas.xmlsoap.org/ws/2004/08/addressing", "http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous"))
+	store := &MemoryStore{}
+	store.Put("http://192.0.2.1:16992", &DeviceInfo{Version: "16.1.25", ManagedSystem: ref.String()})
+	client, err := NewClient(Connection{
+		Host:  "192.0.2.1",
+		Store: store,
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				return errors.New("unexpected request")
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	version, err := client.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "16.1.25", version)
+	cached, err := getManagedSystemRef(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, ref.String(), cached.String())
+}
+
+func TestStore_When_DevicesShareHost_Expect_SeparateDeviceInfo(t *testing.T) {
+	store := &MemoryStore{}
+	store.Put("http://192.0.2.1:16992", &DeviceInfo{Version: "16.1.25"})
+	store.Put("uuid-a", &DeviceInfo{Version: "12.0.45"})
+	tests := map[string]struct {
+		connection Connection
+		expected   string
+	}{
+		"same port":         {connection: Connection{Host: "192.0.2.1"}, expected: "16.1.25"},
+		"forwarded port":    {connection: Connection{Host: "192.0.2.1", Port: 20000}},
+		"tls":               {connection: Connection{Host: "192.0.2.1", Port: 16992, TLS: true}},
+		"device id":         {connection: Connection{Host: "localhost", DeviceID: "uuid-a"}, expected: "12.0.45"},
+		"another device id": {connection: Connection{Host: "192.0.2.1", DeviceID: "uuid-b"}},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.connection.Store = store
+			client, err := NewClient(tt.connection)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, client.deviceInfo().Version)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package amt
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FingerprintStore remembers the certificate fingerprint of each host, for
+// trust on first use verification of the self-signed certificates AMT ships with.
+type FingerprintStore interface {
+	// Fingerprint returns the fingerprint stored for host, or "" when host hasn't been seen yet.
+	Fingerprint(host string) (string, error)
+	// SetFingerprint stores the fingerprint of host.
+	SetFingerprint(host, fingerprint string) error
+}
+
+// MemoryFingerprintStore is a FingerprintStore kept in memory.
+type MemoryFingerprintStore struct {
+	mu           sync.Mutex
+	fingerprints map[string]string
+}
+
+// Fingerprint implements FingerprintStore.
+func (s *MemoryFingerprintStore) Fingerprint(host string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fingerprints[host], nil
+}
+
+// SetFingerprint implements FingerprintStore.
+func (s *MemoryFingerprintStore) SetFingerprint(host, fingerprint string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fingerprints == nil {
+		s.fingerprints = map[string]string{}
+	}
+	s.fingerprints[host] = fingerprint
+	return nil
+}
+
+// FingerprintMismatchError is returned when a host presents a certificate other than the pinned one.
+type FingerprintMismatchError struct {
+	Host     string
+	Expected string
+	Actual   string
+}
+
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("certificate fingerprint of %s is %s, expected %s", e.Host, e.Actual, e.Expected)
+}
+
+// CertificateFingerprint returns the hex encoded SHA-256 of a DER encoded certificate.
+func CertificateFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// PinnedTLSConfig returns a TLS configuration that accepts the certificate of
+// host when its fingerprint matches the one in store. The first certificate
+// seen for a host is stored and trusted.
+func PinnedTLSConfig(host string, store FingerprintStore) *tls.Config {
+	return &tls.Config{
+		// the chain is not verified, the pinned fingerprint replaces it.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("%s presented no certificate", host)
+			}
+			actual := CertificateFingerprint(rawCerts[0])
+			expected, err := store.Fingerprint(host)
+			if err != nil {
+				return err
+			}
+			if expected == "" {
+				return store.SetFingerprint(host, actual)
+			}
+			if !strings.EqualFold(normalizeFingerprint(expected), actual) {
+				return &FingerprintMismatchError{Host: host, Expected: expected, Actual: actual}
+			}
+			return nil
+		},
+	}
+}
+
+// normalizeFingerprint accepts the colon separated form shown by most tools.
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ReplaceAll(fingerprint, ":", "")
+}
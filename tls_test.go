@@ -0,0 +1,34 @@
+package amt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedTLSConfig_When_CertificateChanges_Expect_Mismatch(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	store := &MemoryFingerprintStore{}
+
+	get := func() error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: PinnedTLSConfig("amt", store)}}
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	assert.NoError(t, get())
+	pinned, _ := store.Fingerprint("amt")
+	assert.Equal(t, CertificateFingerprint(server.Certificate().Raw), pinned)
+	assert.NoError(t, get())
+
+	store.SetFingerprint("amt", "00:11")
+	assert.Error(t, get())
+}
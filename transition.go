@@ -0,0 +1,311 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+)
+
+// PowerAction is what a power request should achieve.
+type PowerAction string
+
+// Power actions of PlanPowerTransition.
+const (
+	PowerActionOn    PowerAction = "on"
+	PowerActionOff   PowerAction = "off"
+	PowerActionCycle PowerAction = "cycle"
+	PowerActionSleep PowerAction = "sleep"
+	// PowerActionReset resets a running machine without powering it off.
+	PowerActionReset PowerAction = "reset"
+	// PowerActionDiag sends a diagnostic interrupt (NMI) to a running machine.
+	PowerActionDiag PowerAction = "diag"
+	// PowerActionSoft asks the operating system to shut down, through ACPI.
+	PowerActionSoft PowerAction = "soft"
+	// PowerActionHardOff powers off a running machine without asking the
+	// operating system, like ipmitool's "chassis power off". PowerActionOff
+	// tries a graceful shutdown first.
+	PowerActionHardOff PowerAction = "hard off"
+	// PowerActionHardCycle power cycles a running machine without asking the
+	// operating system. PowerActionCycle tries a graceful cycle first.
+	PowerActionHardCycle PowerAction = "hard cycle"
+	// PowerActionSoftCycle asks the operating system to shut down, through
+	// ACPI, then powers the machine back on. Unlike PowerActionCycle, it never
+	// falls back to a forced cycle.
+	PowerActionSoftCycle PowerAction = "soft cycle"
+)
+
+// TransitionPlan tells which power state a power action requests and why.
+type TransitionPlan struct {
+	Action PowerAction
+	// Current is the power state of the machine.
+	Current PowerState
+	// Available are the states the firmware advertises it can transition to.
+	Available []PowerState
+	// Request is the state that will be requested. It is PowerStateUnknown
+	// when nothing is requested, either because the machine already is in
+	// the target state (Done) or because no transition is possible.
+	Request PowerState
+	Done    bool
+	Reason  string
+}
+
+// TransitionError is returned when the firmware can't transition to the
+// requested state, or to any of the states of a power action.
+type TransitionError struct {
+	// Action is the power action, empty when a single state was requested.
+	Action PowerAction
+	// Current is the power state of the machine.
+	Current PowerState
+	// Requested is the unavailable state, PowerStateUnknown when none of the
+	// states of Action is available.
+	Requested PowerState
+	// Available are the states the firmware advertises it can transition to.
+	Available []PowerState
+}
+
+func (e *TransitionError) Error() string {
+	if e.Requested != PowerStateUnknown {
+		return fmt.Sprintf("there is no implemented transition state to <%d> from the current machine state <%d>. available states are: %v", e.Requested, e.Current, e.Available)
+	}
+	goal := map[PowerAction]string{
+		PowerActionOff:       "power off the machine",
+		PowerActionCycle:     "power cycle the machine",
+		PowerActionSleep:     "put the machine to sleep",
+		PowerActionReset:     "reset the machine",
+		PowerActionDiag:      "send a diagnostic interrupt to the machine",
+		PowerActionSoft:      "shut the machine down gracefully",
+		PowerActionHardOff:   "power off the machine without a graceful shutdown",
+		PowerActionHardCycle: "power cycle the machine without a graceful shutdown",
+		PowerActionSoftCycle: "restart the machine gracefully",
+	}[e.Action]
+	return fmt.Sprintf("there is no implemented transition state to %s from the current machine state %d. available states are: %v", goal, e.Current, e.Available)
+}
+
+func (p *TransitionPlan) transitionError() *TransitionError {
+	return &TransitionError{Action: p.Action, Current: p.Current, Requested: PowerStateUnknown, Available: p.Available}
+}
+
+func getSleepStates() []PowerState {
+	return []PowerState{
+		PowerStateSleepDeep,
+		PowerStateSleepLight,
+	}
+}
+
+func getResetStates() []PowerState {
+	return []PowerState{
+		PowerStateMasterBusReset,
+		PowerStateMasterBusResetGraceful,
+	}
+}
+
+func getDiagStates() []PowerState {
+	return []PowerState{
+		PowerStateDiagnosticInterruptNMI,
+	}
+}
+
+// getHardOffStates are the off states the operating system takes no part in.
+func getHardOffStates() []PowerState {
+	return []PowerState{
+		PowerStateOffSoft,
+		PowerStateOffHard,
+	}
+}
+
+// getHardCycleStates are the power cycle states the operating system takes
+// no part in.
+func getHardCycleStates() []PowerState {
+	return []PowerState{
+		PowerStatePowerCycleOffSoft,
+		PowerStatePowerCycleOffHard,
+	}
+}
+
+// getSoftCycleStates are the power cycle and reset states the operating
+// system takes part in.
+func getSoftCycleStates() []PowerState {
+	return []PowerState{
+		PowerStatePowerCycleOffSoftGraceful,
+		PowerStateMasterBusResetGraceful,
+	}
+}
+
+// getSoftOffStates are the off states the operating system takes part in.
+func getSoftOffStates() []PowerState {
+	return []PowerState{
+		PowerStateOffSoftGraceful,
+	}
+}
+
+func planPowerTransition(ctx context.Context, client *Client, action PowerAction) (*TransitionPlan, error) {
+	status, err := getPowerStatus(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return planTransition(getQuirks(ctx, client), status, action)
+}
+
+// planTransition chooses the state requested for action from status, the
+// same way for planning and for executing the action.
+func planTransition(q quirks, status *powerStatus, action PowerAction) (*TransitionPlan, error) {
+	plan := &TransitionPlan{
+		Action:    action,
+		Current:   status.currentState,
+		Available: status.AvailableRequestedpowerStates,
+	}
+	on := status.currentState == PowerStateOn
+
+	var candidates []PowerState
+	switch action {
+	case PowerActionOn:
+		if on {
+			plan.Done, plan.Reason = true, "the machine is already on"
+			return plan, nil
+		}
+		plan.Request, plan.Reason = PowerStateOn, "the machine is "+describePowerState(status.currentState)
+		return plan, nil
+	case PowerActionOff, PowerActionHardOff:
+		if !on {
+			plan.Done, plan.Reason = true, "the machine is already "+describePowerState(status.currentState)
+			return plan, nil
+		}
+		candidates = getPowerOffStates()
+		if action == PowerActionHardOff {
+			candidates = getHardOffStates()
+		}
+	case PowerActionCycle, PowerActionHardCycle, PowerActionSoftCycle:
+		if !on {
+			plan.Request, plan.Reason = PowerStateOn, fmt.Sprintf("the machine is %s, powering it on instead", describePowerState(status.currentState))
+			return plan, nil
+		}
+		candidates = getPowerCycleStates()
+		switch action {
+		case PowerActionHardCycle:
+			candidates = getHardCycleStates()
+		case PowerActionSoftCycle:
+			candidates = getSoftCycleStates()
+		}
+	case PowerActionSleep:
+		if !on {
+			plan.Reason = fmt.Sprintf("the machine is %s, only a running machine can sleep", describePowerState(status.currentState))
+			return plan, nil
+		}
+		candidates = getSleepStates()
+	case PowerActionReset:
+		if !on {
+			plan.Reason = fmt.Sprintf("the machine is %s, only a running machine can be reset", describePowerState(status.currentState))
+			return plan, nil
+		}
+		candidates = getResetStates()
+	case PowerActionDiag:
+		if !on {
+			plan.Reason = fmt.Sprintf("the machine is %s, only a running machine can be interrupted", describePowerState(status.currentState))
+			return plan, nil
+		}
+		candidates = getDiagStates()
+	case PowerActionSoft:
+		if !on {
+			plan.Done, plan.Reason = true, "the machine is already "+describePowerState(status.currentState)
+			return plan, nil
+		}
+		candidates = getSoftOffStates()
+	default:
+		return nil, fmt.Errorf("unknown power action %q", action)
+	}
+
+	plan.Request = selectNextStateWithQuirks(q, candidates, status.AvailableRequestedpowerStates)
+	switch {
+	case plan.Request == PowerStateUnknown:
+		plan.Reason = plan.transitionError().Error()
+	case len(status.AvailableRequestedpowerStates) == 0:
+		plan.Reason = fmt.Sprintf("the firmware advertised no available states, requesting the standard %v", plan.Request)
+	case q.ignoreAvailablePowerStates:
+		plan.Reason = fmt.Sprintf("the firmware misreports the available states, requesting %v", plan.Request)
+	case q.noGracefulTransitions:
+		plan.Reason = fmt.Sprintf("%v is the first available of %v, graceful states fail on this firmware version", plan.Request, candidates)
+	default:
+		plan.Reason = fmt.Sprintf("%v is the first available of %v", plan.Request, candidates)
+	}
+	return plan, nil
+}
+
+// PowerResult tells what a power operation did.
+type PowerResult int
+
+// Power results.
+const (
+	// PowerResultNoOp is returned when the machine already was in the target state.
+	PowerResultNoOp PowerResult = iota
+	// PowerResultRequested is returned when the firmware accepted the transition.
+	PowerResultRequested
+	// PowerResultCompleted is returned when the firmware already reported the
+	// target state right after accepting the transition.
+	PowerResultCompleted
+)
+
+func (r PowerResult) String() string {
+	switch r {
+	case PowerResultNoOp:
+		return "NoOp"
+	case PowerResultRequested:
+		return "Requested"
+	case PowerResultCompleted:
+		return "Completed"
+	}
+	return fmt.Sprintf("PowerResult(%d)", int(r))
+}
+
+// executePowerAction requests the state planned for action.
+func executePowerAction(ctx context.Context, client *Client, action PowerAction) (PowerResult, error) {
+	return dedupePower(ctx, client, string(action), func() (PowerResult, error) {
+		return runPowerAction(ctx, client, action)
+	})
+}
+
+func runPowerAction(ctx context.Context, client *Client, action PowerAction) (PowerResult, error) {
+	plan, err := planPowerTransition(ctx, client, action)
+	if err != nil {
+		return PowerResultNoOp, err
+	}
+	client.logger.V(1).Info("power transition plan", "action", string(action), "current", plan.Current.String(), "request", plan.Request.String(), "reason", plan.Reason)
+	if plan.Done {
+		return PowerResultNoOp, nil
+	}
+	if plan.Request == PowerStateUnknown {
+		return PowerResultNoOp, plan.transitionError()
+	}
+	returnValue, err := requestpowerState(ctx, client, plan.Request)
+	if err != nil {
+		return PowerResultNoOp, err
+	}
+	if returnValue != 0 {
+		return PowerResultNoOp, fmt.Errorf("requesting %v failed with return value %d", plan.Request, returnValue)
+	}
+	// a cycle, reset or interrupt ends in the state it started from, there is nothing to check.
+	if (action == PowerActionCycle || action == PowerActionHardCycle || action == PowerActionSoftCycle || action == PowerActionReset || action == PowerActionDiag) && plan.Request != PowerStateOn {
+		return PowerResultRequested, nil
+	}
+	status, err := getPowerStatus(ctx, client)
+	if err != nil {
+		// the transition was accepted, failing to read it back doesn't change that.
+		client.logger.V(1).Info("could not read the power state back", "error", err.Error())
+		return PowerResultRequested, nil
+	}
+	if reachedTarget(action, status.currentState) {
+		return PowerResultCompleted, nil
+	}
+	return PowerResultRequested, nil
+}
+
+// reachedTarget reports whether current is the target state of action.
+func reachedTarget(action PowerAction, current PowerState) bool {
+	switch action {
+	case PowerActionOn, PowerActionCycle, PowerActionHardCycle, PowerActionSoftCycle:
+		return current == PowerStateOn
+	case PowerActionOff, PowerActionSoft, PowerActionHardOff:
+		return current != PowerStateOn && current != PowerStateUnknown
+	case PowerActionSleep:
+		return current == PowerStateSleepLight || current == PowerStateSleepDeep
+	}
+	return false
+}
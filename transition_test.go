@@ -0,0 +1,62 @@
+package amt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanTransition_When_OffAndCycle_Expect_PowerOnInstead(t *testing.T) {
+	status := &powerStatus{currentState: PowerStateOffSoft, AvailableRequestedpowerStates: []PowerState{PowerStateOn}}
+	plan, err := planTransition(quirks{}, status, PowerActionCycle)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateOn, plan.Request)
+	assert.False(t, plan.Done)
+	assert.Contains(t, plan.Reason, "powering it on instead")
+}
+
+func TestPlanTransition_When_OnAndOffWithoutGraceful_Expect_FirstNonGracefulState(t *testing.T) {
+	status := &powerStatus{
+		currentState:                  PowerStateOn,
+		AvailableRequestedpowerStates: []PowerState{PowerStateOffSoftGraceful, PowerStateOffSoft, PowerStateOffHard},
+	}
+	plan, err := planTransition(quirks{noGracefulTransitions: true}, status, PowerActionOff)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateOffSoft, plan.Request)
+	assert.Contains(t, plan.Reason, "graceful states fail")
+}
+
+func TestPlanTransition_When_SleepNotAvailable_Expect_NoRequest(t *testing.T) {
+	status := &powerStatus{currentState: PowerStateOn, AvailableRequestedpowerStates: []PowerState{PowerStateOffSoft}}
+	plan, err := planTransition(quirks{}, status, PowerActionSleep)
+	assert.NoError(t, err)
+	assert.Equal(t, PowerStateUnknown, plan.Request)
+	assert.False(t, plan.Done)
+	assert.Contains(t, plan.Reason, "put the machine to sleep")
+}
+
+func TestPlanTransition_When_AlreadyOn_Expect_Done(t *testing.T) {
+	plan, err := planTransition(quirks{}, &powerStatus{currentState: PowerStateOn}, PowerActionOn)
+	assert.NoError(t, err)
+	assert.True(t, plan.Done)
+	assert.Equal(t, PowerStateUnknown, plan.Request)
+}
+
+func TestReachedTarget_When_OffSoftAfterOff_Expect_True(t *testing.T) {
+	assert.True(t, reachedTarget(PowerActionOff, PowerStateOffSoft))
+	assert.False(t, reachedTarget(PowerActionOff, PowerStateOn))
+	assert.False(t, reachedTarget(PowerActionSleep, PowerStateOn))
+	assert.Equal(t, "NoOp", PowerResultNoOp.String())
+}
+
+func TestTransitionError_When_NoOffStateAvailable_Expect_Fields(t *testing.T) {
+	status := &powerStatus{currentState: PowerStateOn, AvailableRequestedpowerStates: []PowerState{PowerStateSleepDeep}}
+	plan, err := planTransition(quirks{}, status, PowerActionOff)
+	assert.NoError(t, err)
+	transitionErr := plan.transitionError()
+	assert.Equal(t, PowerActionOff, transitionErr.Action)
+	assert.Equal(t, PowerStateOn, transitionErr.Current)
+	assert.Equal(t, []PowerState{PowerStateSleepDeep}, transitionErr.Available)
+	assert.Equal(t, plan.Reason, transitionErr.Error())
+	assert.Contains(t, transitionErr.Error(), "power off the machine")
+}
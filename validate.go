@@ -0,0 +1,75 @@
+package amt
+
+import (
+	"fmt"
+
+	"github.com/VictorLowther/simplexml/dom"
+	"github.com/jacobweinstock/wsman"
+)
+
+// maxValidationResponseLength bounds how much of the response is kept in a ValidationError.
+const maxValidationResponseLength = 4096
+
+// ValidationError is returned in strict mode when a response does not have the expected shape.
+type ValidationError struct {
+	Resource string
+	Element  string
+	Reason   string
+	Response string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid response for %s: %s %s. response: %s", e.Resource, e.Element, e.Reason, e.Response)
+}
+
+func newValidationError(resource, element, reason string, response *wsman.Message) *ValidationError {
+	body := ""
+	if response != nil {
+		body = response.String()
+		if len(body) > maxValidationResponseLength {
+			body = body[:maxValidationResponseLength] + "..."
+		}
+	}
+	return &ValidationError{
+		Resource: resource,
+		Element:  element,
+		Reason:   reason,
+		Response: body,
+	}
+}
+
+// validateInvokeResponse checks the response answers the invoked method and
+// carries an output element in the resource's namespace.
+func validateInvokeResponse(m namespaceMatcher, request, response *wsman.Message) error {
+	resource := request.GetResource()
+	action, err := request.GHC("Action")
+	if err != nil {
+		return err
+	}
+	responseAction, err := response.GHC("Action")
+	if err != nil || responseAction != action+"Response" {
+		return newValidationError(resource, "Action", fmt.Sprintf("is %q, expected %q", responseAction, action+"Response"), response)
+	}
+	body := response.Body()
+	if len(body) == 0 || !m.matches(resource, body[0].Name.Space) {
+		return newValidationError(resource, "Body", "does not contain an output element in the resource namespace", response)
+	}
+	return nil
+}
+
+// validateElements checks that every name is present among elements in namespace.
+func validateElements(m namespaceMatcher, resource string, elements []*dom.Element, response *wsman.Message, names ...string) error {
+	for _, name := range names {
+		found := false
+		for _, e := range elements {
+			if e.Name.Local == name && m.matches(resource, e.Name.Space) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return newValidationError(resource, name, "is missing", response)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrict_When_ResponseIsMalformed_Expect_ValidationError(t *testing.T) {
+	getHostName := func(ctx context.Context, client *Client) (string, error) {
+		properties, err := getInstance(ctx, client, client.resourceURI(ResourceAMTGeneralSettings), "HostName")
+		return propertyContent(properties, "HostName"), err
+	}
+	setBootConfigRole := func(ctx context.Context, client *Client) (string, error) {
+		_, returnValue, err := sendInvoke(ctx, client, client.wsManClient.Invoke(client.resourceURI(ResourceCIMBootService), "SetBootConfigRole"))
+		if returnValue == -1 {
+			return "", err
+		}
+		return "returned", err
+	}
+	tests := map[string]struct {
+		key     string
+		body    string
+		action  string
+		call    func(ctx context.Context, client *Client) (string, error)
+		element string
+		// lenient is the result of the call outside of strict mode.
+		lenient string
+	}{
+		"missing required element": {
+			key:     "AMT_GeneralSettings Get",
+			body:    instanceBody(ResourceAMTGeneralSettings, `<h:DomainName>example.com</h:DomainName>`),
+			call:    getHostName,
+			element: "HostName",
+		},
+		"wrong namespace": {
+			key:     "AMT_GeneralSettings Get",
+			body:    instanceBody(ResourceAMTGeneralSettings, `<x:HostName xmlns:x="http://oem.example.com/AMT_GeneralSettings">machine</x:HostName>`),
+			call:    getHostName,
+			element: "HostName",
+			lenient: "machine",
+		},
+		"mismatched invoke action": {
+			key:     "CIM_BootService SetBootConfigRole",
+			body:    outputBody(ResourceCIMBootService, "SetBootConfigRole", 0),
+			action:  ResourceCIMBootService + "/ChangeBootOrderResponse",
+			call:    setBootConfigRole,
+			element: "Action",
+			lenient: "returned",
+		},
+		"invoke return value in another namespace": {
+			key:     "CIM_BootService SetBootConfigRole",
+			body:    outputBody(ResourceCIMBootConfigSetting, "SetBootConfigRole", 0),
+			call:    setBootConfigRole,
+			element: "Body",
+			lenient: "returned",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := &fakeFirmware{}
+			f.set(tt.key, tt.body)
+			if tt.action != "" {
+				f.actions = map[string]string{tt.key: tt.action}
+			}
+
+			strict, closeStrict := newFirmwareClient(t, f, Connection{Strict: true})
+			defer closeStrict()
+			_, err := tt.call(context.Background(), strict)
+			var validationErr *ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				assert.Equal(t, tt.element, validationErr.Element)
+			}
+
+			lenient, closeLenient := newFirmwareClient(t, f, Connection{})
+			defer closeLenient()
+			result, err := tt.call(context.Background(), lenient)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.lenient, result)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// amtSoftwareIdentity is the InstanceID of the CIM_SoftwareIdentity holding the firmware version.
+const amtSoftwareIdentity = "AMT"
+
+// SoftwareIdentity is a firmware component and its version, e.g. "AMT",
+// "Flash", "Build Number" or "Recovery Version".
+type SoftwareIdentity struct {
+	InstanceID string
+	Version    string
+	// IsEntity is true for the components that are installed, as opposed to
+	// informational entries such as "Sku".
+	IsEntity bool
+}
+
+func getSoftwareIdentities(ctx context.Context, client *Client) ([]SoftwareIdentity, error) {
+	resource := client.resourceURI(ResourceCIMSoftwareIdentity)
+	items, err := enumerate(ctx, client, resource)
+	if err != nil {
+		return nil, err
+	}
+	identities := make([]SoftwareIdentity, 0, len(items))
+	for _, item := range items {
+		id := client.namespaces.firstTag("InstanceID", resource, item.Children())
+		if id == nil {
+			continue
+		}
+		identities = append(identities, SoftwareIdentity{
+			InstanceID: string(id.Content),
+			Version:    propertyContent(item.Children(), "VersionString"),
+			IsEntity:   propertyContent(item.Children(), "IsEntity") == "true",
+		})
+	}
+	return identities, nil
+}
+
+func getAMTVersion(ctx context.Context, client *Client) (string, error) {
+	version := client.deviceInfo().Version
+	if version != "" {
+		return version, nil
+	}
+
+	identities, err := getSoftwareIdentities(ctx, client)
+	if err != nil {
+		info, scrapeErr := webUIInfo(ctx, client)
+		if scrapeErr != nil || info.Version == "" {
+			return "", err
+		}
+		identities = []SoftwareIdentity{{InstanceID: amtSoftwareIdentity, Version: info.Version}}
+	}
+	for _, identity := range identities {
+		if identity.InstanceID == amtSoftwareIdentity {
+			version = identity.Version
+		}
+	}
+	if version == "" {
+		return "", fmt.Errorf("could not find the %s software identity", amtSoftwareIdentity)
+	}
+	client.updateDeviceInfo(func(info *DeviceInfo) {
+		info.Version = version
+	})
+	return version, nil
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1.
+// Missing or non numeric components count as 0.
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for len(as) < len(bs) {
+		as = append(as, "0")
+	}
+	for len(bs) < len(as) {
+		bs = append(bs, "0")
+	}
+	for i := range as {
+		x, _ := strconv.Atoi(as[i])
+		y, _ := strconv.Atoi(bs[i])
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
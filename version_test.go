@@ -0,0 +1,62 @@
+package amt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func softwareIdentityItem(properties string) string {
+	return instanceBody(ResourceCIMSoftwareIdentity, properties)
+}
+
+func TestSoftwareIdentities_When_Enumerated_Expect_TypedInventory(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_SoftwareIdentity Enumerate", enumerationBody(
+		softwareIdentityItem(`<h:InstanceID>Flash</h:InstanceID><h:IsEntity>true</h:IsEntity><h:VersionString>16.1.25</h:VersionString>`),
+		softwareIdentityItem(`<h:InstanceID>Sku</h:InstanceID><h:IsEntity>false</h:IsEntity><h:VersionString>16392</h:VersionString>`),
+		// an identity without InstanceID can't be told apart, it is skipped.
+		softwareIdentityItem(`<h:VersionString>1.0</h:VersionString>`),
+		softwareIdentityItem(`<h:InstanceID>AMT</h:InstanceID><h:IsEntity>true</h:IsEntity><h:VersionString>16.1.25</h:VersionString>`),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	identities, err := client.SoftwareIdentities(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []SoftwareIdentity{
+		{InstanceID: "Flash", Version: "16.1.25", IsEntity: true},
+		{InstanceID: "Sku", Version: "16392"},
+		{InstanceID: "AMT", Version: "16.1.25", IsEntity: true},
+	}, identities)
+}
+
+func TestVersion_When_AMTIdentityListed_Expect_VersionCached(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_SoftwareIdentity Enumerate", enumerationBody(
+		softwareIdentityItem(`<h:InstanceID>Flash</h:InstanceID><h:VersionString>16.1.27</h:VersionString>`),
+		softwareIdentityItem(`<h:InstanceID>AMT</h:InstanceID><h:VersionString>16.1.25</h:VersionString>`),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	version, err := client.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "16.1.25", version)
+	_, err = client.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, f.received(), 1)
+}
+
+func TestVersion_When_AMTIdentityMissing_Expect_Error(t *testing.T) {
+	f := &fakeFirmware{}
+	f.set("CIM_SoftwareIdentity Enumerate", enumerationBody(
+		softwareIdentityItem(`<h:InstanceID>Flash</h:InstanceID><h:VersionString>16.1.27</h:VersionString>`),
+	))
+	client, closeServer := newFirmwareClient(t, f, Connection{})
+	defer closeServer()
+
+	_, err := client.Version(context.Background())
+	assert.EqualError(t, err, "could not find the AMT software identity")
+}
@@ -0,0 +1,135 @@
+package amt
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jacobweinstock/wsman"
+)
+
+// webUIPages are the pages of the web UI scraped by the fallback: the system
+// status and the network settings.
+var webUIPages = []string{"/index.htm", "/ip.htm"}
+
+var (
+	webUIRow     = regexp.MustCompile(`(?i)<tr[^>]*>`)
+	webUICell    = regexp.MustCompile(`(?i)<t[dh][^>]*>`)
+	webUITag     = regexp.MustCompile(`<[^>]*>`)
+	webUIVersion = regexp.MustCompile(`\d+(\.\d+)+`)
+)
+
+// scrapeWebUI returns the label and value rows of the tables of the web UI
+// pages, labels in lower case. It's the fallback of Connection.WebUIFallback
+// for firmware older than the WSMAN classes the client reads; the pages that
+// can't be read are skipped.
+func scrapeWebUI(ctx context.Context, client *Client) (map[string]string, error) {
+	rows := map[string]string{}
+	var lastErr error
+	for _, page := range webUIPages {
+		body, err := getWebUIPage(ctx, client, page)
+		if err != nil {
+			client.logger.V(1).Info("could not read the web UI page", "page", page, "error", err.Error())
+			lastErr = err
+			continue
+		}
+		for label, value := range parseWebUIRows(body) {
+			if _, ok := rows[label]; !ok {
+				rows[label] = value
+			}
+		}
+	}
+	if len(rows) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return rows, nil
+}
+
+// getWebUIPage reads page like a WSMAN get: through the transport, the hooks
+// and the ReadTimeout of the client.
+func getWebUIPage(ctx context.Context, client *Client, page string) (string, error) {
+	request := &Request{Action: wsman.GET, ResourceURI: client.webUIBase + page}
+	var body []byte
+	_, err := client.do(ctx, request, func(ctx context.Context) (*wsman.Message, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, request.ResourceURI, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.webUI.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("web UI page %s returned %s", page, resp.Status)
+		}
+		body, err = ioutil.ReadAll(resp.Body)
+		return nil, err
+	})
+	return string(body), err
+}
+
+// parseWebUIRows returns the first two cells of the table rows of page, the
+// label and the value. The pages of old firmware rarely close their cells
+// and rows, so they are split on the opening tags.
+func parseWebUIRows(page string) map[string]string {
+	rows := map[string]string{}
+	for _, row := range webUIRow.Split(page, -1)[1:] {
+		cells := webUICell.Split(row, -1)[1:]
+		if len(cells) < 2 {
+			continue
+		}
+		label := strings.ToLower(strings.TrimSuffix(webUIText(cells[0]), ":"))
+		if _, ok := rows[label]; label != "" && !ok {
+			rows[label] = webUIText(cells[1])
+		}
+	}
+	return rows
+}
+
+// webUIText returns the text of an HTML fragment with its spaces collapsed.
+func webUIText(fragment string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(webUITag.ReplaceAllString(fragment, " "))), " ")
+}
+
+// webUIValue returns the value of the first row, in label order, whose label
+// contains one of labels.
+func webUIValue(rows map[string]string, labels ...string) string {
+	sorted := make([]string, 0, len(rows))
+	for l := range rows {
+		sorted = append(sorted, l)
+	}
+	sort.Strings(sorted)
+	for _, label := range labels {
+		for _, l := range sorted {
+			if strings.Contains(l, label) {
+				return rows[l]
+			}
+		}
+	}
+	return ""
+}
+
+// applyWebUI fills the parts of info left empty from the rows of the web UI.
+func applyWebUI(info *Info, rows map[string]string) {
+	if info.Version == "" {
+		info.Version = webUIVersion.FindString(webUIValue(rows, "amt version", "firmware version", "version"))
+	}
+	if info.HostName == "" {
+		info.HostName = webUIValue(rows, "host name", "hostname")
+	}
+	if info.DNSSuffix == "" {
+		info.DNSSuffix = webUIValue(rows, "domain name", "domain")
+	}
+	if len(info.Interfaces) == 0 {
+		ip, mac := webUIValue(rows, "ip address"), webUIValue(rows, "mac address")
+		if ip != "" || mac != "" {
+			info.Interfaces = append(info.Interfaces, NetworkSettings{Port: WiredPort, IPAddress: ip, MACAddress: mac})
+		}
+	}
+}
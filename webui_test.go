@@ -0,0 +1,121 @@
+package amt
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// webUIStatusPage is shaped like the system status page of old firmware,
+// whose cells and rows are not closed.
+const webUIStatusPage = `<html><body><table class=lst>
+<tr><td class=r1><p>Intel&reg; AMT version:<td class=r1>3.2.1
+<tr><td class=r1><p>IP address<td class=r1>192.168.1.10
+<tr><td class=r1><p>Computer host name<td class=r1>node1
+<tr><td class=r1><p>Domain name<td class=r1>example.com
+</table></body></html>`
+
+func TestParseWebUIRows_When_CellsNotClosed_Expect_LabelsAndValues(t *testing.T) {
+	rows := parseWebUIRows(webUIStatusPage)
+	assert.Equal(t, "3.2.1", rows["intel® amt version"])
+	assert.Equal(t, "192.168.1.10", rows["ip address"])
+
+	info := &Info{}
+	applyWebUI(info, rows)
+	assert.Equal(t, "3.2.1", info.Version)
+	assert.Equal(t, "node1", info.HostName)
+	assert.Equal(t, "example.com", info.DNSSuffix)
+	assert.Equal(t, []NetworkSettings{{Port: WiredPort, IPAddress: "192.168.1.10"}}, info.Interfaces)
+}
+
+func TestGetInfo_When_NoSoftwareIdentityAndWebUIFallback_Expect_WebUIVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/index.htm" {
+			w.Write([]byte(webUIStatusPage))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	host, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portString)
+
+	client, err := NewClient(Connection{Host: host, Port: uint32(port), WebUIFallback: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Info(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "3.2.1", info.Version)
+
+	// without the option the missing class is an error.
+	client, err = NewClient(Connection{Host: host, Port: uint32(port)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Info(context.Background())
+	assert.ErrorIs(t, err, ErrAMTUnprovisioned)
+}
+
+func TestGetWebUIPage_When_Read_Expect_ClientTransportHooksAndTimeout(t *testing.T) {
+	var mu sync.Mutex
+	var userAgents, requested []string
+	slowDone := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+		mu.Unlock()
+		if r.URL.Path == "/slow.htm" {
+			defer close(slowDone)
+			// answer after the client gave up.
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte(webUIStatusPage))
+	}))
+	defer server.Close()
+	host, portString, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port, _ := strconv.Atoi(portString)
+	client, err := NewClient(Connection{
+		Host:          host,
+		Port:          uint32(port),
+		WebUIFallback: true,
+		UserAgent:     "fleet-manager/1.0",
+		ReadTimeout:   50 * time.Millisecond,
+		Hooks: Hooks{
+			OnRequest: func(ctx context.Context, request *Request) error {
+				mu.Lock()
+				defer mu.Unlock()
+				requested = append(requested, request.ResourceURI)
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := getWebUIPage(context.Background(), client, "/index.htm")
+	assert.NoError(t, err)
+	assert.Equal(t, webUIStatusPage, body)
+	_, err = getWebUIPage(context.Background(), client, "/slow.htm")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	<-slowDone
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"fleet-manager/1.0", "fleet-manager/1.0"}, userAgents)
+	assert.Equal(t, []string{client.webUIBase + "/index.htm", client.webUIBase + "/slow.htm"}, requested)
+	stats := client.Stats()
+	assert.Equal(t, 1, stats.Successes)
+	assert.Equal(t, 1, stats.Failures)
+}
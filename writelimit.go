@@ -0,0 +1,77 @@
+package amt
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// returnValueFlashWriteLimitExceeded is PT_STATUS_FLASH_WRITE_LIMIT_EXCEEDED,
+// returned by the firmware when it stops writing its flash to protect it from wear.
+const returnValueFlashWriteLimitExceeded = 38
+
+var (
+	// ErrFlashWriteLimitExceeded is returned when the firmware refused a change
+	// because too many were written to its flash recently.
+	ErrFlashWriteLimitExceeded = errors.New("firmware flash write limit exceeded")
+	// ErrWriteLimitExceeded is returned when an enforced WriteLimit refused a change.
+	ErrWriteLimitExceeded = errors.New("client write limit exceeded")
+)
+
+// WriteLimit bounds the mutating requests of a Client. Every configuration
+// change is written to the flash of the firmware, which wears out; a
+// reconciliation loop that rewrites the same settings can exhaust it.
+type WriteLimit struct {
+	// Writes is the number of mutating requests allowed in Period.
+	Writes int
+	Period time.Duration
+	// Enforce rejects the requests over the limit with ErrWriteLimitExceeded.
+	// Otherwise they are only logged.
+	Enforce bool
+}
+
+// writeGuard counts the mutating requests of a client.
+type writeGuard struct {
+	limit WriteLimit
+
+	mu     sync.Mutex
+	total  int
+	recent []time.Time
+}
+
+func newWriteGuard(limit WriteLimit) *writeGuard {
+	if limit.Writes <= 0 || limit.Period <= 0 {
+		limit = WriteLimit{}
+	}
+	return &writeGuard{limit: limit}
+}
+
+// allow records a write at now. It reports whether the write is over the limit.
+// Writes refused by an enforced limit are not counted.
+func (g *writeGuard) allow(now time.Time) (over bool, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.limit.Writes > 0 {
+		cutoff := now.Add(-g.limit.Period)
+		i := 0
+		for i < len(g.recent) && !g.recent[i].After(cutoff) {
+			i++
+		}
+		g.recent = g.recent[i:]
+		if len(g.recent) >= g.limit.Writes {
+			over = true
+			if g.limit.Enforce {
+				return true, ErrWriteLimitExceeded
+			}
+		}
+		g.recent = append(g.recent, now)
+	}
+	g.total++
+	return over, nil
+}
+
+func (g *writeGuard) count() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.total
+}
@@ -0,0 +1,37 @@
+package amt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteGuard_When_Enforced_Expect_WritesOverLimitRejected(t *testing.T) {
+	guard := newWriteGuard(WriteLimit{Writes: 2, Period: time.Minute, Enforce: true})
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		over, err := guard.allow(start)
+		assert.False(t, over)
+		assert.NoError(t, err)
+	}
+	over, err := guard.allow(start.Add(time.Second))
+	assert.True(t, over)
+	assert.Equal(t, ErrWriteLimitExceeded, err)
+
+	// the first writes leave the window.
+	over, err = guard.allow(start.Add(time.Minute + time.Second))
+	assert.False(t, over)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, guard.count())
+}
+
+func TestWriteGuard_When_NotEnforced_Expect_WritesOnlyReported(t *testing.T) {
+	guard := newWriteGuard(WriteLimit{Writes: 1, Period: time.Minute})
+	now := time.Now()
+	guard.allow(now)
+	over, err := guard.allow(now)
+	assert.True(t, over)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, guard.count())
+}